@@ -0,0 +1,233 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcert
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrCacheMiss is returned by a Cache when there is no data stored for the key
+var ErrCacheMiss = errors.New("vcert: certificate cache miss")
+
+// Cache is used by CertificateManager to store and retrieve previously issued certificates and private keys.
+// Data is stored as PEM: the private key followed by the certificate and its chain.
+//
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the data stored for key, or ErrCacheMiss if there is none
+	Get(key string) ([]byte, error)
+	// Put stores data for key, replacing any existing value
+	Put(key string, data []byte) error
+	// Delete removes the data stored for key. It does not fail if there is none
+	Delete(key string) error
+}
+
+// MemoryCache is a Cache that keeps data in memory. Its zero value is ready to use.
+type MemoryCache struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// Get implements Cache
+func (c *MemoryCache) Get(key string) ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	data, ok := c.data[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Put implements Cache
+func (c *MemoryCache) Put(key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.data == nil {
+		c.data = make(map[string][]byte)
+	}
+	c.data[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Delete implements Cache
+func (c *MemoryCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, key)
+	return nil
+}
+
+// DirCache is a Cache that stores every key in a file of the given directory.
+// The directory is created with 0700 permissions if it doesn't exist and files are written with 0600 permissions.
+type DirCache string
+
+// Get implements Cache
+func (d DirCache) Get(key string) ([]byte, error) {
+	name, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	return data, err
+}
+
+// Put implements Cache. The file is replaced atomically so readers never see partial data.
+func (d DirCache) Put(key string, data []byte) error {
+	name, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(string(d), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(string(d), ".tmp-"+key)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Delete implements Cache
+func (d DirCache) Delete(key string) error {
+	name, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d DirCache) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+	return filepath.Join(string(d), key), nil
+}
+
+const (
+	encryptedCacheSaltSize = 16
+	encryptedCacheKeySize  = 32
+)
+
+// encryptedCache encrypts data before handing it to the underlying Cache
+type encryptedCache struct {
+	cache      Cache
+	passphrase []byte
+}
+
+// NewEncryptedCache returns a Cache that encrypts data with AES-256-GCM before storing it in c. The encryption key is
+// derived from passphrase with scrypt and a random salt stored with every entry.
+//
+// It is mostly useful with DirCache, to keep private keys encrypted on disk:
+//
+//	cache := vcert.NewEncryptedCache(vcert.DirCache("/var/cache/myservice"), passphrase)
+func NewEncryptedCache(c Cache, passphrase string) Cache {
+	return &encryptedCache{cache: c, passphrase: []byte(passphrase)}
+}
+
+// Get implements Cache
+func (c *encryptedCache) Get(key string) ([]byte, error) {
+	data, err := c.cache.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < encryptedCacheSaltSize {
+		return nil, fmt.Errorf("encrypted cache entry %s is too short", key)
+	}
+	salt, data := data[:encryptedCacheSaltSize], data[encryptedCacheSaltSize:]
+	gcm, err := c.newGCM(salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted cache entry %s is too short", key)
+	}
+	nonce, data := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	// the key is used as additional data, so an entry can't be swapped with another one
+	plain, err := gcm.Open(nil, nonce, data, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt cache entry %s: %w", key, err)
+	}
+	return plain, nil
+}
+
+// Put implements Cache
+func (c *encryptedCache) Put(key string, data []byte) error {
+	salt := make([]byte, encryptedCacheSaltSize)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := c.newGCM(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+
+	out := append(salt, nonce...)
+	out = gcm.Seal(out, nonce, data, []byte(key))
+	return c.cache.Put(key, out)
+}
+
+// Delete implements Cache
+func (c *encryptedCache) Delete(key string) error {
+	return c.cache.Delete(key)
+}
+
+func (c *encryptedCache) newGCM(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(c.passphrase, salt, 1<<15, 8, 1, encryptedCacheKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
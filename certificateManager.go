@@ -0,0 +1,473 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+const (
+	// DefaultRenewBefore is the renew window used by CertificateManager when RenewBefore is not set
+	DefaultRenewBefore = "10%"
+	// defaultRetrieveTimeout is how long CertificateManager waits for a certificate to be issued
+	defaultRetrieveTimeout = time.Minute
+)
+
+// HostPolicy decides whether CertificateManager may request a certificate for a host name.
+// It returns an error to deny the request.
+type HostPolicy func(host string) error
+
+// HostAllowlist returns a HostPolicy that only allows the given host names. Names are compared case-insensitively.
+func HostAllowlist(hosts ...string) HostPolicy {
+	allowed := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		allowed[normalizeHost(h)] = true
+	}
+	return func(host string) error {
+		if !allowed[normalizeHost(host)] {
+			return fmt.Errorf("vcert: host %q is not allowed by the host policy", host)
+		}
+		return nil
+	}
+}
+
+// CertificateManager enrolls certificates through an endpoint.Connector, keeps them renewed in the background and
+// serves them to a tls.Config:
+//
+//	m := &vcert.CertificateManager{
+//		Connector:  connector,
+//		HostPolicy: vcert.HostAllowlist("example.com"),
+//		Cache:      vcert.DirCache("/var/cache/myservice"),
+//	}
+//	defer m.Close()
+//	server := &http.Server{TLSConfig: &tls.Config{GetCertificate: m.GetCertificate}}
+//
+// Certificates for host names are requested on demand, the first time a client asks for them. A CertificateManager
+// is safe for concurrent use and must not be copied after first use.
+type CertificateManager struct {
+	// Connector is used to enroll the certificates. It should be already authenticated.
+	Connector endpoint.Connector
+	// Cache stores the issued certificates and private keys so that they survive restarts.
+	// If nil, certificates are only kept in memory.
+	Cache Cache
+	// HostPolicy controls which host names certificates are requested for. If nil, any host name is allowed.
+	HostPolicy HostPolicy
+	// RenewBefore is the renew window, in the same format as the renewBefore attribute of playbook tasks:
+	// "30d", "12h" or "10%". Defaults to DefaultRenewBefore. "disabled" turns renewal off.
+	RenewBefore string
+	// ClientName is the common name of the certificate returned by GetClientCertificate.
+	ClientName string
+	// NewRequest returns the request used to enroll a certificate for name. If nil, the request has name as
+	// common name and DNS SAN and a locally generated key.
+	NewRequest func(name string) *certificate.Request
+	// Timeout is how long to wait for a certificate to be issued. Defaults to one minute.
+	Timeout time.Duration
+
+	// renewTimeFunc returns the renewal time of a certificate instead of RenewBefore. NewListener sets it to honor
+	// Config.RenewWindow
+	renewTimeFunc func(leaf *x509.Certificate) time.Time
+
+	mu sync.RWMutex
+	// names keeps the order in which certificates were added. The first one is served to clients that
+	// do not send SNI.
+	names   []string
+	certs   map[string]*managedCert
+	pending map[string]*pendingCert
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	wake      chan struct{}
+	done      chan struct{}
+}
+
+// managedCert is a certificate served for a name along with the time it has to be renewed at
+type managedCert struct {
+	cert    *tls.Certificate
+	renewAt time.Time
+}
+
+// pendingCert lets concurrent callers wait for a single enrollment of the same name
+type pendingCert struct {
+	done chan struct{}
+	cert *tls.Certificate
+	err  error
+}
+
+// GetCertificate returns the certificate for the server name requested by the client, enrolling it if needed.
+// It is meant to be used as tls.Config.GetCertificate.
+func (m *CertificateManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := normalizeHost(hello.ServerName)
+	if name == "" {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		if len(m.names) == 0 {
+			return nil, fmt.Errorf("vcert: missing server name")
+		}
+		return m.certs[m.names[0]].cert, nil
+	}
+	return m.Certificate(name)
+}
+
+// GetClientCertificate returns the certificate for ClientName, enrolling it if needed.
+// It is meant to be used as tls.Config.GetClientCertificate.
+func (m *CertificateManager) GetClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if m.ClientName == "" {
+		return nil, fmt.Errorf("vcert: ClientName is not set")
+	}
+	return m.Certificate(m.ClientName)
+}
+
+// Certificate returns the certificate for name. It is looked up in memory first, then in the Cache and
+// enrolled if none of them has a valid one. Concurrent calls for the same name share a single enrollment.
+func (m *CertificateManager) Certificate(name string) (*tls.Certificate, error) {
+	name = normalizeHost(name)
+
+	m.mu.RLock()
+	mc, ok := m.certs[name]
+	m.mu.RUnlock()
+	if ok {
+		return mc.cert, nil
+	}
+
+	if m.HostPolicy != nil {
+		err := m.HostPolicy(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	if mc, ok := m.certs[name]; ok {
+		m.mu.Unlock()
+		return mc.cert, nil
+	}
+	if p, ok := m.pending[name]; ok {
+		m.mu.Unlock()
+		<-p.done
+		return p.cert, p.err
+	}
+	if m.pending == nil {
+		m.pending = make(map[string]*pendingCert)
+	}
+	p := &pendingCert{done: make(chan struct{})}
+	m.pending[name] = p
+	m.mu.Unlock()
+
+	p.cert, p.err = m.load(name)
+
+	m.mu.Lock()
+	delete(m.pending, name)
+	m.mu.Unlock()
+	close(p.done)
+
+	return p.cert, p.err
+}
+
+// Close stops the background renewal. Certificates already issued keep being served.
+func (m *CertificateManager) Close() {
+	m.init()
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+}
+
+// load gets the certificate for name from the cache or enrolls a new one, and starts managing it
+func (m *CertificateManager) load(name string) (*tls.Certificate, error) {
+	cert, err := m.cacheGet(name)
+	if err != nil {
+		if !errors.Is(err, ErrCacheMiss) {
+			log.Printf("Ignoring cached certificate for %s: %s", name, err)
+		}
+		cert, err = m.enroll(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.store(name, cert)
+	return cert, nil
+}
+
+// enroll requests a new certificate for name and saves it in the cache
+func (m *CertificateManager) enroll(name string) (*tls.Certificate, error) {
+	var req *certificate.Request
+	if m.NewRequest != nil {
+		req = m.NewRequest(name)
+	} else {
+		req = &certificate.Request{
+			Subject:   pkix.Name{CommonName: name},
+			DNSNames:  []string{name},
+			CsrOrigin: certificate.LocalGeneratedCSR,
+		}
+	}
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = defaultRetrieveTimeout
+	}
+
+	log.Println("Retrieving certificate for", name)
+	tlsCert, err := enrollTLSCertificate(m.Connector, req, timeout)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tlsCert
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate for %s: %w", name, err)
+	}
+
+	if m.Cache != nil {
+		data, err := encodeTLSCertificate(cert)
+		if err == nil {
+			err = m.Cache.Put(name, data)
+		}
+		if err != nil {
+			log.Printf("Failed to cache certificate for %s: %s", name, err)
+		}
+	}
+	return cert, nil
+}
+
+// cacheGet returns the cached certificate for name. Expired certificates are treated as a cache miss.
+func (m *CertificateManager) cacheGet(name string) (*tls.Certificate, error) {
+	if m.Cache == nil {
+		return nil, ErrCacheMiss
+	}
+	data, err := m.Cache.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(cert.Leaf.NotAfter) {
+		return nil, ErrCacheMiss
+	}
+	return &cert, nil
+}
+
+// store swaps the certificate served for name and schedules its renewal. Handshakes in progress keep the
+// certificate they already got, new handshakes get the new one.
+func (m *CertificateManager) store(name string, cert *tls.Certificate) {
+	m.init()
+	m.mu.Lock()
+	if _, ok := m.certs[name]; !ok {
+		m.names = append(m.names, name)
+	}
+	m.certs[name] = &managedCert{cert: cert, renewAt: m.renewTime(cert.Leaf)}
+	m.mu.Unlock()
+
+	m.startOnce.Do(func() {
+		go m.run()
+	})
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// renewTime returns the moment the certificate should be renewed, or the zero time if renewal is disabled
+func (m *CertificateManager) renewTime(leaf *x509.Certificate) time.Time {
+	if m.RenewBefore == "" && m.renewTimeFunc != nil {
+		return m.renewTimeFunc(leaf)
+	}
+	renewBefore := m.RenewBefore
+	if renewBefore == "" {
+		renewBefore = DefaultRenewBefore
+	}
+	renewAt, err := util.RenewalTime(leaf.NotBefore, leaf.NotAfter, renewBefore)
+	if errors.Is(err, util.ErrRenewalDisabled) {
+		return time.Time{}
+	}
+	if err != nil {
+		log.Printf("Invalid renew window %s, using default %s: %s", renewBefore, DefaultRenewBefore, err)
+		renewAt, _ = util.RenewalTime(leaf.NotBefore, leaf.NotAfter, DefaultRenewBefore)
+	}
+	earliest := time.Now().Add(renewRetryInterval)
+	if renewAt.Before(earliest) {
+		renewAt = earliest
+	}
+	return renewAt
+}
+
+func (m *CertificateManager) init() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.certs == nil {
+		m.certs = make(map[string]*managedCert)
+	}
+	if m.done == nil {
+		m.done = make(chan struct{})
+		m.wake = make(chan struct{}, 1)
+	}
+}
+
+// run renews certificates when they reach their renewal time, until Close is called
+func (m *CertificateManager) run() {
+	for {
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if next := m.nextRenewal(); !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			timerC = timer.C
+		}
+		renew := false
+		select {
+		case <-m.done:
+		case <-m.wake:
+		case <-timerC:
+			renew = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-m.done:
+			return
+		default:
+		}
+		if renew {
+			m.renewDue(time.Now())
+		}
+	}
+}
+
+// nextRenewal returns the earliest renewal time among the managed certificates, or the zero time if there is none
+func (m *CertificateManager) nextRenewal() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var next time.Time
+	for _, mc := range m.certs {
+		if mc.renewAt.IsZero() {
+			continue
+		}
+		if next.IsZero() || mc.renewAt.Before(next) {
+			next = mc.renewAt
+		}
+	}
+	return next
+}
+
+// renewDue renews every certificate whose renewal time is not after now. Failed renewals are
+// retried after renewRetryInterval while the current certificate keeps being served.
+func (m *CertificateManager) renewDue(now time.Time) {
+	m.mu.RLock()
+	var due []string
+	for _, name := range m.names {
+		renewAt := m.certs[name].renewAt
+		if !renewAt.IsZero() && !renewAt.After(now) {
+			due = append(due, name)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, name := range due {
+		log.Println("Renewing certificate for", name)
+		cert, err := m.enroll(name)
+		if err != nil {
+			log.Printf("Failed to renew certificate for %s: %s", name, err)
+			m.mu.Lock()
+			m.certs[name].renewAt = time.Now().Add(renewRetryInterval)
+			m.mu.Unlock()
+			continue
+		}
+		m.store(name, cert)
+	}
+}
+
+// enrollTLSCertificate requests a certificate, waits up to timeout for it to be issued and returns it along
+// with its private key
+func enrollTLSCertificate(conn endpoint.Connector, req *certificate.Request, timeout time.Duration) (tls.Certificate, error) {
+	zc, err := conn.ReadZoneConfiguration()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	err = conn.GenerateRequest(zc, req)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	requestID, err := conn.RequestCertificate(req)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	req.PickupID = requestID
+	req.Timeout = timeout
+	certCollection, err := conn.RetrieveCertificate(req)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if req.CsrOrigin != certificate.ServiceGeneratedCSR {
+		err = certCollection.AddPrivateKey(req.PrivateKey, []byte(req.KeyPassword))
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	privKey, err := util.DecryptPkcs8PrivateKey(certCollection.PrivateKey, req.KeyPassword)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certCollection.PrivateKey = privKey
+
+	cert := certCollection.ToTLSCertificate()
+	if cert.PrivateKey == nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse private key of certificate %s", req.Subject.CommonName)
+	}
+	return cert, nil
+}
+
+// encodeTLSCertificate encodes the private key and the certificate chain as PEM, in the format stored in a Cache
+func encodeTLSCertificate(cert *tls.Certificate) ([]byte, error) {
+	var buf bytes.Buffer
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	err = pem.Encode(&buf, &pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	if err != nil {
+		return nil, err
+	}
+	for _, der := range cert.Certificate {
+		err = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcert
+
+import (
+	"crypto/tls"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/endpoint"
+)
+
+// countingConnector counts the certificate requests made through the wrapped connector
+type countingConnector struct {
+	endpoint.Connector
+	requests int32
+}
+
+func (c *countingConnector) RequestCertificate(req *certificate.Request) (string, error) {
+	atomic.AddInt32(&c.requests, 1)
+	return c.Connector.RequestCertificate(req)
+}
+
+func newTestManager(t *testing.T) (*CertificateManager, *countingConnector) {
+	cfg := Config{ConnectorType: endpoint.ConnectorTypeFake}
+	conn, err := cfg.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingConnector{Connector: conn}
+	m := &CertificateManager{Connector: counting}
+	t.Cleanup(m.Close)
+	return m, counting
+}
+
+func TestCertificateManager_GetCertificate(t *testing.T) {
+	m, conn := newTestManager(t)
+	m.HostPolicy = HostAllowlist("example.com")
+
+	_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+	if err == nil {
+		t.Fatal("host not allowed by the policy should be rejected")
+	}
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{})
+	if err == nil {
+		t.Fatal("missing server name should be rejected when there are no certificates")
+	}
+
+	var wg sync.WaitGroup
+	certs := make([]*tls.Certificate, 10)
+	for i := range certs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			certs[i], _ = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "Example.com"})
+		}(i)
+	}
+	wg.Wait()
+	for _, c := range certs {
+		if c == nil || c != certs[0] {
+			t.Fatal("concurrent calls should get the same certificate")
+		}
+	}
+	if conn.requests != 1 {
+		t.Fatalf("expected a single enrollment, got %d", conn.requests)
+	}
+	if certs[0].Leaf.Subject.CommonName != "example.com" {
+		t.Fatalf("unexpected common name %s", certs[0].Leaf.Subject.CommonName)
+	}
+
+	noSNI, err := m.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if noSNI != certs[0] {
+		t.Fatal("clients without SNI should get the first certificate")
+	}
+}
+
+func TestCertificateManager_GetClientCertificate(t *testing.T) {
+	m, _ := newTestManager(t)
+	_, err := m.GetClientCertificate(&tls.CertificateRequestInfo{})
+	if err == nil {
+		t.Fatal("client certificate should fail without ClientName")
+	}
+	m.ClientName = "client.example.com"
+	cert, err := m.GetClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.Subject.CommonName != "client.example.com" {
+		t.Fatalf("unexpected common name %s", cert.Leaf.Subject.CommonName)
+	}
+}
+
+func TestCertificateManager_Cache(t *testing.T) {
+	caches := map[string]Cache{
+		"memory":    &MemoryCache{},
+		"directory": DirCache(t.TempDir()),
+		"encrypted": NewEncryptedCache(DirCache(t.TempDir()), "passphrase"),
+	}
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			first, conn := newTestManager(t)
+			first.Cache = cache
+			cert, err := first.Certificate("example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			second, _ := newTestManager(t)
+			second.Connector = conn
+			second.Cache = cache
+			cached, err := second.Certificate("example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conn.requests != 1 {
+				t.Fatalf("certificate should have been loaded from the cache, got %d enrollments", conn.requests)
+			}
+			if cached.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) != 0 {
+				t.Fatal("cached certificate doesn't match the enrolled one")
+			}
+		})
+	}
+}
+
+func TestEncryptedCache(t *testing.T) {
+	dir := DirCache(t.TempDir())
+	cache := NewEncryptedCache(dir, "passphrase")
+	err := cache.Put("key", []byte("secret data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := dir.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) == "secret data" {
+		t.Fatal("data should be encrypted on disk")
+	}
+	data, err := cache.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "secret data" {
+		t.Fatalf("unexpected data %q", data)
+	}
+
+	_, err = NewEncryptedCache(dir, "wrong").Get("key")
+	if err == nil {
+		t.Fatal("decryption with a wrong passphrase should fail")
+	}
+
+	err = cache.Delete("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cache.Get("key")
+	if !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected cache miss, got %v", err)
+	}
+}
+
+func TestDirCache_InvalidKey(t *testing.T) {
+	dir := DirCache(t.TempDir())
+	for _, key := range []string{"", "..", "../escape", "a/b"} {
+		err := dir.Put(key, []byte("data"))
+		if err == nil {
+			t.Fatalf("key %q should be rejected", key)
+		}
+	}
+}
+
+func TestCertificateManager_Renewal(t *testing.T) {
+	m, _ := newTestManager(t)
+	// fake certificates are valid for 90 days, so a 100 days window makes them due right away
+	m.RenewBefore = "100d"
+	before, err := m.Certificate("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.renewDue(time.Now())
+	after, _ := m.Certificate("example.com")
+	if after != before {
+		t.Fatal("certificate should not be renewed before the retry interval elapses")
+	}
+
+	m.renewDue(time.Now().Add(2 * renewRetryInterval))
+	after, _ = m.Certificate("example.com")
+	if after == before {
+		t.Fatal("certificate should have been renewed")
+	}
+	if after.Leaf.SerialNumber.Cmp(before.Leaf.SerialNumber) == 0 {
+		t.Fatal("renewed certificate should have a new serial number")
+	}
+}
+
+func TestCertificateManager_RenewalDisabled(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.RenewBefore = "disabled"
+	_, err := m.Certificate("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.nextRenewal().IsZero() {
+		t.Fatal("no renewal should be scheduled")
+	}
+}
+
+func TestCertificateManager_Close(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.init()
+	stopped := make(chan struct{})
+	go func() {
+		m.run()
+		close(stopped)
+	}()
+	m.Close()
+	m.Close()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("renewal goroutine did not stop")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"log"
 
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 	"github.com/Venafi/vcert/v5/pkg/venafi/cloud"
 	"github.com/Venafi/vcert/v5/pkg/venafi/fake"
 	"github.com/Venafi/vcert/v5/pkg/venafi/firefly"
@@ -83,6 +84,10 @@ func (cfg *Config) newClient(args []interface{}) (connector endpoint.Connector,
 	}
 	connector.SetZone(cfg.Zone)
 	connector.SetHTTPClient(cfg.Client)
+	if c, ok := connector.(retryConfigurable); ok {
+		c.SetRetryPolicy(cfg.RetryPolicy)
+		c.SetRateLimiter(cfg.RateLimiter)
+	}
 
 	if clientArgs.authenticate {
 		err = connector.Authenticate(cfg.Credentials)
@@ -91,6 +96,12 @@ func (cfg *Config) newClient(args []interface{}) (connector endpoint.Connector,
 	return
 }
 
+// retryConfigurable is implemented by the connectors whose requests can be retried and rate limited
+type retryConfigurable interface {
+	SetRetryPolicy(policy *httputils.RetryPolicy)
+	SetRateLimiter(limiter *httputils.RateLimiter)
+}
+
 func getNewClientArguments(args []interface{}) (*newClientArgs, error) {
 
 	if len(args) > 1 {
@@ -17,6 +17,7 @@
 package vcert
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509/pkix"
 	"encoding/json"
@@ -454,3 +455,39 @@ func TestNewClient_UserAgent(t *testing.T) {
 		}
 	}
 }
+
+func TestNewClient_ConnectorContext(t *testing.T) {
+	connectorConfigs := []Config{
+		{
+			ConnectorType: endpoint.ConnectorTypeCloud,
+			Credentials:   &endpoint.Authentication{ExternalJWT: "fake-external-idp-jwt", TokenURL: "https://fake.token.url.com/token"},
+		},
+		{
+			ConnectorType: endpoint.ConnectorTypeTPP,
+			BaseUrl:       "https://tpp.example.local",
+			Credentials:   &endpoint.Authentication{User: "fake-user", Password: "fake-password"},
+		},
+		{
+			ConnectorType: endpoint.ConnectorTypeFirefly,
+			BaseUrl:       "https://firefly.example.local",
+			Credentials: &endpoint.Authentication{ClientId: "fake-client-id", ClientSecret: "fake-client-secret",
+				IdentityProvider: &endpoint.OAuthProvider{TokenURL: "https://fake.token.url.com/token"}},
+		},
+		{
+			ConnectorType: endpoint.ConnectorTypeFake,
+		},
+	}
+	for _, cfg := range connectorConfigs {
+		t.Run(cfg.ConnectorType.String(), func(t *testing.T) {
+			c, err := NewClient(&cfg, false)
+			require.NoError(t, err)
+			cc, ok := c.(endpoint.ConnectorContext)
+			require.True(t, ok, "connector should implement endpoint.ConnectorContext")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err = cc.AuthenticateContext(ctx, cfg.Credentials)
+			assert.ErrorIs(t, err, context.Canceled)
+		})
+	}
+}
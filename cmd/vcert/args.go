@@ -36,6 +36,7 @@ const (
 	commandSshPickupName        = "sshpickup"
 	commandSshEnrollName        = "sshenroll"
 	commandSshGetConfigName     = "sshgetconfig"
+	commandSshInspectName       = "sshinspect"
 	commandProvisionName        = "provision"
 	subCommandCloudKeystoreName = "cloudkeystore"
 )
@@ -115,6 +116,7 @@ type commandFlags struct {
 	url                  string
 	deviceURL            string
 	verbose              bool
+	otlpEndpoint         string
 	zone                 string
 	omitSans             bool
 	csrFormat            string
@@ -140,12 +142,19 @@ type commandFlags struct {
 	sshCertGuid          string
 	sshCertPubKey        string
 	sshCertKeySize       int
+	sshCertKeyType       string
 	sshCertKeyPassphrase string
 	sshCertExtension     stringSlice
 	sshCertPrincipal     stringSlice
 	sshCertWindows       bool
 	sshFileCertEnroll    string
 	sshFileGetConfig     string
+	sshFileInspect       string
+	sshCaPublicKeyFile   string
+	sshTrustedUserCAKeys string
+	sshKnownHosts        string
+	sshHostPatterns      stringSlice
+	sshAuthorizedPrinc   string
 	certificateID        string
 	certificateIDFile    string
 	keystoreID           string
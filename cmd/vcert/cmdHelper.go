@@ -17,6 +17,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
@@ -29,11 +30,13 @@ import (
 	"time"
 
 	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/pkcs12"
 
 	"github.com/Venafi/vcert/v5"
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/tracing"
 	"github.com/Venafi/vcert/v5/pkg/venafi"
 	"github.com/Venafi/vcert/v5/pkg/venafi/cloud"
 	"github.com/Venafi/vcert/v5/pkg/venafi/firefly"
@@ -51,6 +54,7 @@ func runBeforeCommand(c *cli.Context) error {
 	flags.customFields = c.StringSlice("field")
 	flags.sshCertExtension = c.StringSlice("extension")
 	flags.sshCertPrincipal = c.StringSlice("principal")
+	flags.sshHostPatterns = c.StringSlice("host-pattern")
 	flags.sshCertSourceAddrs = c.StringSlice("source-address")
 	flags.sshCertDestAddrs = c.StringSlice("destination-address")
 
@@ -99,14 +103,14 @@ func runBeforeCommand(c *cli.Context) error {
 		}
 	}
 
-	return nil
+	return startTracing(flags.otlpEndpoint)
 }
 
 func runBeforeProvisionCommand(c *cli.Context) error {
 	if flags.platformString != "" {
 		flags.platform = venafi.GetPlatformType(flags.platformString)
 	}
-	return nil
+	return startTracing(flags.otlpEndpoint)
 }
 
 func setTLSConfig() error {
@@ -395,3 +399,34 @@ func writeOutKeyAndCsr(commandName string, cf *commandFlags, key []byte, csr []b
 	err = result.Flush()
 	return
 }
+
+// tracingEndpoint is the collector the traces are exported to. It is empty while tracing is disabled
+var tracingEndpoint string
+
+// startTracing enables the export of traces to endpoint, the --otlp-endpoint value. Tracing stays disabled if
+// endpoint is empty
+func startTracing(endpoint string) error {
+	if endpoint == "" || endpoint == tracingEndpoint {
+		return nil
+	}
+	headers, err := tracing.ParseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+	stopTracing()
+	tracing.SetExporter(tracing.NewOTLPExporter(endpoint, headers, os.Getenv("OTEL_SERVICE_NAME")))
+	tracingEndpoint = endpoint
+	zap.L().Debug("exporting traces", zap.String("endpoint", endpoint))
+	return nil
+}
+
+// stopTracing sends the pending spans to the collector. It must be called before exiting
+func stopTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tracingEndpoint = ""
+	err := tracing.Shutdown(ctx)
+	if err != nil {
+		zap.L().Warn("failed to export traces", zap.Error(err))
+	}
+}
@@ -17,12 +17,16 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/Venafi/vcert/v5"
 	"github.com/Venafi/vcert/v5/pkg/certificate"
@@ -34,7 +38,7 @@ var (
 		Name:      commandSshPickupName,
 		Flags:     sshPickupFlags,
 		Action:    doCommandSSHPickup,
-		Usage:     "To retrieve an SSH Certificate from Trust Protection Platform",
+		Usage:     "To retrieve an SSH Certificate from Trust Protection Platform or Venafi Control Plane",
 		UsageText: `vcert sshpickup -u https://tpp.example.com -t <TPP access token> --pickup-id <ssh cert DN>`,
 	}
 
@@ -43,7 +47,7 @@ var (
 		Name:      commandSshEnrollName,
 		Flags:     sshEnrollFlags,
 		Action:    doCommandSSHEnroll,
-		Usage:     "To enroll an SSH Certificate to Trust Protection Platform",
+		Usage:     "To enroll an SSH Certificate to Trust Protection Platform or Venafi Control Plane",
 		UsageText: `vcert sshenroll -u https://tpp.example.com -t <TPP access token> --template <val> --id <val> --principal bob --principal alice --valid-hours 1`,
 	}
 
@@ -52,9 +56,18 @@ var (
 		Name:      commandSshGetConfigName,
 		Flags:     sshGetConfigFlags,
 		Action:    doCommandSSHGetConfig,
-		Usage:     "To get the SSH CA public key and default principals from Trust Protection Platform",
+		Usage:     "To get the SSH CA public key and default principals from Trust Protection Platform or Venafi Control Plane",
 		UsageText: `vcert sshgetconfig -u https://tpp.example.com -t <TPP access token> --template <val>`,
 	}
+
+	commandSshInspect = &cli.Command{
+		Before:    runBeforeCommand,
+		Name:      commandSshInspectName,
+		Flags:     sshInspectFlags,
+		Action:    doCommandSSHInspect,
+		Usage:     "To inspect an SSH certificate file and verify it against the CA public key of its certificate issuing template",
+		UsageText: `vcert sshinspect -u https://tpp.example.com -t <TPP access token> --file <cert file> --template <val> --principal bob`,
+	}
 )
 
 func doCommandSSHPickup(c *cli.Context) error {
@@ -168,24 +181,28 @@ func doCommandSSHEnroll(c *cli.Context) error {
 		flags.keyPassword = flags.sshCertKeyPassphrase
 	}
 
-	var privateKey, publicKey []byte
+	var privateKey []byte
 	sPubKey := ""
 	//support for local generated keypair or provided public key
 	if flags.sshCertPubKey == SshCertPubKeyLocal {
 
-		keySize := flags.sshCertKeySize
-		if keySize <= 0 {
-			keySize = 3072
+		keyType, curveSize, err := util.ParseSshKeyType(flags.sshCertKeyType)
+		if err != nil {
+			return err
+		}
+		req.KeyType = keyType
+		req.KeySize = flags.sshCertKeySize
+		if req.KeySize <= 0 {
+			req.KeySize = curveSize
 		}
 
-		privateKey, publicKey, err = util.GenerateSshKeyPair(keySize, flags.keyPassword, flags.sshCertKeyId, flags.format)
+		privateKey, err = req.GenerateKeyPair(flags.keyPassword, flags.format)
 
 		if err != nil {
 			return err
 		}
 
-		sPubKey = string(publicKey)
-		req.PublicKeyData = sPubKey
+		sPubKey = req.PublicKeyData
 	}
 
 	if isPubKeyInFile() {
@@ -345,9 +362,189 @@ func doCommandSSHGetConfig(c *cli.Context) error {
 		}
 	}
 
+	return updateSshTrustFiles(conf)
+}
+
+// updateSshTrustFiles adds the CA public key and the default principals of conf to the sshd and ssh files given by
+// the flags. They are written in a block named after the template, which is replaced when sshgetconfig runs again
+func updateSshTrustFiles(conf *certificate.SshConfig) error {
+	name := flags.sshCertTemplate
+	if name == "" {
+		name = flags.sshCertGuid
+	}
+
+	if flags.sshTrustedUserCAKeys != "" {
+		lines, err := util.SshCaKeyLines(conf.CaPublicKey)
+		if err != nil {
+			return err
+		}
+		err = updateSshTrustFile(flags.sshTrustedUserCAKeys, name, lines)
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.sshKnownHosts != "" {
+		patterns := flags.sshHostPatterns
+		if len(patterns) == 0 {
+			patterns = []string{"*"}
+		}
+		lines, err := util.SshKnownHostsLines(conf.CaPublicKey, patterns)
+		if err != nil {
+			return err
+		}
+		err = updateSshTrustFile(flags.sshKnownHosts, name, lines)
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.sshAuthorizedPrinc != "" {
+		if len(conf.Principals) == 0 {
+			return fmt.Errorf("no default principals were retrieved for template %s, %s is not updated", name, flags.sshAuthorizedPrinc)
+		}
+		err := updateSshTrustFile(flags.sshAuthorizedPrinc, name, conf.Principals)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func updateSshTrustFile(path string, name string, lines []string) error {
+	changed, err := util.UpdateSshManagedBlock(path, name, lines)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	if changed {
+		logf("Successfully updated %s, previous version (if any) saved as %s", path, path+util.SshBackupSuffix)
+	} else {
+		logf("%s is up to date", path)
+	}
+	return nil
+}
+
+func doCommandSSHInspect(c *cli.Context) error {
+	err := validateSshInspectFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(flags.sshFileInspect)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH certificate file %s: %w", flags.sshFileInspect, err)
+	}
+	cert, err := certificate.ParseSshCertificate(string(data))
+	if err != nil {
+		return err
+	}
+	printSshMetadata(&certificate.SshCertificateObject{CertificateDetails: certificate.NewSshCertificateDetails(cert)})
+
+	principals := flags.sshCertPrincipal
+	caPublicKey := ""
+	if flags.sshCaPublicKeyFile != "" {
+		data, err = os.ReadFile(flags.sshCaPublicKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA public key file %s: %w", flags.sshCaPublicKeyFile, err)
+		}
+		caPublicKey = string(data)
+	} else if flags.sshCertTemplate != "" || flags.sshCertGuid != "" {
+		conf, err := retrieveSshConfig(c)
+		if err != nil {
+			return err
+		}
+		caPublicKey = conf.CaPublicKey
+		if len(principals) == 0 {
+			principals = conf.Principals
+		}
+	}
+
+	if caPublicKey == "" {
+		logf("Warning: SSH certificate was not verified. Use --ca-public-key, --template or --guid to verify it")
+	} else {
+		err = verifySshCertificate(cert, caPublicKey)
+		if err != nil {
+			return err
+		}
+		logf("Successfully verified SSH certificate against CA %s", ssh.FingerprintSHA256(cert.SignatureKey))
+	}
+
+	for _, warning := range checkSshCertificate(cert, principals, time.Now()) {
+		logf("Warning: %s", warning)
+	}
+	return nil
+}
+
+func retrieveSshConfig(c *cli.Context) (*certificate.SshConfig, error) {
+	err := setTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build vcert config: %s", err)
+	}
+
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %s", cfg.ConnectorType, err)
+	}
+
+	return connector.RetrieveSshConfig(&certificate.SshCaTemplateRequest{Template: flags.sshCertTemplate, Guid: flags.sshCertGuid})
+}
+
+// verifySshCertificate checks that cert is signed by the CA of caPublicKey, in the authorized_keys format
+func verifySshCertificate(cert *ssh.Certificate, caPublicKey string) error {
+	caKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(caPublicKey))
+	if err != nil {
+		return fmt.Errorf("failed to parse CA public key: %w", err)
+	}
+	if !bytes.Equal(cert.SignatureKey.Marshal(), caKey.Marshal()) {
+		return fmt.Errorf("SSH certificate is signed by CA %s, not by CA %s", ssh.FingerprintSHA256(cert.SignatureKey), ssh.FingerprintSHA256(caKey))
+	}
+
+	// CheckCert verifies the signature once the principal, the validity period and the critical options are
+	// accepted, which are reported as warnings by checkSshCertificate instead
+	checker := ssh.CertChecker{
+		Clock: func() time.Time {
+			return time.Unix(int64(cert.ValidAfter), 0)
+		},
+	}
+	for name := range cert.CriticalOptions {
+		checker.SupportedCriticalOptions = append(checker.SupportedCriticalOptions, name)
+	}
+	principal := ""
+	if len(cert.ValidPrincipals) > 0 {
+		principal = cert.ValidPrincipals[0]
+	}
+	err = checker.CheckCert(principal, cert)
+	if err != nil {
+		return fmt.Errorf("invalid SSH certificate: %w", err)
+	}
+	return nil
+}
+
+// checkSshCertificate returns warnings about cert not being valid at now, or for all principals. A certificate
+// without principals being valid for any principal
+func checkSshCertificate(cert *ssh.Certificate, principals []string, now time.Time) []string {
+	var warnings []string
+	if now.Unix() < int64(cert.ValidAfter) {
+		warnings = append(warnings, fmt.Sprintf("SSH certificate is not valid yet, it is valid from %s", time.Unix(int64(cert.ValidAfter), 0)))
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && uint64(now.Unix()) >= cert.ValidBefore {
+		warnings = append(warnings, fmt.Sprintf("SSH certificate expired on %s", time.Unix(int64(cert.ValidBefore), 0)))
+	}
+	if len(cert.ValidPrincipals) > 0 {
+		for _, p := range principals {
+			if !slices.Contains(cert.ValidPrincipals, p) {
+				warnings = append(warnings, fmt.Sprintf("SSH certificate is not valid for principal %s", p))
+			}
+		}
+	}
+	return warnings
+}
+
 func buildSSHCertificateRequest(r certificate.SshCertRequest, cf *commandFlags) certificate.SshCertRequest {
 
 	if cf.sshCertKeyPassphrase != "" {
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+func newTestSshSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func newTestSshCertificate(t *testing.T, ca ssh.Signer, validAfter time.Time, validBefore time.Time, principals ...string) *ssh.Certificate {
+	cert := &ssh.Certificate{
+		Key:             newTestSshSigner(t).PublicKey(),
+		CertType:        ssh.UserCert,
+		KeyId:           "test",
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(validAfter.Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: map[string]string{"force-command": "/usr/bin/uptime"},
+		},
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestVerifySshCertificate(t *testing.T) {
+	ca := newTestSshSigner(t)
+	caPublicKey := string(ssh.MarshalAuthorizedKey(ca.PublicKey()))
+	// expired certificates are verified, the expiration being a warning
+	cert := newTestSshCertificate(t, ca, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour), "alice")
+
+	if err := verifySshCertificate(cert, caPublicKey); err != nil {
+		t.Fatalf("expected the certificate to be verified, got %s", err)
+	}
+
+	other := string(ssh.MarshalAuthorizedKey(newTestSshSigner(t).PublicKey()))
+	if err := verifySshCertificate(cert, other); err == nil || !strings.Contains(err.Error(), "is signed by CA") {
+		t.Fatalf("expected a CA mismatch, got %v", err)
+	}
+
+	cert.KeyId = "tampered"
+	if err := verifySshCertificate(cert, caPublicKey); err == nil {
+		t.Fatal("expected the signature of a tampered certificate not to be verified")
+	}
+
+	if err := verifySshCertificate(cert, "not a key"); err == nil {
+		t.Fatal("expected an invalid CA public key to fail")
+	}
+}
+
+func TestCheckSshCertificate(t *testing.T) {
+	ca := newTestSshSigner(t)
+	now := time.Now()
+
+	cases := []struct {
+		name       string
+		cert       *ssh.Certificate
+		principals []string
+		expected   []string
+	}{
+		{"valid", newTestSshCertificate(t, ca, now.Add(-time.Hour), now.Add(time.Hour), "alice", "bob"), []string{"bob"}, nil},
+		{"expired", newTestSshCertificate(t, ca, now.Add(-2*time.Hour), now.Add(-time.Hour), "alice"), nil, []string{"expired on"}},
+		{"not yet valid", newTestSshCertificate(t, ca, now.Add(time.Hour), now.Add(2*time.Hour), "alice"), nil, []string{"not valid yet"}},
+		{"principal mismatch", newTestSshCertificate(t, ca, now.Add(-time.Hour), now.Add(time.Hour), "alice"), []string{"alice", "root"}, []string{"not valid for principal root"}},
+		{"any principal", newTestSshCertificate(t, ca, now.Add(-time.Hour), now.Add(time.Hour)), []string{"root"}, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			warnings := checkSshCertificate(c.cert, c.principals, now)
+			if len(warnings) != len(c.expected) {
+				t.Fatalf("expected %d warnings, got %v", len(c.expected), warnings)
+			}
+			for i, w := range warnings {
+				if !strings.Contains(w, c.expected[i]) {
+					t.Fatalf("expected warning %q to contain %q", w, c.expected[i])
+				}
+			}
+		})
+	}
+
+	infinite := newTestSshCertificate(t, ca, now.Add(-time.Hour), now, "alice")
+	infinite.ValidBefore = ssh.CertTimeInfinity
+	if warnings := checkSshCertificate(infinite, nil, now.Add(24*time.Hour)); len(warnings) != 0 {
+		t.Fatalf("expected a certificate valid forever not to expire, got %v", warnings)
+	}
+}
+
+func TestUpdateSshTrustFiles(t *testing.T) {
+	dir := t.TempDir()
+	defer func(f commandFlags) { flags = f }(flags)
+	flags = commandFlags{
+		sshCertTemplate:      "ssh-users",
+		sshTrustedUserCAKeys: filepath.Join(dir, "trusted_user_ca_keys"),
+		sshKnownHosts:        filepath.Join(dir, "known_hosts"),
+		sshHostPatterns:      []string{"*.example.com"},
+		sshAuthorizedPrinc:   filepath.Join(dir, "auth_principals"),
+	}
+	caPublicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(newTestSshSigner(t).PublicKey())))
+	conf := &certificate.SshConfig{CaPublicKey: caPublicKey + "\n", Principals: []string{"ops", "deploy"}}
+
+	for i := 0; i < 2; i++ {
+		if err := updateSshTrustFiles(conf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{
+		flags.sshTrustedUserCAKeys: caPublicKey,
+		flags.sshKnownHosts:        "@cert-authority *.example.com " + caPublicKey,
+		flags.sshAuthorizedPrinc:   "ops\ndeploy",
+	}
+	for path, lines := range expected {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := "# BEGIN VCERT MANAGED BLOCK ssh-users\n" + lines + "\n# END VCERT MANAGED BLOCK ssh-users\n"
+		if string(content) != block {
+			t.Fatalf("unexpected content of %s:\n%s\nexpected:\n%s", path, content, block)
+		}
+		if _, err = os.Stat(path + util.SshBackupSuffix); !os.IsNotExist(err) {
+			t.Fatalf("expected no backup of %s, which is up to date, got %v", path, err)
+		}
+	}
+
+	conf.Principals = nil
+	if err := updateSshTrustFiles(conf); err == nil {
+		t.Fatal("expected an error without default principals")
+	}
+}
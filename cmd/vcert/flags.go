@@ -319,6 +319,14 @@ var (
 		Value:       false,
 	}
 
+	flagOTLPEndpoint = &cli.StringFlag{
+		Name:    "otlp-endpoint",
+		EnvVars: []string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT"},
+		Usage: "Use to export traces of the requests to an OpenTelemetry collector with OTLP/HTTP. Example: " +
+			"--otlp-endpoint http://localhost:4318. Headers are read from OTEL_EXPORTER_OTLP_HEADERS",
+		Destination: &flags.otlpEndpoint,
+	}
+
 	flagNoPrompt = &cli.BoolFlag{
 		Name: "no-prompt",
 		Usage: "Use to exclude credential and password prompts. If you enable the prompt and you enter incorrect information, " +
@@ -644,10 +652,18 @@ var (
 
 	flagSshKeySize = &cli.IntFlag{
 		Name:        "key-size",
-		Usage:       "key size bits, they will be used for creating keypair on case public-key:local",
+		Usage:       "key size bits, they will be used for creating keypair on case public-key:local. The curve size (256, 384 or 521) for ecdsa keys",
 		Destination: &flags.sshCertKeySize,
 	}
 
+	flagSshKeyType = &cli.StringFlag{
+		Name: "key-type",
+		Usage: "type of the keypair created on case public-key:local: rsa, ed25519 or ecdsa (also ecdsa-sha2-nistp256, ecdsa-sha2-nistp384 and ecdsa-sha2-nistp521)." +
+			" ed25519 and ecdsa private keys are written in the OpenSSH format, rsa ones too with --format openssh",
+		Value:       "rsa",
+		Destination: &flags.sshCertKeyType,
+	}
+
 	flagSshPassPhrase = &cli.StringFlag{
 		Name:        "key-passphrase",
 		Usage:       "passphrase for encrypting the private key",
@@ -716,6 +732,55 @@ var (
 		TakesFile:   true,
 	}
 
+	flagSshTrustedUserCAKeys = &cli.StringFlag{
+		Name: "trusted-user-ca-keys",
+		Usage: "Use to add the CA public key to an sshd TrustedUserCAKeys file, or to update it. " +
+			"Example: --trusted-user-ca-keys /etc/ssh/trusted_user_ca_keys",
+		Destination: &flags.sshTrustedUserCAKeys,
+		TakesFile:   true,
+	}
+
+	flagSshKnownHosts = &cli.StringFlag{
+		Name: "known-hosts",
+		Usage: "Use to add a @cert-authority line trusting the CA public key for the hosts matching --host-pattern to a " +
+			"known_hosts file, or to update it. Example: --known-hosts /etc/ssh/ssh_known_hosts",
+		Destination: &flags.sshKnownHosts,
+		TakesFile:   true,
+	}
+
+	flagSshHostPattern = &cli.StringSliceFlag{
+		Name:  "host-pattern",
+		Usage: "The hosts the CA signs certificates for, in the @cert-authority line of --known-hosts. Example: --host-pattern \"*.example.com\". Default is all hosts (\"*\")",
+	}
+
+	flagSshAuthorizedPrincipals = &cli.StringFlag{
+		Name: "authorized-principals",
+		Usage: "Use to add the default principals of the template to an sshd AuthorizedPrincipalsFile, or to update them. " +
+			"Example: --authorized-principals /etc/ssh/auth_principals/root",
+		Destination: &flags.sshAuthorizedPrinc,
+		TakesFile:   true,
+	}
+
+	flagSshFileInspect = &cli.StringFlag{
+		Name:        "file",
+		Usage:       "REQUIRED. Use to specify the SSH certificate file to inspect. Example: --file /path-to/id_rsa-cert.pub",
+		Destination: &flags.sshFileInspect,
+		TakesFile:   true,
+	}
+
+	flagSshCaPublicKey = &cli.StringFlag{
+		Name: "ca-public-key",
+		Usage: "Use to specify the file of the CA public key the SSH certificate must be signed by, instead of retrieving it " +
+			"from the certificate issuing template (--template or --guid). Example: --ca-public-key /path-to/trusted_ca.pub",
+		Destination: &flags.sshCaPublicKeyFile,
+		TakesFile:   true,
+	}
+
+	flagSshInspectPrincipal = &cli.StringSliceFlag{
+		Name:  "principal",
+		Usage: "The principals the SSH certificate is expected to be valid for. If no value is specified, then the default principals from the certificate template are expected, when retrieved.",
+	}
+
 	flagCertificateID = &cli.StringFlag{
 		Name:        "certificate-id",
 		Usage:       "The id of the certificate to be provisioned to a cloud keystore.",
@@ -779,7 +844,7 @@ var (
 		Destination: &flags.provisionFormat,
 	}
 
-	commonFlags              = []cli.Flag{flagInsecure, flagVerbose, flagNoPrompt}
+	commonFlags              = []cli.Flag{flagInsecure, flagVerbose, flagNoPrompt, flagOTLPEndpoint}
 	keyFlags                 = []cli.Flag{flagKeyType, flagKeySize, flagKeyCurve, flagKeyFile, flagKeyPassword}
 	sansFlags                = []cli.Flag{flagDNSSans, flagEmailSans, flagIPSans, flagURISans, flagUPNSans}
 	subjectFlags             = flagsApppend(flagCommonName, flagCountry, flagState, flagLocality, flagOrg, flagOrgUnits)
@@ -934,6 +999,7 @@ var (
 		flagProvisionPickupID,
 		flagPickupIDFile,
 		flagProviderName,
+		flagOTLPEndpoint,
 	)
 
 	commonCredFlags = []cli.Flag{flagConfig, flagProfile, flagUrl, flagToken, flagTrustBundle}
@@ -975,6 +1041,7 @@ var (
 		flagUrl,
 		flagToken,
 		flagVerbose,
+		flagOTLPEndpoint,
 		flagPolicyName,
 		flagPolicyConfigFile,
 		flagPolicyVerifyConfigFile,
@@ -987,6 +1054,7 @@ var (
 		flagUrl,
 		flagToken,
 		flagVerbose,
+		flagOTLPEndpoint,
 		flagPolicyName,
 		flagPolicyConfigFile,
 		flagPolicyStarterConfigFile,
@@ -995,7 +1063,9 @@ var (
 	))
 
 	sshPickupFlags = sortedFlags(flagsApppend(
+		flagPlatform,
 		flagUrl,
+		flagKey,
 		flagToken,
 		flagTrustBundle,
 		flagSshCertPickupId,
@@ -1006,7 +1076,9 @@ var (
 	))
 
 	sshEnrollFlags = sortedFlags(flagsApppend(
+		flagPlatform,
 		flagUrl,
+		flagKey,
 		flagToken,
 		flagTrustBundle,
 		flagKeyId,
@@ -1021,6 +1093,7 @@ var (
 		flagSshCertCa,
 		flagSshPubKey,
 		flagSshKeySize,
+		flagSshKeyType,
 		flagSshPassPhrase,
 		flagSshCertWindows,
 		flagSshFileCertEnroll,
@@ -1029,14 +1102,37 @@ var (
 	))
 
 	sshGetConfigFlags = sortedFlags(flagsApppend(
+		flagPlatform,
 		flagUrl,
+		flagKey,
 		flagTrustBundle,
 		flagToken,
 		flagSshCertCa,
 		flagSshCertGuid,
 		flagSshFileGetConfig,
+		flagSshTrustedUserCAKeys,
+		flagSshKnownHosts,
+		flagSshHostPattern,
+		flagSshAuthorizedPrincipals,
+		flagInsecure,
+		flagVerbose,
+		flagOTLPEndpoint,
+	))
+
+	sshInspectFlags = sortedFlags(flagsApppend(
+		flagPlatform,
+		flagUrl,
+		flagKey,
+		flagTrustBundle,
+		flagToken,
+		flagSshFileInspect,
+		flagSshCaPublicKey,
+		flagSshCertCa,
+		flagSshCertGuid,
+		flagSshInspectPrincipal,
 		flagInsecure,
 		flagVerbose,
+		flagOTLPEndpoint,
 	))
 )
 
@@ -89,9 +89,16 @@ func main() {
 			commandSshPickup,
 			commandSshEnroll,
 			commandSshGetConfig,
+			commandSshInspect,
 			commandRunPlaybook,
+			commandPlaybook,
 			commandProvision,
 		},
+		After: func(_ *cli.Context) error {
+			// sends the spans of the commands started with --otlp-endpoint
+			stopTracing()
+			return nil
+		},
 		EnableBashCompletion: true, //todo: write BashComplete function for options
 		Authors:              authors,
 		Copyright: `2018-2023 Venafi, Inc.
@@ -129,9 +136,10 @@ ACTIONS:
    checkcred     tpp                  To check the validity of a Trust Protection Platform token and grant
    voidcred      tpp                  To invalidate a Trust Protection Platform authentication token
 
-   sshenroll     tpp                  To enroll an SSH certificate
-   sshpickup     tpp                  To retrieve an SSH certificate
-   sshgetconfig  tpp                  To get the SSH CA public key and default principals
+   sshenroll     tpp | vcp            To enroll an SSH certificate
+   sshpickup     tpp | vcp            To retrieve an SSH certificate
+   sshgetconfig  tpp | vcp            To get the SSH CA public key and default principals
+   sshinspect    tpp | vcp            To inspect an SSH certificate and verify it against its CA
 
 OPTIONS:
    {{range .VisibleFlags}}{{.}}
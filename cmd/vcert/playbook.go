@@ -16,26 +16,41 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/pkcs12"
 
+	"github.com/Venafi/vcert/v5/pkg/metrics"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/parser"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/service"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vcertutil"
 	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/Venafi/vcert/v5/pkg/venafi"
 )
 
 const (
 	commandRunPlaybookName = "run"
+
+	reportFormatJSON  = "json"
+	reportFormatJUnit = "junit"
+
+	// exit codes of the run command when --detailed-exit-code is set. 0 means there was nothing to do
+	playbookExitFailure        = 1
+	playbookExitRenewed        = 2
+	playbookExitPartialFailure = 3
 )
 
 var commandRunPlaybook = &cli.Command{
@@ -47,15 +62,29 @@ var commandRunPlaybook = &cli.Command{
 	UsageText: `vcert run
    vcert run -f /path/to/my/file.yml
    vcert run -f ./myFile.yaml --force-renew
-   vcert run -f ./myFile.yaml --debug`,
+   vcert run -f ./myFile.yaml --debug
+   vcert run -f ./myFile.yaml --parallel 10
+   vcert run -f ./myFile.yaml --plan
+   vcert run -f ./myFile.yaml --daemon --health-address :8080
+   vcert run -f ./myFile.yaml --report-file ./report.xml --report-format junit --detailed-exit-code`,
 	Action: doRunPlaybook,
 	Flags:  playbookFlags,
 }
 
 type runOptions struct {
-	debug    bool
-	filepath string
-	force    bool
+	debug            bool
+	filepath         string
+	force            bool
+	parallel         int
+	reportFile       string
+	reportFormat     string
+	detailedExitCode bool
+	plan             bool
+	daemon           bool
+	healthAddress    string
+	maxCheckInterval time.Duration
+	metricsTextfile  string
+	otlpEndpoint     string
 }
 
 var (
@@ -88,10 +117,112 @@ var (
 		Destination: &playbookOptions.force,
 	}
 
+	PBFlagParallel = &cli.IntFlag{
+		Name:        "parallel",
+		Aliases:     nil,
+		Usage:       "the maximum number of certificate tasks run at the same time. Overrides config.concurrency from the playbook file",
+		Required:    false,
+		Value:       0,
+		Destination: &playbookOptions.parallel,
+	}
+
+	PBFlagReportFile = &cli.StringFlag{
+		Name:        "report-file",
+		Aliases:     nil,
+		Usage:       "the path of a file to write the report of the run to",
+		Required:    false,
+		Destination: &playbookOptions.reportFile,
+	}
+
+	PBFlagReportFormat = &cli.StringFlag{
+		Name:        "report-format",
+		Aliases:     nil,
+		Usage:       "the format of the report file: json or junit",
+		Required:    false,
+		Value:       reportFormatJSON,
+		Destination: &playbookOptions.reportFormat,
+	}
+
+	PBFlagDetailedExitCode = &cli.BoolFlag{
+		Name:    "detailed-exit-code",
+		Aliases: nil,
+		Usage: "exits with 0 when there was nothing to do, 1 when every task failed, 2 when certificates were renewed " +
+			"and 3 when some tasks failed",
+		Required:    false,
+		Value:       false,
+		Destination: &playbookOptions.detailedExitCode,
+	}
+
+	PBFlagPlan = &cli.BoolFlag{
+		Name:    "plan",
+		Aliases: nil,
+		Usage: "prints what running the playbook would do (enroll, renew, skip or policy violation) without " +
+			"requesting certificates or installing them",
+		Required:    false,
+		Value:       false,
+		Destination: &playbookOptions.plan,
+	}
+
+	PBFlagDaemon = &cli.BoolFlag{
+		Name:    "daemon",
+		Aliases: nil,
+		Usage: "keeps running, checking every certificate task when its certificates enter their renew window and " +
+			"reloading the playbook file when it changes",
+		Required:    false,
+		Value:       false,
+		Destination: &playbookOptions.daemon,
+	}
+
+	PBFlagHealthAddress = &cli.StringFlag{
+		Name:        "health-address",
+		Aliases:     nil,
+		Usage:       "the address the health endpoint listens on in --daemon mode, like :8080. Disabled if not set",
+		Required:    false,
+		Destination: &playbookOptions.healthAddress,
+	}
+
+	PBFlagMaxCheckInterval = &cli.DurationFlag{
+		Name:        "max-check-interval",
+		Aliases:     nil,
+		Usage:       "the longest time between two checks of a certificate task in --daemon mode",
+		Required:    false,
+		Value:       service.DefaultMaxCheckInterval,
+		Destination: &playbookOptions.maxCheckInterval,
+	}
+
+	PBFlagMetricsTextfile = &cli.StringFlag{
+		Name:    "metrics-textfile",
+		Aliases: nil,
+		Usage: "the path of a file to write the metrics of the run to, in the Prometheus text format read by the node " +
+			"exporter textfile collector. In --daemon mode, metrics are served on /metrics of --health-address instead",
+		Required:    false,
+		Destination: &playbookOptions.metricsTextfile,
+	}
+
+	PBFlagOTLPEndpoint = &cli.StringFlag{
+		Name:    "otlp-endpoint",
+		Aliases: nil,
+		EnvVars: []string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT"},
+		Usage: "the URL of an OpenTelemetry collector to export traces to with OTLP/HTTP, like " +
+			"http://localhost:4318. Headers are read from OTEL_EXPORTER_OTLP_HEADERS. Tracing is disabled if not set",
+		Required:    false,
+		Destination: &playbookOptions.otlpEndpoint,
+	}
+
 	playbookFlags = flagsApppend(
 		PBFlagDebug,
 		PBFlagFilepath,
 		PBFlagForce,
+		PBFlagParallel,
+		PBFlagReportFile,
+		PBFlagReportFormat,
+		PBFlagDetailedExitCode,
+		PBFlagPlan,
+		PBFlagDaemon,
+		PBFlagHealthAddress,
+		PBFlagMaxCheckInterval,
+		PBFlagMetricsTextfile,
+		PBFlagOTLPEndpoint,
 	)
 )
 
@@ -100,15 +231,38 @@ func doRunPlaybook(_ *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	started := time.Now()
 	zap.L().Info("running playbook file", zap.String("file", playbookOptions.filepath))
 	zap.L().Debug("debug is enabled")
 
+	if playbookOptions.reportFormat != reportFormatJSON && playbookOptions.reportFormat != reportFormatJUnit {
+		zap.L().Error("invalid --report-format value, it must be json or junit",
+			zap.String("reportFormat", playbookOptions.reportFormat))
+		os.Exit(1)
+	}
+
+	err = startTracing(playbookOptions.otlpEndpoint)
+	if err != nil {
+		zap.L().Error("invalid tracing configuration", zap.Error(err))
+		os.Exit(1)
+	}
+
+	if playbookOptions.daemon {
+		return doRunPlaybookDaemon()
+	}
+
 	playbook, err := parser.ReadPlaybook(playbookOptions.filepath)
 	if err != nil {
 		zap.L().Error(fmt.Errorf("%w", err).Error())
 		os.Exit(1)
 	}
 
+	err = service.ReadVaultCredentials(&playbook)
+	if err != nil {
+		zap.L().Error("failed to read playbook credentials", zap.Error(err))
+		os.Exit(1)
+	}
+
 	_, err = playbook.IsValid()
 	if err != nil {
 		zap.L().Error("invalid playbook file", zap.String("file", playbookOptions.filepath), zap.Error(err))
@@ -117,10 +271,17 @@ func doRunPlaybook(_ *cli.Context) error {
 
 	//Set the forceRenew variable
 	playbook.Config.ForceRenew = playbookOptions.force
+	if playbookOptions.parallel < 0 {
+		zap.L().Error("invalid --parallel value, it must not be negative", zap.Int("parallel", playbookOptions.parallel))
+		os.Exit(1)
+	}
+	if playbookOptions.parallel > 0 {
+		playbook.Config.Concurrency = playbookOptions.parallel
+	}
 
-	if len(playbook.CertificateTasks) == 0 {
+	if len(playbook.CertificateTasks) == 0 && len(playbook.SshCertificateTasks) == 0 {
 		zap.L().Info("no tasks in the playbook. Nothing to do")
-		return nil
+		return writePlaybookReport(service.NewReport(playbookOptions.filepath, started, nil))
 	}
 
 	// emulate the setTLSConfig from vcert
@@ -132,6 +293,10 @@ func doRunPlaybook(_ *cli.Context) error {
 
 	zap.L().Info("using Venafi Platform", zap.String("platform", playbook.Config.Connection.Platform.String()))
 
+	if playbookOptions.plan {
+		return doPlanPlaybook(playbook)
+	}
+
 	if playbook.Config.Connection.Platform == venafi.TPP {
 		err = service.ValidateTPPCredentials(&playbook)
 		if err != nil {
@@ -140,26 +305,166 @@ func doRunPlaybook(_ *cli.Context) error {
 		}
 	}
 
-	var taskErrors []string
+	results := service.Run(playbook)
+	stopTracing()
+	report := service.NewReport(playbookOptions.filepath, started, results)
+	logPlaybookResults(report)
 
-	for _, certTask := range playbook.CertificateTasks {
-		zap.L().Info("running playbook task", zap.String("task", certTask.Name))
-		errors := service.Execute(playbook.Config, certTask)
-		if len(errors) > 0 {
-			taskErrors = append(taskErrors, certTask.Name)
-			for _, err2 := range errors {
-				zap.L().Error("error running task", zap.String("task", certTask.Name), zap.Error(err2))
-			}
+	err = writePlaybookReport(report)
+	if err != nil {
+		zap.L().Error("failed to write report", zap.String("file", playbookOptions.reportFile), zap.Error(err))
+		os.Exit(playbookExitFailure)
+	}
+
+	if playbookOptions.metricsTextfile != "" {
+		err = metrics.Default.WriteTextfile(playbookOptions.metricsTextfile)
+		if err != nil {
+			zap.L().Error("failed to write metrics", zap.String("file", playbookOptions.metricsTextfile), zap.Error(err))
+			os.Exit(playbookExitFailure)
 		}
 	}
-	if len(taskErrors) > 0 {
-		os.Exit(1)
+
+	exitCode := playbookExitCode(report.Summary, playbookOptions.detailedExitCode)
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
 
 	zap.L().Info("playbook run finished")
 	return nil
 }
 
+// doRunPlaybookDaemon runs the playbook in daemon mode until vcert is interrupted
+func doRunPlaybookDaemon() error {
+	if playbookOptions.force || playbookOptions.plan || playbookOptions.reportFile != "" ||
+		playbookOptions.metricsTextfile != "" {
+		zap.L().Error("--daemon can't be used with --force-renew, --plan, --report-file or --metrics-textfile")
+		os.Exit(1)
+	}
+	if playbookOptions.parallel < 0 {
+		zap.L().Error("invalid --parallel value, it must not be negative", zap.Int("parallel", playbookOptions.parallel))
+		os.Exit(1)
+	}
+
+	daemon := service.NewDaemon(service.DaemonOptions{
+		File:             playbookOptions.filepath,
+		HealthAddress:    playbookOptions.healthAddress,
+		MaxCheckInterval: playbookOptions.maxCheckInterval,
+		Load: func(file string) (domain.Playbook, parser.Inputs, error) {
+			playbook, inputs, err := service.LoadPlaybook(file)
+			if err != nil {
+				return playbook, inputs, err
+			}
+			if playbookOptions.parallel > 0 {
+				playbook.Config.Concurrency = playbookOptions.parallel
+			}
+			err = setPlaybookTLSConfig(playbook)
+			if err != nil {
+				return playbook, inputs, fmt.Errorf("tls config error: %w", err)
+			}
+			return playbook, inputs, nil
+		},
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	zap.L().Info("running playbook in daemon mode", zap.String("file", playbookOptions.filepath))
+	err := daemon.Run(ctx)
+	stopTracing()
+	if err != nil {
+		zap.L().Error("playbook daemon failed", zap.Error(err))
+		os.Exit(1)
+	}
+	return nil
+}
+
+// doPlanPlaybook prints what running playbook would do. It exits with 1 when a task can't be planned or violates the
+// policy of its zone
+func doPlanPlaybook(playbook domain.Playbook) error {
+	zap.L().Info("planning playbook tasks. No certificates will be requested or installed")
+
+	// refreshing the TPP tokens rewrites the playbook file, a plan only reports they need it
+	if playbook.Config.Connection.Platform == venafi.TPP && playbook.Config.Connection.Credentials.AccessToken != "" {
+		isValid, err := vcertutil.IsValidAccessToken(playbook.Config)
+		if err != nil || !isValid {
+			zap.L().Warn("access token is invalid or expired. vcert run would refresh it", zap.Error(err))
+		}
+	}
+
+	plans := service.Plan(playbook)
+	stopTracing()
+	err := service.WritePlan(os.Stdout, plans)
+	if err != nil {
+		return err
+	}
+
+	if service.PlanFailed(plans) {
+		os.Exit(playbookExitFailure)
+	}
+	return nil
+}
+
+// playbookExitCode returns the exit code of the run command for summary. Unless detailed is set, it is 1 if any task
+// failed and 0 otherwise
+func playbookExitCode(summary service.ReportSummary, detailed bool) int {
+	switch {
+	case summary.Failed > 0 && (!detailed || summary.Failed == summary.Tasks):
+		return playbookExitFailure
+	case summary.Failed > 0:
+		return playbookExitPartialFailure
+	case summary.Renewed > 0 && detailed:
+		return playbookExitRenewed
+	default:
+		return 0
+	}
+}
+
+// writePlaybookReport writes report to the file set with --report-file, if any
+func writePlaybookReport(report service.Report) error {
+	if playbookOptions.reportFile == "" {
+		return nil
+	}
+
+	buf := bytes.Buffer{}
+	var err error
+	if playbookOptions.reportFormat == reportFormatJUnit {
+		err = report.WriteJUnit(&buf)
+	} else {
+		err = report.WriteJSON(&buf)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(playbookOptions.reportFile, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("report written", zap.String("file", playbookOptions.reportFile))
+	return nil
+}
+
+// logPlaybookResults logs the result of every task and a summary of the run
+func logPlaybookResults(report service.Report) {
+	for _, result := range report.Tasks {
+		fields := []zap.Field{
+			zap.String("task", result.Name),
+			zap.String("status", string(result.Status)),
+			zap.Duration("duration", result.Duration),
+		}
+		if result.Reason != "" {
+			fields = append(fields, zap.String("reason", result.Reason))
+		}
+		if len(result.Errors) > 0 {
+			fields = append(fields, zap.Errors("errors", result.Errors))
+		}
+		zap.L().Info("task result", fields...)
+	}
+	zap.L().Info("playbook results", zap.Int("tasks", report.Summary.Tasks),
+		zap.Int("renewed", report.Summary.Renewed),
+		zap.Int("unchanged", report.Summary.Unchanged),
+		zap.Int("failed", report.Summary.Failed))
+}
+
 func setPlaybookTLSConfig(playbook domain.Playbook) error {
 	// NOTE: This should use the standard setTLSConfig from vCert once incorporated into vCert
 	//  added here mostly to deal with TPP servers that are enabled for certificate authentication
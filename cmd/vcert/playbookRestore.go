@@ -0,0 +1,159 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/parser"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/service"
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+const (
+	commandPlaybookName       = "playbook"
+	subCommandPBRestoreName   = "restore"
+	defaultRestoreGeneration  = 1
+	restoreGenerationFlagName = "generation"
+)
+
+var (
+	commandPlaybook = &cli.Command{
+		Name:        commandPlaybookName,
+		Usage:       "To manage the certificates installed by a playbook",
+		Action:      doCommandPlaybook,
+		Subcommands: []*cli.Command{subCommandPBRestore},
+	}
+
+	subCommandPBRestore = &cli.Command{
+		Name: subCommandPBRestoreName,
+		Usage: `Installs a previous generation of the backups of the installations of a certificate task again,
+	and runs their after-install actions. Generation 1 is the latest backup.`,
+		UsageText: `vcert playbook restore -f ./myFile.yaml --task myTask --list
+   vcert playbook restore -f ./myFile.yaml --task myTask --generation 2`,
+		Action: doRestorePlaybook,
+		Flags:  restoreFlags,
+	}
+)
+
+type restoreOptions struct {
+	debug      bool
+	filepath   string
+	task       string
+	generation int
+	list       bool
+}
+
+var (
+	restoreOpts = restoreOptions{}
+
+	restoreFlags = flagsApppend(
+		&cli.BoolFlag{
+			Name:        "debug",
+			Aliases:     []string{"d"},
+			Usage:       "Enables debug log messages",
+			Destination: &restoreOpts.debug,
+		},
+		&cli.StringFlag{
+			Name:        "file",
+			Aliases:     []string{"f"},
+			Usage:       "the path to the playbook file",
+			Value:       domain.DefaultFilepath,
+			Destination: &restoreOpts.filepath,
+		},
+		&cli.StringFlag{
+			Name:        "task",
+			Usage:       "the name of the certificate task to restore",
+			Required:    true,
+			Destination: &restoreOpts.task,
+		},
+		&cli.IntFlag{
+			Name:        restoreGenerationFlagName,
+			Usage:       "the generation of the backups to restore, 1 being the latest",
+			Value:       defaultRestoreGeneration,
+			Destination: &restoreOpts.generation,
+		},
+		&cli.BoolFlag{
+			Name:        "list",
+			Usage:       "lists the generations of the backups of the task instead of restoring one",
+			Destination: &restoreOpts.list,
+		},
+	)
+)
+
+func doCommandPlaybook(_ *cli.Context) error {
+	return fmt.Errorf("the following subcommand(s) are required: \n%s",
+		createBulletList([]string{subCommandPBRestoreName}))
+}
+
+func doRestorePlaybook(_ *cli.Context) error {
+	err := util.ConfigureLogger(restoreOpts.debug)
+	if err != nil {
+		return err
+	}
+
+	playbook, err := parser.ReadPlaybook(restoreOpts.filepath)
+	if err != nil {
+		zap.L().Error(fmt.Errorf("%w", err).Error())
+		os.Exit(1)
+	}
+
+	task, err := findPlaybookTask(playbook, restoreOpts.task)
+	if err != nil {
+		zap.L().Error("invalid --task value", zap.Error(err))
+		os.Exit(1)
+	}
+
+	if restoreOpts.list {
+		backups, err := service.Backups(task)
+		if err != nil {
+			zap.L().Error("failed to read backups", zap.String("task", task.Name), zap.Error(err))
+			os.Exit(1)
+		}
+		return service.WriteBackups(os.Stdout, backups)
+	}
+
+	zap.L().Info("restoring certificate task", zap.String("task", task.Name),
+		zap.Int(restoreGenerationFlagName, restoreOpts.generation))
+	err = service.Restore(task, restoreOpts.generation)
+	if err != nil {
+		zap.L().Error("failed to restore certificate task", zap.String("task", task.Name), zap.Error(err))
+		os.Exit(1)
+	}
+	zap.L().Info("certificate task restored", zap.String("task", task.Name))
+	return nil
+}
+
+// findPlaybookTask returns the certificate task of playbook named name, after validating it
+func findPlaybookTask(playbook domain.Playbook, name string) (domain.CertificateTask, error) {
+	for _, task := range playbook.CertificateTasks {
+		if task.Name != name {
+			continue
+		}
+		_, err := task.IsValid()
+		if err != nil {
+			return task, fmt.Errorf("invalid certificate task %s:\n%w", name, err)
+		}
+		return task, nil
+	}
+	return domain.CertificateTask{}, fmt.Errorf("no certificate task named %s in the playbook", name)
+}
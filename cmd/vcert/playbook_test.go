@@ -15,6 +15,7 @@ import (
 	"golang.org/x/crypto/pkcs12"
 
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/service"
 	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/Venafi/vcert/v5/pkg/venafi"
 )
@@ -200,3 +201,25 @@ func (s *PlaybookSuite) TestPlaybook_SetTLSConfig_Insecure() {
 	tlsCfg := http.DefaultTransport.(*http.Transport).TLSClientConfig
 	s.True(tlsCfg.InsecureSkipVerify)
 }
+
+func (s *PlaybookSuite) TestPlaybook_ExitCode() {
+	cases := []struct {
+		name     string
+		summary  service.ReportSummary
+		detailed bool
+		expected int
+	}{
+		{name: "nothing_to_do", summary: service.ReportSummary{Tasks: 2, Unchanged: 2}, expected: 0},
+		{name: "renewed", summary: service.ReportSummary{Tasks: 2, Renewed: 1, Unchanged: 1}, expected: 0},
+		{name: "failed", summary: service.ReportSummary{Tasks: 2, Renewed: 1, Failed: 1}, expected: playbookExitFailure},
+		{name: "detailed_nothing_to_do", summary: service.ReportSummary{Tasks: 2, Unchanged: 2}, detailed: true, expected: 0},
+		{name: "detailed_renewed", summary: service.ReportSummary{Tasks: 2, Renewed: 1, Unchanged: 1}, detailed: true, expected: playbookExitRenewed},
+		{name: "detailed_partial_failure", summary: service.ReportSummary{Tasks: 2, Renewed: 1, Failed: 1}, detailed: true, expected: playbookExitPartialFailure},
+		{name: "detailed_failure", summary: service.ReportSummary{Tasks: 2, Failed: 2}, detailed: true, expected: playbookExitFailure},
+	}
+	for _, tc := range cases {
+		s.Run(tc.name, func() {
+			s.Equal(tc.expected, playbookExitCode(tc.summary, tc.detailed))
+		})
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"math/rand"
 	"os"
 	"regexp"
@@ -469,6 +470,14 @@ func printCriticalOptions(fc string, sa []string) {
 	}
 }
 
+// sshValidTo formats the end of the validity period of an SSH certificate, which may never expire
+func sshValidTo(validTo int64) string {
+	if validTo == math.MaxInt64 {
+		return "forever"
+	}
+	return util.ConvertSecondsToTime(validTo).String()
+}
+
 func printSshMetadata(data *certificate.SshCertificateObject) {
 	logf("SSH certificate:")
 
@@ -480,7 +489,7 @@ func printSshMetadata(data *certificate.SshCertificateObject) {
 	logf("\tCertificate Identifier: %s", data.CertificateDetails.KeyID)
 	logf("\tSerial: %s", data.CertificateDetails.SerialNumber)
 	logf("\tValid From: %s", util.ConvertSecondsToTime(data.CertificateDetails.ValidFrom).String())
-	logf("\tValid To: %s", util.ConvertSecondsToTime(data.CertificateDetails.ValidTo).String())
+	logf("\tValid To: %s", sshValidTo(data.CertificateDetails.ValidTo))
 	printPrincipals(data.CertificateDetails.Principals)
 	printCriticalOptions(data.CertificateDetails.ForceCommand, data.CertificateDetails.SourceAddresses)
 	printExtensions(data.CertificateDetails.Extensions)
@@ -682,6 +682,17 @@ func validateSshEnrollFlags(commandName string) error {
 		}
 	}
 
+	keyType, curveSize, err := util.ParseSshKeyType(flags.sshCertKeyType)
+	if err != nil {
+		return err
+	}
+	if keyType != util.SshKeyTypeRSA && flags.sshCertPubKey != SshCertPubKeyLocal {
+		return fmt.Errorf("key-type %s is only supported with public-key:local", flags.sshCertKeyType)
+	}
+	if curveSize != 0 && flags.sshCertKeySize != 0 && flags.sshCertKeySize != curveSize {
+		return fmt.Errorf("key-size %d does not match key-type %s", flags.sshCertKeySize, flags.sshCertKeyType)
+	}
+
 	err = readData(commandName)
 	if err != nil {
 		return err
@@ -701,6 +712,30 @@ func validateGetSshConfigFlags(commandName string) error {
 		return fmt.Errorf("SSH certificate issuance template name (--template) or template guid (--guid) value is required")
 	}
 
+	if len(flags.sshHostPatterns) > 0 && flags.sshKnownHosts == "" {
+		return fmt.Errorf("--host-pattern can only be used with --known-hosts")
+	}
+
+	return nil
+}
+
+func validateSshInspectFlags(commandName string) error {
+	if flags.sshFileInspect == "" {
+		return fmt.Errorf("SSH certificate file (--file) value is required")
+	}
+
+	if flags.sshCaPublicKeyFile != "" {
+		if flags.sshCertTemplate != "" || flags.sshCertGuid != "" {
+			return fmt.Errorf("only one of --ca-public-key or the certificate issuing template (--template or --guid) can be used")
+		}
+		return nil
+	}
+
+	// the CA public key is retrieved from the certificate issuing template
+	if flags.sshCertTemplate != "" || flags.sshCertGuid != "" {
+		return validateConnectionFlags(commandName)
+	}
+
 	return nil
 }
 
@@ -3,11 +3,7 @@ package main
 import "fmt"
 
 func validateConnectionFlagsCloud(commandName string) error {
-	//sshgetconfig command
-	//This is not supported for VaaS as of now, but when (if) it does, it is going to be an unauthenticated endpoint, just like TPP
-	if commandName == commandSshGetConfigName {
-		return nil
-	}
+	//sshgetconfig command is authenticated for VaaS, unlike TPP, so it is validated as any other command
 
 	//getcred command
 	if commandName == commandGetCredName {
@@ -23,10 +23,12 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/ini.v1"
 
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 )
 
 const (
@@ -68,6 +70,18 @@ type Config struct {
 	// If nil, the default is `vcert/v5`.
 	// Further reading: https://www.rfc-editor.org/rfc/rfc9110#field.user-agent
 	UserAgent *string
+	// RenewWindow is how long before expiration the certificates served by NewListener are renewed.
+	// If zero, they are renewed once two thirds of their validity period have elapsed.
+	RenewWindow time.Duration
+	// RenewBefore is the renew window of the certificates served by NewListener, in the same format as
+	// CertificateManager.RenewBefore: "30d", "12h" or "10%". It takes precedence over RenewWindow when set.
+	RenewBefore string
+	// RetryPolicy sets how requests failing with a transient error (network error, 429, 502, 503, 504) are retried.
+	// If nil, requests are not retried.
+	RetryPolicy *httputils.RetryPolicy
+	// RateLimiter limits the rate of requests sent to the platform. It can be shared by several clients.
+	// If nil, requests are not limited.
+	RateLimiter *httputils.RateLimiter
 }
 
 // LoadConfigFromFile is deprecated. In the future will be rewritten.
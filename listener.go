@@ -2,6 +2,7 @@ package vcert
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"crypto/x509/pkix"
 	"fmt"
 	"log"
@@ -10,9 +11,13 @@ import (
 
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
-	"github.com/Venafi/vcert/v5/pkg/util"
 )
 
+// renewRetryInterval is the time to wait before retrying a failed renewal. It is also the minimum
+// time between two renewals of the same domain, so a renew window longer than the certificate
+// validity does not turn into a busy loop.
+var renewRetryInterval = time.Minute
+
 // NewListener returns a net.Listener that listens on the first port
 // specified in domains list (like "example.com:8443") or on default
 // (443) port on all interfaces and returns *tls.Conn connections with
@@ -25,6 +30,10 @@ import (
 // The returned listener uses a *tls.Config that enables HTTP/2, and
 // should only be used with servers that support HTTP/2.
 //
+// Certificates are renewed in the background before they expire (see Config.RenewBefore and Config.RenewWindow)
+// and swapped in without interrupting established connections. Closing the returned
+// listener stops the renewal.
+//
 // The returned Listener also enables TCP keep-alives on the accepted
 // connections. The returned *tls.Conn are returned before their TLS
 // handshake has completed.
@@ -35,10 +44,10 @@ func (cfg *Config) NewListener(domains ...string) net.Listener {
 		l.e = err
 		return &l
 	}
-	certs := make([]tls.Certificate, len(domains))
-	certsMap := make(map[string]*tls.Certificate)
+	cache := newCertCache(conn, cfg.RenewWindow)
+	cache.manager.RenewBefore = cfg.RenewBefore
 	port := ""
-	for i, d := range domains {
+	for _, d := range domains {
 		parsedHost, parsedPort, err := net.SplitHostPort(d)
 		if err == nil {
 			if port != "" && parsedPort != port {
@@ -49,13 +58,11 @@ func (cfg *Config) NewListener(domains ...string) net.Listener {
 			d = parsedHost
 		}
 		log.Println("Retrieving certificate for domain", d)
-		cert, err := getSimpleCertificate(conn, d)
+		err = cache.add(d)
 		if err != nil {
 			l.e = err
 			return &l
 		}
-		certs[i] = cert
-		certsMap[d] = &certs[i]
 	}
 	if port == "" {
 		port = "443"
@@ -63,53 +70,119 @@ func (cfg *Config) NewListener(domains ...string) net.Listener {
 
 	/* #nosec */
 	l.conf = &tls.Config{
-		Certificates:      certs,
-		NameToCertificate: certsMap,
+		GetCertificate: cache.GetCertificate,
 	}
 	l.Listener, l.e = net.Listen("tcp", ":"+port)
+	if l.e != nil {
+		return &l
+	}
+	l.cache = cache
+	go cache.run()
 	log.Println("Starting server on port", port)
 	return &l
 }
 
 func getSimpleCertificate(conn endpoint.Connector, cn string) (tls.Certificate, error) {
 	req := certificate.Request{Subject: pkix.Name{CommonName: cn}, DNSNames: []string{cn}, CsrOrigin: certificate.LocalGeneratedCSR}
-	zc, err := conn.ReadZoneConfiguration()
-	if err != nil {
-		return tls.Certificate{}, err
+	return enrollTLSCertificate(conn, &req, time.Minute)
+}
+
+// certCache holds the certificates served by a listener and renews them before they expire, through a
+// CertificateManager serving only the domains added to it. Renewed certificates replace the old ones atomically:
+// handshakes in progress keep the certificate they already got, new handshakes get the renewed one.
+type certCache struct {
+	conn        endpoint.Connector
+	renewWindow time.Duration
+	manager     *CertificateManager
+}
+
+func newCertCache(conn endpoint.Connector, renewWindow time.Duration) *certCache {
+	c := &certCache{
+		conn:        conn,
+		renewWindow: renewWindow,
 	}
-	err = conn.GenerateRequest(zc, &req)
-	if err != nil {
-		return tls.Certificate{}, err
+	c.manager = &CertificateManager{
+		Connector:     conn,
+		renewTimeFunc: c.renewTime,
 	}
-	requestID, err := conn.RequestCertificate(&req)
+	return c
+}
+
+// add enrolls a certificate for the domain and starts serving it
+func (c *certCache) add(domain string) error {
+	cert, err := getSimpleCertificate(c.conn, domain)
 	if err != nil {
-		return tls.Certificate{}, err
+		return err
+	}
+	return c.store(domain, &cert)
+}
+
+// store parses the leaf certificate and swaps the certificate for the domain, scheduling its renewal
+func (c *certCache) store(domain string, cert *tls.Certificate) error {
+	if len(cert.Certificate) == 0 {
+		return fmt.Errorf("no certificate returned for domain %s", domain)
 	}
-	req.PickupID = requestID
-	req.Timeout = time.Minute
-	certCollection, err := conn.RetrieveCertificate(&req)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
 	if err != nil {
-		return tls.Certificate{}, err
+		return fmt.Errorf("failed to parse certificate for domain %s: %w", domain, err)
 	}
-	err = certCollection.AddPrivateKey(req.PrivateKey, nil)
+	cert.Leaf = leaf
+	c.manager.store(normalizeHost(domain), cert)
+	return nil
+}
 
-	if err != nil {
-		return tls.Certificate{}, err
+// renewTime returns the moment the certificate should be renewed. When no renew window is set
+// the certificate is renewed once two thirds of its validity period have elapsed.
+func (c *certCache) renewTime(leaf *x509.Certificate) time.Time {
+	var renewAt time.Time
+	if c.renewWindow > 0 {
+		renewAt = leaf.NotAfter.Add(-c.renewWindow)
+	} else {
+		validity := leaf.NotAfter.Sub(leaf.NotBefore)
+		renewAt = leaf.NotAfter.Add(-validity / 3)
 	}
+	earliest := time.Now().Add(renewRetryInterval)
+	if renewAt.Before(earliest) {
+		renewAt = earliest
+	}
+	return renewAt
+}
 
-	privKey, err := util.DecryptPkcs8PrivateKey(certCollection.PrivateKey, "")
-	if err != nil {
-		return tls.Certificate{}, err
+// GetCertificate returns the certificate for the server name requested by the client. Clients asking for
+// other names get the certificate of the first domain. It is meant to be used as tls.Config.GetCertificate.
+func (c *certCache) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.manager.mu.RLock()
+	_, ok := c.manager.certs[normalizeHost(hello.ServerName)]
+	c.manager.mu.RUnlock()
+	if !ok {
+		hello = &tls.ClientHelloInfo{}
 	}
-	certCollection.PrivateKey = privKey
+	return c.manager.GetCertificate(hello)
+}
+
+// run waits until close is called. The certificates are renewed by the CertificateManager as soon as the
+// first one is added.
+func (c *certCache) run() {
+	c.manager.init()
+	<-c.manager.done
+}
 
-	return certCollection.ToTLSCertificate(), err
+// renewDue renews every certificate whose renewal time is not after now. Failed renewals are
+// retried after renewRetryInterval while the current certificate keeps being served.
+func (c *certCache) renewDue(now time.Time) {
+	c.manager.renewDue(now)
+}
+
+// close stops the renewal. It is safe to call it more than once.
+func (c *certCache) close() {
+	c.manager.Close()
 }
 
 type listener struct {
 	net.Listener
-	conf *tls.Config
-	e    error
+	conf  *tls.Config
+	cache *certCache
+	e     error
 }
 
 func (ln *listener) Accept() (net.Conn, error) {
@@ -133,9 +206,14 @@ func (ln *listener) Accept() (net.Conn, error) {
 	return tls.Server(tcpConn, ln.conf), nil
 }
 
+// Close stops accepting connections and stops the certificate renewal.
+// Connections already accepted are not closed.
 func (ln *listener) Close() error {
 	if ln.e != nil {
 		return ln.e
 	}
+	if ln.cache != nil {
+		ln.cache.close()
+	}
 	return ln.Listener.Close()
 }
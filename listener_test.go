@@ -70,3 +70,86 @@ func testListener(t *testing.T, host string, domains []string, success bool) {
 	}
 
 }
+
+func TestCertCache_Renewal(t *testing.T) {
+	cfg := Config{ConnectorType: endpoint.ConnectorTypeFake}
+	conn, err := cfg.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fake certificates are valid for 90 days, so a 100 days window makes them due right away
+	cache := newCertCache(conn, 100*24*time.Hour)
+	err = cache.add("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := &tls.ClientHelloInfo{ServerName: "localhost"}
+	before, err := cache.GetCertificate(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Leaf == nil {
+		t.Fatal("leaf certificate should be parsed")
+	}
+
+	cache.renewDue(time.Now())
+	after, _ := cache.GetCertificate(hello)
+	if after != before {
+		t.Fatal("certificate should not be renewed before the retry interval elapses")
+	}
+
+	cache.renewDue(time.Now().Add(2 * renewRetryInterval))
+	after, _ = cache.GetCertificate(hello)
+	if after == before {
+		t.Fatal("certificate should have been renewed")
+	}
+	if after.Leaf.SerialNumber.Cmp(before.Leaf.SerialNumber) == 0 {
+		t.Fatal("renewed certificate should have a new serial number")
+	}
+
+	// unknown server names get the first domain certificate
+	other, _ := cache.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.example.com"})
+	if other != after {
+		t.Fatal("certificate of the first domain should be served by default")
+	}
+}
+
+func TestCertCache_Close(t *testing.T) {
+	cfg := Config{ConnectorType: endpoint.ConnectorTypeFake}
+	conn, err := cfg.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newCertCache(conn, 0)
+	stopped := make(chan struct{})
+	go func() {
+		cache.run()
+		close(stopped)
+	}()
+	cache.close()
+	cache.close()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("renewal goroutine did not stop")
+	}
+}
+
+func TestCertCache_RenewBefore(t *testing.T) {
+	cfg := Config{ConnectorType: endpoint.ConnectorTypeFake}
+	conn, err := cfg.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RenewBefore takes precedence over the renew window
+	cache := newCertCache(conn, 100*24*time.Hour)
+	cache.manager.RenewBefore = "disabled"
+	defer cache.close()
+	err = cache.add("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := cache.manager.nextRenewal(); !next.IsZero() {
+		t.Fatalf("renewal should be disabled, got %s", next)
+	}
+}
@@ -68,9 +68,26 @@ type SshCertRequest struct {
 	PrivateKeyFormat          string
 	IncludeCertificateDetails bool
 
+	// KeyType and KeySize select the key pair generated locally by GenerateKeyPair. KeySize is the size of an RSA key
+	// or the curve of an ECDSA key, 0 meaning the default one
+	KeyType util.SshKeyType
+	KeySize int
+
 	Timeout time.Duration
 }
 
+// GenerateKeyPair generates a key pair of KeyType and KeySize, sets PublicKeyData to its public key, with KeyId as
+// comment, and returns the private key encrypted with passphrase if not empty. ed25519 and ECDSA private keys are in
+// the OpenSSH format, RSA ones in format (PKCS#8 by default, util.LegacyPem or util.OpenSshFormat)
+func (r *SshCertRequest) GenerateKeyPair(passphrase string, format string) ([]byte, error) {
+	privateKey, publicKey, err := util.GenerateSshKeyPairWithType(r.KeyType, r.KeySize, passphrase, r.KeyId, format)
+	if err != nil {
+		return nil, err
+	}
+	r.PublicKeyData = string(publicKey)
+	return privateKey, nil
+}
+
 type TPPSshCertRequest struct {
 	CADN                      string                 `json:"CADN,omitempty"`
 	PolicyDN                  string                 `json:"PolicyDN,omitempty"`
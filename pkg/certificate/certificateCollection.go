@@ -174,7 +174,14 @@ func (col *PEMCollection) ToTLSCertificate() tls.Certificate {
 
 	switch b.Type {
 	case "EC PRIVATE KEY":
-		cert.PrivateKey, _ = x509.ParseECPrivateKey(b.Bytes)
+		var privKey interface{}
+		privKey, err := x509.ParseECPrivateKey(b.Bytes)
+		if err != nil {
+			privKey, _ = x509.ParsePKCS8PrivateKey(b.Bytes)
+		}
+		cert.PrivateKey = privKey
+	case "PRIVATE KEY":
+		cert.PrivateKey, _ = x509.ParsePKCS8PrivateKey(b.Bytes)
 	case "RSA PRIVATE KEY":
 		var privKey interface{}
 		privKey, err := x509.ParsePKCS1PrivateKey(b.Bytes)
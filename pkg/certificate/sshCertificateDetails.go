@@ -0,0 +1,82 @@
+package certificate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	SshCertificateTypeUser = "User"
+	SshCertificateTypeHost = "Host"
+
+	sshFingerprintPrefix       = "SHA256:"
+	sshCriticalOptionCommand   = "force-command"
+	sshCriticalOptionAddresses = "source-address"
+)
+
+// ParseSshCertificate parses an OpenSSH certificate in the authorized_keys format, as found in a -cert.pub file
+func ParseSshCertificate(certificateData string) (*ssh.Certificate, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certificateData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH certificate: %w", err)
+	}
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse SSH certificate: %s is a public key, not a certificate", pubKey.Type())
+	}
+	return cert, nil
+}
+
+// NewSshCertificateDetails returns the details of cert in the form returned by Venafi SSH certificate operations.
+// Fingerprints are base64 encoded SHA256 hashes without the "SHA256:" prefix and validity dates are in seconds
+func NewSshCertificateDetails(cert *ssh.Certificate) SshCertificateDetails {
+	details := SshCertificateDetails{
+		KeyType:                      cert.Key.Type(),
+		CertificateType:              SshCertificateTypeUser,
+		CertificateFingerprintSHA256: strings.TrimPrefix(ssh.FingerprintSHA256(cert), sshFingerprintPrefix),
+		CAFingerprintSHA256:          strings.TrimPrefix(ssh.FingerprintSHA256(cert.SignatureKey), sshFingerprintPrefix),
+		KeyID:                        cert.KeyId,
+		SerialNumber:                 strconv.FormatUint(cert.Serial, 10),
+		Principals:                   cert.ValidPrincipals,
+		ValidFrom:                    sshTimestamp(cert.ValidAfter),
+		ValidTo:                      sshTimestamp(cert.ValidBefore),
+		PublicKeyFingerprintSHA256:   strings.TrimPrefix(ssh.FingerprintSHA256(cert.Key), sshFingerprintPrefix),
+	}
+	if cert.CertType == ssh.HostCert {
+		details.CertificateType = SshCertificateTypeHost
+	}
+
+	details.ForceCommand = cert.CriticalOptions[sshCriticalOptionCommand]
+	if addresses := cert.CriticalOptions[sshCriticalOptionAddresses]; addresses != "" {
+		details.SourceAddresses = strings.Split(addresses, ",")
+	}
+
+	if len(cert.Extensions) > 0 {
+		details.Extensions = make(map[string]interface{}, len(cert.Extensions))
+		for name, value := range cert.Extensions {
+			details.Extensions[name] = value
+		}
+	}
+	return details
+}
+
+// ParseSshCertificateDetails parses an OpenSSH certificate and returns its details, see NewSshCertificateDetails
+func ParseSshCertificateDetails(certificateData string) (*SshCertificateDetails, error) {
+	cert, err := ParseSshCertificate(certificateData)
+	if err != nil {
+		return nil, err
+	}
+	details := NewSshCertificateDetails(cert)
+	return &details, nil
+}
+
+// sshTimestamp converts an OpenSSH validity bound to seconds, ssh.CertTimeInfinity being beyond what an int64 holds
+func sshTimestamp(t uint64) int64 {
+	if t > uint64(1<<63-1) {
+		return 1<<63 - 1
+	}
+	return int64(t)
+}
@@ -0,0 +1,67 @@
+package certificate
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseSshCertificateDetails(t *testing.T) {
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := ssh.NewPublicKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pubKey,
+		Serial:          7,
+		CertType:        ssh.HostCert,
+		KeyId:           "web01",
+		ValidPrincipals: []string{"web01.example.com"},
+		ValidAfter:      1700000000,
+		ValidBefore:     ssh.CertTimeInfinity,
+		Permissions: ssh.Permissions{
+			CriticalOptions: map[string]string{"source-address": "10.0.0.1,10.0.0.2"},
+		},
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := ParseSshCertificateDetails(string(ssh.MarshalAuthorizedKey(cert)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.CertificateType != SshCertificateTypeHost || details.KeyID != "web01" || details.SerialNumber != "7" {
+		t.Fatalf("unexpected details %+v", details)
+	}
+	if details.ValidFrom != 1700000000 || details.ValidTo <= details.ValidFrom {
+		t.Fatalf("unexpected validity %d - %d", details.ValidFrom, details.ValidTo)
+	}
+	if strings.Join(details.SourceAddresses, " ") != "10.0.0.1 10.0.0.2" || details.ForceCommand != "" {
+		t.Fatalf("unexpected critical options %+v", details)
+	}
+	if details.PublicKeyFingerprintSHA256 != strings.TrimPrefix(ssh.FingerprintSHA256(pubKey), "SHA256:") {
+		t.Fatalf("unexpected public key fingerprint %s", details.PublicKeyFingerprintSHA256)
+	}
+
+	_, err = ParseSshCertificateDetails(string(ssh.MarshalAuthorizedKey(pubKey)))
+	if err == nil {
+		t.Fatal("expected an error parsing a public key")
+	}
+}
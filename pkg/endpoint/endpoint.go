@@ -17,6 +17,7 @@
 package endpoint
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rsa"
@@ -147,6 +148,47 @@ type Connector interface {
 	SetUserAgent(userAgent string)
 }
 
+// ConnectorContext is a Connector whose operations take a context.Context as first argument. The context is used for
+// every HTTP request made to the server and for the polling loops waiting for a certificate to be issued, so callers
+// can cancel in-flight operations and propagate deadlines. req.Timeout still applies when it is shorter.
+//
+// All the connectors returned by vcert.NewClient implement it:
+//
+//	if cc, ok := connector.(endpoint.ConnectorContext); ok {
+//		pcc, err = cc.RetrieveCertificateContext(ctx, req)
+//	}
+type ConnectorContext interface {
+	Connector
+	AuthenticateContext(ctx context.Context, auth *Authentication) error
+	PingContext(ctx context.Context) error
+	ReadPolicyConfigurationContext(ctx context.Context) (*Policy, error)
+	ReadZoneConfigurationContext(ctx context.Context) (*ZoneConfiguration, error)
+	GetZonesByParentContext(ctx context.Context, parent string) ([]string, error)
+	GenerateRequestContext(ctx context.Context, config *ZoneConfiguration, req *certificate.Request) error
+	ResetCertificateContext(ctx context.Context, req *certificate.Request, restart bool) error
+	RequestCertificateContext(ctx context.Context, req *certificate.Request) (string, error)
+	RetrieveCertificateContext(ctx context.Context, req *certificate.Request) (*certificate.PEMCollection, error)
+	SynchronousRequestCertificateContext(ctx context.Context, req *certificate.Request) (*certificate.PEMCollection, error)
+	ProvisionCertificateContext(ctx context.Context, req *domain.ProvisioningRequest, options *domain.ProvisioningOptions) (*domain.ProvisioningMetadata, error)
+	IsCSRServiceGeneratedContext(ctx context.Context, req *certificate.Request) (bool, error)
+	RevokeCertificateContext(ctx context.Context, req *certificate.RevocationRequest) error
+	RenewCertificateContext(ctx context.Context, req *certificate.RenewalRequest) (string, error)
+	RetireCertificateContext(ctx context.Context, req *certificate.RetireRequest) error
+	ImportCertificateContext(ctx context.Context, req *certificate.ImportRequest) (*certificate.ImportResponse, error)
+	ListCertificatesContext(ctx context.Context, filter Filter) ([]certificate.CertificateInfo, error)
+	SearchCertificatesContext(ctx context.Context, req *certificate.SearchRequest) (*certificate.CertSearchResponse, error)
+	SearchCertificateContext(ctx context.Context, zone string, cn string, sans *certificate.Sans, certMinTimeLeft time.Duration) (*certificate.CertificateInfo, error)
+	RetrieveCertificateMetaDataContext(ctx context.Context, dn string) (*certificate.CertificateMetaData, error)
+	SetPolicyContext(ctx context.Context, name string, ps *policy.PolicySpecification) (string, error)
+	GetPolicyContext(ctx context.Context, name string) (*policy.PolicySpecification, error)
+	RequestSSHCertificateContext(ctx context.Context, req *certificate.SshCertRequest) (*certificate.SshCertificateObject, error)
+	RetrieveSSHCertificateContext(ctx context.Context, req *certificate.SshCertRequest) (*certificate.SshCertificateObject, error)
+	RetrieveSshConfigContext(ctx context.Context, ca *certificate.SshCaTemplateRequest) (*certificate.SshConfig, error)
+	RetrieveAvailableSSHTemplatesContext(ctx context.Context) ([]certificate.SshAvaliableTemplate, error)
+	RetrieveSystemVersionContext(ctx context.Context) (string, error)
+	WriteLogContext(ctx context.Context, req *LogRequest) error
+}
+
 type Filter struct {
 	Limit       *int
 	WithExpired bool
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Venafi/vcert/v5/pkg/metrics"
+)
+
+// idSegment matches the path segments identifying a resource (UUIDs, numbers, escaped DNs, pickup IDs), which are
+// replaced in the endpoint label so every resource doesn't get its own metric series
+var idSegment = regexp.MustCompile(`^[0-9a-fA-F-]{8,}$|^[0-9]+$|[%\\{]`)
+
+// endpointLabel returns the path of u with the resource identifiers replaced by ":id"
+func endpointLabel(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		if idSegment.MatchString(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// recordAttempt counts an attempt of a request, by the status code of its response or "error" if it failed
+func recordAttempt(method string, endpoint string, res *http.Response, err error) {
+	code := "error"
+	if err == nil && res != nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+	metrics.ConnectorRequests.Inc(method, endpoint, code)
+}
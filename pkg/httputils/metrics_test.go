@@ -0,0 +1,72 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Venafi/vcert/v5/pkg/metrics"
+)
+
+func TestEndpointLabel(t *testing.T) {
+	cases := map[string]string{
+		"https://tpp.example.com/vedsdk/certificates/request":                                                    "/vedsdk/certificates/request",
+		"https://api.venafi.cloud/outagedetection/v1/certificates/3fa85f64-5717-4562-b3fc-2c963f66afa6/contents": "/outagedetection/v1/certificates/:id/contents",
+		"https://tpp.example.com/vedsdk/certificates/%5CVED%5CPolicy%5Ccert":                                     "/vedsdk/certificates/:id",
+		"https://api.venafi.cloud/v1/certificaterequests/42?x=y":                                                 "/v1/certificaterequests/:id",
+	}
+	for raw, expected := range cases {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if label := endpointLabel(u); label != expected {
+			t.Errorf("%s: expected endpoint %q, got %q", raw, expected, label)
+		}
+	}
+}
+
+func TestDo_Metrics(t *testing.T) {
+	srv, _ := failingServer(t, 2, http.StatusServiceUnavailable, nil)
+	const endpoint = "/metrics/test"
+	before503 := metrics.ConnectorRequests.Value(http.MethodGet, endpoint, "503")
+	before200 := metrics.ConnectorRequests.Value(http.MethodGet, endpoint, "200")
+	beforeRetries := metrics.ConnectorRetries.Value(http.MethodGet, endpoint)
+	beforeObservations := metrics.ConnectorRequestDuration.Count(http.MethodGet, endpoint)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+endpoint, nil)
+	res, err := Do(srv.Client(), req, true, testPolicy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+
+	if v := metrics.ConnectorRequests.Value(http.MethodGet, endpoint, "503") - before503; v != 2 {
+		t.Errorf("expected 2 requests answered 503, got %v", v)
+	}
+	if v := metrics.ConnectorRequests.Value(http.MethodGet, endpoint, "200") - before200; v != 1 {
+		t.Errorf("expected 1 request answered 200, got %v", v)
+	}
+	if v := metrics.ConnectorRetries.Value(http.MethodGet, endpoint) - beforeRetries; v != 2 {
+		t.Errorf("expected 2 retries, got %v", v)
+	}
+	if v := metrics.ConnectorRequestDuration.Count(http.MethodGet, endpoint) - beforeObservations; v != 1 {
+		t.Errorf("expected 1 latency observation, got %v", v)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+// RateLimiter is a token bucket limiting the number of requests sent to a Venafi platform. The bucket holds up to
+// burst tokens and is refilled at a steady rate; every request takes one token, waiting for it if the bucket is empty.
+//
+// A RateLimiter is safe for concurrent use and can be shared by several connectors talking to the same platform.
+// A nil *RateLimiter doesn't limit anything.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing requestsPerSecond requests on average, and bursts of up to burst
+// requests. burst is raised to 1 if lower. It returns nil (no limit) when requestsPerSecond is not positive.
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   requestsPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done, in which case it returns the context error
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	delay := l.reserve(time.Now())
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	err := util.SleepContext(ctx, delay)
+	if err != nil {
+		// give the token back, it was never used
+		l.mu.Lock()
+		l.tokens = min(l.tokens+1, l.burst)
+		l.mu.Unlock()
+	}
+	return err
+}
+
+// reserve takes a token and returns how long the caller must wait before using it. The bucket may go negative, which
+// queues concurrent callers one after the other.
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = min(l.tokens+elapsed.Seconds()*l.rate, l.burst)
+		l.last = now
+	}
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
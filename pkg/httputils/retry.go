@@ -0,0 +1,237 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Venafi/vcert/v5/pkg/metrics"
+	"github.com/Venafi/vcert/v5/pkg/tracing"
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+const (
+	// DefaultInitialBackoff is the delay before the first retry when RetryPolicy.InitialBackoff is not set
+	DefaultInitialBackoff = time.Second
+	// DefaultMaxBackoff is the longest delay between two attempts when RetryPolicy.MaxBackoff is not set
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// RetryPolicy controls how requests to the Venafi platforms are retried when they fail with a transient error:
+// a network error or one of the RetryableStatusCodes.
+//
+// The delay between attempts grows exponentially from InitialBackoff up to MaxBackoff, with random jitter. When the
+// server answers with a Retry-After header, that delay is used instead (still capped by MaxBackoff).
+//
+// Requests that are not idempotent (like certificate enrollments) are only retried when the server can't have
+// processed them: the connection could not be established or the server answered 429 Too Many Requests. This
+// prevents a retry from issuing the same certificate twice.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt. Zero disables retries
+	MaxRetries int `yaml:"maxRetries,omitempty"`
+	// InitialBackoff is the delay before the first retry. Defaults to DefaultInitialBackoff
+	InitialBackoff time.Duration `yaml:"initialBackoff,omitempty"`
+	// MaxBackoff caps the delay between two attempts. Defaults to DefaultMaxBackoff
+	MaxBackoff time.Duration `yaml:"maxBackoff,omitempty"`
+	// RetryableStatusCodes are the HTTP statuses considered transient. Defaults to 429, 502, 503 and 504
+	RetryableStatusCodes []int `yaml:"retryableStatusCodes,omitempty"`
+}
+
+var defaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Do sends req with client and returns its response, retrying according to policy and waiting on limiter before
+// every attempt. Both policy and limiter may be nil.
+//
+// idempotent tells whether the request can safely be sent more than once. Methods like GET always are, but some
+// platforms use POST for read-only operations, so the caller makes the decision.
+//
+// Do honors the context of req: it stops waiting and returns the context error as soon as it is done.
+//
+// Every call is recorded in the connector metrics and, when tracing is enabled, in a client span propagated to the
+// server with the traceparent header.
+func Do(client *http.Client, req *http.Request, idempotent bool, policy *RetryPolicy, limiter *RateLimiter) (*http.Response, error) {
+	method, endpoint := req.Method, endpointLabel(req.URL)
+	start := time.Now()
+
+	ctx, span := tracing.StartKind(req.Context(), tracing.SpanKindClient, "HTTP "+method,
+		tracing.String("http.request.method", method),
+		tracing.String("server.address", req.URL.Host),
+		tracing.String("url.path", endpoint))
+	if span != nil {
+		// the header of the caller's request is left untouched
+		req = req.WithContext(ctx)
+		req.Header = req.Header.Clone()
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		tracing.Inject(ctx, req.Header)
+	}
+
+	res, retries, err := do(client, req, idempotent, policy, limiter, method, endpoint)
+
+	metrics.ConnectorRequestDuration.Observe(time.Since(start).Seconds(), method, endpoint)
+	span.SetAttributes(tracing.Int("http.request.resend_count", retries))
+	if res != nil {
+		span.SetAttributes(tracing.Int("http.response.status_code", res.StatusCode))
+		if res.StatusCode >= http.StatusBadRequest {
+			span.RecordError(errors.New(res.Status))
+		}
+	}
+	span.Finish(err)
+	return res, err
+}
+
+// do implements Do and returns the number of retries
+func do(client *http.Client, req *http.Request, idempotent bool, policy *RetryPolicy, limiter *RateLimiter, method string, endpoint string) (*http.Response, int, error) {
+	ctx := req.Context()
+	attemptReq := req
+	for attempt := 0; ; attempt++ {
+		err := limiter.Wait(ctx)
+		if err != nil {
+			return nil, attempt, err
+		}
+		if attempt > 0 {
+			attemptReq, err = rewind(req)
+			if err != nil {
+				return nil, attempt, err
+			}
+		}
+
+		res, err := client.Do(attemptReq)
+		recordAttempt(method, endpoint, res, err)
+		if policy == nil || attempt >= policy.MaxRetries || !policy.shouldRetry(res, err, idempotent) {
+			return res, attempt, err
+		}
+		if attempt == 0 && req.Body != nil && req.GetBody == nil {
+			// the body was consumed and can't be sent again
+			return res, attempt, err
+		}
+
+		delay := policy.backoff(attempt, res)
+		if res != nil {
+			// drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+			_ = res.Body.Close()
+		}
+		err = util.SleepContext(ctx, delay)
+		if err != nil {
+			return nil, attempt, err
+		}
+		metrics.ConnectorRetries.Inc(method, endpoint)
+	}
+}
+
+// rewind returns a copy of req with a fresh body, ready to be sent again
+func rewind(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+func (p *RetryPolicy) shouldRetry(res *http.Response, err error, idempotent bool) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		return idempotent || isDialError(err)
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return p.isRetryableStatus(res.StatusCode)
+	}
+	return idempotent && p.isRetryableStatus(res.StatusCode)
+}
+
+func (p *RetryPolicy) isRetryableStatus(code int) bool {
+	codes := p.RetryableStatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryableStatusCodes
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the attempt following attempt (0 based)
+func (p *RetryPolicy) backoff(attempt int, res *http.Response) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	if res != nil {
+		if d, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+			return min(d, maxBackoff)
+		}
+	}
+
+	d := initial
+	for i := 0; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+	// pick a random delay between d/2 and d, so concurrent clients don't retry in lockstep
+	// nolint:gosec // jitter doesn't need a cryptographic random source
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either delay-seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// isDialError tells whether err happened while establishing the connection, before anything was sent to the server
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testPolicy = &RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     10 * time.Millisecond,
+}
+
+// failingServer answers status to the first failures requests and 200 to the following ones
+func failingServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodPost && string(body) != "payload" {
+			t.Errorf("unexpected body %q on attempt %d", body, calls.Load()+1)
+		}
+		if calls.Add(1) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestDo_RetriesIdempotentRequests(t *testing.T) {
+	srv, calls := failingServer(t, 2, http.StatusServiceUnavailable, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	res, err := Do(srv.Client(), req, true, testPolicy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.StatusCode)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls.Load())
+	}
+}
+
+func TestDo_MaxRetries(t *testing.T) {
+	srv, calls := failingServer(t, 10, http.StatusBadGateway, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	res, err := Do(srv.Client(), req, true, testPolicy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected status 502, got %d", res.StatusCode)
+	}
+	if calls.Load() != 4 {
+		t.Fatalf("expected 4 calls, got %d", calls.Load())
+	}
+}
+
+func TestDo_NilPolicy(t *testing.T) {
+	srv, calls := failingServer(t, 1, http.StatusServiceUnavailable, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	res, err := Do(srv.Client(), req, true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Fatalf("expected a single failed call, got status %d after %d calls", res.StatusCode, calls.Load())
+	}
+}
+
+func TestDo_NonIdempotentRequests(t *testing.T) {
+	t.Run("ServerError", func(t *testing.T) {
+		// the server may have processed the enrollment, it must not be sent again
+		srv, calls := failingServer(t, 1, http.StatusServiceUnavailable, nil)
+
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader([]byte("payload")))
+		res, err := Do(srv.Client(), req, false, testPolicy, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+			t.Fatalf("expected a single failed call, got status %d after %d calls", res.StatusCode, calls.Load())
+		}
+	})
+	t.Run("TooManyRequests", func(t *testing.T) {
+		srv, calls := failingServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}})
+
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader([]byte("payload")))
+		res, err := Do(srv.Client(), req, false, testPolicy, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK || calls.Load() != 2 {
+			t.Fatalf("expected a successful retry, got status %d after %d calls", res.StatusCode, calls.Load())
+		}
+	})
+	t.Run("ConnectionRefused", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := l.Addr().String()
+		_ = l.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, "http://"+addr, bytes.NewReader([]byte("payload")))
+		_, err = Do(http.DefaultClient, req, false, testPolicy, nil)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if !isDialError(err) {
+			t.Fatalf("expected a dial error, got %v", err)
+		}
+	})
+}
+
+func TestDo_ContextCanceled(t *testing.T) {
+	srv, calls := failingServer(t, 10, http.StatusServiceUnavailable, http.Header{"Retry-After": {"60"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	policy := &RetryPolicy{MaxRetries: 5, MaxBackoff: time.Minute}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	_, err := Do(srv.Client(), req, true, policy, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected 1 call, got %d", calls.Load())
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		expected *= time.Millisecond
+		d := p.backoff(attempt, nil)
+		if d < expected/2 || d > expected {
+			t.Errorf("attempt %d: expected a delay between %s and %s, got %s", attempt, expected/2, expected, d)
+		}
+	}
+
+	res := &http.Response{Header: http.Header{"Retry-After": {"120"}}}
+	if d := p.backoff(0, res); d != time.Second {
+		t.Errorf("expected Retry-After to be capped to MaxBackoff, got %s", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 31 Dec 2023 23:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, c := range cases {
+		d, ok := parseRetryAfter(c.value, now)
+		if d != c.expected || ok != c.ok {
+			t.Errorf("%q: expected (%s, %v), got (%s, %v)", c.value, c.expected, c.ok, d, ok)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(100, 2)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		err := l.Wait(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 requests of burst, then 4 more at 100 per second
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatalf("expected requests to be limited, took %s", elapsed)
+	}
+
+	if NewRateLimiter(0, 10) != nil {
+		t.Fatal("expected no limiter when rate is zero")
+	}
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimiter_ContextCanceled(t *testing.T) {
+	l := NewRateLimiter(0.1, 1)
+	err := l.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = l.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httputils
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v5/pkg/tracing"
+)
+
+func TestDo_Tracing(t *testing.T) {
+	recorder := &tracing.Recorder{}
+	tracing.SetExporter(recorder)
+	defer tracing.SetExporter(nil)
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/vedsdk/certificates/42?secret=x", nil)
+	res, err := Do(srv.Client(), req, true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	parent.End()
+
+	span, ok := recorder.Find("HTTP GET")
+	if !ok {
+		t.Fatal("no span recorded for the request")
+	}
+	if span.Kind != tracing.SpanKindClient {
+		t.Errorf("expected a client span, got kind %d", span.Kind)
+	}
+	if path := span.Attribute("url.path"); path != "/vedsdk/certificates/:id" {
+		t.Errorf("expected the endpoint as url.path, got %v", path)
+	}
+	if code := span.Attribute("http.response.status_code"); code != int64(http.StatusNotFound) {
+		t.Errorf("expected status code 404, got %v", code)
+	}
+	if !span.Error {
+		t.Error("expected the span of a 404 response to be failed")
+	}
+	p, _ := recorder.Find("parent")
+	if span.ParentSpanID != p.SpanID {
+		t.Error("expected the request span to be a child of the span of the request context")
+	}
+
+	expected := "00-" + hex.EncodeToString(span.TraceID[:]) + "-" + hex.EncodeToString(span.SpanID[:]) + "-01"
+	if traceparent != expected {
+		t.Errorf("expected traceparent %q, got %q", expected, traceparent)
+	}
+	for _, a := range span.Attributes {
+		if s, ok := a.Value.(string); ok && strings.Contains(s, "secret") {
+			t.Errorf("attribute %s holds the query string: %s", a.Key, s)
+		}
+	}
+}
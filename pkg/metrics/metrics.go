@@ -0,0 +1,371 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics collects the metrics of vcert and exposes them in the Prometheus text format, either on an HTTP
+// endpoint or in a file read by the node exporter textfile collector.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+
+	// labelSeparator joins label values into the key of a series. It can't be part of a valid UTF-8 label value
+	labelSeparator = "\xff"
+)
+
+// DefaultBuckets are the histogram buckets used when none are given, in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// Registry holds metrics and writes them in the Prometheus text format. It is safe for concurrent use
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// family is a metric with all its series, one per combination of label values
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	valueFunc   func() float64
+	// histograms only
+	counts []uint64
+	count  uint64
+}
+
+func (r *Registry) register(name string, help string, typ string, labels []string, buckets []float64) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.families {
+		if existing.name == name {
+			panic(fmt.Sprintf("metric %s registered twice", name))
+		}
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series of labelValues, creating it if needed. The family lock must be held
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, labelSeparator)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.typ == typeHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	f *family
+}
+
+// NewCounterVec registers a counter with the given label names
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{f: r.register(name, help, typeCounter, labels, nil)}
+}
+
+// Inc adds one to the counter of labelValues
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter of labelValues
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s can't decrease", c.f.name))
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.get(labelValues).value += v
+}
+
+// Value returns the current value of the counter of labelValues
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	return c.f.value(labelValues)
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	f *family
+}
+
+// NewGaugeVec registers a gauge with the given label names
+func (r *Registry) NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{f: r.register(name, help, typeGauge, labels, nil)}
+}
+
+// Set sets the gauge of labelValues to v
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	s := g.f.get(labelValues)
+	s.value = v
+	s.valueFunc = nil
+}
+
+// SetFunc makes the gauge of labelValues report the result of fn every time the metrics are written. It is meant for
+// values changing with time, like the seconds left before a certificate expires.
+func (g *GaugeVec) SetFunc(fn func() float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.get(labelValues).valueFunc = fn
+}
+
+// Value returns the current value of the gauge of labelValues
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	return g.f.value(labelValues)
+}
+
+// Reset removes all the series of the gauge
+func (g *GaugeVec) Reset() {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.series = make(map[string]*series)
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	f *family
+}
+
+// NewHistogramVec registers a histogram with the given buckets, DefaultBuckets if nil, and label names
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{f: r.register(name, help, typeHistogram, labels, buckets)}
+}
+
+// Observe adds v to the histogram of labelValues
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.get(labelValues)
+	s.value += v
+	s.count++
+	for i, bound := range h.f.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+}
+
+// Count returns the number of observations of the histogram of labelValues
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s, ok := h.f.series[strings.Join(labelValues, labelSeparator)]
+	if !ok {
+		return 0
+	}
+	return s.count
+}
+
+func (f *family) value(labelValues []string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[strings.Join(labelValues, labelSeparator)]
+	if !ok {
+		return 0
+	}
+	if s.valueFunc != nil {
+		return s.valueFunc()
+	}
+	return s.value
+}
+
+// WriteText writes all the metrics of the registry to w in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.series) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		labels := formatLabels(f.labels, s.labelValues, "", "")
+		if f.typ != typeHistogram {
+			v := s.value
+			if s.valueFunc != nil {
+				v = s.valueFunc()
+			}
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labels, formatValue(v))
+			continue
+		}
+
+		for i, bound := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name,
+				formatLabels(f.labels, s.labelValues, "le", formatValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labels, formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, labels, s.count)
+	}
+}
+
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	b := strings.Builder{}
+	b.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabelValue(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, extraValue)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// Handler returns an HTTP handler serving the metrics of the registry, for a Prometheus server to scrape
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+// WriteTextfile writes the metrics of the registry to file, for the node exporter textfile collector. The file is
+// replaced atomically, so the collector never reads a partial file.
+func (r *Registry) WriteTextfile(file string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	err = r.WriteText(tmp)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	// the collector runs as another user
+	err = os.Chmod(tmp.Name(), 0644) // #nosec G302
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
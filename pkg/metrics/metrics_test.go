@@ -0,0 +1,108 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.", "method", "code")
+	expiry := r.NewGaugeVec("test_expiry_seconds", "Expiry\nof certificates.", "location")
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency.", []float64{1, 0.1}, "method")
+	r.NewCounterVec("test_unused_total", "Never incremented.")
+
+	requests.Inc("GET", "200")
+	requests.Add(2, "GET", "200")
+	requests.Inc("POST", "503")
+	expiry.Set(10, `C:\certs\"a".pem`)
+	expiry.SetFunc(func() float64 { return 42 }, "/etc/ssl/b.pem")
+	latency.Observe(0.05, "GET")
+	latency.Observe(0.5, "GET")
+	latency.Observe(5, "GET")
+
+	buf := bytes.Buffer{}
+	require.NoError(t, r.WriteText(&buf))
+	expected := `# HELP test_expiry_seconds Expiry\nof certificates.
+# TYPE test_expiry_seconds gauge
+test_expiry_seconds{location="/etc/ssl/b.pem"} 42
+test_expiry_seconds{location="C:\\certs\\\"a\".pem"} 10
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{method="GET",le="0.1"} 1
+test_latency_seconds_bucket{method="GET",le="1"} 2
+test_latency_seconds_bucket{method="GET",le="+Inf"} 3
+test_latency_seconds_sum{method="GET"} 5.55
+test_latency_seconds_count{method="GET"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",code="200"} 3
+test_requests_total{method="POST",code="503"} 1
+`
+	assert.Equal(t, expected, buf.String())
+
+	assert.Equal(t, float64(3), requests.Value("GET", "200"))
+	assert.Equal(t, float64(42), expiry.Value("/etc/ssl/b.pem"))
+	assert.Equal(t, uint64(3), latency.Count("GET"))
+
+	expiry.Reset()
+	assert.Equal(t, float64(0), expiry.Value("/etc/ssl/b.pem"))
+
+	assert.Panics(t, func() { requests.Inc("GET") })
+	assert.Panics(t, func() { requests.Add(-1, "GET", "200") })
+	assert.Panics(t, func() { r.NewGaugeVec("test_requests_total", "Duplicate.") })
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeVec("test_gauge", "Gauge.").Set(1)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, string(body), "test_gauge 1\n")
+}
+
+func TestRegistry_WriteTextfile(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeVec("test_gauge", "Gauge.").Set(1)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "vcert.prom")
+
+	require.NoError(t, r.WriteTextfile(file))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "test_gauge 1\n")
+
+	// no temporary file is left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.Error(t, r.WriteTextfile(filepath.Join(dir, "missing", "vcert.prom")))
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+// Default is the registry holding the metrics of vcert
+var Default = NewRegistry()
+
+// Connector metrics, recorded for every HTTP request a connector sends to a Venafi platform
+var (
+	// ConnectorRequests counts the requests by method, endpoint and status code. The code is "error" when no response
+	// was received
+	ConnectorRequests = Default.NewCounterVec("vcert_connector_requests_total",
+		"Requests sent to the Venafi platform, by method, endpoint and HTTP status code.",
+		"method", "endpoint", "code")
+	// ConnectorRequestDuration observes the latency of the requests, including their retries
+	ConnectorRequestDuration = Default.NewHistogramVec("vcert_connector_request_duration_seconds",
+		"Latency of the requests sent to the Venafi platform, including retries.",
+		nil, "method", "endpoint")
+	// ConnectorRetries counts the retries of failed requests
+	ConnectorRetries = Default.NewCounterVec("vcert_connector_retries_total",
+		"Requests to the Venafi platform retried after a transient failure.",
+		"method", "endpoint")
+)
+
+// Playbook metrics, recorded for every run of playbook tasks
+var (
+	// PlaybookTasks counts the tasks run by status
+	PlaybookTasks = Default.NewCounterVec("vcert_playbook_tasks_total",
+		"Playbook certificate tasks run, by status.",
+		"status")
+	// PlaybookLastRun is the time the last run of playbook tasks finished
+	PlaybookLastRun = Default.NewGaugeVec("vcert_playbook_last_run_timestamp_seconds",
+		"Unix time the last run of playbook tasks finished.")
+	// PlaybookLastSuccess is the time the last run of playbook tasks without failed tasks finished
+	PlaybookLastSuccess = Default.NewGaugeVec("vcert_playbook_last_success_timestamp_seconds",
+		"Unix time the last run of playbook tasks without failures finished.")
+	// CertificateExpiry is the time left before the certificate installed by a task expires
+	CertificateExpiry = Default.NewGaugeVec("vcert_certificate_expiry_seconds",
+		"Seconds left before the installed certificate expires, by task, installation type and location.",
+		"task", "type", "location")
+)
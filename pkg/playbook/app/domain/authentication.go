@@ -37,12 +37,16 @@ const (
 	refreshToken = "refreshToken"
 	scope        = "scope"
 	tokenURL     = "tokenURL"
+	vault        = "vault"
 )
 
 // Authentication holds the credentials to connect to Venafi platforms: TPP and TLSPC
 type Authentication struct {
 	endpoint.Authentication `yaml:"-"`
 	P12Task                 string `yaml:"p12Task,omitempty"`
+	// Vault is the secret the credentials are read from. Its values are used for the credentials not set in the
+	// playbook, and the refreshed TPP tokens are written to it instead of the playbook file
+	Vault *VaultSecret `yaml:"vault,omitempty"`
 }
 
 // MarshalYAML customizes the behavior of Authentication when being marshaled into a YAML document.
@@ -87,6 +91,9 @@ func (a Authentication) MarshalYAML() (interface{}, error) {
 	if a.TokenURL != "" {
 		values[tokenURL] = a.TokenURL
 	}
+	if a.Vault != nil {
+		values[vault] = a.Vault
+	}
 
 	return values, nil
 }
@@ -135,6 +142,17 @@ func (a *Authentication) UnmarshalYAML(value *yaml.Node) error {
 		a.IdentityProvider = provider
 	}
 
+	if _, found := authMap[vault]; found {
+		var v struct {
+			Vault *VaultSecret `yaml:"vault"`
+		}
+		err = value.Decode(&v)
+		if err != nil {
+			return err
+		}
+		a.Vault = v.Vault
+	}
+
 	return nil
 }
 
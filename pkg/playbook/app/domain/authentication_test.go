@@ -125,3 +125,36 @@ func (s *AuthenticationSuite) TestAuthentication_UnmarshalIdentityProvider() {
 	s.Equal("some.token.url", playbook.Config.Connection.Credentials.IdentityProvider.TokenURL)
 	s.Equal("some audience", playbook.Config.Connection.Credentials.IdentityProvider.Audience)
 }
+
+func (s *AuthenticationSuite) TestAuthentication_Vault() {
+	data := `credentials:
+    refreshToken: abcdef
+    vault:
+        address: https://vault.example.com:8200
+        auth:
+            method: approle
+            roleId: role
+            secretId: secret
+        path: secret/vcert/tpp
+`
+	var connection Connection
+	err := yaml.Unmarshal([]byte(data), &connection)
+	s.NoError(err)
+	s.Equal("abcdef", connection.Credentials.RefreshToken)
+	s.NotNil(connection.Credentials.Vault)
+	s.Equal("https://vault.example.com:8200", connection.Credentials.Vault.Address)
+	s.Equal(VaultAuthAppRole, connection.Credentials.Vault.Auth.Method)
+	s.Equal("role", connection.Credentials.Vault.Auth.RoleID)
+	s.Equal("secret", connection.Credentials.Vault.Auth.SecretID)
+	s.Equal("secret/vcert/tpp", connection.Credentials.Vault.Path)
+
+	out, err := yaml.Marshal(connection)
+	s.NoError(err)
+	s.Equal(data, string(out))
+
+	connection.Platform = venafi.TPP
+	connection.URL = "https://tpp.example.com"
+	connection.Credentials.Vault.KVVersion = 3
+	_, err = connection.IsValid()
+	s.ErrorIs(err, ErrInvalidVaultKVVersion)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+const (
+	// DefaultBackupKeep is the number of generations of backups kept when BackupPolicy.Keep is not set
+	DefaultBackupKeep = 5
+	// BackupDirSuffix is appended to the file of an installation to name the directory of its backups
+	BackupDirSuffix = ".vcert-backup"
+)
+
+// BackupPolicy configures the generations of backups taken of the files of a PEM, JKS or PKCS12 installation
+type BackupPolicy struct {
+	// Dir is the directory the generations are kept in. Defaults to the file of the installation suffixed with
+	// .vcert-backup
+	Dir string `yaml:"dir,omitempty"`
+	// Keep is the number of generations kept. Defaults to DefaultBackupKeep
+	Keep int `yaml:"keep,omitempty"`
+	// MaxAge removes the generations older than it, in the format of renewBefore such as 90d or 12h. 0 or disabled keep
+	// them regardless of their age. The latest generation is always kept
+	MaxAge string `yaml:"maxAge,omitempty"`
+}
+
+// BackupDir returns the directory the generations of backups of the installation are kept in
+func (installation Installation) BackupDir() string {
+	if installation.BackupPolicy != nil && installation.BackupPolicy.Dir != "" {
+		return installation.BackupPolicy.Dir
+	}
+	return installation.File + BackupDirSuffix
+}
+
+// BackupKeep returns the number of generations of backups kept for the installation
+func (installation Installation) BackupKeep() int {
+	if installation.BackupPolicy != nil && installation.BackupPolicy.Keep > 0 {
+		return installation.BackupPolicy.Keep
+	}
+	return DefaultBackupKeep
+}
+
+// BackupMaxAge returns the age after which the generations of backups of the installation are removed. 0 means they
+// are kept regardless of their age
+func (installation Installation) BackupMaxAge() (time.Duration, error) {
+	if installation.BackupPolicy == nil || installation.BackupPolicy.MaxAge == "" {
+		return 0, nil
+	}
+	maxAge, err := util.ParseDuration(installation.BackupPolicy.MaxAge)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidBackupMaxAge, err)
+	}
+	if maxAge < 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidBackupMaxAge, installation.BackupPolicy.MaxAge)
+	}
+	return maxAge, nil
+}
+
+func (b BackupPolicy) validate() error {
+	if b.Keep < 0 {
+		return ErrInvalidBackupKeep
+	}
+	_, err := Installation{BackupPolicy: &b}.BackupMaxAge()
+	return err
+}
@@ -29,6 +29,11 @@ type CertificateTask struct {
 	Installations Installations   `yaml:"installations,omitempty"`
 	RenewBefore   string          `yaml:"renewBefore,omitempty"`
 	SetEnvVars    []string        `yaml:"setEnvVars,omitempty"`
+	// Transactional installs the certificate in all the installations or in none of them. Every location is backed
+	// up first, and restored if an installation, an after-install action or a validation fails
+	Transactional bool `yaml:"transactional,omitempty"`
+	// Vars are the variables of the task templates, e.g. {{ .Vars.service }}
+	Vars map[string]string `yaml:"vars,omitempty"`
 }
 
 // CertificateTasks is a slice of CertificateTask
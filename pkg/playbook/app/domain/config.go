@@ -18,11 +18,16 @@ package domain
 
 // Config contains all the values necessary to connect to a given Venafi platform: TPP or TLSPC
 type Config struct {
-	Connection Connection `yaml:"connection,omitempty"`
-	ForceRenew bool       `yaml:"-"`
+	// Concurrency is the maximum number of certificate tasks run at the same time. Defaults to 1
+	Concurrency int        `yaml:"concurrency,omitempty"`
+	Connection  Connection `yaml:"connection,omitempty"`
+	ForceRenew  bool       `yaml:"-"`
 }
 
 // IsValid Ensures the provided connection configuration is valid and logical
 func (c Config) IsValid() (bool, error) {
+	if c.Concurrency < 0 {
+		return false, ErrInvalidConcurrency
+	}
 	return c.Connection.IsValid()
 }
@@ -22,17 +22,28 @@ import (
 	"os"
 
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 	"github.com/Venafi/vcert/v5/pkg/venafi"
 )
 
 // Connection represents the issuer that vCert will connect to
 // in order to issue certificates
 type Connection struct {
-	Credentials     Authentication  `yaml:"credentials,omitempty"`
-	Insecure        bool            `yaml:"insecure,omitempty"`
-	Platform        venafi.Platform `yaml:"platform,omitempty"`
-	TrustBundlePath string          `yaml:"trustBundle,omitempty"`
-	URL             string          `yaml:"url,omitempty"`
+	Credentials     Authentication         `yaml:"credentials,omitempty"`
+	Insecure        bool                   `yaml:"insecure,omitempty"`
+	Platform        venafi.Platform        `yaml:"platform,omitempty"`
+	RateLimit       *RateLimit             `yaml:"rateLimit,omitempty"`
+	Retry           *httputils.RetryPolicy `yaml:"retry,omitempty"`
+	TrustBundlePath string                 `yaml:"trustBundle,omitempty"`
+	URL             string                 `yaml:"url,omitempty"`
+}
+
+// RateLimit limits the number of requests sent to the platform. All the tasks of a playbook share the same limit
+type RateLimit struct {
+	// Burst is the number of requests that can be sent at once before being limited. Defaults to 1
+	Burst int `yaml:"burst,omitempty"`
+	// RequestsPerSecond is the average number of requests allowed per second. Zero means no limit
+	RequestsPerSecond float64 `yaml:"requestsPerSecond,omitempty"`
 }
 
 // GetConnectorType returns the type of vcert Connector this config will create
@@ -60,9 +71,30 @@ func (c Connection) validateTrustBundle() error {
 	return nil
 }
 
+func (c Connection) validateRequestPolicies() error {
+	if c.Retry != nil && (c.Retry.MaxRetries < 0 || c.Retry.InitialBackoff < 0 || c.Retry.MaxBackoff < 0) {
+		return ErrInvalidRetryPolicy
+	}
+	if c.RateLimit != nil && (c.RateLimit.RequestsPerSecond < 0 || c.RateLimit.Burst < 0) {
+		return ErrInvalidRateLimit
+	}
+	return nil
+}
+
 // IsValid returns true if the Connection is supported by vcert
 // and has the necessary values to connect to the given platform
 func (c Connection) IsValid() (bool, error) {
+	err := c.validateRequestPolicies()
+	if err != nil {
+		return false, err
+	}
+	if c.Credentials.Vault != nil {
+		err = c.Credentials.Vault.validate()
+		if err != nil {
+			return false, err
+		}
+	}
+
 	switch c.Platform {
 	case venafi.TPP:
 		return isValidTpp(c)
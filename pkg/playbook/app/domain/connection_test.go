@@ -19,11 +19,13 @@ package domain
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/Venafi/vcert/v5/pkg/venafi"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 )
 
 type ConnectionSuite struct {
@@ -231,6 +233,51 @@ func (s *ConnectionSuite) SetupTest() {
 			expectedValid: false,
 			expectedErr:   ErrNoCredentials,
 		},
+		{
+			name: "VaaS_valid_retry_rate_limit",
+			c: Connection{
+				Platform: venafi.TLSPCloud,
+				Credentials: Authentication{
+					Authentication: endpoint.Authentication{
+						APIKey: "xxx-XXX-xxx",
+					},
+				},
+				Retry:     &httputils.RetryPolicy{MaxRetries: 3, InitialBackoff: time.Second},
+				RateLimit: &RateLimit{RequestsPerSecond: 5, Burst: 10},
+			},
+			expectedCType: endpoint.ConnectorTypeCloud,
+			expectedValid: true,
+		},
+		{
+			name: "VaaS_invalid_retry",
+			c: Connection{
+				Platform: venafi.TLSPCloud,
+				Credentials: Authentication{
+					Authentication: endpoint.Authentication{
+						APIKey: "xxx-XXX-xxx",
+					},
+				},
+				Retry: &httputils.RetryPolicy{MaxRetries: -1},
+			},
+			expectedCType: endpoint.ConnectorTypeCloud,
+			expectedValid: false,
+			expectedErr:   ErrInvalidRetryPolicy,
+		},
+		{
+			name: "VaaS_invalid_rate_limit",
+			c: Connection{
+				Platform: venafi.TLSPCloud,
+				Credentials: Authentication{
+					Authentication: endpoint.Authentication{
+						APIKey: "xxx-XXX-xxx",
+					},
+				},
+				RateLimit: &RateLimit{RequestsPerSecond: -5},
+			},
+			expectedCType: endpoint.ConnectorTypeCloud,
+			expectedValid: false,
+			expectedErr:   ErrInvalidRateLimit,
+		},
 		// UNKNOWN USE CASES
 		{
 			name: "Unknown_invalid",
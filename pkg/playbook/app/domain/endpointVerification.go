@@ -0,0 +1,70 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package domain
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	// DefaultEndpointPeriod is how long an endpoint is retried when EndpointVerification.Period is not set
+	DefaultEndpointPeriod = time.Minute
+	// DefaultEndpointInterval is the time between two connections to an endpoint when EndpointVerification.Interval
+	// is not set
+	DefaultEndpointInterval = 2 * time.Second
+)
+
+// EndpointVerification is a TLS endpoint expected to serve the certificate once it is installed, e.g. the server
+// reloaded by the after-install action
+type EndpointVerification struct {
+	// Address is the host:port of the endpoint
+	Address string `yaml:"address,omitempty"`
+	// ServerName is sent as SNI. Defaults to the host of Address
+	ServerName string `yaml:"serverName,omitempty"`
+	// Period is how long the endpoint is retried until it serves the certificate. Defaults to DefaultEndpointPeriod
+	Period time.Duration `yaml:"period,omitempty"`
+	// Interval is the time between two connections to the endpoint. Defaults to DefaultEndpointInterval
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// RetryPeriod returns how long the endpoint is retried
+func (e EndpointVerification) RetryPeriod() time.Duration {
+	if e.Period == 0 {
+		return DefaultEndpointPeriod
+	}
+	return e.Period
+}
+
+// RetryInterval returns the time between two connections to the endpoint
+func (e EndpointVerification) RetryInterval() time.Duration {
+	if e.Interval == 0 {
+		return DefaultEndpointInterval
+	}
+	return e.Interval
+}
+
+func (e EndpointVerification) validate() error {
+	host, port, err := net.SplitHostPort(e.Address)
+	if err != nil || host == "" || port == "" {
+		return ErrInvalidEndpointAddress
+	}
+	if e.Period < 0 || e.Interval < 0 {
+		return ErrInvalidEndpointOptions
+	}
+	return nil
+}
@@ -21,7 +21,7 @@ import "fmt"
 var (
 	// ErrNoConfig is thrown when the Playbook has no config section
 	ErrNoConfig = fmt.Errorf("no config found on playbook")
-	// ErrNoTasks is thrown when the Playbook has no certificateTasks section
+	// ErrNoTasks is thrown when the Playbook has neither a certificateTasks nor an sshCertificateTasks section
 	ErrNoTasks = fmt.Errorf("no certificate tasks found on playbook")
 	// ErrNoInstallations is thrown when any task (item in Certificates section) has no installations defined
 	ErrNoInstallations = fmt.Errorf("no installations found on certificate task")
@@ -31,6 +31,20 @@ var (
 	// ErrNoRequestCN si thrown when a certificate request does not contain subject.CommonName
 	ErrNoRequestCN = fmt.Errorf("request.subject.commonName is required and was not found")
 
+	// ErrNoSshTemplate is thrown when an SSH certificate request is specified without a template
+	ErrNoSshTemplate = fmt.Errorf("request.template is required and was not found")
+	// ErrNoSshKeyFile is thrown when an SSH certificate task has no keyFile
+	ErrNoSshKeyFile = fmt.Errorf("keyFile is required and was not found")
+	// ErrSshKeyFileIsPublic is thrown when the keyFile of an SSH certificate task is a public key file
+	ErrSshKeyFileIsPublic = fmt.Errorf("keyFile must be the private key file, its public key is read from keyFile.pub")
+	// ErrInvalidSshKeyType is thrown when an SSH certificate task generates a key of an unsupported request.keyType
+	ErrInvalidSshKeyType = fmt.Errorf("request.keyType must be rsa, ecdsa or ed25519 when generateKey is set")
+	// ErrInvalidSshTimeout is thrown when request.timeout of an SSH certificate task is negative
+	ErrInvalidSshTimeout = fmt.Errorf("request.timeout must not be negative")
+
+	// ErrInvalidConcurrency is thrown when config.concurrency is negative
+	ErrInvalidConcurrency = fmt.Errorf("concurrency must not be negative")
+
 	// ErrNoCredentials is thrown when the Playbook has no config section
 	ErrNoCredentials = fmt.Errorf("no credentials defined on playbook")
 	// ErrMultipleCredentials is thrown when the config.credentials section has both apikey and accessToken declared
@@ -39,6 +53,10 @@ var (
 	ErrNoTPPURL = fmt.Errorf("no url defined. TPP platform requires an url to the TPP instance")
 	// ErrTrustBundleNotExist is thrown when config.trustBundle is set but the path does not exist or cannot be read
 	ErrTrustBundleNotExist = fmt.Errorf("trustBundle path does not exist")
+	// ErrInvalidRetryPolicy is thrown when config.connection.retry has negative values
+	ErrInvalidRetryPolicy = fmt.Errorf("retry maxRetries, initialBackoff and maxBackoff must not be negative")
+	// ErrInvalidRateLimit is thrown when config.connection.rateLimit has negative values
+	ErrInvalidRateLimit = fmt.Errorf("rateLimit requestsPerSecond and burst must not be negative")
 
 	// ErrNoJKSAlias is thrown when certificates.installations[].type is JKS but no jksAlias is set
 	ErrNoJKSAlias = fmt.Errorf("jksAlias should not be empty when installing a certificate in JKS format")
@@ -57,6 +75,43 @@ var (
 	// ErrNoKeyFile is thrown when certificates.installations[].type is PEM but no pemKeyFilename is set
 	ErrNoKeyFile = fmt.Errorf("keyFile should not be empty when installing a certificate in PEM format")
 
+	// ErrInvalidPEMLayout is thrown when certificates.installations[].layout, or the layout of a bundle, is unknown
+	ErrInvalidPEMLayout = fmt.Errorf("invalid PEM layout. Should be certificate, fullchain, key+fullchain, chain or a comma separated list of certificate, chain and key")
+	// ErrNoPEMLayoutCertificate is thrown when certificates.installations[].layout doesn't contain the certificate
+	ErrNoPEMLayoutCertificate = fmt.Errorf("layout of the PEM file must contain the certificate. Use bundles for other layouts")
+	// ErrInvalidFileMode is thrown when certificates.installations[].fileMode is not an octal permission
+	ErrInvalidFileMode = fmt.Errorf("fileMode must be octal permissions such as 0640")
+	// ErrFileOwnerOnWindows is thrown when certificates.installations[].fileOwner or fileGroup is set on Windows
+	ErrFileOwnerOnWindows = fmt.Errorf("fileOwner and fileGroup are not supported on Windows")
+	// ErrInvalidBackupKeep is thrown when certificates.installations[].backupPolicy.keep is negative
+	ErrInvalidBackupKeep = fmt.Errorf("backupPolicy.keep must not be negative")
+	// ErrInvalidBackupMaxAge is thrown when certificates.installations[].backupPolicy.maxAge is not a duration
+	ErrInvalidBackupMaxAge = fmt.Errorf("backupPolicy.maxAge must be a number of days or hours such as 90d or 12h")
+
+	// ErrInvalidHookType is thrown when the type of a hook is unknown
+	ErrInvalidHookType = fmt.Errorf("hook type must be one of command, signal, systemd or webhook")
+	// ErrHookOnWindows is thrown when a signal or systemd hook is used on Windows
+	ErrHookOnWindows = fmt.Errorf("signal and systemd hooks are not supported on Windows")
+	// ErrInvalidHookOptions is thrown when the timeout, retries, retryDelay or exitCode of a hook is negative
+	ErrInvalidHookOptions = fmt.Errorf("hook timeout, retries, retryDelay and exitCode must not be negative")
+	// ErrNoHookCommand is thrown when a command hook has no command
+	ErrNoHookCommand = fmt.Errorf("command should not be empty in a command hook")
+	// ErrNoHookPIDFile is thrown when a signal hook has no pidFile
+	ErrNoHookPIDFile = fmt.Errorf("pidFile should not be empty in a signal hook")
+	// ErrInvalidHookSignal is thrown when the signal of a signal hook is not supported
+	ErrInvalidHookSignal = fmt.Errorf("signal must be one of HUP, INT, QUIT, TERM, USR1 or USR2")
+	// ErrNoHookUnit is thrown when a systemd hook has no unit
+	ErrNoHookUnit = fmt.Errorf("unit should not be empty in a systemd hook")
+	// ErrInvalidHookSystemdAction is thrown when the action of a systemd hook is not supported
+	ErrInvalidHookSystemdAction = fmt.Errorf("action must be one of reload, restart, try-restart, reload-or-restart or try-reload-or-restart")
+	// ErrInvalidHookURL is thrown when a webhook hook has no http or https url
+	ErrInvalidHookURL = fmt.Errorf("url must be an http or https URL in a webhook hook")
+
+	// ErrInvalidEndpointAddress is thrown when certificates.installations[].verifyEndpoint.address is not a host:port
+	ErrInvalidEndpointAddress = fmt.Errorf("verifyEndpoint.address must be a host:port")
+	// ErrInvalidEndpointOptions is thrown when the period or interval of verifyEndpoint is negative
+	ErrInvalidEndpointOptions = fmt.Errorf("verifyEndpoint period and interval must not be negative")
+
 	// ErrUndefinedInstallationFormat is thrown when certificates.installations[].type is unknown
 	ErrUndefinedInstallationFormat = fmt.Errorf("unknown installation format specified")
 	// ErrNoInstallationFile is thrown when certificates.installations[].File is not set
@@ -78,6 +133,18 @@ var (
 	WarningNoCAPIFriendlyName = "no capiFriendlyName defined. It is strongly recommended to define a " +
 		"capiFriendlyName for CAPI installation type. This will become required in a future release"
 
+	// ErrNoKubernetesSecretName is thrown when certificates.installations[].format is KUBERNETES but no kubernetes.name is set
+	ErrNoKubernetesSecretName = fmt.Errorf("kubernetes.name should not be empty when installing a certificate in KUBERNETES format")
+	// ErrKubernetesKeyPassword is thrown when certificates.installations[].format is KUBERNETES and a keyPassword is set
+	ErrKubernetesKeyPassword = fmt.Errorf("keyPassword is not supported in KUBERNETES format: the private key of a kubernetes.io/tls Secret can't be encrypted")
+
+	// ErrNoVaultPath is thrown when certificates.installations[].format is VAULT, or config.connection.credentials.vault is set, but no vault.path is set
+	ErrNoVaultPath = fmt.Errorf("vault.path should not be empty when using a HashiCorp Vault secret")
+	// ErrInvalidVaultKVVersion is thrown when vault.kvVersion is not 1 or 2
+	ErrInvalidVaultKVVersion = fmt.Errorf("vault.kvVersion must be 1 or 2")
+	// ErrInvalidVaultAuthMethod is thrown when vault.auth.method is unknown
+	ErrInvalidVaultAuthMethod = fmt.Errorf("vault.auth.method must be one of token, approle or kubernetes")
+
 	// ErrNoFireflyURL is thrown when platform is Firefly but no url is specified inf config.credentials
 	ErrNoFireflyURL = fmt.Errorf("no url defined. Firefly platform requires an url to the Firefly instance")
 	// ErrNoClientId is thrown when platform is Firefly and no config.credentials.clientId is defined
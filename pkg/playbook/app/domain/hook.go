@@ -0,0 +1,183 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// HookCommand runs a program, without a shell. It is the default type of a Hook
+	HookCommand = "command"
+	// HookSignal sends a signal to the process whose PID is in a file
+	HookSignal = "signal"
+	// HookSystemd runs systemctl on a unit, reload by default
+	HookSystemd = "systemd"
+	// HookWebhook sends a POST request with the details of the certificate installed
+	HookWebhook = "webhook"
+
+	// DefaultHookTimeout is the longest time a Hook may run when Hook.Timeout is not set
+	DefaultHookTimeout = time.Minute
+	// DefaultHookRetryDelay is the time between two attempts of a Hook when Hook.RetryDelay is not set
+	DefaultHookRetryDelay = time.Second
+	// DefaultHookSignal is sent by a signal Hook when Hook.Signal is not set
+	DefaultHookSignal = "HUP"
+	// DefaultHookSystemdAction is run by a systemd Hook when Hook.Action is not set
+	DefaultHookSystemdAction = "reload"
+)
+
+var (
+	// hookSignals are the signals a signal Hook may send
+	hookSignals = []string{"HUP", "INT", "QUIT", "TERM", "USR1", "USR2"}
+	// hookSystemdActions are the systemctl commands a systemd Hook may run
+	hookSystemdActions = []string{"reload", "restart", "try-restart", "reload-or-restart", "try-reload-or-restart"}
+)
+
+// Hooks are the actions run after a certificate is installed, without a shell
+type Hooks struct {
+	// AfterInstall run after the certificate is installed, in order
+	AfterInstall []Hook `yaml:"afterInstall,omitempty"`
+	// Validation run after the AfterInstall hooks, in order, to check the certificate is in use
+	Validation []Hook `yaml:"validation,omitempty"`
+}
+
+// Hook is an action run after a certificate is installed. It fails when it doesn't end with ExitCode, after Retries
+// more attempts
+type Hook struct {
+	// Type is one of command (default), signal, systemd and webhook
+	Type string `yaml:"type,omitempty"`
+
+	// Command is the program of a command hook followed by its arguments
+	Command []string `yaml:"command,omitempty"`
+	// Dir is the working directory of a command hook
+	Dir string `yaml:"dir,omitempty"`
+	// Env is added to the environment of a command hook, which also has the VCERT_ variables of the certificate
+	Env map[string]string `yaml:"env,omitempty"`
+	// ExitCode is the exit code of a successful command hook. Defaults to 0
+	ExitCode int `yaml:"exitCode,omitempty"`
+
+	// PIDFile is the file holding the PID of the process a signal hook is sent to
+	PIDFile string `yaml:"pidFile,omitempty"`
+	// Signal is sent by a signal hook. One of HUP (default), INT, QUIT, TERM, USR1 and USR2
+	Signal string `yaml:"signal,omitempty"`
+
+	// Unit is the systemd unit of a systemd hook
+	Unit string `yaml:"unit,omitempty"`
+	// Action is the systemctl command of a systemd hook: reload (default), restart, try-restart, reload-or-restart
+	// or try-reload-or-restart
+	Action string `yaml:"action,omitempty"`
+
+	// URL receives the POST request of a webhook hook
+	URL string `yaml:"url,omitempty"`
+	// Headers are added to the request of a webhook hook
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// Timeout is the longest time an attempt may run. Defaults to DefaultHookTimeout
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Retries is the number of attempts made after the first one failed
+	Retries int `yaml:"retries,omitempty"`
+	// RetryDelay is the time between two attempts. Defaults to DefaultHookRetryDelay
+	RetryDelay time.Duration `yaml:"retryDelay,omitempty"`
+}
+
+// String describes what the hook does
+func (h Hook) String() string {
+	switch h.Type {
+	case HookSignal:
+		return fmt.Sprintf("signal %s to %s", h.SignalName(), h.PIDFile)
+	case HookSystemd:
+		return fmt.Sprintf("systemctl %s %s", h.SystemdAction(), h.Unit)
+	case HookWebhook:
+		return "POST " + h.URL
+	default:
+		return strings.Join(h.Command, " ")
+	}
+}
+
+// SignalName returns the signal sent by a signal hook, without the SIG prefix
+func (h Hook) SignalName() string {
+	if h.Signal == "" {
+		return DefaultHookSignal
+	}
+	return strings.TrimPrefix(strings.ToUpper(h.Signal), "SIG")
+}
+
+// SystemdAction returns the systemctl command of a systemd hook
+func (h Hook) SystemdAction() string {
+	if h.Action == "" {
+		return DefaultHookSystemdAction
+	}
+	return h.Action
+}
+
+func (h Hooks) validate() error {
+	for i, hook := range h.AfterInstall {
+		if err := hook.validate(); err != nil {
+			return fmt.Errorf("hooks.afterInstall[%d]: %w", i, err)
+		}
+	}
+	for i, hook := range h.Validation {
+		if err := hook.validate(); err != nil {
+			return fmt.Errorf("hooks.validation[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (h Hook) validate() error {
+	if h.Timeout < 0 || h.Retries < 0 || h.RetryDelay < 0 || h.ExitCode < 0 {
+		return ErrInvalidHookOptions
+	}
+
+	if (h.Type == HookSignal || h.Type == HookSystemd) && runtime.GOOS == "windows" {
+		return fmt.Errorf("%w: %s", ErrHookOnWindows, h.Type)
+	}
+
+	switch h.Type {
+	case "", HookCommand:
+		if len(h.Command) == 0 || h.Command[0] == "" {
+			return ErrNoHookCommand
+		}
+	case HookSignal:
+		if h.PIDFile == "" {
+			return ErrNoHookPIDFile
+		}
+		if !slices.Contains(hookSignals, h.SignalName()) {
+			return fmt.Errorf("%w: %s", ErrInvalidHookSignal, h.Signal)
+		}
+	case HookSystemd:
+		if h.Unit == "" {
+			return ErrNoHookUnit
+		}
+		if !slices.Contains(hookSystemdActions, h.SystemdAction()) {
+			return fmt.Errorf("%w: %s", ErrInvalidHookSystemdAction, h.Action)
+		}
+	case HookWebhook:
+		u, err := url.Parse(h.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: %s", ErrInvalidHookURL, h.URL)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidHookType, h.Type)
+	}
+	return nil
+}
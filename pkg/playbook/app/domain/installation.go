@@ -50,11 +50,59 @@ type Installation struct {
 	JKSPassword         string `yaml:"jksPassword,omitempty"`
 	KeyFile             string `yaml:"keyFile,omitempty"`
 	KeyPassword         string `yaml:"keyPassword,omitempty"`
+	// Kubernetes is the Secret the certificate is installed in, when Type is FormatKubernetes
+	Kubernetes *KubernetesSecret `yaml:"kubernetes,omitempty"`
+	// Bundles are additional files written by a PEM installation, each with its own layout
+	Bundles []PEMBundle `yaml:"bundles,omitempty"`
+	// Layout is the content of File for a PEM installation. See ParsePEMLayout
+	Layout string `yaml:"layout,omitempty"`
+	// Mode is the octal permissions of the files written by the installation without the private key. Defaults to 0600.
+	// When none of Mode, KeyMode, Owner and Group is set, the files replaced keep their permissions and ownership
+	Mode string `yaml:"fileMode,omitempty"`
+	// KeyMode is the octal permissions of the files written by the installation holding the private key: the key
+	// file, the PEM files whose layout has the key, the JKS and PKCS#12 keystores and the backups. Defaults to 0600
+	KeyMode string `yaml:"keyFileMode,omitempty"`
+	// Owner is the owner of the files written by the installation, by name or ID. Not supported on Windows
+	Owner string `yaml:"fileOwner,omitempty"`
+	// Group is the group of the files written by the installation, by name or ID. Not supported on Windows
+	Group string `yaml:"fileGroup,omitempty"`
+	// BackupPolicy is where and for how long the backups of the files of the installation are kept
+	BackupPolicy *BackupPolicy `yaml:"backupPolicy,omitempty"`
+	// Hooks are run after the certificate is installed: AfterInstall after AfterAction, Validation after
+	// InstallValidation
+	Hooks *Hooks `yaml:"hooks,omitempty"`
+	// VerifyEndpoint is checked to serve the certificate once installed, after the AfterInstall hooks
+	VerifyEndpoint *EndpointVerification `yaml:"verifyEndpoint,omitempty"`
 	// Deprecated: Location is deprecated in favor of CAPILocation. It will be removed on a future release
 	Location     string             `yaml:"location,omitempty"`
 	P12Password  string             `yaml:"p12Password,omitempty"`
 	UseLegacyP12 bool               `yaml:"useLegacyP12,omitempty"`
 	Type         InstallationFormat `yaml:"format,omitempty"`
+	// Vault is the secret the certificate is installed in, when Type is FormatVault
+	Vault *VaultSecret `yaml:"vault,omitempty"`
+}
+
+// KubernetesSecret is a kubernetes.io/tls Secret holding a certificate, its private key and its chain
+type KubernetesSecret struct {
+	// Annotations are set on the Secret, in addition to the ones it already has
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	// Kubeconfig is the path of the kubeconfig file used to connect to the cluster. Defaults to the in-cluster
+	// configuration when running in a pod, then to $KUBECONFIG and ~/.kube/config
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	// Labels are set on the Secret, in addition to the ones it already has
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Name is the name of the Secret
+	Name string `yaml:"name,omitempty"`
+	// Namespace is the namespace of the Secret. Defaults to the namespace of the pod, or of the kubeconfig context
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// String returns the namespace and the name of the Secret
+func (k KubernetesSecret) String() string {
+	if k.Namespace == "" {
+		return k.Name
+	}
+	return k.Namespace + "/" + k.Name
 }
 
 // Installations is a slice of Installation
@@ -79,12 +127,35 @@ func (installation Installation) IsValid() (bool, error) {
 		if err := validateCAPI(installation); err != nil {
 			return false, fmt.Errorf("\t\t\t%w", err)
 		}
+	case FormatKubernetes:
+		if err := validateKubernetes(installation); err != nil {
+			return false, fmt.Errorf("\t\t\t%w", err)
+		}
+	case FormatVault:
+		if installation.Vault == nil {
+			return false, fmt.Errorf("\t\t\t%w", ErrNoVaultPath)
+		}
+		if err := installation.Vault.validate(); err != nil {
+			return false, fmt.Errorf("\t\t\t%w", err)
+		}
 	case FormatUnknown:
 		fallthrough
 	default:
 		return false, fmt.Errorf("\t\t\t%w", ErrUndefinedInstallationFormat)
 	}
 
+	if installation.Hooks != nil {
+		if err := installation.Hooks.validate(); err != nil {
+			return false, fmt.Errorf("\t\t\t%w", err)
+		}
+	}
+
+	if installation.VerifyEndpoint != nil {
+		if err := installation.VerifyEndpoint.validate(); err != nil {
+			return false, fmt.Errorf("\t\t\t%w", err)
+		}
+	}
+
 	return true, nil
 }
 
@@ -166,7 +237,7 @@ func validateJKS(installation Installation) error {
 		}
 	}
 
-	return nil
+	return validateFileOptions(installation)
 }
 
 func validatePEM(installation Installation) error {
@@ -174,13 +245,31 @@ func validatePEM(installation Installation) error {
 		return ErrNoInstallationFile
 	}
 
-	if installation.ChainFile == "" {
+	// The certificate is read from File to check it. The key and the chain can be in it too
+	parts, err := ParsePEMLayout(installation.Layout)
+	if err != nil {
+		return err
+	}
+	if !hasPart(parts, PEMPartCertificate) {
+		return ErrNoPEMLayoutCertificate
+	}
+	if installation.ChainFile == "" && !hasPart(parts, PEMPartChain) {
 		return ErrNoChainFile
 	}
-	if installation.KeyFile == "" {
+	if installation.KeyFile == "" && !hasPart(parts, PEMPartKey) {
 		return ErrNoKeyFile
 	}
-	return nil
+
+	for _, bundle := range installation.Bundles {
+		if bundle.File == "" {
+			return ErrNoInstallationFile
+		}
+		_, err = ParsePEMLayout(bundle.Layout)
+		if err != nil {
+			return err
+		}
+	}
+	return validateFileOptions(installation)
 }
 
 func validateP12(installation Installation) error {
@@ -190,5 +279,15 @@ func validateP12(installation Installation) error {
 	if installation.P12Password == "" {
 		return ErrNoP12Password
 	}
+	return validateFileOptions(installation)
+}
+
+func validateKubernetes(installation Installation) error {
+	if installation.Kubernetes == nil || installation.Kubernetes.Name == "" {
+		return ErrNoKubernetesSecretName
+	}
+	if installation.KeyPassword != "" {
+		return ErrKubernetesKeyPassword
+	}
 	return nil
 }
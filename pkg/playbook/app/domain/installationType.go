@@ -23,7 +23,7 @@ import (
 )
 
 // InstallationFormat represents the type of installation to be done:
-// PEM, PKCS12, JKS or CAPI (only on Windows environments)
+// PEM, PKCS12, JKS, KUBERNETES, VAULT or CAPI (only on Windows environments)
 type InstallationFormat int64
 
 const (
@@ -37,13 +37,19 @@ const (
 	FormatPEM
 	// FormatPKCS12 represents an installation with the PKCS12 format
 	FormatPKCS12
+	// FormatKubernetes represents an installation in a kubernetes.io/tls Secret
+	FormatKubernetes
+	// FormatVault represents an installation in a secret of a HashiCorp Vault KV secrets engine
+	FormatVault
 
 	// String representations of the InstallationFormat types
-	stringCAPI    = "CAPI"
-	stringJKS     = "JKS"
-	stringPEM     = "PEM"
-	stringPKCS12  = "PKCS12"
-	stringUnknown = "Unknown"
+	stringCAPI       = "CAPI"
+	stringJKS        = "JKS"
+	stringKubernetes = "KUBERNETES"
+	stringPEM        = "PEM"
+	stringPKCS12     = "PKCS12"
+	stringUnknown    = "Unknown"
+	stringVault      = "VAULT"
 )
 
 // String returns a string representation of this object
@@ -57,6 +63,10 @@ func (it *InstallationFormat) String() string {
 		return stringJKS
 	case FormatCAPI:
 		return stringCAPI
+	case FormatKubernetes:
+		return stringKubernetes
+	case FormatVault:
+		return stringVault
 	default:
 		return stringUnknown
 	}
@@ -92,6 +102,10 @@ func parseInstallationType(installationType string) (InstallationFormat, error)
 		return FormatPEM, nil
 	case stringPKCS12:
 		return FormatPKCS12, nil
+	case stringKubernetes:
+		return FormatKubernetes, nil
+	case stringVault:
+		return FormatVault, nil
 	default:
 		return FormatUnknown, nil
 	}
@@ -42,6 +42,8 @@ func (s *InstallationTypeSuite) SetupTest() {
 		{it: FormatJKS, strValue: stringJKS},
 		{it: FormatPEM, strValue: stringPEM},
 		{it: FormatPKCS12, strValue: stringPKCS12},
+		{it: FormatKubernetes, strValue: stringKubernetes},
+		{it: FormatVault, strValue: stringVault},
 		{it: FormatUnknown, strValue: stringUnknown},
 	}
 
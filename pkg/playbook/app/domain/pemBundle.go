@@ -0,0 +1,140 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package domain
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PEMPartCertificate is the certificate in a PEM layout
+	PEMPartCertificate = "certificate"
+	// PEMPartChain is the chain of the certificate in a PEM layout
+	PEMPartChain = "chain"
+	// PEMPartKey is the private key in a PEM layout
+	PEMPartKey = "key"
+
+	// PEMLayoutCertificate is the default layout of a PEM file: the certificate only
+	PEMLayoutCertificate = "certificate"
+	// PEMLayoutFullChain is the certificate followed by its chain
+	PEMLayoutFullChain = "fullchain"
+	// PEMLayoutKeyFullChain is the private key followed by the certificate and its chain
+	PEMLayoutKeyFullChain = "key+fullchain"
+	// PEMLayoutChain is the chain only
+	PEMLayoutChain = "chain"
+)
+
+var pemLayouts = map[string][]string{
+	PEMLayoutCertificate:  {PEMPartCertificate},
+	PEMLayoutFullChain:    {PEMPartCertificate, PEMPartChain},
+	PEMLayoutKeyFullChain: {PEMPartKey, PEMPartCertificate, PEMPartChain},
+	PEMLayoutChain:        {PEMPartChain},
+}
+
+// PEMBundle is an additional file of a PEM installation
+type PEMBundle struct {
+	// File is the path of the bundle
+	File string `yaml:"file,omitempty"`
+	// Layout is the content of the bundle. See ParsePEMLayout
+	Layout string `yaml:"layout,omitempty"`
+}
+
+// ParsePEMLayout returns the parts of a PEM file in the order they are written. layout is one of certificate,
+// fullchain, key+fullchain and chain, or a comma separated list of the parts certificate, chain and key, e.g.
+// "certificate,key,chain". An empty layout is the certificate only
+func ParsePEMLayout(layout string) ([]string, error) {
+	if layout == "" {
+		layout = PEMLayoutCertificate
+	}
+	if parts, found := pemLayouts[strings.ToLower(layout)]; found {
+		return parts, nil
+	}
+
+	parts := make([]string, 0, 3)
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(layout, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		switch part {
+		case PEMPartCertificate, PEMPartChain, PEMPartKey:
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPEMLayout, layout)
+		}
+		if seen[part] {
+			return nil, fmt.Errorf("%w: %s is repeated in %s", ErrInvalidPEMLayout, part, layout)
+		}
+		seen[part] = true
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// hasPart returns true if parts contains part
+func hasPart(parts []string, part string) bool {
+	for _, p := range parts {
+		if p == part {
+			return true
+		}
+	}
+	return false
+}
+
+// FileMode returns the permissions of the files written by the installation without the private key. Defaults to
+// 0600
+func (installation Installation) FileMode() (os.FileMode, error) {
+	return parseFileMode(installation.Mode)
+}
+
+// KeyFileMode returns the permissions of the files written by the installation holding the private key. Defaults to
+// 0600
+func (installation Installation) KeyFileMode() (os.FileMode, error) {
+	return parseFileMode(installation.KeyMode)
+}
+
+// parseFileMode returns the octal permissions of value, 0600 if it is empty
+func parseFileMode(value string) (os.FileMode, error) {
+	if value == "" {
+		return 0600, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidFileMode, value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// validateFileOptions validates the permissions and ownership of the files written by the installation
+func validateFileOptions(installation Installation) error {
+	_, err := installation.FileMode()
+	if err != nil {
+		return err
+	}
+	_, err = installation.KeyFileMode()
+	if err != nil {
+		return err
+	}
+	if (installation.Owner != "" || installation.Group != "") && runtime.GOOS == "windows" {
+		return ErrFileOwnerOnWindows
+	}
+	if installation.BackupPolicy != nil {
+		return installation.BackupPolicy.validate()
+	}
+	return nil
+}
@@ -35,10 +35,13 @@ const (
 // A task includes:
 //   - a Request object that defines the values of the certificate to request
 //   - a list of locations where the certificate will be installed
+//
+// An SSH task requests an SSH certificate for a key pair, and installs it next to the key.
 type Playbook struct {
-	CertificateTasks CertificateTasks `yaml:"certificateTasks,omitempty"`
-	Config           Config           `yaml:"config,omitempty"`
-	Location         string           `yaml:"-"`
+	CertificateTasks    CertificateTasks    `yaml:"certificateTasks,omitempty"`
+	SshCertificateTasks SshCertificateTasks `yaml:"sshCertificateTasks,omitempty"`
+	Config              Config              `yaml:"config,omitempty"`
+	Location            string              `yaml:"-"`
 }
 
 // NewPlaybook returns a Playbook with some default values
@@ -67,7 +70,7 @@ func (p Playbook) IsValid() (bool, error) {
 	rValid = rValid && valid
 
 	// There is at least one task to execute
-	if len(p.CertificateTasks) < 1 {
+	if len(p.CertificateTasks) < 1 && len(p.SshCertificateTasks) < 1 {
 		rValid = false
 		rErr = errors.Join(rErr, ErrNoTasks)
 	}
@@ -90,6 +93,22 @@ func (p Playbook) IsValid() (bool, error) {
 		}
 	}
 
+	// Check that the included SSH certificate tasks are valid. Their names are unique among all the tasks
+	for _, t := range p.SshCertificateTasks {
+		if !taskNames[t.Name] {
+			taskNames[t.Name] = true
+		} else {
+			rErr = errors.Join(rErr, fmt.Errorf("task '%s' is defined multiple times", t.Name))
+			rValid = false
+		}
+
+		_, err := t.IsValid()
+		if err != nil {
+			rErr = errors.Join(rErr, fmt.Errorf("task '%s' is invalid: %w", t.Name, err))
+			rValid = false
+		}
+	}
+
 	return rValid, rErr
 
 }
@@ -32,6 +32,7 @@ type PlaybookRequest struct {
 	EmailAddresses []string                     `yaml:"sanEmail,omitempty"`
 	FriendlyName   string                       `yaml:"nickname,omitempty"`
 	IPAddresses    []string                     `yaml:"sanIP,omitempty"`
+	Issuer         string                       `yaml:"issuer,omitempty"`
 	IssuerHint     util.IssuerHint              `yaml:"issuerHint,omitempty"`
 	KeyCurve       certificate.EllipticCurve    `yaml:"keyCurve,omitempty"`
 	KeyLength      int                          `yaml:"keySize,omitempty"`
@@ -48,6 +48,10 @@ func (s *PlaybookSuite) SetupTest() {
 		},
 	}
 
+	sshReq := SshPlaybookRequest{
+		Template: "host-template",
+	}
+
 	config := Config{
 		Connection: Connection{
 			Platform: venafi.TLSPCloud,
@@ -135,6 +139,106 @@ func (s *PlaybookSuite) SetupTest() {
 				CertificateTasks: nil,
 			},
 		},
+		{
+			err:  nil,
+			name: "ValidSshTask",
+			pb: Playbook{
+				Config: config,
+				SshCertificateTasks: SshCertificateTasks{
+					{
+						Name:    "hostCert",
+						Request: sshReq,
+						KeyFile: "/etc/ssh/ssh_host_ed25519_key",
+					},
+				},
+			},
+		},
+		{
+			err:  ErrNoSshTemplate,
+			name: "NoSshTemplate",
+			pb: Playbook{
+				Config: config,
+				SshCertificateTasks: SshCertificateTasks{
+					{
+						Name:    "hostCert",
+						KeyFile: "/etc/ssh/ssh_host_ed25519_key",
+					},
+				},
+			},
+		},
+		{
+			err:  ErrNoSshKeyFile,
+			name: "NoSshKeyFile",
+			pb: Playbook{
+				Config: config,
+				SshCertificateTasks: SshCertificateTasks{
+					{
+						Name:    "hostCert",
+						Request: sshReq,
+					},
+				},
+			},
+		},
+		{
+			err:  ErrSshKeyFileIsPublic,
+			name: "SshKeyFileIsPublic",
+			pb: Playbook{
+				Config: config,
+				SshCertificateTasks: SshCertificateTasks{
+					{
+						Name:    "hostCert",
+						Request: sshReq,
+						KeyFile: "/etc/ssh/ssh_host_ed25519_key.pub",
+					},
+				},
+			},
+		},
+		{
+			err:  ErrInvalidSshKeyType,
+			name: "InvalidSshKeyType",
+			pb: Playbook{
+				Config: config,
+				SshCertificateTasks: SshCertificateTasks{
+					{
+						Name: "hostCert",
+						Request: SshPlaybookRequest{
+							Template: "host-template",
+							KeyType:  "dsa",
+						},
+						KeyFile:     "/etc/ssh/ssh_host_dsa_key",
+						GenerateKey: true,
+					},
+				},
+			},
+		},
+		{
+			err:  fmt.Errorf("task 'web' is defined multiple times"),
+			name: "SshTaskNameInUse",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "web",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:      FormatPEM,
+								File:      "/foo/cert.pem",
+								ChainFile: "/foo/chain.pem",
+								KeyFile:   "/foo/key.pem",
+							},
+						},
+					},
+				},
+				SshCertificateTasks: SshCertificateTasks{
+					{
+						Name:    "web",
+						Request: sshReq,
+						KeyFile: "/etc/ssh/ssh_host_ed25519_key",
+					},
+				},
+			},
+		},
 		{
 			err:  ErrNoRequestZone,
 			name: "NoRequestZone",
@@ -346,6 +450,176 @@ func (s *PlaybookSuite) SetupTest() {
 			},
 		},
 
+		{
+			err:  ErrNoPEMLayoutCertificate,
+			name: "PEMLayoutWithoutCertificate",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:   FormatPEM,
+								File:   "/foo/bar/pem/ca.pem",
+								Layout: PEMLayoutChain,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  ErrInvalidPEMLayout,
+			name: "InvalidPEMBundleLayout",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:   FormatPEM,
+								File:   "/foo/bar/pem/haproxy.pem",
+								Layout: PEMLayoutKeyFullChain,
+								Bundles: []PEMBundle{
+									{File: "/foo/bar/pem/other.pem", Layout: "certificate,certificate"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  ErrInvalidFileMode,
+			name: "InvalidFileMode",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:   FormatPEM,
+								File:   "/foo/bar/pem/haproxy.pem",
+								Layout: PEMLayoutKeyFullChain,
+								Mode:   "rw-r-----",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  ErrInvalidFileMode,
+			name: "InvalidKeyFileMode",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:    FormatPEM,
+								File:    "/foo/bar/pem/haproxy.pem",
+								Layout:  PEMLayoutKeyFullChain,
+								KeyMode: "01777",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  ErrNoHookCommand,
+			name: "NoHookCommand",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:  FormatPEM,
+								File:  "/foo/bar/cert.pem",
+								Hooks: &Hooks{AfterInstall: []Hook{{Dir: "/foo"}}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  ErrInvalidEndpointAddress,
+			name: "InvalidEndpointAddress",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:           FormatPEM,
+								File:           "/foo/bar/cert.pem",
+								VerifyEndpoint: &EndpointVerification{Address: "www.example.com"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  ErrInvalidBackupMaxAge,
+			name: "InvalidBackupMaxAge",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:         FormatPKCS12,
+								File:         "/foo/bar/p12/cert.p12",
+								P12Password:  "foo123",
+								BackupPolicy: &BackupPolicy{Keep: 3, MaxAge: "3w"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  nil,
+			name: "ValidPEMBundleConfig",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:   FormatPEM,
+								File:   "/foo/bar/pem/haproxy.pem",
+								Layout: PEMLayoutKeyFullChain,
+								Bundles: []PEMBundle{
+									{File: "/foo/bar/pem/ca.pem", Layout: PEMLayoutChain},
+								},
+								Mode: "0640",
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			err:  nil,
 			name: "ValidPEMConfig",
@@ -408,6 +682,128 @@ func (s *PlaybookSuite) SetupTest() {
 				},
 			},
 		},
+		{
+			err:  ErrNoKubernetesSecretName,
+			name: "NoKubernetesSecretName",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:       FormatKubernetes,
+								Kubernetes: &KubernetesSecret{Namespace: "default"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  ErrKubernetesKeyPassword,
+			name: "KubernetesKeyPassword",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:        FormatKubernetes,
+								Kubernetes:  &KubernetesSecret{Name: "www-tls"},
+								KeyPassword: "foo123",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  nil,
+			name: "ValidKubernetesConfig",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type: FormatKubernetes,
+								Kubernetes: &KubernetesSecret{
+									Namespace: "default",
+									Name:      "www-tls",
+									Labels:    map[string]string{"app": "www"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  ErrNoVaultPath,
+			name: "NoVaultPath",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:  FormatVault,
+								Vault: &VaultSecret{Vault: Vault{Address: "https://vault.example.com:8200"}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  ErrInvalidVaultAuthMethod,
+			name: "InvalidVaultAuthMethod",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type: FormatVault,
+								Vault: &VaultSecret{
+									Vault: Vault{Auth: VaultAuth{Method: "userpass"}},
+									Path:  "secret/vcert/www",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			err:  nil,
+			name: "ValidVaultConfig",
+			pb: Playbook{
+				Config: config,
+				CertificateTasks: CertificateTasks{
+					{
+						Name:    "testTask",
+						Request: req,
+						Installations: Installations{
+							{
+								Type:  FormatVault,
+								Vault: &VaultSecret{Path: "secret/vcert/www"},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	s.nonWindowsTestCases = []testCase{
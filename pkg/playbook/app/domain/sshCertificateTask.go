@@ -0,0 +1,129 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+const (
+	// SshPublicKeySuffix is appended to SshCertificateTask.KeyFile to name the file of its public key
+	SshPublicKeySuffix = ".pub"
+	// SshCertificateSuffix is appended to SshCertificateTask.KeyFile to name the file of its certificate, where
+	// OpenSSH looks for it
+	SshCertificateSuffix = "-cert.pub"
+)
+
+// SshCertificateTask represents an SSH certificate to be requested/renewed for a key pair, host or user one, and
+// installed next to its private key as OpenSSH expects it: the public key is read from KeyFile.pub and the certificate
+// written to KeyFile-cert.pub
+type SshCertificateTask struct {
+	Name    string             `yaml:"name,omitempty"`
+	Request SshPlaybookRequest `yaml:"request,omitempty"`
+	// KeyFile is the private key the certificate is issued for, such as /etc/ssh/ssh_host_ed25519_key
+	KeyFile string `yaml:"keyFile,omitempty"`
+	// GenerateKey generates a key pair of Request.KeyType and Request.KeySize at KeyFile when there is none. A missing
+	// public key is derived from KeyFile, and fails the task when KeyFile is missing without GenerateKey
+	GenerateKey bool   `yaml:"generateKey,omitempty"`
+	RenewBefore string `yaml:"renewBefore,omitempty"`
+	// AfterAction is run after the certificate is installed, such as reloading sshd
+	AfterAction string `yaml:"afterInstallAction,omitempty"`
+	// Hooks are run after AfterAction: AfterInstall, then Validation
+	Hooks *Hooks `yaml:"hooks,omitempty"`
+	// Vars are the variables of the task templates, e.g. {{ .Vars.host }}
+	Vars map[string]string `yaml:"vars,omitempty"`
+}
+
+// SshPlaybookRequest is the SSH certificate requested by an SshCertificateTask. The type of the certificate, host or
+// user, is set by its template
+type SshPlaybookRequest struct {
+	// Template is the SSH certificate issuing template, or the DN of the SSH CA on TPP
+	Template string `yaml:"template,omitempty"`
+	// PolicyDN is the folder of the certificate object on TPP
+	PolicyDN             string   `yaml:"policyDN,omitempty"`
+	ObjectName           string   `yaml:"objectName,omitempty"`
+	KeyID                string   `yaml:"keyId,omitempty"`
+	Principals           []string `yaml:"principals,omitempty"`
+	ValidityPeriod       string   `yaml:"validityPeriod,omitempty"`
+	Extensions           []string `yaml:"extensions,omitempty"`
+	ForceCommand         string   `yaml:"forceCommand,omitempty"`
+	SourceAddresses      []string `yaml:"sourceAddresses,omitempty"`
+	DestinationAddresses []string `yaml:"destinationAddresses,omitempty"`
+	// KeyType and KeySize are the algorithm and size of the key pair generated when SshCertificateTask.GenerateKey is
+	// set: rsa (default), ecdsa or ed25519, as given to ssh-keygen -t
+	KeyType string `yaml:"keyType,omitempty"`
+	KeySize int    `yaml:"keySize,omitempty"`
+	// Timeout is how long, in seconds, the certificate is waited for once requested
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+// SshCertificateTasks is a slice of SshCertificateTask
+type SshCertificateTasks []SshCertificateTask
+
+// PublicKeyFile returns the file of the public key of the task
+func (task SshCertificateTask) PublicKeyFile() string {
+	return task.KeyFile + SshPublicKeySuffix
+}
+
+// CertificateFile returns the file the certificate of the task is installed in
+func (task SshCertificateTask) CertificateFile() string {
+	return task.KeyFile + SshCertificateSuffix
+}
+
+// IsValid returns true if the SshCertificateTask has the minimum required fields to be run
+func (task SshCertificateTask) IsValid() (bool, error) {
+	var rErr error = nil
+	rValid := true
+
+	if task.Request.Template == "" {
+		rValid = false
+		rErr = errors.Join(rErr, fmt.Errorf("\t\t%w", ErrNoSshTemplate))
+	}
+
+	if task.KeyFile == "" {
+		rValid = false
+		rErr = errors.Join(rErr, fmt.Errorf("\t\t%w", ErrNoSshKeyFile))
+	} else if strings.HasSuffix(task.KeyFile, SshPublicKeySuffix) {
+		rValid = false
+		rErr = errors.Join(rErr, fmt.Errorf("\t\t%w", ErrSshKeyFileIsPublic))
+	}
+
+	if task.GenerateKey {
+		if _, _, err := util.ParseSshKeyType(task.Request.KeyType); err != nil {
+			rValid = false
+			rErr = errors.Join(rErr, fmt.Errorf("\t\t%w", ErrInvalidSshKeyType))
+		}
+	}
+
+	if task.Request.Timeout < 0 {
+		rValid = false
+		rErr = errors.Join(rErr, fmt.Errorf("\t\t%w", ErrInvalidSshTimeout))
+	}
+
+	if task.Hooks != nil {
+		if err := task.Hooks.validate(); err != nil {
+			rValid = false
+			rErr = errors.Join(rErr, fmt.Errorf("\t\t%w", err))
+		}
+	}
+
+	return rValid, rErr
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package domain
+
+import (
+	"strings"
+)
+
+const (
+	// VaultAuthToken logs in to Vault with a token
+	VaultAuthToken = "token"
+	// VaultAuthAppRole logs in to Vault with the role ID and secret ID of an AppRole
+	VaultAuthAppRole = "approle"
+	// VaultAuthKubernetes logs in to Vault with the service account token of a pod
+	VaultAuthKubernetes = "kubernetes"
+)
+
+// Vault is the connection to a HashiCorp Vault server. Empty values default to the ones of the VAULT_* environment
+// variables used by the Vault CLI
+type Vault struct {
+	// Address is the URL of the Vault server. Defaults to $VAULT_ADDR
+	Address string `yaml:"address,omitempty"`
+	// Auth is the method used to log in to Vault
+	Auth VaultAuth `yaml:"auth,omitempty"`
+	// CACert is the path of the CA certificate to verify the server with. Defaults to $VAULT_CACERT
+	CACert string `yaml:"caCert,omitempty"`
+	// Insecure disables the verification of the certificate of the server. Defaults to $VAULT_SKIP_VERIFY
+	Insecure bool `yaml:"insecure,omitempty"`
+	// Namespace is the Vault Enterprise namespace. Defaults to $VAULT_NAMESPACE
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// VaultAuth is the method used to log in to Vault.
+//
+// When Method is empty, it is token if a token is set, approle if a role ID is set, kubernetes if a role is set and
+// else it is guessed in the same order from $VAULT_TOKEN, $VAULT_ROLE_ID and $VAULT_K8S_ROLE
+type VaultAuth struct {
+	// JWTFile is the service account token used by the kubernetes method. Defaults to the one of the pod
+	JWTFile string `yaml:"jwtFile,omitempty"`
+	// Method is one of token, approle or kubernetes
+	Method string `yaml:"method,omitempty"`
+	// Mount is the path the auth method is enabled at. Defaults to the name of the method
+	Mount string `yaml:"mount,omitempty"`
+	// Role is the role used by the kubernetes method. Defaults to $VAULT_K8S_ROLE
+	Role string `yaml:"role,omitempty"`
+	// RoleID is the role ID used by the approle method. Defaults to $VAULT_ROLE_ID
+	RoleID string `yaml:"roleId,omitempty"`
+	// SecretID is the secret ID used by the approle method. Defaults to $VAULT_SECRET_ID
+	SecretID string `yaml:"secretId,omitempty"`
+	// Token is the token used by the token method. Defaults to $VAULT_TOKEN
+	Token string `yaml:"token,omitempty"`
+}
+
+// VaultSecret is a secret of a KV secrets engine
+type VaultSecret struct {
+	Vault `yaml:",inline"`
+	// KVVersion is the version of the KV secrets engine, 1 or 2. Detected from the server when not set
+	KVVersion int `yaml:"kvVersion,omitempty"`
+	// Mount is the path the KV secrets engine is enabled at. When set, Path is relative to it. Otherwise, Path
+	// starts with the mount, which is detected from the server
+	Mount string `yaml:"mount,omitempty"`
+	// Path is the path of the secret, as given to `vault kv get`
+	Path string `yaml:"path,omitempty"`
+}
+
+// String returns the path of the secret
+func (v VaultSecret) String() string {
+	if v.Mount == "" {
+		return v.Path
+	}
+	return strings.Trim(v.Mount, "/") + "/" + strings.Trim(v.Path, "/")
+}
+
+func (v VaultSecret) validate() error {
+	if strings.Trim(v.Path, "/") == "" {
+		return ErrNoVaultPath
+	}
+	if v.KVVersion < 0 || v.KVVersion > 2 {
+		return ErrInvalidVaultKVVersion
+	}
+	switch v.Auth.Method {
+	case "", VaultAuthToken, VaultAuthAppRole, VaultAuthKubernetes:
+	default:
+		return ErrInvalidVaultAuthMethod
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hooks
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+// endpointDialTimeout is the longest time a connection to an endpoint may take
+const endpointDialTimeout = 10 * time.Second
+
+var (
+	// ErrEndpointNotVerified is returned when an endpoint did not serve the certificate within its retry period
+	ErrEndpointNotVerified = errors.New("endpoint does not serve the certificate")
+	// ErrEndpointMismatch is returned when an endpoint serves another certificate
+	ErrEndpointMismatch = errors.New("endpoint serves another certificate")
+)
+
+// VerifyEndpoint connects to endpoint until it serves the certificate of event, identified by its serial and
+// thumbprint, or its retry period is over
+func VerifyEndpoint(ctx context.Context, endpoint domain.EndpointVerification, event Event) (string, error) {
+	period := endpoint.RetryPeriod()
+	ctx, cancel := context.WithTimeout(ctx, period)
+	defer cancel()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		var served *x509.Certificate
+		served, err = servedCertificate(ctx, endpoint)
+		if err == nil {
+			err = matchCertificate(served, event)
+			if err == nil {
+				return fmt.Sprintf("%s serves serial %s", endpoint.Address, event.Serial), nil
+			}
+		}
+		zap.L().Debug("endpoint not verified", zap.String("address", endpoint.Address), zap.Int("attempt", attempt),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w after %s: %w", ErrEndpointNotVerified, period, err)
+		case <-time.After(endpoint.RetryInterval()):
+		}
+	}
+}
+
+// servedCertificate returns the leaf certificate served by endpoint. The chain is not verified: the certificate is
+// identified by its thumbprint instead
+func servedCertificate(ctx context.Context, endpoint domain.EndpointVerification) (*x509.Certificate, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: endpointDialTimeout},
+		// nolint:gosec // the certificate served is compared to the one installed, trusting it is not needed
+		Config: &tls.Config{ServerName: endpoint.ServerName, InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate served by %s", endpoint.Address)
+	}
+	return certs[0], nil
+}
+
+// matchCertificate checks cert has the serial and thumbprint of event
+func matchCertificate(cert *x509.Certificate, event Event) error {
+	// nolint:gosec // SHA-1 is the thumbprint reported for the certificates installed
+	sum := sha1.Sum(cert.Raw)
+	thumbprint := hex.EncodeToString(sum[:])
+	if event.Serial != "" && cert.SerialNumber.String() != event.Serial {
+		return fmt.Errorf("%w: serial %s, expected %s", ErrEndpointMismatch, cert.SerialNumber.String(), event.Serial)
+	}
+	if event.Thumbprint != "" && !strings.EqualFold(thumbprint, event.Thumbprint) {
+		return fmt.Errorf("%w: thumbprint %s, expected %s", ErrEndpointMismatch, thumbprint, event.Thumbprint)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hooks
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+func TestVerifyEndpoint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	cert := server.Certificate()
+	sum := sha1.Sum(cert.Raw)
+	endpoint := domain.EndpointVerification{
+		Address:    strings.TrimPrefix(server.URL, "https://"),
+		ServerName: "www.vcert.test",
+		Period:     time.Second,
+		Interval:   10 * time.Millisecond,
+	}
+
+	event := Event{Serial: cert.SerialNumber.String(), Thumbprint: strings.ToUpper(hex.EncodeToString(sum[:]))}
+	output, err := VerifyEndpoint(context.Background(), endpoint, event)
+	require.NoError(t, err)
+	assert.Contains(t, output, event.Serial)
+
+	// another certificate is still served once the period is over
+	event.Serial = "1234"
+	start := time.Now()
+	_, err = VerifyEndpoint(context.Background(), endpoint, event)
+	assert.ErrorIs(t, err, ErrEndpointNotVerified)
+	assert.ErrorIs(t, err, ErrEndpointMismatch)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// nothing listens
+	server.Close()
+	_, err = VerifyEndpoint(context.Background(), endpoint, event)
+	assert.ErrorIs(t, err, ErrEndpointNotVerified)
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+const (
+	// waitDelay is how long a command hook may keep its output open once it was killed for running out of time
+	waitDelay = time.Second
+	// maxOutput is the number of bytes of the output of a hook that are kept
+	maxOutput = 4096
+)
+
+var (
+	// ErrHookTimeout is returned when an attempt of a hook runs longer than its timeout
+	ErrHookTimeout = errors.New("hook timed out")
+	// ErrUnexpectedExitCode is returned when a command hook doesn't end with the expected exit code
+	ErrUnexpectedExitCode = errors.New("unexpected exit code")
+	// ErrWebhookStatus is returned when a webhook doesn't answer with a 2xx status
+	ErrWebhookStatus = errors.New("unexpected webhook status")
+
+	// systemctl is the program run by systemd hooks
+	systemctl = "systemctl"
+	// webhookClient sends the requests of webhook hooks. The hook timeout applies to each request
+	webhookClient = &http.Client{}
+)
+
+// Event describes the certificate a hook runs for. It is given to command hooks as VCERT_ environment variables and
+// sent as the JSON body of webhooks
+type Event struct {
+	Task       string    `json:"task"`
+	Type       string    `json:"type"`
+	Location   string    `json:"location"`
+	File       string    `json:"file,omitempty"`
+	KeyFile    string    `json:"keyFile,omitempty"`
+	ChainFile  string    `json:"chainFile,omitempty"`
+	CommonName string    `json:"commonName,omitempty"`
+	Serial     string    `json:"serial,omitempty"`
+	Thumbprint string    `json:"thumbprint,omitempty"`
+	NotAfter   time.Time `json:"notAfter,omitempty"`
+}
+
+// Environ returns the environment variables describing e, in the form "key=value"
+func (e Event) Environ() []string {
+	env := []string{
+		"VCERT_TASK=" + e.Task,
+		"VCERT_INSTALLATION_TYPE=" + e.Type,
+		"VCERT_LOCATION=" + e.Location,
+		"VCERT_FILE=" + e.File,
+		"VCERT_KEY_FILE=" + e.KeyFile,
+		"VCERT_CHAIN_FILE=" + e.ChainFile,
+		"VCERT_COMMON_NAME=" + e.CommonName,
+		"VCERT_SERIAL=" + e.Serial,
+		"VCERT_THUMBPRINT=" + e.Thumbprint,
+	}
+	if !e.NotAfter.IsZero() {
+		env = append(env, "VCERT_NOT_AFTER="+e.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return env
+}
+
+// Run runs hook for event until an attempt succeeds or its retries are exhausted, and returns the output of the last
+// attempt. Each attempt is stopped when it runs longer than the hook timeout
+func Run(ctx context.Context, hook domain.Hook, event Event) (string, error) {
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = domain.DefaultHookTimeout
+	}
+	delay := hook.RetryDelay
+	if delay == 0 {
+		delay = domain.DefaultHookRetryDelay
+	}
+
+	var output string
+	var err error
+	for attempt := 0; attempt <= hook.Retries; attempt++ {
+		if attempt > 0 {
+			zap.L().Info("retrying hook", zap.String("hook", hook.String()), zap.Int("attempt", attempt+1),
+				zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return output, errors.Join(err, ctx.Err())
+			case <-time.After(delay):
+			}
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		output, err = runOnce(attemptCtx, hook, event)
+		if err != nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s: %w", ErrHookTimeout, timeout, err)
+		}
+		cancel()
+		if err == nil {
+			zap.L().Debug("hook output", zap.String("hook", hook.String()), zap.String("output", output))
+			return output, nil
+		}
+	}
+	return output, err
+}
+
+func runOnce(ctx context.Context, hook domain.Hook, event Event) (string, error) {
+	switch hook.Type {
+	case domain.HookSignal:
+		return "", sendSignal(hook)
+	case domain.HookSystemd:
+		return command(ctx, []string{systemctl, hook.SystemdAction(), hook.Unit}, "", nil, 0, event)
+	case domain.HookWebhook:
+		return webhook(ctx, hook, event)
+	default:
+		return command(ctx, hook.Command, hook.Dir, hook.Env, hook.ExitCode, event)
+	}
+}
+
+// command runs argv without a shell and checks it ends with exitCode
+func command(ctx context.Context, argv []string, dir string, env map[string]string, exitCode int, event Event) (string, error) {
+	zap.L().Debug("running hook command", zap.Strings("argv", argv))
+
+	// nolint:gosec // the program and its arguments are set in the playbook, no shell is involved
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), event.Environ()...)
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	// a child process keeping the output open doesn't block the playbook once the command is killed
+	cmd.WaitDelay = waitDelay
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+	output := truncate(out.String())
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		if exitErr.ExitCode() == exitCode {
+			return output, nil
+		}
+		return output, fmt.Errorf("%w: %d, expected %d", ErrUnexpectedExitCode, exitErr.ExitCode(), exitCode)
+	}
+	if err != nil {
+		return output, err
+	}
+	if exitCode != 0 {
+		return output, fmt.Errorf("%w: 0, expected %d", ErrUnexpectedExitCode, exitCode)
+	}
+	return output, nil
+}
+
+// webhook posts event as JSON to the URL of hook and checks the answer has a 2xx status
+func webhook(ctx context.Context, hook domain.Hook, event Event) (string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutput))
+	output := truncate(string(data))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return output, fmt.Errorf("%w: %s", ErrWebhookStatus, resp.Status)
+	}
+	return output, nil
+}
+
+// readPIDFile returns the PID written in file
+func readPIDFile(file string) (int, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s: %q", file, strings.TrimSpace(string(data)))
+	}
+	return pid, nil
+}
+
+func truncate(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxOutput {
+		return output[:maxOutput]
+	}
+	return output
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+var testEvent = Event{
+	Task:       "www",
+	Type:       "PEM",
+	Location:   "/etc/ssl/www.pem",
+	File:       "/etc/ssl/www.pem",
+	Serial:     "1234",
+	Thumbprint: "abcd",
+	NotAfter:   time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+func skipOnWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("command hooks are run with unix programs")
+	}
+}
+
+func TestRun_Command(t *testing.T) {
+	skipOnWindows(t)
+	dir := t.TempDir()
+	hook := domain.Hook{
+		Command:  []string{"sh", "-c", `echo "$VCERT_SERIAL $VCERT_THUMBPRINT $VCERT_NOT_AFTER $EXTRA $(pwd)"; exit 3`},
+		Dir:      dir,
+		Env:      map[string]string{"EXTRA": "extra"},
+		ExitCode: 3,
+	}
+	output, err := Run(context.Background(), hook, testEvent)
+	require.NoError(t, err)
+	realDir, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "1234 abcd 2030-01-02T03:04:05Z extra "+realDir, output)
+
+	hook.ExitCode = 0
+	_, err = Run(context.Background(), hook, testEvent)
+	assert.ErrorIs(t, err, ErrUnexpectedExitCode)
+}
+
+func TestRun_Timeout(t *testing.T) {
+	skipOnWindows(t)
+	hook := domain.Hook{Command: []string{"sleep", "10"}, Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err := Run(context.Background(), hook, testEvent)
+	assert.ErrorIs(t, err, ErrHookTimeout)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRun_Webhook(t *testing.T) {
+	var calls atomic.Int32
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		// the first attempt fails
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		_, _ = w.Write([]byte("reloaded"))
+	}))
+	defer server.Close()
+
+	hook := domain.Hook{
+		Type:       domain.HookWebhook,
+		URL:        server.URL,
+		Headers:    map[string]string{"Authorization": "Bearer token"},
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+	}
+	output, err := Run(context.Background(), hook, testEvent)
+	require.NoError(t, err)
+	assert.Equal(t, "reloaded", output)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, testEvent, received)
+
+	hook.Retries = 0
+	calls.Store(0)
+	_, err = Run(context.Background(), hook, testEvent)
+	assert.ErrorIs(t, err, ErrWebhookStatus)
+}
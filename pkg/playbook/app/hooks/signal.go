@@ -0,0 +1,51 @@
+//go:build !windows
+
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hooks
+
+import (
+	"fmt"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// sendSignal sends the signal of hook to the process whose PID is in its PID file
+func sendSignal(hook domain.Hook) error {
+	sig, found := signals[hook.SignalName()]
+	if !found {
+		return fmt.Errorf("%w: %s", domain.ErrInvalidHookSignal, hook.Signal)
+	}
+	pid, err := readPIDFile(hook.PIDFile)
+	if err != nil {
+		return err
+	}
+	zap.L().Debug("sending signal", zap.String("signal", hook.SignalName()), zap.Int("pid", pid))
+	return syscall.Kill(pid, sig)
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hooks
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+func TestRun_Signal(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "vcert.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0600))
+
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, syscall.SIGUSR1)
+	defer signal.Stop(received)
+
+	_, err := Run(context.Background(), domain.Hook{Type: domain.HookSignal, PIDFile: pidFile, Signal: "SIGUSR1"},
+		testEvent)
+	require.NoError(t, err)
+	select {
+	case sig := <-received:
+		assert.Equal(t, syscall.SIGUSR1, sig)
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal not received")
+	}
+
+	require.NoError(t, os.WriteFile(pidFile, []byte("nginx"), 0600))
+	_, err = Run(context.Background(), domain.Hook{Type: domain.HookSignal, PIDFile: pidFile}, testEvent)
+	assert.Error(t, err)
+}
@@ -0,0 +1,418 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/util"
+)
+
+const (
+	// backupManifestFile describes the generations kept in a backup directory
+	backupManifestFile = "manifest.json"
+	// backupIDFormat names the directory of a generation from the time it was taken
+	backupIDFormat = "20060102T150405Z"
+)
+
+var (
+	// ErrNoBackupGeneration is returned when restoring a generation of backups that doesn't exist
+	ErrNoBackupGeneration = errors.New("backup generation not found")
+	// ErrEmptyBackupGeneration is returned when restoring a generation of backups taken when no certificate was
+	// installed
+	ErrEmptyBackupGeneration = errors.New("backup generation has no files")
+)
+
+// takenGenerations is the ID of the latest generation of backups taken by this process for each installation. A
+// Rollback restores this generation, never an older one
+var takenGenerations sync.Map // generationKey -> generation ID
+
+// generationKey identifies the generations of an installation: several installations may share a backup directory
+type generationKey struct {
+	dir      string
+	location string
+}
+
+// VersionedInstaller is implemented by the installers keeping several generations of backups of their location
+type VersionedInstaller interface {
+	Installer
+
+	// Generations returns the backups of the location, the latest first
+	Generations() ([]BackupGeneration, error)
+
+	// Restore installs the generation of the backups of the location again, 1 being the latest. The current version
+	// is backed up first
+	Restore(generation int) error
+}
+
+// BackupDiscarder is implemented by the installers whose backups hold the private key. The backup a transaction takes
+// of an installation without backupFiles is discarded once the transaction is over
+type BackupDiscarder interface {
+	// DiscardBackup removes the backup taken by the latest call to Backup
+	DiscardBackup() error
+}
+
+// BackupGeneration is a backup of the files of an installation, taken before installing a new certificate
+type BackupGeneration struct {
+	// ID names the directory of the generation, from the time it was taken
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Location is the file of the installation the generation was taken of, keeping apart the generations of the
+	// installations sharing a backup directory
+	Location string `json:"location"`
+	// Serial and NotAfter identify the certificate backed up, when it could be read
+	Serial   string       `json:"serial,omitempty"`
+	NotAfter *time.Time   `json:"notAfter,omitempty"`
+	Files    []BackupFile `json:"files"`
+}
+
+// BackupFile is a file of a BackupGeneration
+type BackupFile struct {
+	// Path is the location of the file
+	Path string `json:"path"`
+	// Backup is the path of its copy, relative to the backup directory
+	Backup string `json:"backup"`
+}
+
+// backupManifest lists the generations of a backup directory, the oldest first
+type backupManifest struct {
+	Generations []BackupGeneration `json:"generations"`
+}
+
+// backupFiles takes a new generation of backups of the locations of inst that exist, then removes the generations
+// that are beyond the BackupPolicy of inst. cert is the certificate installed, if known.
+//
+// A generation is taken even if none of the locations exist, so that rolling back the installation removes them
+func backupFiles(inst domain.Installation, cert *x509.Certificate, locations ...string) error {
+	// the backups of the files holding the key, and the ones without, share a directory
+	options, err := keyFileOptions(inst)
+	if err != nil {
+		return err
+	}
+	maxAge, err := inst.BackupMaxAge()
+	if err != nil {
+		return err
+	}
+
+	dir := inst.BackupDir()
+	manifest, err := readBackupManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	generation := BackupGeneration{ID: now.Format(backupIDFormat), Time: now, Location: inst.File}
+	// two backups in the same second get distinct directories
+	for i := 2; backupExists(manifest, generation.ID); i++ {
+		generation.ID = fmt.Sprintf("%s-%d", now.Format(backupIDFormat), i)
+	}
+	if cert != nil {
+		generation.Serial = cert.SerialNumber.String()
+		notAfter := cert.NotAfter
+		generation.NotAfter = &notAfter
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, generation.ID), 0700)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for i, location := range locations {
+		if location == "" {
+			continue
+		}
+		content, err := os.ReadFile(location)
+		if errors.Is(err, fs.ErrNotExist) {
+			zap.L().Info(fmt.Sprintf("file %s does not exist, no backup taken", location))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// files of different directories may have the same name
+		name := filepath.Base(location)
+		if names[name] {
+			name = fmt.Sprintf("%d-%s", i, name)
+		}
+		names[name] = true
+		backup := filepath.Join(generation.ID, name)
+		err = util.WriteFileWithOptions(filepath.Join(dir, backup), content, options)
+		if err != nil {
+			return err
+		}
+		generation.Files = append(generation.Files, BackupFile{Path: location, Backup: filepath.ToSlash(backup)})
+		zap.L().Info("certificate resource backed up", zap.String("location", location),
+			zap.String("backupLocation", filepath.Join(dir, backup)))
+	}
+
+	generations := append(manifest.generationsOf(inst.File), generation)
+	generations = pruneBackups(dir, generations, inst.BackupKeep(), maxAge, now)
+	manifest.setGenerationsOf(inst.File, generations)
+	err = writeBackupManifest(dir, manifest)
+	if err != nil {
+		return err
+	}
+	takenGenerations.Store(generationKey{dir: dir, location: inst.File}, generation.ID)
+	return nil
+}
+
+// backupGenerations returns the generations of backups of inst, the latest first
+func backupGenerations(inst domain.Installation) ([]BackupGeneration, error) {
+	manifest, err := readBackupManifest(inst.BackupDir())
+	if err != nil {
+		return nil, err
+	}
+	own := manifest.generationsOf(inst.File)
+	generations := make([]BackupGeneration, 0, len(own))
+	for i := len(own) - 1; i >= 0; i-- {
+		generations = append(generations, own[i])
+	}
+	return generations, nil
+}
+
+// readBackupGeneration returns the content of the files of generation of inst, 1 being the latest, by location
+func readBackupGeneration(inst domain.Installation, generation int) (map[string][]byte, error) {
+	generations, err := backupGenerations(inst)
+	if err != nil {
+		return nil, err
+	}
+	if generation < 1 || generation > len(generations) {
+		return nil, fmt.Errorf("%w: %d, %s has %d for %s", ErrNoBackupGeneration, generation, inst.BackupDir(),
+			len(generations), inst.File)
+	}
+
+	return readGenerationFiles(inst, generations[generation-1])
+}
+
+// readGenerationFiles returns the content of the files of generation of inst, by location
+func readGenerationFiles(inst domain.Installation, generation BackupGeneration) (map[string][]byte, error) {
+	contents := make(map[string][]byte)
+	for _, file := range generation.Files {
+		content, err := os.ReadFile(filepath.Join(inst.BackupDir(), filepath.FromSlash(file.Backup)))
+		if err != nil {
+			return nil, err
+		}
+		contents[file.Path] = content
+	}
+	return contents, nil
+}
+
+// restoreFiles writes contents back to their locations, with the permissions and ownership set in inst. The
+// locations without content did not exist when the backup was taken, so they are removed
+func restoreFiles(inst domain.Installation, contents map[string][]byte, locations ...string) error {
+	for _, location := range locations {
+		if location == "" {
+			continue
+		}
+		content, found := contents[location]
+		if !found {
+			err := os.Remove(location)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			zap.L().Info("certificate resource removed", zap.String("location", location))
+			continue
+		}
+
+		options, err := fileOptions(inst, location)
+		if err != nil {
+			return err
+		}
+		err = util.WriteFileWithOptions(location, content, options)
+		if err != nil {
+			return err
+		}
+		zap.L().Info("certificate resource restored", zap.String("location", location))
+	}
+	return nil
+}
+
+// rollbackFiles restores the locations of inst from the generation of backups taken before the installation, removing
+// the ones it doesn't have. It fails if no generation was taken, rather than restoring an older one
+func rollbackFiles(inst domain.Installation, locations ...string) error {
+	id, taken := takenGenerations.Load(generationKey{dir: inst.BackupDir(), location: inst.File})
+	if !taken {
+		return fmt.Errorf("%w: no backup of %s was taken in %s before the installation", ErrNoBackupGeneration,
+			inst.File, inst.BackupDir())
+	}
+	generations, err := backupGenerations(inst)
+	if err != nil {
+		return err
+	}
+	for _, generation := range generations {
+		if generation.ID != id {
+			continue
+		}
+		contents, err := readGenerationFiles(inst, generation)
+		if err != nil {
+			return err
+		}
+		return restoreFiles(inst, contents, locations...)
+	}
+	return fmt.Errorf("%w: %s in %s", ErrNoBackupGeneration, id, inst.BackupDir())
+}
+
+// discardFiles removes the generation of backups of inst taken by this process. The manifest, and the backup directory
+// if it is empty, are removed with the last generation
+func discardFiles(inst domain.Installation) error {
+	dir := inst.BackupDir()
+	id, taken := takenGenerations.LoadAndDelete(generationKey{dir: dir, location: inst.File})
+	if !taken {
+		return nil
+	}
+	manifest, err := readBackupManifest(dir)
+	if err != nil {
+		return err
+	}
+	generations := manifest.generationsOf(inst.File)
+	kept := make([]BackupGeneration, 0, len(generations))
+	for _, generation := range generations {
+		if generation.ID != id {
+			kept = append(kept, generation)
+		}
+	}
+	manifest.setGenerationsOf(inst.File, kept)
+
+	err = os.RemoveAll(filepath.Join(dir, id.(string)))
+	if err != nil {
+		return err
+	}
+	zap.L().Info("backup removed", zap.String("location", filepath.Join(dir, id.(string))))
+	if len(manifest.Generations) > 0 {
+		return writeBackupManifest(dir, manifest)
+	}
+	err = os.Remove(filepath.Join(dir, backupManifestFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	// a directory holding other files is kept
+	_ = os.Remove(dir)
+	return nil
+}
+
+// restoreGeneration installs generation of the backups of inst again, after backing up its current version with
+// backup. Only the locations in the generation are written
+func restoreGeneration(inst domain.Installation, generation int, backup func() error) error {
+	contents, err := readBackupGeneration(inst, generation)
+	if err != nil {
+		return err
+	}
+	if len(contents) == 0 {
+		return fmt.Errorf("%w: %d, in %s", ErrEmptyBackupGeneration, generation, inst.BackupDir())
+	}
+	err = backup()
+	if err != nil {
+		return err
+	}
+	locations := make([]string, 0, len(contents))
+	for location := range contents {
+		locations = append(locations, location)
+	}
+	return restoreFiles(inst, contents, locations...)
+}
+
+// pruneBackups removes the directories of the generations beyond keep, or older than maxAge if it is not 0, and
+// returns the generations left. The latest generation is always kept
+func pruneBackups(dir string, generations []BackupGeneration, keep int, maxAge time.Duration, now time.Time) []BackupGeneration {
+	kept := make([]BackupGeneration, 0, len(generations))
+	for i, generation := range generations {
+		latest := i == len(generations)-1
+		tooMany := len(generations)-i > keep
+		tooOld := maxAge > 0 && now.Sub(generation.Time) > maxAge
+		if latest || !(tooMany || tooOld) {
+			kept = append(kept, generation)
+			continue
+		}
+		err := os.RemoveAll(filepath.Join(dir, generation.ID))
+		if err != nil {
+			zap.L().Warn("failed to remove backup", zap.String("location", filepath.Join(dir, generation.ID)),
+				zap.Error(err))
+			kept = append(kept, generation)
+			continue
+		}
+		zap.L().Info("old backup removed", zap.String("location", filepath.Join(dir, generation.ID)))
+	}
+	return kept
+}
+
+// generationsOf returns the generations of the installation of location, the oldest first
+func (m backupManifest) generationsOf(location string) []BackupGeneration {
+	var generations []BackupGeneration
+	for _, generation := range m.Generations {
+		if generation.Location == location {
+			generations = append(generations, generation)
+		}
+	}
+	return generations
+}
+
+// setGenerationsOf replaces the generations of the installation of location, leaving the ones of the other
+// installations sharing the backup directory alone
+func (m *backupManifest) setGenerationsOf(location string, generations []BackupGeneration) {
+	kept := make([]BackupGeneration, 0, len(m.Generations)+len(generations))
+	for _, generation := range m.Generations {
+		if generation.Location != location {
+			kept = append(kept, generation)
+		}
+	}
+	m.Generations = append(kept, generations...)
+}
+
+func backupExists(manifest backupManifest, id string) bool {
+	for _, generation := range manifest.Generations {
+		if generation.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func readBackupManifest(dir string) (backupManifest, error) {
+	var manifest backupManifest
+	data, err := os.ReadFile(filepath.Join(dir, backupManifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("invalid backup manifest %s: %w", filepath.Join(dir, backupManifestFile), err)
+	}
+	return manifest, nil
+}
+
+func writeBackupManifest(dir string, manifest backupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileWithOptions(filepath.Join(dir, backupManifestFile), data, util.FileOptions{Mode: 0600})
+}
@@ -19,6 +19,10 @@
 package installer
 
 import (
+	// nolint:gosec // CAPI identifies certificates by their SHA-1 thumbprint
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"strings"
 
@@ -44,10 +48,30 @@ func NewCAPIInstaller(inst domain.Installation) CAPIInstaller {
 // Check is the method in charge of making the validations to install a new certificate:
 // 1. Does the certificate exists? > Install if it doesn't.
 // 2. Does the certificate is about to expire? Renew if about to expire.
+// 3. Does the certificate match the request? Re-issue if it doesn't. See Drift.
 // Returns true if the certificate needs to be installed.
 func (r CAPIInstaller) Check(renewBefore string, request domain.PlaybookRequest) (bool, error) {
 	zap.L().Info("checking certificate health", zap.String("format", r.Type.String()), zap.String("location", r.CAPILocation))
 
+	cert, err := r.InstalledCertificate(request)
+	if err != nil {
+		return true, err
+	}
+
+	// Certificate was not found.
+	if cert == nil {
+		zap.L().Info("certificate not found")
+		return true, nil
+	}
+
+	// Check certificate expiration and drift from the request
+	renew := needReissue(cert, renewBefore, request)
+
+	return renew, nil
+}
+
+// InstalledCertificate returns the certificate currently installed in the location, or nil if there is none
+func (r CAPIInstaller) InstalledCertificate(request domain.PlaybookRequest) (*x509.Certificate, error) {
 	// Get friendly name. If no friendly name is set, get CN from request as friendly name.
 	//  NOTE: This functionality is deprecated, and in a future version will be removed, and CAPIFriendlyName will be req'd
 	friendlyName := r.CAPIFriendlyName
@@ -64,7 +88,7 @@ func (r CAPIInstaller) Check(renewBefore string, request domain.PlaybookRequest)
 	storeLocation, storeName, err := getCertStore(location)
 	if err != nil {
 		zap.L().Error("failed to get certificate store", zap.Error(err))
-		return true, err
+		return nil, err
 	}
 
 	config := capistore.InstallationConfig{
@@ -78,25 +102,15 @@ func (r CAPIInstaller) Check(renewBefore string, request domain.PlaybookRequest)
 	certPem, err := ps.RetrieveCertificateFromCAPI(config)
 	if err != nil {
 		zap.L().Error("failed to retrieve certificate from CAPI store", zap.Error(err))
-		return true, err
+		return nil, err
 	}
 
 	// Certificate was not found.
 	if certPem == "" {
-		zap.L().Info("certificate not found")
-		return true, nil
+		return nil, nil
 	}
 
-	// Check certificate expiration
-	cert, err := parsePEMCertificate([]byte(certPem))
-	if err != nil {
-		return false, err
-	}
-
-	// Check certificate expiration
-	renew := needRenewal(cert, renewBefore)
-
-	return renew, nil
+	return parsePEMCertificate([]byte(certPem))
 }
 
 // Backup takes the certificate request and backs up the current version prior to overwriting
@@ -159,6 +173,49 @@ func (r CAPIInstaller) Install(pcc certificate.PEMCollection) error {
 	return nil
 }
 
+// Rollback undoes the installation of pcc and restores the location from the data of Backup.
+//
+// The previous certificate is kept in the CAPI store when a new one is installed, so the certificate of pcc and its
+// private key are removed from the store. Its chain certificates are kept
+func (r CAPIInstaller) Rollback(pcc certificate.PEMCollection) error {
+	zap.L().Debug("rolling back certificate", zap.String("location", r.CAPILocation))
+
+	cert, err := parsePEMCertificate([]byte(pcc.Certificate))
+	if err != nil {
+		return err
+	}
+	// nolint:gosec // CAPI identifies certificates by their SHA-1 thumbprint
+	thumbprint := sha1.Sum(cert.Raw)
+
+	// Get location from CAPILocation. If CAPILocation is not set, check deprecated Location field
+	location := r.CAPILocation
+	if location == "" {
+		location = r.Location
+	}
+
+	storeLocation, storeName, err := getCertStore(location)
+	if err != nil {
+		zap.L().Error("failed to get certificate store", zap.Error(err))
+		return err
+	}
+
+	config := capistore.InstallationConfig{
+		StoreLocation: storeLocation,
+		StoreName:     storeName,
+		Thumbprint:    strings.ToUpper(hex.EncodeToString(thumbprint[:])),
+	}
+
+	ps := capistore.NewPowerShell()
+
+	err = ps.RemoveCertificateFromCAPI(config)
+	if err != nil {
+		zap.L().Error("failed to remove certificate from CAPI store", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
 // AfterInstallActions runs any instructions declared in the Installer on a terminal.
 //
 // No validations happen over the content of the AfterAction string, so caution is advised
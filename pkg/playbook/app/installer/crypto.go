@@ -23,10 +23,9 @@ import (
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -136,12 +135,17 @@ func loadPEMCertificate(certFile string) (*x509.Certificate, error) {
 	return parsePEMCertificate(certData)
 }
 
+// parsePEMCertificate returns the first certificate of certData. Other PEM blocks before it, such as the private key
+// of a key+fullchain bundle, are skipped
 func parsePEMCertificate(certData []byte) (*x509.Certificate, error) {
-	p, _ := pem.Decode(certData)
+	p, rest := pem.Decode(certData)
 	if p == nil {
 		return nil, fmt.Errorf("could not decode PEM data")
 	}
-	if p.Type != "CERTIFICATE" {
+	for p != nil && p.Type != "CERTIFICATE" {
+		p, rest = pem.Decode(rest)
+	}
+	if p == nil {
 		return nil, fmt.Errorf("certificate data does not contain a certificate")
 	}
 
@@ -154,32 +158,19 @@ func parsePEMCertificate(certData []byte) (*x509.Certificate, error) {
 }
 
 func needRenewal(cert *x509.Certificate, renewBefore string) bool {
+	timeToRenew, err := util.RenewalTime(cert.NotBefore, cert.NotAfter, renewBefore)
 	// if duration is 0 anything, then return false, auto-renewal is disabled
-	if renewBefore == "0" || strings.ToLower(renewBefore) == "disabled" {
+	if errors.Is(err, util.ErrRenewalDisabled) {
 		zap.L().Warn("certificate expiring soon but automatic renewal disabled",
 			zap.String("certificate", cert.Subject.CommonName),
 			zap.String("expirationDate", cert.NotAfter.String()))
 		return false
 	}
-
-	timePostfix := renewBefore[len(renewBefore)-1:]
-
-	renew := renewBefore[:len(renewBefore)-1]
-	renewValue, err := strconv.ParseInt(renew, 10, 32)
 	if err != nil {
 		zap.L().Error("could not parse renewBefore value. Using default value [10%] instead",
 			zap.String("renewBefore", renewBefore), zap.Error(err))
 		// TODO: use real global default duration
-		timePostfix = "%"
-		renewValue = 10
-	}
-
-	// if duration is 0 anything, then return false, auto-renewal is disabled
-	if renewValue == 0 {
-		zap.L().Warn("certificate expiring soon but automatic renewal disabled",
-			zap.String("certificate", cert.Subject.CommonName),
-			zap.String("expirationDate", cert.NotAfter.String()))
-		return false
+		timeToRenew, _ = util.RenewalTime(cert.NotBefore, cert.NotAfter, "10%")
 	}
 
 	// Cert expired, renew
@@ -188,37 +179,6 @@ func needRenewal(cert *x509.Certificate, renewBefore string) bool {
 		return true
 	}
 
-	var timeToRenew time.Time
-
-	switch timePostfix {
-	case "d":
-		// operation happens in integers to avoid issues with linter and time.Duration struct
-		ns := DayDuration.Nanoseconds()
-		renewDuration := time.Duration(ns * renewValue)
-		timeToRenew = cert.NotAfter.Add(-renewDuration)
-	case "h":
-		ns := time.Hour.Nanoseconds()
-		renewDuration := time.Duration(ns * renewValue)
-		timeToRenew = cert.NotAfter.Add(-renewDuration)
-	case "%":
-		// Total # of ns in the whole certificate lifetime
-		nsCertValidity := cert.NotAfter.Sub(cert.NotBefore).Nanoseconds()
-
-		// if 10%, then renew when 90% of the validity time has elapsed
-		pct := float64(renewValue) / 100
-		renewDuration := time.Duration(float64(nsCertValidity) * pct)
-		timeToRenew = cert.NotAfter.Add(-renewDuration)
-	default:
-		zap.L().Warn("unknown duration postfix. Valid postfixes are: d (Days) and h (Hours): Using default [10%]",
-			zap.String("postfix", timePostfix))
-		// Total # of ns in the whole certificate lifetime
-		nsCertValidity := cert.NotAfter.Sub(cert.NotBefore).Nanoseconds()
-
-		// TODO: Respect global DefaultRenewal
-		renewDuration := time.Duration(float64(nsCertValidity) * float64(0.10))
-		timeToRenew = cert.NotAfter.Add(-renewDuration)
-	}
-
 	// Check certificate renew window
 	//Time now + renew window is bigger than cert expiration day? Then renew
 	if time.Now().After(timeToRenew) {
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vcertutil"
+)
+
+// Drift compares the installed certificate cert with request and returns the differences, or nil if cert matches it.
+//
+// Only the values set in request are compared: subject, SANs, key algorithm and size or curve, extended key usages and
+// issuer. Only the requested values missing from cert are reported: the CA or the policy of the zone may add values,
+// like extended key usages, organizational units or the common name as a DNS SAN. Subject values are compared ignoring
+// case. The subject, SANs and key of a user provided CSR are not compared, they don't come from the request.
+func Drift(cert *x509.Certificate, request domain.PlaybookRequest) []string {
+	var drift []string
+	installed := certificate.NewRequest(cert)
+
+	if !strings.HasPrefix(request.CsrOrigin, certificate.StrUserProvidedCSR+":") {
+		drift = append(drift, subjectDrift(cert, request.Subject)...)
+		drift = append(drift, sanDrift(installed, request)...)
+		drift = append(drift, keyDrift(installed, request)...)
+	}
+
+	if len(request.ExtKeyUsages) > 0 {
+		expected := make([]string, 0, len(request.ExtKeyUsages))
+		for _, eku := range request.ExtKeyUsages {
+			expected = append(expected, eku.String())
+		}
+		actual := make([]string, 0, len(cert.ExtKeyUsage))
+		for _, eku := range cert.ExtKeyUsage {
+			e := certificate.ExtKeyUsage(eku)
+			actual = append(actual, e.String())
+		}
+		drift = append(drift, listDrift("extended key usages", expected, actual)...)
+	}
+
+	if request.Issuer != "" && !strings.EqualFold(request.Issuer, cert.Issuer.CommonName) &&
+		!strings.EqualFold(request.Issuer, cert.Issuer.String()) {
+		drift = append(drift, fmt.Sprintf("issuer %q doesn't match %q", cert.Issuer.String(), request.Issuer))
+	}
+	return drift
+}
+
+// needReissue returns true when cert must be replaced: it expired, entered its renew window or drifted from request.
+// The differences with request are logged
+func needReissue(cert *x509.Certificate, renewBefore string, request domain.PlaybookRequest) bool {
+	if needRenewal(cert, renewBefore) {
+		return true
+	}
+	drift := Drift(cert, request)
+	if len(drift) == 0 {
+		return false
+	}
+	zap.L().Info("installed certificate doesn't match the request", zap.String("certificate", cert.Subject.CommonName),
+		zap.Strings("drift", drift))
+	return true
+}
+
+func subjectDrift(cert *x509.Certificate, subject domain.Subject) []string {
+	var drift []string
+	if subject.CommonName != "" && !strings.EqualFold(subject.CommonName, cert.Subject.CommonName) {
+		drift = append(drift, fmt.Sprintf("common name %q doesn't match %q", cert.Subject.CommonName,
+			subject.CommonName))
+	}
+	for _, attr := range []struct {
+		name     string
+		expected string
+		actual   []string
+	}{
+		{"organization", subject.Organization, cert.Subject.Organization},
+		{"locality", subject.Locality, cert.Subject.Locality},
+		{"state", subject.Province, cert.Subject.Province},
+		{"country", subject.Country, cert.Subject.Country},
+	} {
+		if attr.expected == "" {
+			continue
+		}
+		if !contains(lower(attr.actual), strings.ToLower(attr.expected)) {
+			drift = append(drift, fmt.Sprintf("%s %q doesn't match %q", attr.name, strings.Join(attr.actual, ","),
+				attr.expected))
+		}
+	}
+	if len(subject.OrgUnits) > 0 {
+		drift = append(drift, listDrift("organizational units", lower(subject.OrgUnits),
+			lower(cert.Subject.OrganizationalUnit))...)
+	}
+	return drift
+}
+
+func sanDrift(installed *certificate.Request, request domain.PlaybookRequest) []string {
+	if request.OmitSANs {
+		return nil
+	}
+	var drift []string
+	drift = append(drift, listDrift("DNS SANs", lower(request.DNSNames), lower(installed.DNSNames))...)
+	drift = append(drift, listDrift("email SANs", lower(request.EmailAddresses), lower(installed.EmailAddresses))...)
+
+	// IPs are compared in their canonical form
+	expectedIPs := make([]string, 0, len(request.IPAddresses))
+	for _, ip := range request.IPAddresses {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ip = parsed.String()
+		}
+		expectedIPs = append(expectedIPs, ip)
+	}
+	actualIPs := make([]string, 0, len(installed.IPAddresses))
+	for _, ip := range installed.IPAddresses {
+		actualIPs = append(actualIPs, ip.String())
+	}
+	drift = append(drift, listDrift("IP SANs", expectedIPs, actualIPs)...)
+
+	actualURIs := make([]string, 0, len(installed.URIs))
+	for _, uri := range installed.URIs {
+		actualURIs = append(actualURIs, uri.String())
+	}
+	drift = append(drift, listDrift("URI SANs", request.URIs, actualURIs)...)
+	drift = append(drift, listDrift("UPN SANs", lower(request.UPNs), lower(installed.UPNs))...)
+	return drift
+}
+
+// keyDrift compares the key of the installed certificate with the one requested, using the same defaults as the
+// enrollment: RSA 2048 when the key type is not set
+func keyDrift(installed *certificate.Request, request domain.PlaybookRequest) []string {
+	if installed.KeyType != request.KeyType {
+		return []string{fmt.Sprintf("key type %s doesn't match %s", installed.KeyType.String(),
+			request.KeyType.String())}
+	}
+	switch request.KeyType {
+	case certificate.KeyTypeRSA:
+		size := request.KeyLength
+		if size <= 0 {
+			size = vcertutil.DefaultRSALength
+		}
+		if installed.KeyLength != size {
+			return []string{fmt.Sprintf("key size %d doesn't match %d", installed.KeyLength, size)}
+		}
+	case certificate.KeyTypeECDSA:
+		if request.KeyCurve != certificate.EllipticCurveNotSet && installed.KeyCurve != request.KeyCurve {
+			return []string{fmt.Sprintf("key curve %s doesn't match %s", installed.KeyCurve.String(),
+				request.KeyCurve.String())}
+		}
+	}
+	return nil
+}
+
+// listDrift reports the expected values of a list missing from actual, ignoring their order. The values in actual
+// that were not expected were added by the CA or the policy, they are not reported
+func listDrift(name string, expected []string, actual []string) []string {
+	var missing []string
+	for _, v := range expected {
+		if !contains(actual, v) {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return []string{fmt.Sprintf("missing %s: %s", name, strings.Join(missing, ", "))}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func lower(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, strings.ToLower(v))
+	}
+	return out
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+// testCertificate returns a certificate for key, issued by "Test CA"
+func testCertificate(t *testing.T, template *x509.Certificate, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	template.SerialNumber = big.NewInt(2)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestDrift(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	cert := testCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "www.vcert.test",
+			Organization:       []string{"Venafi"},
+			OrganizationalUnit: []string{"Dev", "Ops"},
+		},
+		DNSNames:    []string{"www.vcert.test", "vcert.test"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, rsaKey)
+
+	request := domain.PlaybookRequest{
+		Subject: domain.Subject{
+			CommonName:   "WWW.vcert.test",
+			Organization: "Venafi",
+			OrgUnits:     []string{"Ops", "Dev"},
+		},
+		DNSNames:     []string{"vcert.test"},
+		IPAddresses:  []string{"10.0.0.1"},
+		ExtKeyUsages: certificate.ExtKeyUsageSlice{certificate.ExtKeyUsage(x509.ExtKeyUsageServerAuth)},
+		Issuer:       "Test CA",
+	}
+	assert.Empty(t, Drift(cert, request))
+
+	// values not set in the request are not compared
+	assert.Empty(t, Drift(cert, domain.PlaybookRequest{}))
+
+	changed := request
+	changed.Subject.CommonName = "api.vcert.test"
+	changed.Subject.Organization = "Venafi Inc."
+	assert.Equal(t, []string{
+		`common name "www.vcert.test" doesn't match "api.vcert.test"`,
+		`organization "Venafi" doesn't match "Venafi Inc."`,
+	}, Drift(cert, changed))
+
+	// subject values are compared ignoring case, and the ones added by the policy are ignored
+	changed = request
+	changed.Subject.Organization = "VENAFI"
+	changed.Subject.OrgUnits = []string{"ops"}
+	assert.Empty(t, Drift(cert, changed))
+
+	changed = request
+	changed.DNSNames = []string{"vcert.test", "api.vcert.test"}
+	changed.IPAddresses = nil
+	changed.URIs = []string{"spiffe://vcert.test/api"}
+	assert.Equal(t, []string{
+		"missing DNS SANs: api.vcert.test",
+		"missing URI SANs: spiffe://vcert.test/api",
+	}, Drift(cert, changed))
+
+	changed = request
+	changed.KeyLength = 4096
+	assert.Equal(t, []string{"key size 2048 doesn't match 4096"}, Drift(cert, changed))
+	changed.KeyType = certificate.KeyTypeECDSA
+	assert.Equal(t, []string{"key type RSA doesn't match ECDSA"}, Drift(cert, changed))
+
+	changed = request
+	changed.ExtKeyUsages = certificate.ExtKeyUsageSlice{certificate.ExtKeyUsage(x509.ExtKeyUsageClientAuth)}
+	changed.Issuer = "Other CA"
+	assert.Equal(t, []string{
+		"missing extended key usages: ClientAuth",
+		`issuer "CN=Test CA" doesn't match "Other CA"`,
+	}, Drift(cert, changed))
+
+	// the subject, SANs and key of a user provided CSR don't come from the request
+	changed = request
+	changed.CsrOrigin = "file:/etc/ssl/www.csr"
+	changed.Subject.CommonName = "api.vcert.test"
+	changed.KeyLength = 4096
+	assert.Empty(t, Drift(cert, changed))
+}
+
+func TestDrift_AddedByCA(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	// the CA added the ClientAuth EKU, an organizational unit and a DNS SAN to the request
+	cert := testCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "www.vcert.test",
+			OrganizationalUnit: []string{"Dev", "Managed by Venafi"},
+		},
+		DNSNames:    []string{"www.vcert.test", "vcert.test"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, rsaKey)
+
+	request := domain.PlaybookRequest{
+		Subject:      domain.Subject{CommonName: "www.vcert.test", OrgUnits: []string{"Dev"}},
+		DNSNames:     []string{"vcert.test"},
+		ExtKeyUsages: certificate.ExtKeyUsageSlice{certificate.ExtKeyUsage(x509.ExtKeyUsageServerAuth)},
+	}
+	assert.Empty(t, Drift(cert, request))
+}
+
+func TestDrift_ECDSA(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	cert := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ec.vcert.test"}}, ecKey)
+
+	request := domain.PlaybookRequest{KeyType: certificate.KeyTypeECDSA}
+	assert.Empty(t, Drift(cert, request))
+	request.KeyCurve = certificate.EllipticCurveP384
+	assert.Empty(t, Drift(cert, request))
+	request.KeyCurve = certificate.EllipticCurveP256
+	assert.Equal(t, []string{"key curve P384 doesn't match P256"}, Drift(cert, request))
+
+	// RSA 2048 is enrolled when the key type is not set
+	assert.Equal(t, []string{"key type ECDSA doesn't match RSA"}, Drift(cert, domain.PlaybookRequest{}))
+}
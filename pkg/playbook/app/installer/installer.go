@@ -17,8 +17,12 @@
 package installer
 
 import (
+	"crypto/x509"
+	"slices"
+
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/util"
 )
 
 // Installer represents the interface for all installers.
@@ -28,6 +32,7 @@ type Installer interface {
 	// Check is the method in charge of making the validations to install a new certificate:
 	// 1. Does the certificate exists? > Install if it doesn't.
 	// 2. Does the certificate is about to expire? Renew if about to expire.
+	// 3. Does the certificate match the request? Re-issue if it doesn't. See Drift.
 	// Returns true if the certificate needs to be installed.
 	Check(renewBefore string, request domain.PlaybookRequest) (bool, error)
 
@@ -46,4 +51,74 @@ type Installer interface {
 	// "0" for successful validation and "1" for a validation failure
 	// No validations happen over the content of the InstallValidation string, so caution is advised
 	InstallValidationActions() (string, error)
+
+	// Rollback undoes the installation of pcc and restores the location from the data of the latest Backup.
+	// A location that had no backup is left without a certificate
+	Rollback(pcc certificate.PEMCollection) error
+}
+
+// CertificateReader is an Installer that can read the certificate installed in its location. The certificate is
+// read once per run and used for the checks, the run report and the hooks, with CheckCertificate instead of Check.
+// All the installers of this package implement it.
+type CertificateReader interface {
+	Installer
+
+	// InstalledCertificate returns the certificate currently installed in the location, or nil if there is none
+	InstalledCertificate(request domain.PlaybookRequest) (*x509.Certificate, error)
+}
+
+// CheckCertificate is Check for cert, the certificate installed in a location, or nil if there is none. It returns
+// true if cert needs to be installed again.
+func CheckCertificate(cert *x509.Certificate, renewBefore string, request domain.PlaybookRequest) bool {
+	return cert == nil || needReissue(cert, renewBefore, request)
+}
+
+// fileOptions returns the permissions and ownership of location, a file written by inst. The files holding the
+// private key get the key file mode of inst, the others its file mode
+func fileOptions(inst domain.Installation, location string) (util.FileOptions, error) {
+	getMode := inst.FileMode
+	if holdsKey(inst, location) {
+		getMode = inst.KeyFileMode
+	}
+	mode, err := getMode()
+	if err != nil {
+		return util.FileOptions{}, err
+	}
+	options := util.FileOptions{Mode: mode, Owner: inst.Owner, Group: inst.Group, KeepExisting: keepsFileOptions(inst)}
+	return options, nil
+}
+
+// keyFileOptions returns the permissions and ownership of the files written by inst holding the private key
+func keyFileOptions(inst domain.Installation) (util.FileOptions, error) {
+	mode, err := inst.KeyFileMode()
+	if err != nil {
+		return util.FileOptions{}, err
+	}
+	options := util.FileOptions{Mode: mode, Owner: inst.Owner, Group: inst.Group, KeepExisting: keepsFileOptions(inst)}
+	return options, nil
+}
+
+// keepsFileOptions returns true if inst sets none of the permissions and ownership of its files. The files it replaces
+// then keep theirs, and only the new ones get the defaults
+func keepsFileOptions(inst domain.Installation) bool {
+	return inst.Mode == "" && inst.KeyMode == "" && inst.Owner == "" && inst.Group == ""
+}
+
+// holdsKey returns true if location, a file written by inst, holds the private key: the keystores, the key file and
+// the PEM files whose layout has the key. A layout that can't be parsed is assumed to hold it
+func holdsKey(inst domain.Installation, location string) bool {
+	if inst.Type != domain.FormatPEM || location == inst.KeyFile {
+		return true
+	}
+	bundles := append([]domain.PEMBundle{{File: inst.File, Layout: inst.Layout}}, inst.Bundles...)
+	for _, bundle := range bundles {
+		if bundle.File != location {
+			continue
+		}
+		parts, err := domain.ParsePEMLayout(bundle.Layout)
+		if err != nil || slices.Contains(parts, domain.PEMPartKey) {
+			return true
+		}
+	}
+	return false
 }
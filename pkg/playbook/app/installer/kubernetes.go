@@ -0,0 +1,341 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/util"
+)
+
+const (
+	// the keys of a kubernetes.io/tls Secret
+	secretKeyCertificate = "tls.crt"
+	secretKeyPrivateKey  = "tls.key"
+	secretKeyCA          = "ca.crt"
+
+	// backupSuffix is appended to the name of a Secret to name its backup copy
+	backupSuffix = "-vcert-backup"
+	// AnnotationBackupOf is set on the backup copy of a Secret to the name of the Secret
+	AnnotationBackupOf = "vcert.venafi.com/backup-of"
+	// AnnotationBackupTime is set on the backup copy of a Secret to the time it was taken
+	AnnotationBackupTime = "vcert.venafi.com/backup-time"
+)
+
+// KubernetesInstaller represents an installation that will use a kubernetes.io/tls Secret for the certificate bundle
+type KubernetesInstaller struct {
+	domain.Installation
+}
+
+// NewKubernetesInstaller returns a new installer of type KUBERNETES with the values defined in inst
+func NewKubernetesInstaller(inst domain.Installation) KubernetesInstaller {
+	return KubernetesInstaller{inst}
+}
+
+// Check is the method in charge of making the validations to install a new certificate:
+// 1. Does the certificate exists? > Install if it doesn't.
+// 2. Does the certificate is about to expire? Renew if about to expire.
+// 3. Does the certificate match the request? Re-issue if it doesn't. See Drift.
+// Returns true if the certificate needs to be installed.
+func (r KubernetesInstaller) Check(renewBefore string, request domain.PlaybookRequest) (bool, error) {
+	zap.L().Info("checking certificate health", zap.String("format", r.Type.String()),
+		zap.String("location", r.Kubernetes.String()))
+
+	cert, err := r.InstalledCertificate(request)
+	if err != nil {
+		return false, err
+	}
+	if cert == nil {
+		return true, nil
+	}
+
+	// Check certificate expiration and drift from the request
+	renew := needReissue(cert, renewBefore, request)
+
+	return renew, nil
+}
+
+// InstalledCertificate returns the certificate currently installed in the location, or nil if there is none
+func (r KubernetesInstaller) InstalledCertificate(_ domain.PlaybookRequest) (*x509.Certificate, error) {
+	client, namespace, err := r.client()
+	if err != nil {
+		return nil, err
+	}
+	s, err := client.getSecret(namespace, r.Kubernetes.Name)
+	if errors.Is(err, errSecretNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	certData := s.Data[secretKeyCertificate]
+	if len(certData) == 0 {
+		return nil, nil
+	}
+	return parsePEMCertificate(certData)
+}
+
+// Backup takes the certificate request and backs up the current version prior to overwriting.
+//
+// The previous version of the Secret is copied to a Secret of the same name suffixed with -vcert-backup, annotated
+// with the name of the original Secret and the time of the backup. Only the latest backup is kept. If the Secret
+// doesn't exist, the backup left by a previous installation is deleted, so that Rollback deletes the Secret instead
+// of restoring it.
+func (r KubernetesInstaller) Backup() error {
+	zap.L().Debug("backing up certificate", zap.String("location", r.Kubernetes.String()))
+
+	client, namespace, err := r.client()
+	if err != nil {
+		return err
+	}
+	backupName := r.Kubernetes.Name + backupSuffix
+	current, err := client.getSecret(namespace, r.Kubernetes.Name)
+	if errors.Is(err, errSecretNotFound) {
+		err = client.deleteSecret(namespace, backupName)
+		if err != nil && !errors.Is(err, errSecretNotFound) {
+			return err
+		}
+		zap.L().Info("new certificate location specified, no back up taken")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	backup := &secret{
+		Metadata: secretMetadata{
+			Name:        backupName,
+			Namespace:   namespace,
+			Labels:      current.Metadata.Labels,
+			Annotations: map[string]string{},
+		},
+		Type: current.Type,
+		Data: current.Data,
+	}
+	for k, v := range current.Metadata.Annotations {
+		backup.Metadata.Annotations[k] = v
+	}
+	backup.Metadata.Annotations[AnnotationBackupOf] = r.Kubernetes.Name
+	backup.Metadata.Annotations[AnnotationBackupTime] = time.Now().UTC().Format(time.RFC3339)
+
+	previous, err := client.getSecret(namespace, backupName)
+	switch {
+	case errors.Is(err, errSecretNotFound):
+	case err != nil:
+		return err
+	default:
+		backup.Metadata.ResourceVersion = previous.Metadata.ResourceVersion
+	}
+
+	err = client.putSecret(backup)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("certificate resource backed up", zap.String("location", r.Kubernetes.String()),
+		zap.String("backupLocation", namespace+"/"+backupName))
+	return nil
+}
+
+// DiscardBackup deletes the -vcert-backup copy of the Secret taken by Backup
+func (r KubernetesInstaller) DiscardBackup() error {
+	client, namespace, err := r.client()
+	if err != nil {
+		return err
+	}
+	err = client.deleteSecret(namespace, r.Kubernetes.Name+backupSuffix)
+	if err != nil && !errors.Is(err, errSecretNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Install takes the certificate bundle and moves it to the location specified in the installer.
+//
+// The Secret is created if it doesn't exist. tls.crt holds the certificate followed by its chain, tls.key the private
+// key and ca.crt the chain. The labels and annotations of the installation are added to the ones of the Secret.
+func (r KubernetesInstaller) Install(pcc certificate.PEMCollection) error {
+	zap.L().Debug("installing certificate", zap.String("location", r.Kubernetes.String()))
+
+	client, namespace, err := r.client()
+	if err != nil {
+		return err
+	}
+
+	s := &secret{Metadata: secretMetadata{Name: r.Kubernetes.Name, Namespace: namespace}}
+	current, err := client.getSecret(namespace, r.Kubernetes.Name)
+	switch {
+	case errors.Is(err, errSecretNotFound):
+	case err != nil:
+		return err
+	default:
+		if current.Type != secretTypeTLS {
+			return fmt.Errorf("secret %s/%s has type %q, expected %q", namespace, r.Kubernetes.Name, current.Type,
+				secretTypeTLS)
+		}
+		s.Metadata = current.Metadata
+	}
+
+	s.Metadata.Labels = mergeStrings(s.Metadata.Labels, r.Kubernetes.Labels)
+	s.Metadata.Annotations = mergeStrings(s.Metadata.Annotations, r.Kubernetes.Annotations)
+	s.Type = secretTypeTLS
+	chain := strings.Join(pcc.Chain, "")
+	s.Data = map[string][]byte{
+		secretKeyCertificate: []byte(pcc.Certificate + chain),
+		secretKeyPrivateKey:  []byte(pcc.PrivateKey),
+	}
+	if chain != "" {
+		s.Data[secretKeyCA] = []byte(chain)
+	}
+
+	return client.putSecret(s)
+}
+
+// Rollback undoes the installation of pcc and restores the location from the data of Backup.
+//
+// The data, type, labels and annotations of the Secret are restored from its -vcert-backup copy. The Secret is
+// deleted if there is no copy
+func (r KubernetesInstaller) Rollback(_ certificate.PEMCollection) error {
+	zap.L().Debug("rolling back certificate", zap.String("location", r.Kubernetes.String()))
+
+	client, namespace, err := r.client()
+	if err != nil {
+		return err
+	}
+
+	backupName := r.Kubernetes.Name + backupSuffix
+	backup, err := client.getSecret(namespace, backupName)
+	if errors.Is(err, errSecretNotFound) {
+		err = client.deleteSecret(namespace, r.Kubernetes.Name)
+		if err != nil && !errors.Is(err, errSecretNotFound) {
+			return err
+		}
+		zap.L().Info("certificate resource removed", zap.String("location", r.Kubernetes.String()))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s := &secret{
+		Metadata: secretMetadata{
+			Name:        r.Kubernetes.Name,
+			Namespace:   namespace,
+			Labels:      backup.Metadata.Labels,
+			Annotations: map[string]string{},
+		},
+		Type: backup.Type,
+		Data: backup.Data,
+	}
+	for k, v := range backup.Metadata.Annotations {
+		if k != AnnotationBackupOf && k != AnnotationBackupTime {
+			s.Metadata.Annotations[k] = v
+		}
+	}
+
+	current, err := client.getSecret(namespace, r.Kubernetes.Name)
+	switch {
+	case errors.Is(err, errSecretNotFound):
+	case err != nil:
+		return err
+	default:
+		s.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+	}
+
+	err = client.putSecret(s)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("certificate resource restored", zap.String("location", r.Kubernetes.String()),
+		zap.String("backupLocation", namespace+"/"+backupName))
+	return nil
+}
+
+// AfterInstallActions runs any instructions declared in the Installer on a terminal.
+//
+// No validations happen over the content of the AfterAction string, so caution is advised
+func (r KubernetesInstaller) AfterInstallActions() (string, error) {
+	zap.L().Debug("running after-install actions", zap.String("location", r.Kubernetes.String()))
+
+	result, err := util.ExecuteScript(r.AfterAction)
+	return result, err
+}
+
+// InstallValidationActions runs any instructions declared in the Installer on a terminal and expects
+// "0" for successful validation and "1" for a validation failure
+// No validations happen over the content of the InstallValidation string, so caution is advised
+func (r KubernetesInstaller) InstallValidationActions() (string, error) {
+	zap.L().Debug("running install validation actions", zap.String("location", r.Kubernetes.String()))
+
+	validationResult, err := util.ExecuteScript(r.InstallValidation)
+	if err != nil {
+		return "", err
+	}
+
+	return validationResult, err
+}
+
+// KubernetesLocation returns the namespace and the name of secret. When secret has no namespace, the default namespace
+// of the cluster is resolved like the installer does, so that "name" and "default/name" are the same location
+func KubernetesLocation(secret domain.KubernetesSecret) string {
+	if secret.Namespace == "" {
+		client, err := newKubernetesClient(secret.Kubeconfig)
+		if err == nil {
+			secret.Namespace = client.namespace
+		}
+	}
+	return secret.String()
+}
+
+// client returns the client of the cluster and the namespace of the Secret
+func (r KubernetesInstaller) client() (*kubernetesClient, string, error) {
+	if r.Kubernetes == nil {
+		return nil, "", domain.ErrNoKubernetesSecretName
+	}
+	client, err := newKubernetesClient(r.Kubernetes.Kubeconfig)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to connect to kubernetes: %w", err)
+	}
+	namespace := r.Kubernetes.Namespace
+	if namespace == "" {
+		namespace = client.namespace
+	}
+	return client, namespace, nil
+}
+
+// mergeStrings returns the values of base overwritten by the ones of values
+func mergeStrings(base map[string]string, values map[string]string) map[string]string {
+	if len(base) == 0 && len(values) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(values))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,359 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// serviceAccountDir holds the credentials of the service account of a pod
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	secretTypeTLS = "kubernetes.io/tls"
+)
+
+// errSecretNotFound is returned when the Secret doesn't exist
+var errSecretNotFound = errors.New("secret not found")
+
+// kubernetesClient reads and writes Secrets with the REST API of a Kubernetes cluster
+type kubernetesClient struct {
+	server    string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// secret is the subset of a Kubernetes Secret used by the installer. Data values are base64 encoded by encoding/json
+type secret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   secretMetadata    `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string][]byte `json:"data,omitempty"`
+}
+
+type secretMetadata struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// newKubernetesClient returns a client for the cluster of kubeconfig. When kubeconfig is empty, the in-cluster
+// configuration is used when running in a pod, then $KUBECONFIG and ~/.kube/config
+func newKubernetesClient(kubeconfig string) (*kubernetesClient, error) {
+	if kubeconfig == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return inClusterClient()
+	}
+	if kubeconfig == "" {
+		kubeconfig = os.Getenv("KUBECONFIG")
+		if i := strings.IndexRune(kubeconfig, os.PathListSeparator); i >= 0 {
+			kubeconfig = kubeconfig[:i]
+		}
+	}
+	if kubeconfig == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("no kubeconfig found: %w", err)
+		}
+		kubeconfig = filepath.Join(home, ".kube", "config")
+	}
+	return kubeconfigClient(kubeconfig)
+}
+
+func inClusterClient() (*kubernetesClient, error) {
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account token: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cluster CA: %w", err)
+	}
+	namespace, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		namespace = []byte("default")
+	}
+
+	tlsConfig, err := kubernetesTLSConfig(ca, nil, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	server := "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	return &kubernetesClient{
+		server:    server,
+		token:     strings.TrimSpace(string(token)),
+		namespace: strings.TrimSpace(string(namespace)),
+		client:    kubernetesHTTPClient(tlsConfig),
+	}, nil
+}
+
+// kubeconfig is the subset of a kubeconfig file used by the installer. Exec and auth-provider plugins are not
+// supported: the user must have a token or a client certificate
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+func kubeconfigClient(file string) (*kubernetesClient, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	var config kubeconfig
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig %s: %w", file, err)
+	}
+	// relative paths in a kubeconfig are relative to the file
+	dir := filepath.Dir(file)
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+
+	c := &kubernetesClient{namespace: "default"}
+	clusterName, userName := "", ""
+	for _, ctx := range config.Contexts {
+		if ctx.Name == config.CurrentContext {
+			clusterName, userName = ctx.Context.Cluster, ctx.Context.User
+			if ctx.Context.Namespace != "" {
+				c.namespace = ctx.Context.Namespace
+			}
+		}
+	}
+	if clusterName == "" {
+		return nil, fmt.Errorf("kubeconfig %s: context %q not found", file, config.CurrentContext)
+	}
+
+	var ca []byte
+	insecure := false
+	for _, cluster := range config.Clusters {
+		if cluster.Name != clusterName {
+			continue
+		}
+		c.server = strings.TrimSuffix(cluster.Cluster.Server, "/")
+		insecure = cluster.Cluster.InsecureSkipTLSVerify
+		ca, err = fileOrData(resolve(cluster.Cluster.CertificateAuthority), cluster.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: certificate authority: %w", file, err)
+		}
+	}
+	if c.server == "" {
+		return nil, fmt.Errorf("kubeconfig %s: cluster %q not found", file, clusterName)
+	}
+
+	var cert, key []byte
+	for _, user := range config.Users {
+		if user.Name != userName {
+			continue
+		}
+		c.token = user.User.Token
+		if c.token == "" && user.User.TokenFile != "" {
+			token, err := os.ReadFile(resolve(user.User.TokenFile))
+			if err != nil {
+				return nil, fmt.Errorf("kubeconfig %s: token: %w", file, err)
+			}
+			c.token = strings.TrimSpace(string(token))
+		}
+		cert, err = fileOrData(resolve(user.User.ClientCertificate), user.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: client certificate: %w", file, err)
+		}
+		key, err = fileOrData(resolve(user.User.ClientKey), user.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: client key: %w", file, err)
+		}
+	}
+
+	tlsConfig, err := kubernetesTLSConfig(ca, cert, key, insecure)
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig %s: %w", file, err)
+	}
+	c.client = kubernetesHTTPClient(tlsConfig)
+	return c, nil
+}
+
+// fileOrData returns the content of file if set, or else data decoded from base64
+func fileOrData(file string, data string) ([]byte, error) {
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	if data == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(data)
+}
+
+func kubernetesTLSConfig(ca []byte, cert []byte, key []byte, insecure bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// #nosec G402 -- set explicitly in the kubeconfig
+		InsecureSkipVerify: insecure,
+	}
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to parse the cluster CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(cert) > 0 {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+	return tlsConfig, nil
+}
+
+func kubernetesHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+func (c *kubernetesClient) secretsURL(namespace string) string {
+	return fmt.Sprintf("%s/api/v1/namespaces/%s/secrets", c.server, url.PathEscape(namespace))
+}
+
+// getSecret returns the Secret name of namespace, or errSecretNotFound
+func (c *kubernetesClient) getSecret(namespace string, name string) (*secret, error) {
+	var s secret
+	err := c.do(http.MethodGet, c.secretsURL(namespace)+"/"+url.PathEscape(name), nil, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// putSecret creates s, or replaces it if it has a resource version
+func (c *kubernetesClient) putSecret(s *secret) error {
+	s.APIVersion = "v1"
+	s.Kind = "Secret"
+	if s.Metadata.ResourceVersion == "" {
+		return c.do(http.MethodPost, c.secretsURL(s.Metadata.Namespace), s, nil)
+	}
+	return c.do(http.MethodPut, c.secretsURL(s.Metadata.Namespace)+"/"+url.PathEscape(s.Metadata.Name), s, nil)
+}
+
+// deleteSecret deletes the Secret name of namespace, or returns errSecretNotFound
+func (c *kubernetesClient) deleteSecret(namespace string, name string) error {
+	return c.do(http.MethodDelete, c.secretsURL(namespace)+"/"+url.PathEscape(name), nil, nil)
+}
+
+func (c *kubernetesClient) do(method string, u string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode == http.StatusNotFound && (method == http.MethodGet || method == http.MethodDelete) {
+		return errSecretNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		// the API server answers a Status object with a message
+		var status struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("kubernetes API answered %s to %s %s: %s", res.Status, method, req.URL.Path,
+			status.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,291 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+const testToken = "test-token"
+
+// fakeAPIServer is a Kubernetes API server that only knows about Secrets
+type fakeAPIServer struct {
+	mu      sync.Mutex
+	secrets map[string]secret
+	version int
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	// /api/v1/namespaces/{ns}/secrets[/{name}]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")
+	if len(parts) < 2 || parts[1] != "secrets" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	namespace := parts[0]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 3:
+		s, ok := f.secrets[namespace+"/"+parts[2]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(w, `{"kind":"Status","message":"secrets %q not found"}`, parts[2])
+			return
+		}
+		_ = json.NewEncoder(w).Encode(s)
+	case r.Method == http.MethodPost && len(parts) == 2, r.Method == http.MethodPut && len(parts) == 3:
+		var s secret
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		key := namespace + "/" + s.Metadata.Name
+		current, exists := f.secrets[key]
+		if r.Method == http.MethodPost && exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if r.Method == http.MethodPut && (!exists || current.Metadata.ResourceVersion != s.Metadata.ResourceVersion) {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"kind":"Status","message":"the object has been modified"}`))
+			return
+		}
+		f.version++
+		s.Metadata.Namespace = namespace
+		s.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.secrets[key] = s
+		_ = json.NewEncoder(w).Encode(s)
+	case r.Method == http.MethodDelete && len(parts) == 3:
+		key := namespace + "/" + parts[2]
+		if _, ok := f.secrets[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.secrets, key)
+		_, _ = w.Write([]byte(`{"kind":"Status","status":"Success"}`))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newFakeCluster starts a fake API server and returns it with the path of a kubeconfig for it
+func newFakeCluster(t *testing.T) (*fakeAPIServer, string) {
+	t.Helper()
+	api := &fakeAPIServer{secrets: map[string]secret{}}
+	server := httptest.NewTLSServer(api)
+	t.Cleanup(server.Close)
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test-cluster
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+contexts:
+- name: test
+  context:
+    cluster: test-cluster
+    user: test-user
+    namespace: team-a
+users:
+- name: test-user
+  user:
+    token: %s
+`, server.URL, base64.StdEncoding.EncodeToString(ca), testToken)
+
+	file := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(file, []byte(kubeconfig), 0600))
+	return api, file
+}
+
+// testPEMCollection returns a certificate for commonName with its key and the chain
+func testPEMCollection(t *testing.T, commonName string) certificate.PEMCollection {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cert := testCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: []string{commonName},
+	}, key)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return certificate.PEMCollection{
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		Chain:       []string{"-----BEGIN CERTIFICATE-----\nY2hhaW4=\n-----END CERTIFICATE-----\n"},
+	}
+}
+
+func TestKubernetesInstaller(t *testing.T) {
+	api, kubeconfig := newFakeCluster(t)
+	inst := NewKubernetesInstaller(domain.Installation{
+		Type: domain.FormatKubernetes,
+		Kubernetes: &domain.KubernetesSecret{
+			Kubeconfig:  kubeconfig,
+			Name:        "www-tls",
+			Labels:      map[string]string{"app": "www"},
+			Annotations: map[string]string{"owner": "team-a"},
+		},
+	})
+	request := domain.PlaybookRequest{
+		KeyType: certificate.KeyTypeECDSA,
+		Subject: domain.Subject{CommonName: "www.vcert.test"},
+	}
+
+	// Nothing installed yet
+	cert, err := inst.InstalledCertificate(request)
+	require.NoError(t, err)
+	assert.Nil(t, cert)
+	install, err := inst.Check("30d", request)
+	require.NoError(t, err)
+	assert.True(t, install)
+	require.NoError(t, inst.Backup())
+	assert.Empty(t, api.secrets)
+
+	// First install creates the Secret in the namespace of the context
+	pcc := testPEMCollection(t, "www.vcert.test")
+	require.NoError(t, inst.Install(pcc))
+	s, ok := api.secrets["team-a/www-tls"]
+	require.True(t, ok)
+	assert.Equal(t, secretTypeTLS, s.Type)
+	assert.Equal(t, pcc.Certificate+pcc.Chain[0], string(s.Data[secretKeyCertificate]))
+	assert.Equal(t, pcc.PrivateKey, string(s.Data[secretKeyPrivateKey]))
+	assert.Equal(t, pcc.Chain[0], string(s.Data[secretKeyCA]))
+	assert.Equal(t, map[string]string{"app": "www"}, s.Metadata.Labels)
+	assert.Equal(t, map[string]string{"owner": "team-a"}, s.Metadata.Annotations)
+
+	cert, err = inst.InstalledCertificate(request)
+	require.NoError(t, err)
+	require.NotNil(t, cert)
+	assert.Equal(t, "www.vcert.test", cert.Subject.CommonName)
+	install, err = inst.Check("1h", request)
+	require.NoError(t, err)
+	assert.False(t, install)
+	install, err = inst.Check("100%", request)
+	require.NoError(t, err)
+	assert.True(t, install)
+
+	// Labels set by others survive a renewal and the previous version is kept in the backup
+	s.Metadata.Labels["team"] = "a"
+	api.secrets["team-a/www-tls"] = s
+	require.NoError(t, inst.Backup())
+	backup, ok := api.secrets["team-a/www-tls"+backupSuffix]
+	require.True(t, ok)
+	assert.Equal(t, s.Data, backup.Data)
+	assert.Equal(t, "www-tls", backup.Metadata.Annotations[AnnotationBackupOf])
+	assert.NotEmpty(t, backup.Metadata.Annotations[AnnotationBackupTime])
+	assert.Equal(t, "team-a", backup.Metadata.Annotations["owner"])
+
+	renewed := testPEMCollection(t, "www.vcert.test")
+	require.NoError(t, inst.Install(renewed))
+	s = api.secrets["team-a/www-tls"]
+	assert.Equal(t, renewed.PrivateKey, string(s.Data[secretKeyPrivateKey]))
+	assert.Equal(t, map[string]string{"app": "www", "team": "a"}, s.Metadata.Labels)
+
+	// A second backup replaces the first one
+	require.NoError(t, inst.Backup())
+	backup = api.secrets["team-a/www-tls"+backupSuffix]
+	assert.Equal(t, renewed.PrivateKey, string(backup.Data[secretKeyPrivateKey]))
+
+	// Rollback restores the Secret from the backup
+	require.NoError(t, inst.Install(testPEMCollection(t, "www.vcert.test")))
+	require.NoError(t, inst.Rollback(renewed))
+	s = api.secrets["team-a/www-tls"]
+	assert.Equal(t, renewed.PrivateKey, string(s.Data[secretKeyPrivateKey]))
+	assert.NotContains(t, s.Metadata.Annotations, AnnotationBackupOf)
+
+	// A Secret without backup is deleted
+	inst.Kubernetes.Name = "new-tls"
+	require.NoError(t, inst.Install(renewed))
+	require.NoError(t, inst.Rollback(renewed))
+	assert.NotContains(t, api.secrets, "team-a/new-tls")
+
+	// The backup left by a Secret deleted since is not restored
+	inst.Kubernetes.Name = "www-tls"
+	delete(api.secrets, "team-a/www-tls")
+	require.NoError(t, inst.Backup())
+	assert.NotContains(t, api.secrets, "team-a/www-tls"+backupSuffix)
+	require.NoError(t, inst.Install(pcc))
+	require.NoError(t, inst.Rollback(pcc))
+	assert.NotContains(t, api.secrets, "team-a/www-tls")
+}
+
+func TestKubernetesLocation(t *testing.T) {
+	_, kubeconfig := newFakeCluster(t)
+	// the namespace of the context of the kubeconfig is the default one
+	assert.Equal(t, "team-a/www", KubernetesLocation(domain.KubernetesSecret{Name: "www", Kubeconfig: kubeconfig}))
+	assert.Equal(t, "team-b/www", KubernetesLocation(domain.KubernetesSecret{Namespace: "team-b", Name: "www",
+		Kubeconfig: kubeconfig}))
+}
+
+func TestKubernetesInstaller_Errors(t *testing.T) {
+	api, kubeconfig := newFakeCluster(t)
+	api.secrets["default/opaque"] = secret{
+		Metadata: secretMetadata{Name: "opaque", Namespace: "default", ResourceVersion: "1"},
+		Type:     "Opaque",
+	}
+
+	inst := NewKubernetesInstaller(domain.Installation{
+		Type: domain.FormatKubernetes,
+		Kubernetes: &domain.KubernetesSecret{
+			Kubeconfig: kubeconfig,
+			Namespace:  "default",
+			Name:       "opaque",
+		},
+	})
+	err := inst.Install(testPEMCollection(t, "www.vcert.test"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `has type "Opaque"`)
+
+	inst.Kubernetes.Kubeconfig = filepath.Join(t.TempDir(), "missing")
+	_, err = inst.InstalledCertificate(domain.PlaybookRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to kubernetes")
+}
@@ -17,7 +17,7 @@
 package installer
 
 import (
-	"fmt"
+	"crypto/x509"
 	"strings"
 
 	"go.uber.org/zap"
@@ -41,81 +41,61 @@ func NewPEMInstaller(inst domain.Installation) PEMInstaller {
 // Check is the method in charge of making the validations to install a new certificate:
 // 1. Does the certificate exists? > Install if it doesn't.
 // 2. Does the certificate is about to expire? Renew if about to expire.
+// 3. Does the certificate match the request? Re-issue if it doesn't. See Drift.
 // Returns true if the certificate needs to be installed.
-func (r PEMInstaller) Check(renewBefore string, _ domain.PlaybookRequest) (bool, error) {
+func (r PEMInstaller) Check(renewBefore string, request domain.PlaybookRequest) (bool, error) {
 	zap.L().Info("checking certificate health", zap.String("format", r.Type.String()), zap.String("location", r.File))
 
-	// Check certificate bundle file exists
-	certExists, err := util.FileExists(r.File)
+	cert, err := r.InstalledCertificate(request)
 	if err != nil {
 		return false, err
 	}
-	if !certExists {
+	if cert == nil {
 		return true, nil
 	}
 
-	// Load Certificate
-	cert, err := loadPEMCertificate(r.File)
-	if err != nil {
-		return false, err
-	}
-
-	// Check certificate expiration
-	renew := needRenewal(cert, renewBefore)
+	// Check certificate expiration and drift from the request
+	renew := needReissue(cert, renewBefore, request)
 
 	return renew, nil
 }
 
-// Backup takes the certificate request and backs up the current version prior to overwriting
-func (r PEMInstaller) Backup() error {
-	zap.L().Debug("backing up certificate", zap.String("location", r.File))
-
-	// Check certificate file exists
+// InstalledCertificate returns the certificate currently installed in the location, or nil if there is none
+func (r PEMInstaller) InstalledCertificate(_ domain.PlaybookRequest) (*x509.Certificate, error) {
+	// Check certificate bundle file exists
 	certExists, err := util.FileExists(r.File)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// No cert file
 	if !certExists {
-		zap.L().Info("new certificate location specified, no back up taken")
-		return nil
+		return nil, nil
 	}
 
-	resources := []struct {
-		oldLocation string
-		newLocation string
-	}{
-		{oldLocation: r.File, newLocation: fmt.Sprintf("%s.bak", r.File)},
-		{oldLocation: r.KeyFile, newLocation: fmt.Sprintf("%s.bak", r.KeyFile)},
-		{oldLocation: r.ChainFile, newLocation: fmt.Sprintf("%s.bak", r.ChainFile)},
-	}
+	// Load Certificate
+	return loadPEMCertificate(r.File)
+}
 
-	for _, resource := range resources {
-		fileExists, err := util.FileExists(resource.oldLocation)
-		if err != nil {
-			return err
-		} else if !fileExists {
-			zap.L().Info(fmt.Sprintf("file %s does not exist, no backup taken", resource.oldLocation))
-			continue
-		}
-		err = util.CopyFile(resource.oldLocation, resource.newLocation)
-		if err != nil {
-			return err
-		}
-		zap.L().Info("certificate resource backed up", zap.String("location", resource.oldLocation),
-			zap.String("backupLocation", resource.newLocation))
-	}
+// Backup takes the certificate request and backs up the current version prior to overwriting.
+//
+// File, KeyFile, ChainFile and the Bundles are copied to a new generation of the backup directory. The generations
+// beyond the BackupPolicy are removed
+func (r PEMInstaller) Backup() error {
+	zap.L().Debug("backing up certificate", zap.String("location", r.File))
 
-	return nil
+	cert, err := r.InstalledCertificate(domain.PlaybookRequest{})
+	if err != nil {
+		zap.L().Warn("failed to read the certificate backed up", zap.String("location", r.File), zap.Error(err))
+	}
+	return backupFiles(r.Installation, cert, r.locations()...)
 }
 
-// Install takes the certificate bundle and moves it to the location specified in the installer
+// Install takes the certificate bundle and moves it to the location specified in the installer.
+//
+// File holds the parts of Layout, the certificate only by default. KeyFile, ChainFile and the Bundles are written too
+// when set. Every file is replaced atomically
 func (r PEMInstaller) Install(pcc certificate.PEMCollection) error {
 	zap.L().Debug("installing certificate", zap.String("location", r.File))
 
-	//TODO: should we add support for PEM bundle?
-
 	preppedPK := pcc.PrivateKey
 	var err error
 	// Needs to be encrypted again using legacy PEM
@@ -127,20 +107,40 @@ func (r PEMInstaller) Install(pcc certificate.PEMCollection) error {
 		}
 	}
 
+	parts := map[string]string{
+		domain.PEMPartCertificate: pcc.Certificate,
+		domain.PEMPartChain:       strings.Join(pcc.Chain, ""),
+		domain.PEMPartKey:         preppedPK,
+	}
+	bundles := append([]domain.PEMBundle{{File: r.File, Layout: r.Layout}}, r.Bundles...)
+
 	resources := []struct {
 		path    string
 		content []byte
 	}{
-		{path: r.File, content: []byte(pcc.Certificate)},
 		{path: r.KeyFile, content: []byte(preppedPK)},
-		{path: r.ChainFile, content: []byte(strings.Join(pcc.Chain, ""))},
+		{path: r.ChainFile, content: []byte(parts[domain.PEMPartChain])},
+	}
+	for _, bundle := range bundles {
+		content, err := pemBundle(parts, bundle.Layout)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, struct {
+			path    string
+			content []byte
+		}{path: bundle.File, content: content})
 	}
 
 	for _, resource := range resources {
-		if len(resource.content) == 0 {
+		if resource.path == "" || len(resource.content) == 0 {
 			continue
 		}
-		err = util.WriteFile(resource.path, resource.content)
+		options, err := fileOptions(r.Installation, resource.path)
+		if err != nil {
+			return err
+		}
+		err = util.WriteFileWithOptions(resource.path, resource.content, options)
 		if err != nil {
 			return err
 		}
@@ -149,6 +149,63 @@ func (r PEMInstaller) Install(pcc certificate.PEMCollection) error {
 	return nil
 }
 
+// pemBundle returns the parts of layout, concatenated in its order
+func pemBundle(parts map[string]string, layout string) ([]byte, error) {
+	order, err := domain.ParsePEMLayout(layout)
+	if err != nil {
+		return nil, err
+	}
+	var bundle strings.Builder
+	for _, part := range order {
+		content := parts[part]
+		if content == "" {
+			continue
+		}
+		bundle.WriteString(content)
+		if !strings.HasSuffix(content, "\n") {
+			bundle.WriteString("\n")
+		}
+	}
+	return []byte(bundle.String()), nil
+}
+
+// Rollback undoes the installation of pcc and restores the location from the data of the latest Backup.
+//
+// File, KeyFile, ChainFile and the Bundles are restored from the latest generation of backups. The ones it doesn't
+// have are removed
+func (r PEMInstaller) Rollback(_ certificate.PEMCollection) error {
+	zap.L().Debug("rolling back certificate", zap.String("location", r.File))
+
+	return rollbackFiles(r.Installation, r.locations()...)
+}
+
+// DiscardBackup removes the generation of backups taken by the latest call to Backup
+func (r PEMInstaller) DiscardBackup() error {
+	return discardFiles(r.Installation)
+}
+
+// Generations returns the backups of the location, the latest first
+func (r PEMInstaller) Generations() ([]BackupGeneration, error) {
+	return backupGenerations(r.Installation)
+}
+
+// Restore installs the generation of the backups of the location again, 1 being the latest. The current version is
+// backed up first
+func (r PEMInstaller) Restore(generation int) error {
+	zap.L().Debug("restoring certificate", zap.String("location", r.File), zap.Int("generation", generation))
+
+	return restoreGeneration(r.Installation, generation, r.Backup)
+}
+
+// locations returns the files written by the installation
+func (r PEMInstaller) locations() []string {
+	locations := []string{r.File, r.KeyFile, r.ChainFile}
+	for _, bundle := range r.Bundles {
+		locations = append(locations, bundle.File)
+	}
+	return locations
+}
+
 // AfterInstallActions runs any instructions declared in the Installer on a terminal.
 //
 // No validations happen over the content of the AfterAction string, so caution is advised
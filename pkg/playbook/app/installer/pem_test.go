@@ -0,0 +1,291 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+func readFile(t *testing.T, file string) string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestPEMInstaller_Layout(t *testing.T) {
+	dir := t.TempDir()
+	pcc := testPEMCollection(t, "www.vcert.test")
+	request := domain.PlaybookRequest{
+		KeyType: certificate.KeyTypeECDSA,
+		Subject: domain.Subject{CommonName: "www.vcert.test"},
+	}
+
+	inst := NewPEMInstaller(domain.Installation{
+		Type:   domain.FormatPEM,
+		File:   filepath.Join(dir, "haproxy.pem"),
+		Layout: domain.PEMLayoutKeyFullChain,
+		Bundles: []domain.PEMBundle{
+			{File: filepath.Join(dir, "fullchain.pem"), Layout: domain.PEMLayoutFullChain},
+			{File: filepath.Join(dir, "ca.pem"), Layout: domain.PEMLayoutChain},
+			{File: filepath.Join(dir, "custom.pem"), Layout: "certificate, key"},
+		},
+		Mode: "0640",
+	})
+	require.NoError(t, inst.Install(pcc))
+
+	chain := pcc.Chain[0]
+	assert.Equal(t, pcc.PrivateKey+pcc.Certificate+chain, readFile(t, filepath.Join(dir, "haproxy.pem")))
+	assert.Equal(t, pcc.Certificate+chain, readFile(t, filepath.Join(dir, "fullchain.pem")))
+	assert.Equal(t, chain, readFile(t, filepath.Join(dir, "ca.pem")))
+	assert.Equal(t, pcc.Certificate+pcc.PrivateKey, readFile(t, filepath.Join(dir, "custom.pem")))
+	if runtime.GOOS != "windows" {
+		// fileMode doesn't apply to the files holding the private key
+		for file, mode := range map[string]os.FileMode{
+			"haproxy.pem":   0600,
+			"fullchain.pem": 0640,
+			"ca.pem":        0640,
+			"custom.pem":    0600,
+		} {
+			info, err := os.Stat(filepath.Join(dir, file))
+			require.NoError(t, err)
+			assert.Equal(t, mode, info.Mode().Perm(), file)
+		}
+	}
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.False(t, strings.Contains(entry.Name(), ".tmp-"), entry.Name())
+	}
+
+	// The certificate is found after the private key
+	cert, err := inst.InstalledCertificate(request)
+	require.NoError(t, err)
+	require.NotNil(t, cert)
+	assert.Equal(t, "www.vcert.test", cert.Subject.CommonName)
+	install, err := inst.Check("1h", request)
+	require.NoError(t, err)
+	assert.False(t, install)
+
+	inst.BackupFiles = true
+	require.NoError(t, inst.Backup())
+	generations, err := inst.Generations()
+	require.NoError(t, err)
+	require.Len(t, generations, 1)
+	require.Len(t, generations[0].Files, 4)
+	assert.Equal(t, filepath.Join(dir, "ca.pem"), generations[0].Files[2].Path)
+	assert.Equal(t, chain, readFile(t, filepath.Join(dir, "haproxy.pem"+domain.BackupDirSuffix,
+		generations[0].Files[2].Backup)))
+	if runtime.GOOS != "windows" {
+		// the backups of the files without the key are kept with the ones with it
+		info, err := os.Stat(filepath.Join(dir, "haproxy.pem"+domain.BackupDirSuffix, generations[0].Files[2].Backup))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestPEMInstaller_KeyFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+	dir := t.TempDir()
+	inst := NewPEMInstaller(domain.Installation{
+		Type:      domain.FormatPEM,
+		File:      filepath.Join(dir, "cert.pem"),
+		KeyFile:   filepath.Join(dir, "key.pem"),
+		ChainFile: filepath.Join(dir, "chain.pem"),
+		Mode:      "0644",
+		KeyMode:   "0640",
+	})
+	require.NoError(t, inst.Install(testPEMCollection(t, "www.vcert.test")))
+
+	for file, mode := range map[string]os.FileMode{"cert.pem": 0644, "chain.pem": 0644, "key.pem": 0640} {
+		info, err := os.Stat(filepath.Join(dir, file))
+		require.NoError(t, err)
+		assert.Equal(t, mode, info.Mode().Perm(), file)
+	}
+}
+
+func TestPEMInstaller_SeparateFiles(t *testing.T) {
+	dir := t.TempDir()
+	pcc := testPEMCollection(t, "www.vcert.test")
+
+	inst := NewPEMInstaller(domain.Installation{
+		Type:      domain.FormatPEM,
+		File:      filepath.Join(dir, "cert.pem"),
+		KeyFile:   filepath.Join(dir, "key.pem"),
+		ChainFile: filepath.Join(dir, "chain.pem"),
+	})
+	require.NoError(t, inst.Install(pcc))
+
+	assert.Equal(t, pcc.Certificate, readFile(t, filepath.Join(dir, "cert.pem")))
+	assert.Equal(t, pcc.PrivateKey, readFile(t, filepath.Join(dir, "key.pem")))
+	assert.Equal(t, pcc.Chain[0], readFile(t, filepath.Join(dir, "chain.pem")))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dir, "key.pem"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestPEMInstaller_KeepFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not supported on Windows")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cert.pem"), []byte("old"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "real-key.pem"), []byte("old"), 0640))
+	require.NoError(t, os.Symlink("real-key.pem", filepath.Join(dir, "key.pem")))
+
+	// without fileMode, keyFileMode, fileOwner and fileGroup the files replaced keep their mode
+	inst := NewPEMInstaller(domain.Installation{
+		Type:    domain.FormatPEM,
+		File:    filepath.Join(dir, "cert.pem"),
+		KeyFile: filepath.Join(dir, "key.pem"),
+	})
+	pcc := testPEMCollection(t, "www.vcert.test")
+	require.NoError(t, inst.Install(pcc))
+
+	info, err := os.Stat(filepath.Join(dir, "cert.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// a symbolic link is kept and the file it points to is written
+	info, err = os.Lstat(filepath.Join(dir, "key.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSymlink, info.Mode().Type())
+	assert.Equal(t, pcc.PrivateKey, readFile(t, filepath.Join(dir, "real-key.pem")))
+	info, err = os.Stat(filepath.Join(dir, "real-key.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+func TestPEMInstaller_Rollback(t *testing.T) {
+	dir := t.TempDir()
+	pcc := testPEMCollection(t, "www.vcert.test")
+
+	inst := NewPEMInstaller(domain.Installation{
+		Type:    domain.FormatPEM,
+		File:    filepath.Join(dir, "cert.pem"),
+		KeyFile: filepath.Join(dir, "key.pem"),
+	})
+	require.NoError(t, inst.Install(pcc))
+	require.NoError(t, inst.Backup())
+
+	// A bundle added afterwards has no backup
+	inst.Bundles = []domain.PEMBundle{{File: filepath.Join(dir, "fullchain.pem"), Layout: domain.PEMLayoutFullChain}}
+	renewed := testPEMCollection(t, "www.vcert.test")
+	require.NoError(t, inst.Install(renewed))
+	assert.Equal(t, renewed.Certificate, readFile(t, filepath.Join(dir, "cert.pem")))
+
+	require.NoError(t, inst.Rollback(renewed))
+	assert.Equal(t, pcc.Certificate, readFile(t, filepath.Join(dir, "cert.pem")))
+	assert.Equal(t, pcc.PrivateKey, readFile(t, filepath.Join(dir, "key.pem")))
+	assert.NoFileExists(t, filepath.Join(dir, "fullchain.pem"))
+}
+
+func TestPEMInstaller_RollbackNewLocation(t *testing.T) {
+	dir := t.TempDir()
+	backups := &domain.BackupPolicy{Dir: filepath.Join(dir, "backups")}
+	previous := NewPEMInstaller(domain.Installation{
+		Type:         domain.FormatPEM,
+		File:         filepath.Join(dir, "previous.pem"),
+		BackupPolicy: backups,
+	})
+	require.NoError(t, previous.Install(testPEMCollection(t, "www.vcert.test")))
+	require.NoError(t, previous.Backup())
+
+	// The backup of a location that doesn't exist yet is an empty generation, not the one of the other installation
+	// sharing the backup directory
+	inst := NewPEMInstaller(domain.Installation{
+		Type:         domain.FormatPEM,
+		File:         filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		BackupPolicy: backups,
+	})
+	require.NoError(t, inst.Backup())
+	generations, err := inst.Generations()
+	require.NoError(t, err)
+	require.Len(t, generations, 1)
+	assert.Empty(t, generations[0].Files)
+
+	pcc := testPEMCollection(t, "www.vcert.test")
+	require.NoError(t, inst.Install(pcc))
+	require.NoError(t, inst.Rollback(pcc))
+	assert.NoFileExists(t, filepath.Join(dir, "cert.pem"))
+	assert.NoFileExists(t, filepath.Join(dir, "key.pem"))
+	assert.FileExists(t, filepath.Join(dir, "previous.pem"))
+	assert.ErrorIs(t, inst.Restore(1), ErrEmptyBackupGeneration)
+	assert.ErrorIs(t, inst.Restore(2), ErrNoBackupGeneration)
+
+	generations, err = previous.Generations()
+	require.NoError(t, err)
+	require.Len(t, generations, 1)
+	assert.NotEmpty(t, generations[0].Files)
+}
+
+func TestPEMInstaller_Generations(t *testing.T) {
+	dir := t.TempDir()
+	inst := NewPEMInstaller(domain.Installation{
+		Type:         domain.FormatPEM,
+		File:         filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		BackupPolicy: &domain.BackupPolicy{Dir: filepath.Join(dir, "backups"), Keep: 2},
+	})
+
+	installed := make([]certificate.PEMCollection, 4)
+	for i := range installed {
+		installed[i] = testPEMCollection(t, "www.vcert.test")
+		require.NoError(t, inst.Backup())
+		require.NoError(t, inst.Install(installed[i]))
+	}
+
+	// The first generation is empty, only the latest ones are kept up to Keep
+	generations, err := inst.Generations()
+	require.NoError(t, err)
+	require.Len(t, generations, 2)
+	assert.NotEqual(t, generations[0].ID, generations[1].ID)
+	assert.NotEmpty(t, generations[0].Serial)
+	assert.NotNil(t, generations[0].NotAfter)
+	entries, err := os.ReadDir(filepath.Join(dir, "backups"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "two generations and the manifest")
+
+	// Restoring the generation before the latest one installs the second certificate again and backs up the fourth
+	require.NoError(t, inst.Restore(2))
+	assert.Equal(t, installed[1].Certificate, readFile(t, filepath.Join(dir, "cert.pem")))
+	assert.Equal(t, installed[1].PrivateKey, readFile(t, filepath.Join(dir, "key.pem")))
+	generations, err = inst.Generations()
+	require.NoError(t, err)
+	require.Len(t, generations, 2)
+	require.NoError(t, inst.Restore(1))
+	assert.Equal(t, installed[3].Certificate, readFile(t, filepath.Join(dir, "cert.pem")))
+
+	assert.ErrorIs(t, inst.Restore(3), ErrNoBackupGeneration)
+}
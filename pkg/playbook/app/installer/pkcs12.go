@@ -43,54 +43,51 @@ func NewPKCS12Installer(inst domain.Installation) PKCS12Installer {
 // Check is the method in charge of making the validations to install a new certificate:
 // 1. Does the certificate exists? > Install if it doesn't.
 // 2. Does the certificate is about to expire? Renew if about to expire.
+// 3. Does the certificate match the request? Re-issue if it doesn't. See Drift.
 // Returns true if the certificate needs to be installed.
-func (r PKCS12Installer) Check(renewBefore string, _ domain.PlaybookRequest) (bool, error) {
+func (r PKCS12Installer) Check(renewBefore string, request domain.PlaybookRequest) (bool, error) {
 	zap.L().Info("checking certificate health", zap.String("format", r.Type.String()), zap.String("location", r.File))
 
-	// Check certificate file exists
-	certExists, err := util.FileExists(r.File)
+	cert, err := r.InstalledCertificate(request)
 	if err != nil {
 		return false, err
 	}
-	if !certExists {
+	if cert == nil {
 		return true, nil
 	}
 
-	// Load Certificate
-	cert, err := loadPKCS12(r.File, r.P12Password)
-	if err != nil {
-		return false, err
-	}
-
-	// Check certificate expiration
-	renew := needRenewal(cert, renewBefore)
+	// Check certificate expiration and drift from the request
+	renew := needReissue(cert, renewBefore, request)
 
 	return renew, nil
 }
 
-// Backup takes the certificate request and backs up the current version prior to overwriting
-func (r PKCS12Installer) Backup() error {
-	zap.L().Debug("backing up certificate", zap.String("location", r.File))
-
+// InstalledCertificate returns the certificate currently installed in the location, or nil if there is none
+func (r PKCS12Installer) InstalledCertificate(_ domain.PlaybookRequest) (*x509.Certificate, error) {
 	// Check certificate file exists
 	certExists, err := util.FileExists(r.File)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !certExists {
-		zap.L().Info("new certificate location specified, no back up taken")
-		return nil
+		return nil, nil
 	}
 
-	newLocation := fmt.Sprintf("%s.bak", r.File)
+	// Load Certificate
+	return loadPKCS12(r.File, r.P12Password)
+}
 
-	err = util.CopyFile(r.File, newLocation)
+// Backup takes the certificate request and backs up the current version prior to overwriting.
+//
+// File is copied to a new generation of the backup directory. The generations beyond the BackupPolicy are removed
+func (r PKCS12Installer) Backup() error {
+	zap.L().Debug("backing up certificate", zap.String("location", r.File))
+
+	cert, err := r.InstalledCertificate(domain.PlaybookRequest{})
 	if err != nil {
-		return err
+		zap.L().Warn("failed to read the certificate backed up", zap.String("location", r.File), zap.Error(err))
 	}
-
-	zap.L().Info("certificate backed up", zap.String("location", r.File), zap.String("backupLocation", newLocation))
-	return err
+	return backupFiles(r.Installation, cert, r.File)
 }
 
 // Install takes the certificate bundle and moves it to the location specified in the installer
@@ -107,7 +104,11 @@ func (r PKCS12Installer) Install(pcc certificate.PEMCollection) error {
 		return err
 	}
 
-	err = util.WriteFile(r.File, content)
+	options, err := keyFileOptions(r.Installation)
+	if err != nil {
+		return err
+	}
+	err = util.WriteFileWithOptions(r.File, content, options)
 	if err != nil {
 		return err
 	}
@@ -115,6 +116,33 @@ func (r PKCS12Installer) Install(pcc certificate.PEMCollection) error {
 	return nil
 }
 
+// Rollback undoes the installation of pcc and restores the location from the data of the latest Backup.
+//
+// File is restored from the latest generation of backups, or removed if there is none
+func (r PKCS12Installer) Rollback(_ certificate.PEMCollection) error {
+	zap.L().Debug("rolling back certificate", zap.String("location", r.File))
+
+	return rollbackFiles(r.Installation, r.File)
+}
+
+// DiscardBackup removes the generation of backups taken by the latest call to Backup
+func (r PKCS12Installer) DiscardBackup() error {
+	return discardFiles(r.Installation)
+}
+
+// Generations returns the backups of the location, the latest first
+func (r PKCS12Installer) Generations() ([]BackupGeneration, error) {
+	return backupGenerations(r.Installation)
+}
+
+// Restore installs the generation of the backups of the location again, 1 being the latest. The current version is
+// backed up first
+func (r PKCS12Installer) Restore(generation int) error {
+	zap.L().Debug("restoring certificate", zap.String("location", r.File), zap.Int("generation", generation))
+
+	return restoreGeneration(r.Installation, generation, r.Backup)
+}
+
 // AfterInstallActions runs any instructions declared in the Installer on a terminal.
 //
 // No validations happen over the content of the AfterAction string, so caution is advised
@@ -37,6 +37,10 @@ func GetInstaller(inst domain.Installation) Installer {
 		return NewPEMInstaller(inst)
 	case domain.FormatPKCS12:
 		return NewPKCS12Installer(inst)
+	case domain.FormatKubernetes:
+		return NewKubernetesInstaller(inst)
+	case domain.FormatVault:
+		return NewVaultInstaller(inst)
 	default:
 		zap.L().Fatal(fmt.Sprintf("runner not found for installation type: %s", inst.Type.String()))
 		return nil
@@ -0,0 +1,261 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"crypto/x509"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vault"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vcertutil"
+	"github.com/Venafi/vcert/v5/pkg/playbook/util"
+)
+
+const (
+	// the keys of the certificate bundle in a Vault secret
+	vaultKeyCertificate = "certificate"
+	vaultKeyPrivateKey  = "private_key"
+	vaultKeyChain       = "chain"
+	// vaultKeyBackupTime is set in the backup copy of a secret to the time it was taken
+	vaultKeyBackupTime = "backup_time"
+)
+
+// VaultInstaller represents an installation that will use a secret of a HashiCorp Vault KV secrets engine for the
+// certificate bundle
+type VaultInstaller struct {
+	domain.Installation
+}
+
+// NewVaultInstaller returns a new installer of type VAULT with the values defined in inst
+func NewVaultInstaller(inst domain.Installation) VaultInstaller {
+	return VaultInstaller{inst}
+}
+
+// Check is the method in charge of making the validations to install a new certificate:
+// 1. Does the certificate exists? > Install if it doesn't.
+// 2. Does the certificate is about to expire? Renew if about to expire.
+// 3. Does the certificate match the request? Re-issue if it doesn't. See Drift.
+// Returns true if the certificate needs to be installed.
+func (r VaultInstaller) Check(renewBefore string, request domain.PlaybookRequest) (bool, error) {
+	zap.L().Info("checking certificate health", zap.String("format", r.Type.String()),
+		zap.String("location", r.Vault.String()))
+
+	cert, err := r.InstalledCertificate(request)
+	if err != nil {
+		return false, err
+	}
+	if cert == nil {
+		return true, nil
+	}
+
+	// Check certificate expiration and drift from the request
+	renew := needReissue(cert, renewBefore, request)
+
+	return renew, nil
+}
+
+// InstalledCertificate returns the certificate currently installed in the location, or nil if there is none
+func (r VaultInstaller) InstalledCertificate(_ domain.PlaybookRequest) (*x509.Certificate, error) {
+	client, err := r.client()
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.ReadSecret(*r.Vault)
+	if errors.Is(err, vault.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	certData, _ := data[vaultKeyCertificate].(string)
+	if certData == "" {
+		return nil, nil
+	}
+	return parsePEMCertificate([]byte(certData))
+}
+
+// Backup takes the certificate request and backs up the current version prior to overwriting.
+//
+// The secret is copied to a secret of the same path suffixed with -vcert-backup, with the time of the backup. Only the
+// latest backup is kept. KV v2 also keeps the previous versions of the secret. If the secret doesn't exist, the backup
+// left by a previous installation is deleted, so that Rollback deletes the secret instead of restoring it
+func (r VaultInstaller) Backup() error {
+	zap.L().Debug("backing up certificate", zap.String("location", r.Vault.String()))
+
+	client, err := r.client()
+	if err != nil {
+		return err
+	}
+	secret, err := client.Resolve(*r.Vault)
+	if err != nil {
+		return err
+	}
+
+	backup := secret
+	backup.Path = secret.Path + backupSuffix
+	current, err := client.ReadSecret(secret)
+	if errors.Is(err, vault.ErrNotFound) {
+		err = client.DeleteSecret(backup)
+		if err != nil {
+			return err
+		}
+		zap.L().Info("new certificate location specified, no back up taken")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	current[vaultKeyBackupTime] = time.Now().UTC().Format(time.RFC3339)
+	err = client.UpdateSecret(backup, current)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("certificate resource backed up", zap.String("location", secret.String()),
+		zap.String("backupLocation", backup.String()))
+	return nil
+}
+
+// DiscardBackup deletes the -vcert-backup copy of the secret taken by Backup. With KV v2, its previous versions are
+// kept
+func (r VaultInstaller) DiscardBackup() error {
+	client, err := r.client()
+	if err != nil {
+		return err
+	}
+	secret, err := client.Resolve(*r.Vault)
+	if err != nil {
+		return err
+	}
+	backup := secret
+	backup.Path = secret.Path + backupSuffix
+	return client.DeleteSecret(backup)
+}
+
+// Install takes the certificate bundle and moves it to the location specified in the installer.
+//
+// The certificate, its private key and its chain are written to the certificate, private_key and chain keys of the
+// secret. Its other keys are kept.
+func (r VaultInstaller) Install(pcc certificate.PEMCollection) error {
+	zap.L().Debug("installing certificate", zap.String("location", r.Vault.String()))
+
+	preppedPK := pcc.PrivateKey
+	var err error
+	// Needs to be encrypted again using legacy PEM
+	if r.KeyPassword != "" {
+		preppedPK, err = vcertutil.EncryptPrivateKeyPKCS1(pcc.PrivateKey, r.KeyPassword)
+		if err != nil {
+			zap.L().Error("failed to encrypt PrivateKey", zap.Error(err))
+			return err
+		}
+	}
+
+	client, err := r.client()
+	if err != nil {
+		return err
+	}
+	return client.UpdateSecret(*r.Vault, map[string]interface{}{
+		vaultKeyCertificate: pcc.Certificate,
+		vaultKeyPrivateKey:  preppedPK,
+		vaultKeyChain:       strings.Join(pcc.Chain, ""),
+	})
+}
+
+// Rollback undoes the installation of pcc and restores the location from the data of Backup.
+//
+// The values of the secret are restored from its -vcert-backup copy. The certificate, private_key and chain keys are
+// emptied if the copy doesn't have them. With KV v2, this writes a new version of the secret. The secret is deleted if
+// there is no copy
+func (r VaultInstaller) Rollback(_ certificate.PEMCollection) error {
+	zap.L().Debug("rolling back certificate", zap.String("location", r.Vault.String()))
+
+	client, err := r.client()
+	if err != nil {
+		return err
+	}
+	secret, err := client.Resolve(*r.Vault)
+	if err != nil {
+		return err
+	}
+
+	backup := secret
+	backup.Path = secret.Path + backupSuffix
+	data, err := client.ReadSecret(backup)
+	if errors.Is(err, vault.ErrNotFound) {
+		err = client.DeleteSecret(secret)
+		if err != nil {
+			return err
+		}
+		zap.L().Info("certificate resource removed", zap.String("location", secret.String()))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	delete(data, vaultKeyBackupTime)
+	for _, key := range []string{vaultKeyCertificate, vaultKeyPrivateKey, vaultKeyChain} {
+		if _, found := data[key]; !found {
+			data[key] = ""
+		}
+	}
+
+	err = client.UpdateSecret(secret, data)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("certificate resource restored", zap.String("location", secret.String()),
+		zap.String("backupLocation", backup.String()))
+	return nil
+}
+
+// AfterInstallActions runs any instructions declared in the Installer on a terminal.
+//
+// No validations happen over the content of the AfterAction string, so caution is advised
+func (r VaultInstaller) AfterInstallActions() (string, error) {
+	zap.L().Debug("running after-install actions", zap.String("location", r.Vault.String()))
+
+	result, err := util.ExecuteScript(r.AfterAction)
+	return result, err
+}
+
+// InstallValidationActions runs any instructions declared in the Installer on a terminal and expects
+// "0" for successful validation and "1" for a validation failure
+// No validations happen over the content of the InstallValidation string, so caution is advised
+func (r VaultInstaller) InstallValidationActions() (string, error) {
+	zap.L().Debug("running install validation actions", zap.String("location", r.Vault.String()))
+
+	validationResult, err := util.ExecuteScript(r.InstallValidation)
+	if err != nil {
+		return "", err
+	}
+
+	return validationResult, err
+}
+
+func (r VaultInstaller) client() (*vault.Client, error) {
+	if r.Vault == nil {
+		return nil, domain.ErrNoVaultPath
+	}
+	return vault.NewClient(r.Vault.Vault)
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vault/vaulttest"
+)
+
+func TestVaultInstaller(t *testing.T) {
+	server := vaulttest.NewServer()
+	defer server.Close()
+
+	request := domain.PlaybookRequest{
+		KeyType: certificate.KeyTypeECDSA,
+		Subject: domain.Subject{CommonName: "www.vcert.test"},
+	}
+
+	for _, mount := range []string{vaulttest.MountV1, vaulttest.MountV2} {
+		t.Run(mount, func(t *testing.T) {
+			path := mount + "/vcert/www"
+			server.Put(path, map[string]interface{}{"owner": "team-a"})
+			inst := NewVaultInstaller(domain.Installation{
+				Type: domain.FormatVault,
+				Vault: &domain.VaultSecret{
+					Vault: domain.Vault{Address: server.URL, Auth: domain.VaultAuth{Token: vaulttest.Token}},
+					Path:  path,
+				},
+			})
+
+			// No certificate in the secret yet
+			cert, err := inst.InstalledCertificate(request)
+			require.NoError(t, err)
+			assert.Nil(t, cert)
+			install, err := inst.Check("1h", request)
+			require.NoError(t, err)
+			assert.True(t, install)
+
+			pcc := testPEMCollection(t, "www.vcert.test")
+			require.NoError(t, inst.Install(pcc))
+			data := server.Get(path)
+			assert.Equal(t, pcc.Certificate, data[vaultKeyCertificate])
+			assert.Equal(t, pcc.PrivateKey, data[vaultKeyPrivateKey])
+			assert.Equal(t, pcc.Chain[0], data[vaultKeyChain])
+			assert.Equal(t, "team-a", data["owner"])
+
+			cert, err = inst.InstalledCertificate(request)
+			require.NoError(t, err)
+			require.NotNil(t, cert)
+			assert.Equal(t, "www.vcert.test", cert.Subject.CommonName)
+			install, err = inst.Check("1h", request)
+			require.NoError(t, err)
+			assert.False(t, install)
+
+			require.NoError(t, inst.Backup())
+			backup := server.Get(path + backupSuffix)
+			require.NotNil(t, backup)
+			assert.Equal(t, pcc.Certificate, backup[vaultKeyCertificate])
+			assert.NotEmpty(t, backup[vaultKeyBackupTime])
+
+			// The backup is restored
+			require.NoError(t, inst.Install(testPEMCollection(t, "www2.vcert.test")))
+			require.NoError(t, inst.Rollback(pcc))
+			data = server.Get(path)
+			assert.Equal(t, pcc.Certificate, data[vaultKeyCertificate])
+			assert.Equal(t, "team-a", data["owner"])
+			assert.NotContains(t, data, vaultKeyBackupTime)
+
+			// The backup left by a secret deleted since is not restored
+			inst.Vault.Path = mount + "/vcert/new"
+			server.Put(inst.Vault.Path+backupSuffix, backup)
+			require.NoError(t, inst.Backup())
+			assert.Nil(t, server.Get(inst.Vault.Path+backupSuffix))
+			require.NoError(t, inst.Install(pcc))
+			require.NoError(t, inst.Rollback(pcc))
+			assert.Nil(t, server.Get(inst.Vault.Path))
+		})
+	}
+}
+
+func TestVaultInstaller_KeyPassword(t *testing.T) {
+	server := vaulttest.NewServer()
+	defer server.Close()
+
+	inst := NewVaultInstaller(domain.Installation{
+		Type:        domain.FormatVault,
+		KeyPassword: "foo123",
+		Vault: &domain.VaultSecret{
+			Vault:     domain.Vault{Address: server.URL, Auth: domain.VaultAuth{Token: vaulttest.Token}},
+			Mount:     vaulttest.MountV2,
+			KVVersion: 2,
+			Path:      "vcert/www",
+		},
+	})
+	pcc := testPEMCollection(t, "www.vcert.test")
+	require.NoError(t, inst.Install(pcc))
+	key, _ := server.Get(vaulttest.MountV2 + "/vcert/www")[vaultKeyPrivateKey].(string)
+	assert.Contains(t, key, "ENCRYPTED")
+}
@@ -29,4 +29,8 @@ var (
 	ErrTextTplParsing = fmt.Errorf("failed to parse the playbook file")
 	// ErrFileUnmarshall is thrown when the content of the Playbook file cannot be successfully unmarshalled into a domain.Playbook object
 	ErrFileUnmarshall = fmt.Errorf("failed to unmarshal the playbook file")
+	// ErrInclude is thrown when a file included by the Playbook file cannot be read or includes itself
+	ErrInclude = fmt.Errorf("failed to include playbook file")
+	// ErrForEach is thrown when the forEach of a certificate task is invalid or its items cannot be read
+	ErrForEach = fmt.Errorf("failed to expand forEach")
 )
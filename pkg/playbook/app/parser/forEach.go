@@ -0,0 +1,234 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// forEach expands a certificate task into one task per item. Exactly one source of items is set
+type forEach struct {
+	// Items are listed inline: strings, or mappings such as {host: www, port: 443}
+	Items []interface{} `yaml:"items,omitempty"`
+	// Matrix has an item for each combination of its values, e.g. {host: [www, api], env: [dev, prod]} gives the
+	// items {env: dev, host: www}, {env: dev, host: api}...
+	Matrix map[string][]string `yaml:"matrix,omitempty"`
+	// File is a CSV file, whose first row names the columns, or a JSON array of strings or objects
+	File string `yaml:"file,omitempty"`
+	// Glob matches existing certificate files. Each item has the path, name (file name without extension), dir and
+	// commonName of a file
+	Glob string `yaml:"glob,omitempty"`
+}
+
+// expandTask returns task, or the tasks expanded by its forEach with their item. location is the file of task
+func (r *playbookReader) expandTask(location string, task *yaml.Node) ([]taskNode, error) {
+	node := mappingValue(task, keyForEach)
+	if node == nil {
+		return []taskNode{{node: task}}, nil
+	}
+	name := ""
+	if nameNode := mappingValue(task, keyName); nameNode != nil {
+		name = nameNode.Value
+	}
+
+	var each forEach
+	err := node.Decode(&each)
+	if err != nil {
+		return nil, fmt.Errorf("%w: task %s: %w", ErrForEach, name, err)
+	}
+	items, err := each.items(filepath.Dir(location), &r.inputs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: task %s: %w", ErrForEach, name, err)
+	}
+	if len(items) == 0 {
+		zap.L().Warn("forEach has no items, no task is run", zap.String("task", name))
+	}
+
+	removeMappingKeys(task, keyForEach)
+	tasks := make([]taskNode, 0, len(items))
+	for _, item := range items {
+		tasks = append(tasks, taskNode{node: copyNode(task), item: item})
+	}
+	return tasks, nil
+}
+
+// items returns the items of f, adding the files and glob patterns they are read from to inputs. Relative paths are
+// relative to dir
+func (f forEach) items(dir string, inputs *Inputs) ([]interface{}, error) {
+	sources := 0
+	for _, set := range []bool{f.Items != nil, f.Matrix != nil, f.File != "", f.Glob != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("exactly one of items, matrix, file and glob must be set")
+	}
+
+	switch {
+	case f.Items != nil:
+		return f.Items, nil
+	case f.Matrix != nil:
+		return matrixItems(f.Matrix), nil
+	case f.File != "":
+		file := relativeTo(dir, f.File)
+		inputs.addFile(file)
+		return fileItems(file)
+	default:
+		pattern := relativeTo(dir, f.Glob)
+		inputs.addPattern(pattern)
+		items, err := globItems(pattern)
+		if err != nil {
+			return nil, err
+		}
+		// the common names of the items are read from the files
+		for _, item := range items {
+			inputs.addFile(item.(map[string]string)["path"])
+		}
+		return items, nil
+	}
+}
+
+// matrixItems returns every combination of the values of matrix. The keys are sorted, the values of the first one
+// varying the slowest
+func matrixItems(matrix map[string][]string) []interface{} {
+	keys := make([]string, 0, len(matrix))
+	for key := range matrix {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	combinations := []map[string]string{{}}
+	for _, key := range keys {
+		next := make([]map[string]string, 0, len(combinations)*len(matrix[key]))
+		for _, combination := range combinations {
+			for _, value := range matrix[key] {
+				item := make(map[string]string, len(combination)+1)
+				for k, v := range combination {
+					item[k] = v
+				}
+				item[key] = value
+				next = append(next, item)
+			}
+		}
+		combinations = next
+	}
+
+	items := make([]interface{}, 0, len(combinations))
+	for _, combination := range combinations {
+		items = append(items, combination)
+	}
+	return items
+}
+
+// fileItems reads the items of a JSON file, an array of strings or objects, or of a CSV file with a header row
+func fileItems(file string) ([]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		var items []interface{}
+		err = json.Unmarshal(data, &items)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON file %s: %w", file, err)
+		}
+		return items, nil
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV file %s: %w", file, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	header := records[0]
+	items := make([]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		item := make(map[string]string, len(header))
+		for i, column := range header {
+			item[strings.TrimSpace(column)] = strings.TrimSpace(record[i])
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// globItems returns an item for each file matching pattern
+func globItems(pattern string) ([]interface{}, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]interface{}, 0, len(matches))
+	for _, match := range matches {
+		base := filepath.Base(match)
+		items = append(items, map[string]string{
+			"path":       match,
+			"name":       strings.TrimSuffix(base, filepath.Ext(base)),
+			"dir":        filepath.Dir(match),
+			"commonName": certificateCommonName(match),
+		})
+	}
+	return items, nil
+}
+
+// certificateCommonName returns the common name of the first PEM certificate of file, or "" if it has none
+func certificateCommonName(file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return ""
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			zap.L().Warn("failed to read certificate", zap.String("file", file), zap.Error(err))
+			return ""
+		}
+		return cert.Subject.CommonName
+	}
+}
+
+func relativeTo(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const forEachPlaybook = `
+config:
+  connection:
+    platform: vaas
+    credentials:
+      apiKey: key
+defaults:
+  request:
+    zone: Open Source\vcert
+  installation:
+    format: PEM
+    file: /etc/ssl/{{ .Task.Name }}.pem
+    keyFile: /etc/ssl/{{ .Task.Name }}.key
+    chainFile: /etc/ssl/{{ .Task.Name }}-chain.pem
+certificateTasks:
+  - name: 'edge-{{ .Item }}'
+    forEach:
+      items: [pop1, pop2]
+    request:
+      subject:
+        commonName: '{{ .Item }}.edge.example.com'
+      sanDNS:
+        - '{{ .Item }}.edge.example.com'
+        - '{{ .Item }}.example.net'
+    installations:
+      - {}
+  - name: '{{ .Item.host }}'
+    forEach:
+      file: hosts.csv
+    request:
+      subject:
+        commonName: '{{ .Item.host }}.example.com'
+    installations:
+      - afterInstallAction: 'reload {{ .Item.service }}'
+  - name: '{{ .Item.host }}-json'
+    forEach:
+      file: hosts.json
+    request:
+      subject:
+        commonName: '{{ .Item.host }}.example.com'
+    installations:
+      - {}
+  - name: '{{ .Item.host }}-{{ .Item.env }}'
+    forEach:
+      matrix:
+        host: [www, api]
+        env: [dev, prod]
+    request:
+      subject:
+        commonName: '{{ .Item.host }}.{{ .Item.env }}.example.com'
+    installations:
+      - {}
+  - name: 'renew-{{ .Item.name }}'
+    forEach:
+      glob: certs/*.pem
+    request:
+      subject:
+        commonName: '{{ .Item.commonName }}'
+    installations:
+      - file: '{{ .Item.path }}'
+`
+
+func writeTestCertificate(t *testing.T, file string, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	writePlaybookFile(t, file, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+}
+
+func TestReadPlaybook_ForEach(t *testing.T) {
+	dir := t.TempDir()
+	writePlaybookFile(t, filepath.Join(dir, "hosts.csv"), "host, service\nmail, postfix\nldap, slapd\n")
+	writePlaybookFile(t, filepath.Join(dir, "hosts.json"), `[{"host": "vpn"}]`)
+	writeTestCertificate(t, filepath.Join(dir, "certs", "legacy.pem"), "legacy.example.com")
+	main := writePlaybookFile(t, filepath.Join(dir, "playbook.yaml"), forEachPlaybook)
+
+	pb, inputs, err := ReadPlaybookWithInputs(main)
+	require.NoError(t, err)
+	assert.Equal(t, []string{main, filepath.Join(dir, "hosts.csv"), filepath.Join(dir, "hosts.json"),
+		filepath.Join(dir, "certs", "legacy.pem")}, inputs.Files)
+	assert.Equal(t, []string{filepath.Join(dir, "certs", "*.pem")}, inputs.Patterns)
+	names := make([]string, 0, len(pb.CertificateTasks))
+	for _, task := range pb.CertificateTasks {
+		names = append(names, task.Name)
+	}
+	assert.Equal(t, []string{"edge-pop1", "edge-pop2", "mail", "ldap", "vpn-json", "www-dev", "api-dev", "www-prod",
+		"api-prod", "renew-legacy"}, names)
+	_, err = pb.IsValid()
+	assert.NoError(t, err)
+
+	edge := pb.CertificateTasks[1]
+	assert.Equal(t, "pop2.edge.example.com", edge.Request.Subject.CommonName)
+	assert.Equal(t, []string{"pop2.edge.example.com", "pop2.example.net"}, edge.Request.DNSNames)
+	assert.Equal(t, "/etc/ssl/edge-pop2.pem", edge.Installations[0].File)
+
+	ldap := pb.CertificateTasks[3]
+	assert.Equal(t, "ldap.example.com", ldap.Request.Subject.CommonName)
+	assert.Equal(t, "reload slapd", ldap.Installations[0].AfterAction)
+	assert.Equal(t, "/etc/ssl/ldap.key", ldap.Installations[0].KeyFile)
+
+	assert.Equal(t, "vpn.example.com", pb.CertificateTasks[4].Request.Subject.CommonName)
+	assert.Equal(t, "www.prod.example.com", pb.CertificateTasks[7].Request.Subject.CommonName)
+
+	legacy := pb.CertificateTasks[9]
+	assert.Equal(t, "legacy.example.com", legacy.Request.Subject.CommonName)
+	assert.Equal(t, filepath.Join(dir, "certs", "legacy.pem"), legacy.Installations[0].File)
+}
+
+func TestReadPlaybook_ForEachErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"TwoSources":  "certificateTasks:\n  - name: a\n    forEach:\n      items: [a]\n      glob: '*.pem'\n",
+		"MissingFile": "certificateTasks:\n  - name: a\n    forEach:\n      file: missing.csv\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := writePlaybookFile(t, filepath.Join(dir, name+".yaml"), content)
+			_, err := ReadPlaybook(file)
+			assert.ErrorIs(t, err, ErrForEach)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Inputs are what a playbook is read from: the playbook file, the files it includes and the forEach files, and the
+// glob patterns of include and forEach, whose matches make up the tasks
+type Inputs struct {
+	Files    []string
+	Patterns []string
+}
+
+func (i *Inputs) addFile(file string) {
+	if !slices.Contains(i.Files, file) {
+		i.Files = append(i.Files, file)
+	}
+}
+
+func (i *Inputs) addPattern(pattern string) {
+	if !slices.Contains(i.Patterns, pattern) {
+		i.Patterns = append(i.Patterns, pattern)
+	}
+}
+
+// Hash returns a hash of the content of the Files and of the matches of the Patterns, which changes when any of them
+// does. It fails if one of the Files can't be read
+func (i Inputs) Hash() ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	h := sha256.New()
+	for _, file := range i.Files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return sum, err
+		}
+		_, _ = fmt.Fprintf(h, "file %q %d\n", file, len(data))
+		_, _ = h.Write(data)
+	}
+	for _, pattern := range i.Patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return sum, err
+		}
+		_, _ = fmt.Fprintf(h, "pattern %q %q\n", pattern, matches)
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
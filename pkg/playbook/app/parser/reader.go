@@ -18,8 +18,10 @@ package parser
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/template"
 
@@ -27,12 +29,20 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vault"
 )
 
 var errorTemplate = "%w: %s"
 
 // ReadPlaybook reads the file in location, parses the content and returns a Playbook object
 func ReadPlaybook(location string) (domain.Playbook, error) {
+	playbook, _, err := ReadPlaybookWithInputs(location)
+	return playbook, err
+}
+
+// ReadPlaybookWithInputs reads the file in location like ReadPlaybook, and also returns the Inputs the Playbook was
+// read from
+func ReadPlaybookWithInputs(location string) (domain.Playbook, Inputs, error) {
 	playbook := domain.NewPlaybook()
 
 	//Set location. Otherwise, use default
@@ -40,24 +50,48 @@ func ReadPlaybook(location string) (domain.Playbook, error) {
 		playbook.Location = location
 	}
 
-	data, err := readFile(location)
-
+	abs, err := filepath.Abs(playbook.Location)
 	if err != nil {
-		return playbook, err
+		return playbook, Inputs{}, fmt.Errorf(errorTemplate, ErrReadFile, err.Error())
 	}
-
-	data, err = parseConfigTemplate(data)
+	reader := &playbookReader{reading: map[string]bool{abs: true}}
+	root, err := reader.readPlaybookNode(location)
 	if err != nil {
-		return playbook, fmt.Errorf(errorTemplate, ErrTextTplParsing, err.Error())
+		return playbook, reader.inputs, err
 	}
 
-	err = yaml.Unmarshal(data, &playbook)
+	// The tasks of the file and of the files it includes are rendered one by one, with the defaults applied
+	tasks, err := reader.readTasks(abs, root, nil)
+	if err != nil {
+		return playbook, reader.inputs, err
+	}
+	removeMappingKeys(root, keyCertificateTasks, keySshCertificateTasks, keyDefaults, keyInclude)
+	err = root.Decode(&playbook)
 	if err != nil {
-		return playbook, fmt.Errorf(errorTemplate, ErrFileUnmarshall, err.Error())
+		return playbook, reader.inputs, fmt.Errorf(errorTemplate, ErrFileUnmarshall, err.Error())
+	}
+	playbook.CertificateTasks = make(domain.CertificateTasks, 0, len(tasks))
+	for _, task := range tasks {
+		if task.ssh {
+			var sshTask domain.SshCertificateTask
+			err = reader.renderTask(task, &sshTask)
+			if err != nil {
+				return playbook, reader.inputs, err
+			}
+			playbook.SshCertificateTasks = append(playbook.SshCertificateTasks, sshTask)
+			continue
+		}
+
+		var certTask domain.CertificateTask
+		err = reader.renderTask(task, &certTask)
+		if err != nil {
+			return playbook, reader.inputs, err
+		}
+		playbook.CertificateTasks = append(playbook.CertificateTasks, certTask)
 	}
 
 	zap.L().Info("playbook successfully parsed")
-	return playbook, nil
+	return playbook, reader.inputs, nil
 }
 
 // ReadPlaybookRaw reads the file in location and parses the content to a map.
@@ -98,28 +132,86 @@ func readFile(location string) ([]byte, error) {
 }
 
 func parseConfigTemplate(b []byte) ([]byte, error) {
+	// Parse the YAML config template file
+	tpl, err := template.New("config").Funcs(templateFuncs()).Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	// Get a bytes buffer to store results in
+	buf := &bytes.Buffer{}
+
+	err = tpl.Execute(buf, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// vaultEnvPrefix starts the names of the Env template function read from a Vault secret, as vault:<path>#<key>
+const vaultEnvPrefix = "vault:"
+
+// templateFuncs returns the functions of the playbook templates
+func templateFuncs() template.FuncMap {
+	// The Vault client is shared by the Env functions of the template
+	var vaultClient *vault.Client
+	lookupVault := func(name string) (string, bool, error) {
+		path, key, ok := strings.Cut(strings.TrimPrefix(name, vaultEnvPrefix), "#")
+		if !ok || path == "" || key == "" {
+			return "", false, fmt.Errorf("invalid vault variable %s, expected %s<path>#<key>", name, vaultEnvPrefix)
+		}
+		if vaultClient == nil {
+			client, err := vault.NewClient(domain.Vault{})
+			if err != nil {
+				return "", false, err
+			}
+			vaultClient = client
+		}
+		data, err := vaultClient.ReadSecret(domain.VaultSecret{Path: path})
+		if errors.Is(err, vault.ErrNotFound) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		value, found := data[key]
+		if !found {
+			return "", false, nil
+		}
+		if s, ok := value.(string); ok {
+			return s, true, nil
+		}
+		return fmt.Sprint(value), true, nil
+	}
+
 	// Valid functions for the config file template
-	fm := template.FuncMap{
+	return template.FuncMap{
+		// Env returns the value of an environment variable, or the default value given as second argument when it is
+		// not defined. Variables named vault:<path>#<key> are the key of a secret of a Vault KV secrets engine, the
+		// Vault server and credentials being read from the VAULT_* environment variables.
+		//
+		// E.g. {{ Env "TPP_REFRESH_TOKEN" }} or {{ Env "vault:secret/vcert/tpp#refreshToken" }}
 		"Env": func(es ...string) (string, error) {
-			if len(es) == 1 {
-				e := es[0]
-				value, found := os.LookupEnv(e)
-				if found {
-					return value, nil
-				}
-				return "", fmt.Errorf("environment variable not defined: %s", e)
-			} else if len(es) == 2 {
-				e := es[0]
-				d := es[1]
-				value, found := os.LookupEnv(e)
-				if found {
-					return value, nil
-				} else {
-					return d, nil
-				}
-			} else {
+			if len(es) != 1 && len(es) != 2 {
 				return "", fmt.Errorf("unsupported number of inputs provided: %d", len(es))
 			}
+			e := es[0]
+			value, found := os.LookupEnv(e)
+			if strings.HasPrefix(e, vaultEnvPrefix) {
+				var err error
+				value, found, err = lookupVault(e)
+				if err != nil {
+					return "", err
+				}
+			}
+			if found {
+				return value, nil
+			}
+			if len(es) == 2 {
+				return es[1], nil
+			}
+			return "", fmt.Errorf("environment variable not defined: %s", e)
 		},
 		"Hostname": func() string {
 			hostname, err := os.Hostname()
@@ -132,20 +224,4 @@ func parseConfigTemplate(b []byte) ([]byte, error) {
 		"ToLower": strings.ToLower,
 		"ToUpper": strings.ToUpper,
 	}
-
-	// Parse the YAML config template file
-	tpl, err := template.New("config").Funcs(fm).Parse(string(b))
-	if err != nil {
-		return nil, err
-	}
-
-	// Get a bytes buffer to store results in
-	buf := &bytes.Buffer{}
-
-	err = tpl.Execute(buf, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	return buf.Bytes(), nil
 }
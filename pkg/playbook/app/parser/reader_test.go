@@ -25,6 +25,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/suite"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vault/vaulttest"
 )
 
 type ReaderSuite struct {
@@ -131,3 +133,28 @@ func RandomString(n int) string {
 	}
 	return string(b)
 }
+
+func (s *ReaderSuite) TestReader_VaultTpl() {
+	server := vaulttest.NewServer()
+	defer server.Close()
+	server.Put(vaulttest.MountV2+"/vcert/tpp", map[string]interface{}{"refreshToken": s.refreshToken})
+	s.T().Setenv("VAULT_ADDR", server.URL)
+	s.T().Setenv("VAULT_TOKEN", vaulttest.Token)
+
+	data, err := parseConfigTemplate([]byte(`refreshToken: {{ Env "vault:secret/vcert/tpp#refreshToken" }}`))
+	s.Nil(err)
+	s.Equal("refreshToken: "+s.refreshToken, string(data))
+
+	// the default value is used when the key or the secret are not found
+	data, err = parseConfigTemplate([]byte(`accessToken: {{ Env "vault:secret/vcert/tpp#accessToken" "none" }}`))
+	s.Nil(err)
+	s.Equal("accessToken: none", string(data))
+	data, err = parseConfigTemplate([]byte(`accessToken: {{ Env "vault:secret/vcert/missing#accessToken" "none" }}`))
+	s.Nil(err)
+	s.Equal("accessToken: none", string(data))
+
+	_, err = parseConfigTemplate([]byte(`accessToken: {{ Env "vault:secret/vcert/tpp#accessToken" }}`))
+	s.NotNil(err)
+	_, err = parseConfigTemplate([]byte(`accessToken: {{ Env "vault:secret/vcert/tpp" }}`))
+	s.NotNil(err)
+}
@@ -0,0 +1,450 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	keyCertificateTasks    = "certificateTasks"
+	keyConfig              = "config"
+	keyDefaults            = "defaults"
+	keyForEach             = "forEach"
+	keyInclude             = "include"
+	keyInstallation        = "installation"
+	keyInstallations       = "installations"
+	keyName                = "name"
+	keySshCertificateTasks = "sshCertificateTasks"
+	keyVars                = "vars"
+
+	// taskActionToken stands for a task template action until the task is rendered
+	taskActionToken = "__vcert_task_action_%d__"
+)
+
+var (
+	// actionRegex matches the template actions
+	actionRegex = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+	// taskVariableRegex matches the task variables, rendered once per task
+	taskVariableRegex = regexp.MustCompile(`\.(?:Task|Vars|Item)\b`)
+	// taskTokenRegex matches the tokens standing for task template actions
+	taskTokenRegex = regexp.MustCompile(`__vcert_task_action_(\d+)__`)
+)
+
+// TaskTemplateData is the data of the templates of a certificate task: {{ .Task.Name }}, {{ .Vars.myVar }} and, for
+// the tasks expanded by forEach, {{ .Item }}
+type TaskTemplateData struct {
+	Task TaskTemplateInfo
+	Vars map[string]string
+	// Item is the forEach item of the task: a string, or a map such as {{ .Item.host }}
+	Item interface{}
+}
+
+// TaskTemplateInfo describes the certificate task being rendered
+type TaskTemplateInfo struct {
+	Name string
+}
+
+// taskNode is a certificate task read from a playbook file, before it is rendered
+type taskNode struct {
+	node *yaml.Node
+	// item is the forEach item the task was expanded for, if any
+	item interface{}
+	// ssh is true for an SSH certificate task
+	ssh bool
+}
+
+// playbookReader reads a playbook file and the files it includes
+type playbookReader struct {
+	// actions are the task template actions, or blocks of actions, replaced by tokens, by token number
+	actions []string
+	// reading are the files being read, to detect include cycles
+	reading map[string]bool
+	// inputs are the files read and the glob patterns matched so far
+	inputs Inputs
+}
+
+// readPlaybookNode reads the playbook file in location, renders its config templates and returns its content. The
+// task template actions are replaced by tokens
+func (r *playbookReader) readPlaybookNode(location string) (*yaml.Node, error) {
+	r.inputs.addFile(location)
+	data, err := readFile(location)
+	if err != nil {
+		return nil, err
+	}
+
+	// the task template actions can't be rendered yet: they are kept aside until the task is known
+	data = r.replaceTaskActions(data)
+
+	data, err = parseConfigTemplate(data)
+	if err != nil {
+		return nil, fmt.Errorf(errorTemplate, ErrTextTplParsing, err.Error())
+	}
+
+	var doc yaml.Node
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf(errorTemplate, ErrFileUnmarshall, err.Error())
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w: %s is not a mapping", ErrFileUnmarshall, location)
+	}
+	return root, nil
+}
+
+// replaceTaskActions replaces the task template actions of data by tokens. An if, range or with block using the task
+// variables, or nested in such a block, is replaced as a whole, from its action to its end, so that its else and end
+// actions are not rendered with the rest of the file
+func (r *playbookReader) replaceTaskActions(data []byte) []byte {
+	type block struct {
+		start int
+		task  bool
+	}
+	var blocks []block
+	var ranges [][2]int
+	for _, loc := range actionRegex.FindAllIndex(data, -1) {
+		action := data[loc[0]:loc[1]]
+		task := taskVariableRegex.Match(action)
+		keyword, _, _ := strings.Cut(strings.TrimSpace(strings.Trim(string(action), "{}-")), " ")
+		switch keyword {
+		case "if", "range", "with", "define", "block":
+			nested := len(blocks) > 0 && blocks[len(blocks)-1].task
+			blocks = append(blocks, block{start: loc[0], task: task || nested})
+		case "else":
+			// an else if using the task variables makes the whole block a task one
+			if task && len(blocks) > 0 {
+				blocks[len(blocks)-1].task = true
+			}
+		case "end":
+			if len(blocks) == 0 {
+				// the file template reports the unexpected end
+				continue
+			}
+			b := blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+			if b.task {
+				ranges = append(ranges, [2]int{b.start, loc[1]})
+			}
+		default:
+			if task {
+				ranges = append(ranges, [2]int{loc[0], loc[1]})
+			}
+		}
+	}
+
+	// the ranges of the blocks come after the ones of the actions they hold: the outermost range wins
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0] || ranges[i][0] == ranges[j][0] && ranges[i][1] > ranges[j][1]
+	})
+	var replaced bytes.Buffer
+	last := 0
+	for _, rng := range ranges {
+		if rng[0] < last {
+			continue
+		}
+		replaced.Write(data[last:rng[0]])
+		r.actions = append(r.actions, string(data[rng[0]:rng[1]]))
+		replaced.WriteString(fmt.Sprintf(taskActionToken, len(r.actions)-1))
+		last = rng[1]
+	}
+	replaced.Write(data[last:])
+	return replaced.Bytes()
+}
+
+// readTasks returns the certificate tasks of root, read from location, then its SSH certificate tasks, followed by the
+// ones of the files it includes. The defaults of root, merged over parentDefaults, are applied to all the certificate
+// tasks, but not to the SSH ones
+func (r *playbookReader) readTasks(location string, root *yaml.Node, parentDefaults *yaml.Node) ([]taskNode, error) {
+	defaults := mergeNodes(parentDefaults, mappingValue(root, keyDefaults))
+
+	var tasks []taskNode
+	if node := mappingValue(root, keyCertificateTasks); node != nil {
+		if node.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("%w: %s of %s is not a list", ErrFileUnmarshall, keyCertificateTasks, location)
+		}
+		for _, task := range node.Content {
+			expanded, err := r.expandTask(location, applyDefaults(defaults, task))
+			if err != nil {
+				return nil, err
+			}
+			tasks = append(tasks, expanded...)
+		}
+	}
+	if node := mappingValue(root, keySshCertificateTasks); node != nil {
+		if node.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("%w: %s of %s is not a list", ErrFileUnmarshall, keySshCertificateTasks, location)
+		}
+		for _, task := range node.Content {
+			expanded, err := r.expandTask(location, copyNode(task))
+			if err != nil {
+				return nil, err
+			}
+			for i := range expanded {
+				expanded[i].ssh = true
+			}
+			tasks = append(tasks, expanded...)
+		}
+	}
+
+	includes, err := r.includes(location, root)
+	if err != nil {
+		return nil, err
+	}
+	for _, include := range includes {
+		if r.reading[include] {
+			return nil, fmt.Errorf("%w: %s includes itself", ErrInclude, include)
+		}
+		r.reading[include] = true
+		included, err := r.readPlaybookNode(include)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrInclude, include, err)
+		}
+		if mappingValue(included, keyConfig) != nil {
+			return nil, fmt.Errorf("%w %s: the config can only be set in the main playbook file", ErrInclude, include)
+		}
+		includedTasks, err := r.readTasks(include, included, defaults)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, includedTasks...)
+		delete(r.reading, include)
+	}
+	return tasks, nil
+}
+
+// includes returns the files included by root, read from location. Relative paths and globs are relative to the
+// directory of location
+func (r *playbookReader) includes(location string, root *yaml.Node) ([]string, error) {
+	node := mappingValue(root, keyInclude)
+	if node == nil {
+		return nil, nil
+	}
+	var patterns []string
+	err := node.Decode(&patterns)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s of %s must be a list of files: %w", ErrInclude, keyInclude, location, err)
+	}
+
+	var files []string
+	for _, pattern := range patterns {
+		pattern = relativeTo(filepath.Dir(location), pattern)
+		if strings.ContainsAny(pattern, `*?[`) {
+			r.inputs.addPattern(pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid pattern %s: %w", ErrInclude, pattern, err)
+		}
+		// a file that doesn't exist is an error, a glob matching nothing is not
+		if len(matches) == 0 && !strings.ContainsAny(pattern, `*?[`) {
+			return nil, fmt.Errorf("%w %s: %w", ErrInclude, pattern, ErrReadFile)
+		}
+		for _, match := range matches {
+			abs, err := filepath.Abs(match)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, abs)
+		}
+	}
+	return files, nil
+}
+
+// renderTask renders the task template actions of task and decodes it in out, a *domain.CertificateTask or a
+// *domain.SshCertificateTask
+func (r *playbookReader) renderTask(t taskNode, out interface{}) error {
+	task := t.node
+	data := TaskTemplateData{Vars: map[string]string{}, Item: t.item}
+	name := mappingValue(task, keyName)
+	if name == nil {
+		name = &yaml.Node{Kind: yaml.ScalarNode}
+	}
+	if vars := mappingValue(task, keyVars); vars != nil {
+		err := vars.Decode(&data.Vars)
+		if err != nil {
+			return fmt.Errorf("%w: %s of task %s: %w", ErrFileUnmarshall, keyVars, name.Value, err)
+		}
+	}
+	// the name is rendered first, to be used by the other values
+	err := r.renderNode(name, data)
+	if err != nil {
+		return fmt.Errorf("%w: name of task %s: %w", ErrTextTplParsing, name.Value, err)
+	}
+	data.Task.Name = name.Value
+
+	err = r.renderNode(task, data)
+	if err != nil {
+		return fmt.Errorf("%w: task %s: %w", ErrTextTplParsing, data.Task.Name, err)
+	}
+	err = task.Decode(out)
+	if err != nil {
+		return fmt.Errorf(errorTemplate, ErrFileUnmarshall, err.Error())
+	}
+	return nil
+}
+
+// renderNode renders node as a template of its own, with the task template actions put back in place of their
+// tokens, and replaces it with the node read from the result. A value rendered is thus decoded like a value written
+// in the file, and a range may render a list
+func (r *playbookReader) renderNode(node *yaml.Node, data TaskTemplateData) error {
+	text, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	if !taskTokenRegex.Match(text) {
+		return nil
+	}
+	var tokenErr error
+	text = taskTokenRegex.ReplaceAllFunc(text, func(token []byte) []byte {
+		i, err := strconv.Atoi(string(taskTokenRegex.FindSubmatch(token)[1]))
+		if err != nil || i >= len(r.actions) {
+			tokenErr = fmt.Errorf("unknown template action %s", token)
+			return token
+		}
+		return []byte(r.actions[i])
+	})
+	if tokenErr != nil {
+		return tokenErr
+	}
+
+	tpl, err := template.New("task").Funcs(templateFuncs()).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	err = tpl.Execute(buf, data)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	err = yaml.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+		return nil
+	}
+	*node = *doc.Content[0]
+	return nil
+}
+
+// applyDefaults returns a copy of task merged over defaults: the request and vars of defaults are merged into the
+// task, and its installation into each installation of the task
+func applyDefaults(defaults *yaml.Node, task *yaml.Node) *yaml.Node {
+	task = copyNode(task)
+	if defaults == nil || task.Kind != yaml.MappingNode {
+		return task
+	}
+
+	taskDefaults := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i+1 < len(defaults.Content); i += 2 {
+		if defaults.Content[i].Value != keyInstallation {
+			taskDefaults.Content = append(taskDefaults.Content, defaults.Content[i], defaults.Content[i+1])
+		}
+	}
+	task = mergeNodes(taskDefaults, task)
+
+	installation := mappingValue(defaults, keyInstallation)
+	installations := mappingValue(task, keyInstallations)
+	if installation == nil || installations == nil || installations.Kind != yaml.SequenceNode {
+		return task
+	}
+	for i, inst := range installations.Content {
+		installations.Content[i] = mergeNodes(installation, inst)
+	}
+	return task
+}
+
+// mergeNodes returns a copy of base with the values of override. Mappings are merged key by key, any other value of
+// override replaces the one of base
+func mergeNodes(base *yaml.Node, override *yaml.Node) *yaml.Node {
+	if override == nil {
+		return copyNode(base)
+	}
+	if base == nil || base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return copyNode(override)
+	}
+
+	merged := copyNode(base)
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j+1] = mergeNodes(merged.Content[j+1], value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.Content = append(merged.Content, copyNode(key), copyNode(value))
+		}
+	}
+	return merged
+}
+
+// copyNode returns a deep copy of node, so that rendering a task doesn't change the defaults shared with others
+func copyNode(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	c := *node
+	c.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+// mappingValue returns the value of key in the mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// removeMappingKeys removes keys from the mapping node
+func removeMappingKeys(node *yaml.Node, keys ...string) {
+	content := make([]*yaml.Node, 0, len(node.Content))
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if !slices.Contains(keys, node.Content[i].Value) {
+			content = append(content, node.Content[i], node.Content[i+1])
+		}
+	}
+	node.Content = content
+}
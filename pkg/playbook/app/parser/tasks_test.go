@@ -0,0 +1,284 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+)
+
+func writePlaybookFile(t *testing.T, file string, content string) string {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0700))
+	require.NoError(t, os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func TestReadPlaybook_IncludesAndDefaults(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("VCERT_TEST_ZONE", `Open Source\vcert`)
+	main := writePlaybookFile(t, filepath.Join(dir, "playbook.yaml"), `
+config:
+  connection:
+    platform: vaas
+    credentials:
+      apiKey: '{{ Env "VCERT_TEST_APIKEY" "key" }}'
+include:
+  - tasks/*.yaml
+defaults:
+  request:
+    zone: '{{ Env "VCERT_TEST_ZONE" }}'
+    keyType: ECDSA
+    subject:
+      country: US
+  installation:
+    format: PEM
+    file: /etc/ssl/{{ .Task.Name }}.pem
+    keyFile: /etc/ssl/{{ .Task.Name }}.key
+    chainFile: /etc/ssl/{{ .Task.Name }}-chain.pem
+    afterInstallAction: systemctl reload {{ .Vars.service }}
+  vars:
+    service: nginx
+certificateTasks:
+  - name: www
+    vars:
+      size: 4096
+    request:
+      keyType: RSA
+      keySize: {{ .Vars.size }}
+      subject:
+        commonName: '{{ .Task.Name }}.example.com'
+    installations:
+      - keyFile: /etc/ssl/private/www.key
+`)
+	writePlaybookFile(t, filepath.Join(dir, "tasks", "api.yaml"), `
+defaults:
+  vars:
+    service: haproxy
+certificateTasks:
+  - name: api
+    request:
+      subject:
+        commonName: api.example.com
+    installations:
+      - {}
+`)
+
+	pb, err := ReadPlaybook(main)
+	require.NoError(t, err)
+	assert.Equal(t, "key", pb.Config.Connection.Credentials.APIKey)
+	require.Len(t, pb.CertificateTasks, 2)
+
+	www := pb.CertificateTasks[0]
+	assert.Equal(t, `Open Source\vcert`, www.Request.Zone)
+	assert.Equal(t, certificate.KeyTypeRSA, www.Request.KeyType)
+	assert.Equal(t, 4096, www.Request.KeyLength)
+	assert.Equal(t, "www.example.com", www.Request.Subject.CommonName)
+	assert.Equal(t, "US", www.Request.Subject.Country)
+	require.Len(t, www.Installations, 1)
+	assert.Equal(t, "/etc/ssl/www.pem", www.Installations[0].File)
+	assert.Equal(t, "/etc/ssl/private/www.key", www.Installations[0].KeyFile)
+	assert.Equal(t, "systemctl reload nginx", www.Installations[0].AfterAction)
+
+	api := pb.CertificateTasks[1]
+	assert.Equal(t, `Open Source\vcert`, api.Request.Zone)
+	assert.Equal(t, certificate.KeyTypeECDSA, api.Request.KeyType)
+	assert.Equal(t, "/etc/ssl/api-chain.pem", api.Installations[0].ChainFile)
+	assert.Equal(t, "systemctl reload haproxy", api.Installations[0].AfterAction)
+	_, err = pb.IsValid()
+	assert.NoError(t, err)
+
+	// the daemon reloads the playbook when the included files or the matches of the include globs change
+	_, inputs, err := ReadPlaybookWithInputs(main)
+	require.NoError(t, err)
+	assert.Equal(t, []string{main, filepath.Join(dir, "tasks", "api.yaml")}, inputs.Files)
+	assert.Equal(t, []string{filepath.Join(dir, "tasks", "*.yaml")}, inputs.Patterns)
+}
+
+func TestReadPlaybook_TaskTemplateBlocks(t *testing.T) {
+	dir := t.TempDir()
+	main := writePlaybookFile(t, filepath.Join(dir, "playbook.yaml"), `
+config:
+  connection:
+    platform: vaas
+    credentials:
+      apiKey: '{{ if eq (Env "VCERT_TEST_ENV" "dev") "prod" }}prod-key{{ else }}key{{ end }}'
+defaults:
+  installation:
+    format: PEM
+    file: /etc/ssl/{{ .Task.Name }}.pem
+    afterInstallAction: {{ if .Vars.service }}systemctl reload {{ .Vars.service }}{{ else }}echo {{ .Task.Name }}{{ end }}
+  vars:
+    service: ''
+certificateTasks:
+  - name: www
+    vars:
+      service: nginx
+    request:
+      zone: Production\vcert
+      subject:
+        commonName: www.example.com
+    installations:
+      - {}
+  - name: '{{ .Item.host }}'
+    forEach:
+      items:
+        - host: edge
+          env: prod
+          sans: [edge.example.com, edge.example.net]
+        - host: lab
+          env: dev
+          sans: [lab.example.com]
+    request:
+      zone: '{{ if eq .Item.env "prod" }}Production{{ else }}Development{{ end }}\vcert'
+      subject:
+        commonName: '{{ range .Item.sans }}{{ if eq . (printf "%s.example.com" $.Item.host) }}{{ . }}{{ end }}{{ end }}'
+      sanDNS: [{{ range $i, $san := .Item.sans }}{{ if $i }}, {{ end }}{{ $san }}{{ end }}]
+    installations:
+      - {}
+`)
+
+	pb, err := ReadPlaybook(main)
+	require.NoError(t, err)
+	assert.Equal(t, "key", pb.Config.Connection.Credentials.APIKey)
+	require.Len(t, pb.CertificateTasks, 3)
+
+	// if and else
+	www, edge, lab := pb.CertificateTasks[0], pb.CertificateTasks[1], pb.CertificateTasks[2]
+	assert.Equal(t, "systemctl reload nginx", www.Installations[0].AfterAction)
+	assert.Equal(t, "echo edge", edge.Installations[0].AfterAction)
+	assert.Equal(t, `Production\vcert`, edge.Request.Zone)
+	assert.Equal(t, `Development\vcert`, lab.Request.Zone)
+
+	// range, in a value and rendering a list
+	assert.Equal(t, "edge.example.com", edge.Request.Subject.CommonName)
+	assert.Equal(t, []string{"edge.example.com", "edge.example.net"}, edge.Request.DNSNames)
+	assert.Equal(t, "lab.example.com", lab.Request.Subject.CommonName)
+	assert.Equal(t, []string{"lab.example.com"}, lab.Request.DNSNames)
+}
+
+func TestReadPlaybook_IncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	task := `
+certificateTasks:
+  - name: www
+    request:
+      subject:
+        commonName: '{{ .Vars.missing }}'
+`
+	cases := []struct {
+		name  string
+		files map[string]string
+		err   error
+	}{
+		{
+			name:  "MissingFile",
+			files: map[string]string{"playbook.yaml": "include: [missing.yaml]"},
+			err:   ErrInclude,
+		},
+		{
+			name:  "Cycle",
+			files: map[string]string{"playbook.yaml": "include: [a.yaml]", "a.yaml": "include: [playbook.yaml]"},
+			err:   ErrInclude,
+		},
+		{
+			name:  "IncludedConfig",
+			files: map[string]string{"playbook.yaml": "include: [a.yaml]", "a.yaml": "config: {}"},
+			err:   ErrInclude,
+		},
+		{
+			name:  "MissingVar",
+			files: map[string]string{"playbook.yaml": task},
+			err:   ErrTextTplParsing,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			caseDir := filepath.Join(dir, tc.name)
+			for name, content := range tc.files {
+				writePlaybookFile(t, filepath.Join(caseDir, name), content)
+			}
+			_, err := ReadPlaybook(filepath.Join(caseDir, "playbook.yaml"))
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestReadPlaybook_SshCertificateTasks(t *testing.T) {
+	dir := t.TempDir()
+	main := writePlaybookFile(t, filepath.Join(dir, "playbook.yaml"), `
+config:
+  connection:
+    platform: vaas
+    credentials:
+      apiKey: key
+include:
+  - users.yaml
+defaults:
+  request:
+    zone: Open Source\vcert
+sshCertificateTasks:
+  - name: host-{{ .Item }}
+    forEach:
+      items: [ed25519, rsa]
+    request:
+      template: host-template
+      keyId: web01-{{ .Item }}
+      principals: [web01.example.com]
+      validityPeriod: 30d
+    keyFile: /etc/ssh/ssh_host_{{ .Item }}_key
+    renewBefore: 7d
+    afterInstallAction: systemctl reload sshd
+`)
+	writePlaybookFile(t, filepath.Join(dir, "users.yaml"), `
+sshCertificateTasks:
+  - name: deploy
+    request:
+      template: user-template
+      keyType: ed25519
+    keyFile: /home/deploy/.ssh/id_ed25519
+    generateKey: true
+`)
+
+	pb, err := ReadPlaybook(main)
+	require.NoError(t, err)
+	assert.Empty(t, pb.CertificateTasks)
+	require.Len(t, pb.SshCertificateTasks, 3)
+
+	host := pb.SshCertificateTasks[0]
+	assert.Equal(t, "host-ed25519", host.Name)
+	assert.Equal(t, "host-template", host.Request.Template)
+	assert.Equal(t, "web01-ed25519", host.Request.KeyID)
+	assert.Equal(t, []string{"web01.example.com"}, host.Request.Principals)
+	assert.Equal(t, "/etc/ssh/ssh_host_ed25519_key", host.KeyFile)
+	assert.Equal(t, "/etc/ssh/ssh_host_ed25519_key-cert.pub", host.CertificateFile())
+	assert.Equal(t, "7d", host.RenewBefore)
+	assert.Equal(t, "systemctl reload sshd", host.AfterAction)
+	assert.Equal(t, "/etc/ssh/ssh_host_rsa_key", pb.SshCertificateTasks[1].KeyFile)
+
+	deploy := pb.SshCertificateTasks[2]
+	assert.True(t, deploy.GenerateKey)
+	assert.Equal(t, "ed25519", deploy.Request.KeyType)
+	_, err = pb.IsValid()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,453 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/metrics"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/parser"
+	"github.com/Venafi/vcert/v5/pkg/util"
+	"github.com/Venafi/vcert/v5/pkg/venafi"
+)
+
+const (
+	// DefaultMaxCheckInterval is the longest time the daemon waits between two checks of a task
+	DefaultMaxCheckInterval = 24 * time.Hour
+	// DefaultRetryInterval is the time the daemon waits before running a failed task again
+	DefaultRetryInterval = 5 * time.Minute
+	// DefaultWatchInterval is how often the daemon checks the playbook file for changes
+	DefaultWatchInterval = 10 * time.Second
+
+	// minCheckInterval keeps the daemon from checking a task in a loop when its renewal time has passed but the
+	// installers don't renew it, as happens when renewal is disabled
+	minCheckInterval = time.Minute
+)
+
+// DaemonOptions configures a Daemon
+type DaemonOptions struct {
+	// File is the path of the playbook file. It is reloaded when its content changes, or the one of the files it
+	// reads: its includes and the files and globs of forEach
+	File string
+	// HealthAddress is the address the health endpoint listens on, like ":8080". Empty disables the endpoint
+	HealthAddress string
+	// MaxCheckInterval is the longest time between two checks of a task. Defaults to DefaultMaxCheckInterval
+	MaxCheckInterval time.Duration
+	// RetryInterval is the time before a failed task is run again. Defaults to DefaultRetryInterval
+	RetryInterval time.Duration
+	// WatchInterval is how often the playbook file is checked for changes. Defaults to DefaultWatchInterval
+	WatchInterval time.Duration
+	// Load reads and validates the playbook file, and returns the inputs it was read from. Defaults to LoadPlaybook
+	Load func(file string) (domain.Playbook, parser.Inputs, error)
+}
+
+// Daemon keeps a playbook loaded and runs each of its certificate tasks when the installed certificates enter their
+// renew window, instead of relying on an external scheduler to run the playbook repeatedly.
+type Daemon struct {
+	options DaemonOptions
+
+	mu       sync.Mutex
+	playbook domain.Playbook
+	loadErr  error
+	tasks    map[string]*DaemonTaskState
+	started  time.Time
+	lastRun  time.Time
+	runs     int
+
+	// inputs are what playbook was read from, inputsHash their hash when last loaded
+	inputs     parser.Inputs
+	inputsHash [sha256.Size]byte
+}
+
+// DaemonTaskState is the state of a certificate task run by the Daemon
+type DaemonTaskState struct {
+	NextCheck   time.Time        `json:"nextCheck"`
+	LastRun     time.Time        `json:"lastRun,omitempty"`
+	Status      TaskStatus       `json:"status,omitempty"`
+	Errors      []string         `json:"errors,omitempty"`
+	Certificate *CertificateInfo `json:"certificate,omitempty"`
+}
+
+// NewDaemon returns a Daemon running the playbook file of options
+func NewDaemon(options DaemonOptions) *Daemon {
+	if options.MaxCheckInterval <= 0 {
+		options.MaxCheckInterval = DefaultMaxCheckInterval
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = DefaultRetryInterval
+	}
+	if options.WatchInterval <= 0 {
+		options.WatchInterval = DefaultWatchInterval
+	}
+	if options.Load == nil {
+		options.Load = LoadPlaybook
+	}
+	return &Daemon{
+		options: options,
+		tasks:   make(map[string]*DaemonTaskState),
+	}
+}
+
+// LoadPlaybook reads the playbook file, and its credentials from Vault if set, and validates it. It returns the
+// inputs the playbook was read from
+func LoadPlaybook(file string) (domain.Playbook, parser.Inputs, error) {
+	playbook, inputs, err := parser.ReadPlaybookWithInputs(file)
+	if err != nil {
+		return playbook, inputs, err
+	}
+	err = ReadVaultCredentials(&playbook)
+	if err != nil {
+		return playbook, inputs, err
+	}
+	_, err = playbook.IsValid()
+	if err != nil {
+		return playbook, inputs, fmt.Errorf("invalid playbook file %s: %w", file, err)
+	}
+	return playbook, inputs, nil
+}
+
+// Run loads the playbook and runs its tasks when they are due, until ctx is done. It only fails when the playbook
+// can't be loaded at start or the health endpoint can't listen: later errors are logged and the tasks retried.
+func (d *Daemon) Run(ctx context.Context) error {
+	changed, err := d.reload()
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.started = time.Now()
+	d.mu.Unlock()
+
+	if d.options.HealthAddress != "" {
+		server := &http.Server{
+			Addr:              d.options.HealthAddress,
+			Handler:           d.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		serverErr := make(chan error, 1)
+		go func() {
+			serverErr <- server.ListenAndServe()
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+		// fail right away if the address can't be listened on
+		select {
+		case err = <-serverErr:
+			return fmt.Errorf("health endpoint failed: %w", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		zap.L().Info("health endpoint listening", zap.String("address", d.options.HealthAddress))
+	}
+
+	watch := time.NewTicker(d.options.WatchInterval)
+	defer watch.Stop()
+	for {
+		next := d.runDue(time.Now())
+		zap.L().Info("next playbook check scheduled", zap.Time("at", next))
+
+		timer := time.NewTimer(time.Until(next))
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				zap.L().Info("playbook daemon stopped")
+				return nil
+			case <-timer.C:
+				break wait
+			case <-watch.C:
+				changed, err = d.reload()
+				if err != nil {
+					zap.L().Error("failed to reload playbook file, keeping the previous one",
+						zap.String("file", d.options.File), zap.Error(err))
+				}
+				if changed {
+					timer.Stop()
+					break wait
+				}
+			}
+		}
+	}
+}
+
+// reload loads the playbook file if its content, or the one of the inputs it was read from, changed since the last
+// load. All the tasks of a reloaded playbook are due immediately.
+func (d *Daemon) reload() (bool, error) {
+	d.mu.Lock()
+	inputs := d.inputs
+	d.mu.Unlock()
+	if len(inputs.Files) == 0 {
+		inputs = parser.Inputs{Files: []string{d.options.File}}
+	}
+	hash, err := inputs.Hash()
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	unchanged := hash == d.inputsHash
+	d.inputsHash = hash
+	d.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	zap.L().Info("loading playbook file", zap.String("file", d.options.File))
+	playbook, loaded, err := d.options.Load(d.options.File)
+	if err == nil {
+		// the inputs of the new playbook are hashed again, as they may include new files
+		hash, err = loaded.Hash()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.loadErr = err
+	if err != nil {
+		return false, err
+	}
+	d.playbook = playbook
+	d.inputs = loaded
+	d.inputsHash = hash
+	// tasks may have been removed or moved, the expiration of their certificates is recorded again when they run
+	metrics.CertificateExpiry.Reset()
+	names := make([]string, 0, len(playbook.CertificateTasks)+len(playbook.SshCertificateTasks))
+	for _, task := range playbook.CertificateTasks {
+		names = append(names, task.Name)
+	}
+	for _, task := range playbook.SshCertificateTasks {
+		names = append(names, task.Name)
+	}
+	tasks := make(map[string]*DaemonTaskState, len(names))
+	for _, name := range names {
+		state := &DaemonTaskState{}
+		if previous, ok := d.tasks[name]; ok {
+			*state = *previous
+			state.NextCheck = time.Time{}
+		}
+		tasks[name] = state
+	}
+	d.tasks = tasks
+	return true, nil
+}
+
+// runDue runs the tasks due at now and returns when the next task is due
+func (d *Daemon) runDue(now time.Time) time.Time {
+	d.mu.Lock()
+	playbook := d.playbook
+	due := make(domain.CertificateTasks, 0)
+	// renewBefore is the renew window of each due task, in the order of the results of Run
+	renewBefore := make([]string, 0)
+	for _, task := range d.playbook.CertificateTasks {
+		if !d.tasks[task.Name].NextCheck.After(now) {
+			due = append(due, task)
+			renewBefore = append(renewBefore, task.RenewBefore)
+		}
+	}
+	dueSsh := make(domain.SshCertificateTasks, 0)
+	for _, task := range d.playbook.SshCertificateTasks {
+		if !d.tasks[task.Name].NextCheck.After(now) {
+			dueSsh = append(dueSsh, task)
+			renewBefore = append(renewBefore, task.RenewBefore)
+		}
+	}
+	d.mu.Unlock()
+
+	if len(renewBefore) > 0 {
+		zap.L().Info("running due playbook tasks", zap.Int("tasks", len(renewBefore)))
+		d.refreshTokens(&playbook)
+		playbook.CertificateTasks = due
+		playbook.SshCertificateTasks = dueSsh
+		results := Run(playbook)
+
+		finished := time.Now()
+		d.mu.Lock()
+		d.lastRun = finished
+		d.runs++
+		for i, result := range results {
+			state, ok := d.tasks[result.Name]
+			if !ok {
+				// the playbook was reloaded while running
+				continue
+			}
+			state.LastRun = finished
+			state.Status = result.Status
+			state.Errors = state.Errors[:0]
+			for _, err := range result.Errors {
+				state.Errors = append(state.Errors, err.Error())
+			}
+			if result.After != nil {
+				state.Certificate = result.After
+			} else if result.Before != nil {
+				state.Certificate = result.Before
+			}
+			state.NextCheck = d.nextCheck(renewBefore[i], result, finished)
+		}
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	next := time.Now().Add(d.options.MaxCheckInterval)
+	for _, state := range d.tasks {
+		if state.NextCheck.Before(next) {
+			next = state.NextCheck
+		}
+	}
+	return next
+}
+
+// refreshTokens refreshes the TPP access token of playbook when it is expired. The new tokens are written to the
+// playbook file, which is not reloaded because of it, or to the Vault secret of the credentials.
+func (d *Daemon) refreshTokens(playbook *domain.Playbook) {
+	if playbook.Config.Connection.Platform != venafi.TPP {
+		return
+	}
+
+	err := ValidateTPPCredentials(playbook)
+	if err != nil {
+		zap.L().Error("invalid tpp credentials", zap.Error(err))
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	hash, err := d.inputs.Hash()
+	if err != nil {
+		return
+	}
+	d.playbook.Config.Connection.Credentials = playbook.Config.Connection.Credentials
+	d.inputsHash = hash
+}
+
+// nextCheck returns when the task of result, whose renew window is renewBefore, must be checked again after finishing
+// at now: when the first of its certificates enters its renew window, capped at MaxCheckInterval. Failed tasks are
+// retried after RetryInterval.
+func (d *Daemon) nextCheck(renewBefore string, result TaskResult, now time.Time) time.Time {
+	if result.Status.Failed() {
+		return now.Add(d.options.RetryInterval)
+	}
+
+	if renewBefore == "" {
+		renewBefore = DefaultRenew
+	}
+
+	certs := []*CertificateInfo{result.After}
+	if result.After == nil {
+		certs = certs[:0]
+		for _, installation := range result.Installations {
+			certs = append(certs, installation.Before)
+		}
+	}
+
+	next := now.Add(d.options.MaxCheckInterval)
+	for _, cert := range certs {
+		if cert == nil || cert.NotAfter.IsZero() {
+			continue
+		}
+		renewAt, err := util.RenewalTime(cert.NotBefore, cert.NotAfter, renewBefore)
+		if err != nil {
+			if !errors.Is(err, util.ErrRenewalDisabled) {
+				zap.L().Warn("could not work out renewal time", zap.String("task", result.Name), zap.Error(err))
+			}
+			continue
+		}
+		if renewAt.Before(next) {
+			next = renewAt
+		}
+	}
+
+	if earliest := now.Add(minCheckInterval); next.Before(earliest) {
+		return earliest
+	}
+	return next
+}
+
+// DaemonStatus is the state of the Daemon reported by its health endpoint
+type DaemonStatus struct {
+	Healthy   bool                        `json:"healthy"`
+	Playbook  string                      `json:"playbook"`
+	Started   time.Time                   `json:"started"`
+	LastRun   time.Time                   `json:"lastRun,omitempty"`
+	Runs      int                         `json:"runs"`
+	LoadError string                      `json:"loadError,omitempty"`
+	Tasks     map[string]*DaemonTaskState `json:"tasks"`
+}
+
+// Status returns the current state of the daemon. It is healthy when the playbook file was loaded and no task failed
+// in its last run.
+func (d *Daemon) Status() DaemonStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := DaemonStatus{
+		Healthy:  d.loadErr == nil,
+		Playbook: d.options.File,
+		Started:  d.started,
+		LastRun:  d.lastRun,
+		Runs:     d.runs,
+		Tasks:    make(map[string]*DaemonTaskState, len(d.tasks)),
+	}
+	if d.loadErr != nil {
+		status.LoadError = d.loadErr.Error()
+	}
+	for name, state := range d.tasks {
+		s := *state
+		s.Errors = append([]string(nil), state.Errors...)
+		status.Tasks[name] = &s
+		if state.Status.Failed() {
+			status.Healthy = false
+		}
+	}
+	return status
+}
+
+// Handler returns the HTTP handler of the health endpoint:
+//
+//   - /healthz answers 200 while the daemon is running, for liveness probes.
+//   - /status answers the DaemonStatus as JSON, with 503 when the daemon is not healthy.
+//   - /metrics answers the metrics of vcert in the Prometheus text format.
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		status := d.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(status)
+	})
+	mux.Handle("/metrics", metrics.Default.Handler())
+	return mux
+}
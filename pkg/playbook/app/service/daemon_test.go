@@ -0,0 +1,221 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/parser"
+)
+
+// testDaemon returns a Daemon whose playbook file only triggers reloads: the playbook itself is built by load
+func testDaemon(t *testing.T, load func(file string) (domain.Playbook, parser.Inputs, error)) (*Daemon, string) {
+	file := filepath.Join(t.TempDir(), "playbook.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("v1"), 0600))
+	d := NewDaemon(DaemonOptions{
+		File:             file,
+		MaxCheckInterval: 10000 * time.Hour,
+		WatchInterval:    10 * time.Millisecond,
+		Load:             load,
+	})
+	return d, file
+}
+
+func TestDaemon_NextCheck(t *testing.T) {
+	d := NewDaemon(DaemonOptions{MaxCheckInterval: 24 * time.Hour, RetryInterval: time.Hour})
+	now := time.Now()
+	renewBefore := "10d"
+
+	failed := TaskResult{Status: TaskEnrollFailed}
+	assert.Equal(t, now.Add(time.Hour), d.nextCheck(renewBefore, failed, now))
+
+	// the renewal time is further than the maximum interval
+	cert := &CertificateInfo{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(90 * 24 * time.Hour)}
+	renewed := TaskResult{Status: TaskRenewed, After: cert}
+	assert.Equal(t, now.Add(24*time.Hour), d.nextCheck(renewBefore, renewed, now))
+
+	// the earliest renewal time of the installed certificates
+	soon := &CertificateInfo{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(10*24*time.Hour + 2*time.Hour)}
+	unchanged := TaskResult{Status: TaskUnchanged, Installations: []InstallationResult{{Before: cert}, {Before: soon}}}
+	assert.Equal(t, now.Add(2*time.Hour), d.nextCheck(renewBefore, unchanged, now))
+
+	// renewal time already passed, but the certificate was not renewed
+	expiring := &CertificateInfo{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}
+	renewBefore = "disabled"
+	unchanged = TaskResult{Status: TaskUnchanged, Installations: []InstallationResult{{Before: expiring}}}
+	assert.Equal(t, now.Add(24*time.Hour), d.nextCheck(renewBefore, unchanged, now))
+	renewBefore = "10d"
+	assert.Equal(t, now.Add(minCheckInterval), d.nextCheck(renewBefore, unchanged, now))
+}
+
+func TestDaemon_RunDue(t *testing.T) {
+	task := pemTask("daemon", t.TempDir())
+	var loadErr error
+	d, file := testDaemon(t, func(file string) (domain.Playbook, parser.Inputs, error) {
+		return domain.Playbook{CertificateTasks: domain.CertificateTasks{task}}, parser.Inputs{Files: []string{file}},
+			loadErr
+	})
+
+	changed, err := d.reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	next := d.runDue(time.Now())
+	status := d.Status()
+	assert.True(t, status.Healthy)
+	assert.Equal(t, 1, status.Runs)
+	state := status.Tasks["daemon"]
+	require.NotNil(t, state)
+	assert.Equal(t, TaskRenewed, state.Status)
+	require.NotNil(t, state.Certificate)
+	assert.Equal(t, state.Certificate.NotAfter.Add(-30*24*time.Hour), next)
+
+	// nothing is due
+	d.runDue(time.Now())
+	assert.Equal(t, 1, d.Status().Runs)
+
+	// the same file is not reloaded
+	changed, err = d.reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// all the tasks of a changed playbook are due, and they keep their state
+	require.NoError(t, os.WriteFile(file, []byte("v2"), 0600))
+	changed, err = d.reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	d.runDue(time.Now())
+	status = d.Status()
+	assert.Equal(t, 2, status.Runs)
+	assert.Equal(t, TaskUnchanged, status.Tasks["daemon"].Status)
+
+	// an invalid playbook is reported, the previous one is kept
+	loadErr = errors.New("invalid playbook")
+	require.NoError(t, os.WriteFile(file, []byte("v3"), 0600))
+	changed, err = d.reload()
+	assert.Error(t, err)
+	assert.False(t, changed)
+	status = d.Status()
+	assert.False(t, status.Healthy)
+	assert.Equal(t, "invalid playbook", status.LoadError)
+	assert.Contains(t, status.Tasks, "daemon")
+}
+
+func TestDaemon_ReloadInputs(t *testing.T) {
+	task := pemTask("daemon", t.TempDir())
+	dir := t.TempDir()
+	include := filepath.Join(dir, "tasks.yaml")
+	require.NoError(t, os.WriteFile(include, []byte("v1"), 0600))
+	d, _ := testDaemon(t, func(file string) (domain.Playbook, parser.Inputs, error) {
+		inputs := parser.Inputs{Files: []string{file, include}, Patterns: []string{filepath.Join(dir, "*.csv")}}
+		return domain.Playbook{CertificateTasks: domain.CertificateTasks{task}}, inputs, nil
+	})
+
+	changed, err := d.reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = d.reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// a file read by the playbook changed
+	require.NoError(t, os.WriteFile(include, []byte("v2"), 0600))
+	changed, err = d.reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	// a new file matches a glob of the playbook
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hosts.csv"), []byte("host\nmail\n"), 0600))
+	changed, err = d.reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = d.reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestDaemon_Handler(t *testing.T) {
+	task := pemTask("daemon", filepath.Join(t.TempDir(), "file"))
+	require.NoError(t, os.WriteFile(filepath.Dir(task.Installations[0].File), []byte("not a directory"), 0600))
+	d, _ := testDaemon(t, func(file string) (domain.Playbook, parser.Inputs, error) {
+		return domain.Playbook{CertificateTasks: domain.CertificateTasks{task}}, parser.Inputs{Files: []string{file}}, nil
+	})
+	_, err := d.reload()
+	require.NoError(t, err)
+	d.runDue(time.Now())
+
+	server := httptest.NewServer(d.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/healthz")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/status")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	var status DaemonStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	assert.False(t, status.Healthy)
+	require.Contains(t, status.Tasks, "daemon")
+	assert.Equal(t, TaskFailed, status.Tasks["daemon"].Status)
+	assert.NotEmpty(t, status.Tasks["daemon"].Errors)
+}
+
+func TestDaemon_Run(t *testing.T) {
+	task := pemTask("daemon", t.TempDir())
+	d, _ := testDaemon(t, func(file string) (domain.Playbook, parser.Inputs, error) {
+		return domain.Playbook{CertificateTasks: domain.CertificateTasks{task}}, parser.Inputs{Files: []string{file}}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(ctx)
+	}()
+	require.Eventually(t, func() bool { return d.Status().Runs == 1 }, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon did not stop")
+	}
+
+	// the playbook file must be readable at start
+	err := NewDaemon(DaemonOptions{File: filepath.Join(t.TempDir(), "missing.yaml")}).Run(context.Background())
+	assert.Error(t, err)
+}
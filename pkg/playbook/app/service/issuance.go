@@ -0,0 +1,117 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/util"
+)
+
+// issuanceStateSuffix is appended to the location of a playbook to name the file remembering the zone of the
+// certificates its tasks installed
+const issuanceStateSuffix = ".state.json"
+
+// issuance is the zone the certificate installed by a task, identified by its serial, was issued from
+type issuance struct {
+	Zone   string `json:"zone"`
+	Serial string `json:"serial"`
+}
+
+// issuanceState remembers the zone the certificates of the tasks of a playbook were issued from, so that moving a task
+// to another zone re-issues its certificate. A nil *issuanceState doesn't remember anything.
+type issuanceState struct {
+	mu   sync.Mutex
+	path string
+}
+
+// newIssuanceState returns the state of the playbook at location, or nil if the playbook has no location
+func newIssuanceState(location string) *issuanceState {
+	if location == "" {
+		return nil
+	}
+	return &issuanceState{path: location + issuanceStateSuffix}
+}
+
+// zoneDrift returns why cert, installed by task, must be re-issued because the zone of the task changed since it was
+// issued. It is empty when the zone didn't change, or cert was not issued by a run of the playbook
+func (s *issuanceState) zoneDrift(task domain.CertificateTask, cert *x509.Certificate) string {
+	if s == nil || cert == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issuances, err := s.read()
+	if err != nil {
+		zap.L().Warn("failed to read issuance state", zap.String("location", s.path), zap.Error(err))
+		return ""
+	}
+	issued, found := issuances[task.Name]
+	if !found || issued.Serial != cert.SerialNumber.String() || issued.Zone == task.Request.Zone {
+		return ""
+	}
+	return fmt.Sprintf("zone changed from %q to %q", issued.Zone, task.Request.Zone)
+}
+
+// record remembers that cert, installed by task, was issued from the zone of its request
+func (s *issuanceState) record(task domain.CertificateTask, cert *x509.Certificate) {
+	if s == nil || cert == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issuances, err := s.read()
+	if err == nil {
+		issuances[task.Name] = issuance{Zone: task.Request.Zone, Serial: cert.SerialNumber.String()}
+		var data []byte
+		data, err = json.MarshalIndent(issuances, "", "  ")
+		if err == nil {
+			err = util.WriteFileWithOptions(s.path, data, util.FileOptions{Mode: 0600})
+		}
+	}
+	if err != nil {
+		zap.L().Warn("failed to record issuance state", zap.String("location", s.path), zap.Error(err))
+	}
+}
+
+// read returns the issuances of the state file by task name
+func (s *issuanceState) read() (map[string]issuance, error) {
+	issuances := make(map[string]issuance)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return issuances, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &issuances)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuance state %s: %w", s.path, err)
+	}
+	return issuances, nil
+}
@@ -0,0 +1,307 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/installer"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vcertutil"
+	"github.com/Venafi/vcert/v5/pkg/util"
+	"github.com/Venafi/vcert/v5/pkg/verror"
+)
+
+// PlanAction is what running a CertificateTask would do
+type PlanAction string
+
+const (
+	// PlanEnroll means no certificate is installed and a new one would be requested
+	PlanEnroll PlanAction = "enroll"
+	// PlanRenew means the installed certificate would be renewed
+	PlanRenew PlanAction = "renew"
+	// PlanSkip means the installed certificate is in good health and nothing would be done
+	PlanSkip PlanAction = "skip"
+	// PlanPolicyViolation means the request is not allowed by the policy of its zone, requesting it would fail
+	PlanPolicyViolation PlanAction = "policyViolation"
+	// PlanError means the task could not be planned: the installed certificates or the zone could not be read
+	PlanError PlanAction = "error"
+)
+
+// InstallationPlan describes the state of an installation of a CertificateTask
+type InstallationPlan struct {
+	Type     string
+	Location string
+	// Current is the certificate installed in the location, if any
+	Current *CertificateInfo
+	// RenewAt is when the current certificate enters its renew window. It is zero when there is no certificate or
+	// automatic renewal is disabled
+	RenewAt time.Time
+	// NeedsAction is true when the installation would get a new certificate
+	NeedsAction bool
+	Reason      string
+	Error       error
+}
+
+// TaskPlan is what running a CertificateTask would do, and why
+type TaskPlan struct {
+	Name          string
+	Action        PlanAction
+	Reason        string
+	Installations []InstallationPlan
+	Errors        []error
+}
+
+// Plan works out what running the certificate tasks of playbook would do, without requesting certificates or writing
+// to the installation locations. It returns the plan of each task, in the order of the tasks.
+//
+// For every task, the installers check the installed certificates, and the request is validated against the policy
+// of its zone, which requires authenticating to the Venafi platform. The SSH certificate tasks, planned after the
+// certificate tasks, only check their installed certificate.
+func Plan(playbook domain.Playbook) []TaskPlan {
+	tasks := playbook.CertificateTasks
+	sshTasks := playbook.SshCertificateTasks
+	plans := make([]TaskPlan, len(tasks)+len(sshTasks))
+
+	connectors := vcertutil.NewConnectorCache()
+	issued := newIssuanceState(playbook.Location)
+	runConcurrently(playbook.Config.Concurrency, len(plans), func(i int) {
+		if i < len(tasks) {
+			plans[i] = planTask(playbook.Config, tasks[i], connectors, issued)
+			return
+		}
+		plans[i] = planSshTask(playbook.Config, sshTasks[i-len(tasks)])
+	})
+
+	return plans
+}
+
+func planTask(config domain.Config, task domain.CertificateTask, connectors *vcertutil.ConnectorCache, issued *issuanceState) TaskPlan {
+	zap.L().Info("planning playbook task", zap.String("task", task.Name))
+	plan := TaskPlan{
+		Name:          task.Name,
+		Action:        PlanSkip,
+		Reason:        "certificate in good health",
+		Installations: make([]InstallationPlan, len(task.Installations)),
+	}
+
+	renewBefore := DefaultRenew
+	if task.RenewBefore != "" {
+		renewBefore = task.RenewBefore
+	}
+
+	changed := config.ForceRenew
+	installed := false
+	reason := ""
+	for i, installation := range task.Installations {
+		ip := planInstallation(installation, renewBefore, task, issued)
+		plan.Installations[i] = ip
+		if ip.Error != nil {
+			plan.Errors = append(plan.Errors, ip.Error)
+			continue
+		}
+		if ip.Current != nil {
+			installed = true
+		}
+		if ip.NeedsAction {
+			changed = true
+			if reason == "" {
+				reason = ip.Reason
+			}
+		}
+	}
+	if config.ForceRenew {
+		reason = reasonForceRenew
+	}
+
+	err := vcertutil.ValidateRequest(context.Background(), connectors, config, task.Request)
+	switch {
+	case errors.Is(err, verror.PolicyValidationError):
+		plan.Action = PlanPolicyViolation
+		plan.Reason = err.Error()
+		return plan
+	case err != nil:
+		plan.Errors = append(plan.Errors, fmt.Errorf("error validating request of task %s: %w", task.Name, err))
+	}
+
+	switch {
+	case len(plan.Errors) > 0:
+		plan.Action = PlanError
+		plan.Reason = plan.Errors[0].Error()
+	case !changed:
+	case installed:
+		plan.Action = PlanRenew
+		plan.Reason = reason
+	default:
+		plan.Action = PlanEnroll
+		plan.Reason = reason
+	}
+	return plan
+}
+
+// planSshTask works out what running the SSH certificate task would do. SSH certificate requests have no policy to be
+// validated against
+func planSshTask(config domain.Config, task domain.SshCertificateTask) TaskPlan {
+	zap.L().Info("planning playbook SSH task", zap.String("task", task.Name))
+	plan := TaskPlan{
+		Name:   task.Name,
+		Action: PlanSkip,
+		Reason: "certificate in good health",
+	}
+	ip := InstallationPlan{
+		Type:     sshInstallationType,
+		Location: task.CertificateFile(),
+	}
+
+	_, publicKey, err := readSshPublicKey(task)
+	if err != nil {
+		ip.Error = fmt.Errorf("error checking SSH certificate at location %s: %w", ip.Location, err)
+		plan.Installations = []InstallationPlan{ip}
+		plan.Errors = []error{ip.Error}
+		plan.Action = PlanError
+		plan.Reason = ip.Error.Error()
+		return plan
+	}
+	cert := installedSshCertificate(ip.Location)
+	ip.Current = newSshCertificateInfo(cert)
+	ip.RenewAt, ip.Reason = sshRenewalReason(config, task, cert, publicKey)
+	ip.NeedsAction = ip.Reason != ""
+	plan.Installations = []InstallationPlan{ip}
+
+	switch {
+	case !ip.NeedsAction:
+	case cert != nil:
+		plan.Action = PlanRenew
+		plan.Reason = ip.Reason
+	default:
+		plan.Action = PlanEnroll
+		plan.Reason = ip.Reason
+	}
+	return plan
+}
+
+func planInstallation(installation domain.Installation, renewBefore string, task domain.CertificateTask, issued *issuanceState) InstallationPlan {
+	ip := InstallationPlan{
+		Type:     installation.Type.String(),
+		Location: getInstallationLocationString(installation),
+	}
+
+	check := checkInstallation(installation, renewBefore, task.Request, false, nil)
+	if check.err != nil {
+		ip.Error = fmt.Errorf("error checking certificate at location %s: %w", ip.Location, check.err)
+		return ip
+	}
+	ip.Current = newCertificateInfo(check.cert)
+	ip.NeedsAction = check.changed
+	ip.RenewAt, ip.Reason = renewalReason(check.cert, renewBefore, task.Request, ip.NeedsAction)
+	if !ip.NeedsAction {
+		ip.Reason = issued.zoneDrift(task, check.cert)
+		ip.NeedsAction = ip.Reason != ""
+	}
+	return ip
+}
+
+// reasonForceRenew is the reason of the tasks run with --force-renew
+const reasonForceRenew = "force renew is set"
+
+// renewalReason returns when cert enters its renew window and, if it needs action, why
+func renewalReason(cert *x509.Certificate, renewBefore string, request domain.PlaybookRequest, needsAction bool) (time.Time, string) {
+	if cert == nil {
+		return time.Time{}, "no certificate installed"
+	}
+
+	renewAt, err := util.RenewalTime(cert.NotBefore, cert.NotAfter, renewBefore)
+	if err != nil {
+		renewAt = time.Time{}
+	}
+
+	now := time.Now()
+	switch {
+	case !needsAction:
+		return renewAt, ""
+	case cert.NotAfter.Before(now):
+		return renewAt, fmt.Sprintf("certificate expired on %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	case !renewAt.IsZero() && now.After(renewAt):
+		return renewAt, fmt.Sprintf("certificate in renew window since %s (renewBefore: %s)",
+			renewAt.UTC().Format(time.RFC3339), renewBefore)
+	}
+	drift := installer.Drift(cert, request)
+	if len(drift) == 0 {
+		// the installer found the certificate needs to be installed again for a reason of its own
+		return renewAt, "installer check requires a new certificate"
+	}
+	return renewAt, "installed certificate doesn't match the request: " + strings.Join(drift, "; ")
+}
+
+// WritePlan writes a human-readable description of plans to w
+func WritePlan(w io.Writer, plans []TaskPlan) error {
+	for _, plan := range plans {
+		_, err := fmt.Fprintf(w, "task %s: %s", plan.Name, plan.Action)
+		if err != nil {
+			return err
+		}
+		if plan.Reason != "" {
+			_, err = fmt.Fprintf(w, " (%s)", plan.Reason)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintln(w)
+		if err != nil {
+			return err
+		}
+
+		for _, ip := range plan.Installations {
+			line := fmt.Sprintf("  %s %s:", ip.Type, ip.Location)
+			switch {
+			case ip.Error != nil:
+				line += fmt.Sprintf(" error: %s", ip.Error)
+			case ip.Current == nil:
+				line += " no certificate"
+			default:
+				line += fmt.Sprintf(" serial=%s notAfter=%s", ip.Current.Serial,
+					ip.Current.NotAfter.UTC().Format(time.RFC3339))
+				if !ip.RenewAt.IsZero() {
+					line += fmt.Sprintf(" renewAt=%s", ip.RenewAt.UTC().Format(time.RFC3339))
+				}
+			}
+			_, err = fmt.Fprintln(w, line)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PlanFailed returns true if any of plans could not be planned or violates the policy of its zone
+func PlanFailed(plans []TaskPlan) bool {
+	for _, plan := range plans {
+		if plan.Action == PlanError || plan.Action == PlanPolicyViolation {
+			return true
+		}
+	}
+	return false
+}
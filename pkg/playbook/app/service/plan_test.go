@@ -0,0 +1,117 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/util"
+)
+
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+	installed := pemTask("installed", filepath.Join(dir, "installed"))
+	missing := pemTask("missing", filepath.Join(dir, "missing"))
+	violation := pemTask("violation", filepath.Join(dir, "violation"))
+	violation.Request.KeyLength = 1234
+
+	results := Run(domain.Playbook{CertificateTasks: domain.CertificateTasks{installed}})
+	require.Empty(t, results[0].Errors)
+
+	playbook := domain.Playbook{
+		Config:           domain.Config{Concurrency: 2},
+		CertificateTasks: domain.CertificateTasks{installed, missing, violation},
+	}
+	plans := Plan(playbook)
+	require.Len(t, plans, 3)
+
+	assert.Equal(t, PlanSkip, plans[0].Action)
+	require.Len(t, plans[0].Installations, 1)
+	require.NotNil(t, plans[0].Installations[0].Current)
+	assert.Equal(t, results[0].After.Serial, plans[0].Installations[0].Current.Serial)
+	assert.False(t, plans[0].Installations[0].RenewAt.IsZero())
+
+	assert.Equal(t, PlanEnroll, plans[1].Action)
+	assert.Equal(t, "no certificate installed", plans[1].Reason)
+
+	assert.Equal(t, PlanPolicyViolation, plans[2].Action)
+	assert.True(t, PlanFailed(plans))
+
+	// nothing was requested or installed
+	exists, err := util.FileExists(missing.Installations[0].File)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// a renew window covering the whole validity of the certificate
+	installed.RenewBefore = "100%"
+	playbook.CertificateTasks = domain.CertificateTasks{installed}
+	plans = Plan(playbook)
+	assert.Equal(t, PlanRenew, plans[0].Action)
+	assert.Contains(t, plans[0].Reason, "renew window")
+	assert.False(t, PlanFailed(plans))
+
+	playbook.Config.ForceRenew = true
+	installed.RenewBefore = "30d"
+	plans = Plan(playbook)
+	assert.Equal(t, PlanRenew, plans[0].Action)
+	assert.Equal(t, "force renew is set", plans[0].Reason)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, WritePlan(&buf, plans))
+	assert.Contains(t, buf.String(), "task installed: renew (force renew is set)")
+	assert.Contains(t, buf.String(), "serial="+results[0].After.Serial)
+}
+
+func TestRenewalReason(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	now := time.Now()
+	cert := &x509.Certificate{
+		Subject:            pkix.Name{CommonName: "www.vcert.test"},
+		DNSNames:           []string{"www.vcert.test"},
+		NotBefore:          now.Add(-time.Hour),
+		NotAfter:           now.Add(90 * 24 * time.Hour),
+		PublicKeyAlgorithm: x509.RSA,
+		PublicKey:          &key.PublicKey,
+	}
+	request := domain.PlaybookRequest{Subject: domain.Subject{CommonName: "www.vcert.test"}}
+
+	_, reason := renewalReason(cert, "30d", request, false)
+	assert.Empty(t, reason)
+
+	// the certificate is neither expiring nor drifting, the result of the check is reported as is
+	_, reason = renewalReason(cert, "30d", request, true)
+	assert.Equal(t, "installer check requires a new certificate", reason)
+
+	request.Subject.CommonName = "api.vcert.test"
+	_, reason = renewalReason(cert, "30d", request, true)
+	assert.Contains(t, reason, "doesn't match the request")
+
+	_, reason = renewalReason(cert, "100d", request, true)
+	assert.Contains(t, reason, "certificate in renew window since")
+}
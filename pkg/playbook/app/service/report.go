@@ -0,0 +1,356 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	// nolint:gosec // TODO: figure out a way to obtain cert thumbprint to remove the use of weak cryptographic primitive (G401)
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// TaskStatus is the outcome of running a CertificateTask
+type TaskStatus string
+
+const (
+	// TaskUnchanged means the certificate was in good health and nothing was done
+	TaskUnchanged TaskStatus = "unchanged"
+	// TaskRenewed means a certificate was requested and installed in all the locations of the task
+	TaskRenewed TaskStatus = "renewed"
+	// TaskFailed means the installed certificates could not be checked
+	TaskFailed TaskStatus = "failed"
+	// TaskEnrollFailed means the certificate could not be requested or retrieved from the Venafi platform
+	TaskEnrollFailed TaskStatus = "enrollFailed"
+	// TaskInstallFailed means the certificate was issued but at least one installation failed
+	TaskInstallFailed TaskStatus = "installFailed"
+	// TaskRolledBack means the certificate was issued but an installation failed, and the installations of the
+	// transactional task were restored to their previous certificate
+	TaskRolledBack TaskStatus = "rolledBack"
+)
+
+// Failed returns true if the task ended with an error
+func (s TaskStatus) Failed() bool {
+	return s == TaskFailed || s == TaskEnrollFailed || s == TaskInstallFailed || s == TaskRolledBack
+}
+
+// InstallationStatus is the outcome of an installation of a CertificateTask
+type InstallationStatus string
+
+const (
+	// InstallationSkipped means the installation was not attempted, because no certificate was issued
+	InstallationSkipped InstallationStatus = "skipped"
+	// InstallationInstalled means the certificate was installed. After-install actions and validations may have failed
+	InstallationInstalled InstallationStatus = "installed"
+	// InstallationFailed means the installation, or one of its actions, failed
+	InstallationFailed InstallationStatus = "failed"
+	// InstallationRolledBack means the certificate was installed, then restored to the previous one because another
+	// installation of the transactional task failed
+	InstallationRolledBack InstallationStatus = "rolledBack"
+)
+
+// CertificateInfo identifies a certificate in a report
+type CertificateInfo struct {
+	CommonName string    `json:"commonName"`
+	Serial     string    `json:"serial"`
+	Thumbprint string    `json:"thumbprint"`
+	NotBefore  time.Time `json:"notBefore"`
+	NotAfter   time.Time `json:"notAfter"`
+}
+
+func newCertificateInfo(cert *x509.Certificate) *CertificateInfo {
+	if cert == nil {
+		return nil
+	}
+	// nolint:gosec // TODO: figure out a way to obtain cert thumbprint to remove the use of weak cryptographic primitive (G401)
+	thumbprint := sha1.Sum(cert.Raw)
+	return &CertificateInfo{
+		CommonName: cert.Subject.CommonName,
+		Serial:     cert.SerialNumber.String(),
+		Thumbprint: hex.EncodeToString(thumbprint[:]),
+		NotBefore:  cert.NotBefore,
+		NotAfter:   cert.NotAfter,
+	}
+}
+
+// ActionResult is the result of an after-install or install validation action
+type ActionResult struct {
+	Command string `json:"command"`
+	Output  string `json:"output,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// newActionResult builds the result of an action. Actions report a failure by printing "1"
+func newActionResult(command string, output string, err error) *ActionResult {
+	output = strings.TrimSpace(output)
+	r := &ActionResult{
+		Command: command,
+		Output:  output,
+		Success: err == nil && output != "1",
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// InstallationResult is the result of an installation of a CertificateTask
+type InstallationResult struct {
+	Type     string             `json:"type"`
+	Location string             `json:"location"`
+	Status   InstallationStatus `json:"status"`
+	// Reason is why the certificate of the installation needed action, if it did
+	Reason      string           `json:"reason,omitempty"`
+	Before      *CertificateInfo `json:"before,omitempty"`
+	AfterAction *ActionResult    `json:"afterAction,omitempty"`
+	Validation  *ActionResult    `json:"validation,omitempty"`
+	Endpoint    *ActionResult    `json:"endpoint,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	// Hooks are the results of the after-install and validation hooks run, in order
+	Hooks []*ActionResult `json:"hooks,omitempty"`
+}
+
+// TaskResult is the result of running a CertificateTask
+type TaskResult struct {
+	Name     string
+	Status   TaskStatus
+	Errors   []error
+	Duration time.Duration
+	// Reason is why the certificate needed action, if it did: missing, expired, in its renew window or not matching
+	// the request
+	Reason string
+	// Before is the certificate installed before running the task, if any
+	Before *CertificateInfo
+	// After is the certificate issued by the task, if any
+	After         *CertificateInfo
+	Installations []InstallationResult
+}
+
+// MarshalJSON implements json.Marshaler
+func (r TaskResult) MarshalJSON() ([]byte, error) {
+	errs := make([]string, 0, len(r.Errors))
+	for _, err := range r.Errors {
+		errs = append(errs, err.Error())
+	}
+	return json.Marshal(struct {
+		Name            string               `json:"name"`
+		Status          TaskStatus           `json:"status"`
+		DurationSeconds float64              `json:"durationSeconds"`
+		Errors          []string             `json:"errors,omitempty"`
+		Reason          string               `json:"reason,omitempty"`
+		Before          *CertificateInfo     `json:"before,omitempty"`
+		After           *CertificateInfo     `json:"after,omitempty"`
+		Installations   []InstallationResult `json:"installations"`
+	}{
+		Name:            r.Name,
+		Status:          r.Status,
+		DurationSeconds: r.Duration.Seconds(),
+		Errors:          errs,
+		Reason:          r.Reason,
+		Before:          r.Before,
+		After:           r.After,
+		Installations:   r.Installations,
+	})
+}
+
+// ReportSummary counts the tasks of a playbook run by outcome
+type ReportSummary struct {
+	Tasks     int `json:"tasks"`
+	Unchanged int `json:"unchanged"`
+	Renewed   int `json:"renewed"`
+	Failed    int `json:"failed"`
+}
+
+// Report is the machine-readable result of a playbook run
+type Report struct {
+	Playbook        string        `json:"playbook"`
+	Started         time.Time     `json:"started"`
+	DurationSeconds float64       `json:"durationSeconds"`
+	Summary         ReportSummary `json:"summary"`
+	Tasks           []TaskResult  `json:"tasks"`
+}
+
+// NewReport builds the report of the run of the playbook file started at started
+func NewReport(playbook string, started time.Time, results []TaskResult) Report {
+	r := Report{
+		Playbook:        playbook,
+		Started:         started,
+		DurationSeconds: time.Since(started).Seconds(),
+		Summary:         ReportSummary{Tasks: len(results)},
+		Tasks:           results,
+	}
+	if r.Tasks == nil {
+		r.Tasks = []TaskResult{}
+	}
+	for _, result := range results {
+		switch {
+		case result.Status.Failed():
+			r.Summary.Failed++
+		case result.Status == TaskRenewed:
+			r.Summary.Renewed++
+		default:
+			r.Summary.Unchanged++
+		}
+	}
+	return r
+}
+
+// WriteJSON writes the report to w as JSON
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report to w as JUnit XML: every task is a test case, skipped when the certificate was in good
+// health and failed when the task failed
+func (r Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      r.Playbook,
+		Tests:     r.Summary.Tasks,
+		Failures:  r.Summary.Failed,
+		Skipped:   r.Summary.Unchanged,
+		Time:      junitTime(r.DurationSeconds),
+		Timestamp: r.Started.UTC().Format(time.RFC3339),
+		Cases:     make([]junitTestCase, 0, len(r.Tasks)),
+	}
+	for _, task := range r.Tasks {
+		tc := junitTestCase{
+			Name:      task.Name,
+			ClassName: "vcert.playbook",
+			Time:      junitTime(task.Duration.Seconds()),
+			SystemOut: taskDetails(task),
+		}
+		switch {
+		case task.Status.Failed():
+			errs := make([]string, 0, len(task.Errors))
+			for _, err := range task.Errors {
+				errs = append(errs, err.Error())
+			}
+			tc.Failure = &junitMessage{
+				Message: fmt.Sprintf("task %s: %s", task.Name, task.Status),
+				Type:    string(task.Status),
+				Text:    strings.Join(errs, "\n"),
+			}
+		case task.Status == TaskUnchanged:
+			tc.Skipped = &junitMessage{Message: "certificate in good health. No actions needed"}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	suites := junitTestSuites{
+		Name:     "vcert playbook",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(suites)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
+
+// taskDetails describes the certificates and installations of a task for the JUnit system-out
+func taskDetails(task TaskResult) string {
+	b := strings.Builder{}
+	describe := func(label string, c *CertificateInfo) {
+		if c != nil {
+			fmt.Fprintf(&b, "%s: serial=%s thumbprint=%s notAfter=%s\n", label, c.Serial, c.Thumbprint,
+				c.NotAfter.UTC().Format(time.RFC3339))
+		}
+	}
+	if task.Reason != "" {
+		fmt.Fprintf(&b, "reason: %s\n", task.Reason)
+	}
+	describe("before", task.Before)
+	describe("after", task.After)
+	for _, inst := range task.Installations {
+		fmt.Fprintf(&b, "installation %s %s: %s", inst.Type, inst.Location, inst.Status)
+		if inst.Error != "" {
+			fmt.Fprintf(&b, " (%s)", inst.Error)
+		}
+		b.WriteString("\n")
+		for _, action := range []struct {
+			label  string
+			result *ActionResult
+		}{{"afterAction", inst.AfterAction}, {"endpoint", inst.Endpoint}, {"validation", inst.Validation}} {
+			if action.result != nil {
+				fmt.Fprintf(&b, "  %s: success=%t output=%q\n", action.label, action.result.Success, action.result.Output)
+			}
+		}
+		for _, hook := range inst.Hooks {
+			fmt.Fprintf(&b, "  hook %s: success=%t output=%q\n", hook.Command, hook.Success, hook.Output)
+		}
+	}
+	return b.String()
+}
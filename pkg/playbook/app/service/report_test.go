@@ -0,0 +1,137 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+func testReport() Report {
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := []TaskResult{
+		{Name: "healthy", Status: TaskUnchanged, Duration: time.Second,
+			Before: &CertificateInfo{Serial: "1", Thumbprint: "aa", NotAfter: notAfter}},
+		{Name: "renewed", Status: TaskRenewed, Duration: 2 * time.Second, Reason: "missing DNS SANs: vcert.test",
+			Before: &CertificateInfo{Serial: "2", Thumbprint: "bb", NotAfter: notAfter},
+			After:  &CertificateInfo{Serial: "3", Thumbprint: "cc", NotAfter: notAfter},
+			Installations: []InstallationResult{{
+				Type: "PEM", Location: "/tmp/cert.pem", Status: InstallationInstalled,
+				Reason:      "missing DNS SANs: vcert.test",
+				AfterAction: &ActionResult{Command: "echo 0", Output: "0", Success: true},
+			}}},
+		{Name: "broken", Status: TaskEnrollFailed, Errors: []error{errors.New("zone not found")}},
+	}
+	return NewReport("playbook.yaml", time.Now(), results)
+}
+
+func TestNewReport(t *testing.T) {
+	r := testReport()
+	assert.Equal(t, ReportSummary{Tasks: 3, Unchanged: 1, Renewed: 1, Failed: 1}, r.Summary)
+	assert.True(t, TaskInstallFailed.Failed())
+	assert.False(t, TaskRenewed.Failed())
+
+	empty := NewReport("playbook.yaml", time.Now(), nil)
+	assert.NotNil(t, empty.Tasks)
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	buf := bytes.Buffer{}
+	require.NoError(t, testReport().WriteJSON(&buf))
+
+	var decoded struct {
+		Summary ReportSummary
+		Tasks   []struct {
+			Name          string
+			Status        string
+			Errors        []string
+			Reason        string
+			Before        *CertificateInfo
+			After         *CertificateInfo
+			Installations []InstallationResult
+		}
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, 3, decoded.Summary.Tasks)
+	require.Len(t, decoded.Tasks, 3)
+	assert.Equal(t, "renewed", decoded.Tasks[1].Status)
+	assert.Equal(t, "missing DNS SANs: vcert.test", decoded.Tasks[1].Reason)
+	assert.Equal(t, "missing DNS SANs: vcert.test", decoded.Tasks[1].Installations[0].Reason)
+	assert.Empty(t, decoded.Tasks[0].Reason)
+	assert.Equal(t, "2", decoded.Tasks[1].Before.Serial)
+	assert.Equal(t, "3", decoded.Tasks[1].After.Serial)
+	assert.True(t, decoded.Tasks[1].Installations[0].AfterAction.Success)
+	assert.Equal(t, []string{"zone not found"}, decoded.Tasks[2].Errors)
+	assert.Equal(t, "enrollFailed", decoded.Tasks[2].Status)
+}
+
+func TestReport_WriteJUnit(t *testing.T) {
+	buf := bytes.Buffer{}
+	require.NoError(t, testReport().WriteJUnit(&buf))
+
+	var decoded junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, 3, decoded.Tests)
+	assert.Equal(t, 1, decoded.Failures)
+	assert.Equal(t, 1, decoded.Skipped)
+	require.Len(t, decoded.Suites, 1)
+	cases := decoded.Suites[0].Cases
+	require.Len(t, cases, 3)
+	assert.NotNil(t, cases[0].Skipped)
+	assert.Nil(t, cases[1].Skipped)
+	assert.Nil(t, cases[1].Failure)
+	assert.Contains(t, cases[1].SystemOut, "after: serial=3")
+	assert.Contains(t, cases[1].SystemOut, "reason: missing DNS SANs: vcert.test")
+	require.NotNil(t, cases[2].Failure)
+	assert.Equal(t, "zone not found", cases[2].Failure.Text)
+}
+
+func TestRun_Report(t *testing.T) {
+	task := pemTask("report", t.TempDir())
+	task.Installations[0].AfterAction = "echo 0"
+	playbook := domain.Playbook{CertificateTasks: domain.CertificateTasks{task}}
+
+	results := Run(playbook)
+	require.Len(t, results, 1)
+	first := results[0]
+	assert.Equal(t, TaskRenewed, first.Status)
+	assert.Nil(t, first.Before)
+	require.NotNil(t, first.After)
+	require.Len(t, first.Installations, 1)
+	assert.Equal(t, InstallationInstalled, first.Installations[0].Status)
+	assert.Equal(t, filepath.Join(filepath.Dir(task.Installations[0].File), "cert.pem"), first.Installations[0].Location)
+	require.NotNil(t, first.Installations[0].AfterAction)
+	assert.True(t, first.Installations[0].AfterAction.Success)
+
+	// the certificate installed by the first run is reported as the current one
+	playbook.Config.ForceRenew = true
+	results = Run(playbook)
+	require.Len(t, results, 1)
+	require.NotNil(t, results[0].Before)
+	assert.Equal(t, first.After.Serial, results[0].Before.Serial)
+	assert.NotEqual(t, first.After.Serial, results[0].After.Serial)
+}
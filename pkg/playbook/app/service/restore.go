@@ -0,0 +1,151 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/installer"
+)
+
+// InstallationBackups are the generations of backups of an installation, the latest first
+type InstallationBackups struct {
+	Type        string
+	Location    string
+	Generations []installer.BackupGeneration
+}
+
+// Backups returns the generations of backups of the installations of task. The installations that don't keep
+// generations of backups (CAPI, KUBERNETES and VAULT) are left out
+func Backups(task domain.CertificateTask) ([]InstallationBackups, error) {
+	backups := make([]InstallationBackups, 0, len(task.Installations))
+	for _, installation := range task.Installations {
+		versioned, ok := installer.GetInstaller(installation).(installer.VersionedInstaller)
+		if !ok {
+			continue
+		}
+		generations, err := versioned.Generations()
+		if err != nil {
+			return nil, fmt.Errorf("error reading backups of location %s: %w",
+				getInstallationLocationString(installation), err)
+		}
+		backups = append(backups, InstallationBackups{
+			Type:        installation.Type.String(),
+			Location:    getInstallationLocationString(installation),
+			Generations: generations,
+		})
+	}
+	return backups, nil
+}
+
+// Restore installs generation of the backups of the installations of task again, 1 being the latest, and runs their
+// after-install actions and hooks. Nothing is restored unless every installation has the generation. The current
+// version of each location is backed up before being restored
+func Restore(task domain.CertificateTask, generation int) error {
+	backups, err := Backups(task)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("task %s has no installation keeping backups", task.Name)
+	}
+	for _, backup := range backups {
+		if generation < 1 || generation > len(backup.Generations) {
+			return fmt.Errorf("%w: %d, location %s has %d", installer.ErrNoBackupGeneration, generation,
+				backup.Location, len(backup.Generations))
+		}
+	}
+
+	var errs error
+	for _, installation := range task.Installations {
+		versioned, ok := installer.GetInstaller(installation).(installer.VersionedInstaller)
+		if !ok {
+			continue
+		}
+		location := getInstallationLocationString(installation)
+		zap.L().Info("restoring certificate", zap.String("location", location), zap.Int("generation", generation))
+		err = versioned.Restore(generation)
+		if err != nil {
+			zap.L().Error("error restoring certificate", zap.String("location", location), zap.Error(err))
+			errs = errors.Join(errs, fmt.Errorf("error restoring certificate at location %s: %w", location, err))
+			continue
+		}
+		zap.L().Info("successfully restored certificate", zap.String("location", location))
+
+		if installation.AfterAction != "" {
+			_, err = versioned.AfterInstallActions()
+			if err != nil {
+				zap.L().Error("error running after-install actions", zap.String("location", location), zap.Error(err))
+				errs = errors.Join(errs, fmt.Errorf("error running after-install actions at location %s: %w",
+					location, err))
+				continue
+			}
+			zap.L().Info("successfully executed after-install actions", zap.String("location", location))
+		}
+
+		if installation.Hooks == nil || len(installation.Hooks.AfterInstall) == 0 {
+			continue
+		}
+		event := installedHookEvent(task.Name, installation, versioned, location)
+		err = runHooks(context.Background(), installation.Hooks.AfterInstall, event, nil)
+		if err != nil {
+			zap.L().Error("error running after-install hooks", zap.String("location", location), zap.Error(err))
+			errs = errors.Join(errs, fmt.Errorf("error running after-install hooks at location %s: %w",
+				location, err))
+			continue
+		}
+		zap.L().Info("successfully executed after-install hooks", zap.String("location", location))
+	}
+	return errs
+}
+
+// WriteBackups writes a human-readable listing of backups to w
+func WriteBackups(w io.Writer, backups []InstallationBackups) error {
+	for _, backup := range backups {
+		_, err := fmt.Fprintf(w, "%s %s:\n", backup.Type, backup.Location)
+		if err != nil {
+			return err
+		}
+		if len(backup.Generations) == 0 {
+			_, err = fmt.Fprintln(w, "  no backups")
+			if err != nil {
+				return err
+			}
+		}
+		for i, generation := range backup.Generations {
+			line := fmt.Sprintf("  generation %d: taken=%s", i+1, generation.Time.UTC().Format(time.RFC3339))
+			if generation.Serial != "" {
+				line += fmt.Sprintf(" serial=%s", generation.Serial)
+			}
+			if generation.NotAfter != nil {
+				line += fmt.Sprintf(" notAfter=%s", generation.NotAfter.UTC().Format(time.RFC3339))
+			}
+			_, err = fmt.Fprintln(w, line)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
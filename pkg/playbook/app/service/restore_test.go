@@ -0,0 +1,73 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/installer"
+)
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	task := pemTask("restore", dir)
+	task.Installations[0].BackupFiles = true
+	task.Installations[0].AfterAction = "echo reload >> " + filepath.Join(dir, "reloads")
+	playbook := domain.Playbook{
+		Config:           domain.Config{ForceRenew: true},
+		CertificateTasks: domain.CertificateTasks{task},
+	}
+
+	installed := make([]string, 3)
+	for i := range installed {
+		results := Run(playbook)
+		require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+		installed[i] = readFile(t, filepath.Join(dir, "cert.pem"))
+	}
+
+	// the first run had nothing to back up, its generation is empty
+	backups, err := Backups(task)
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	require.Len(t, backups[0].Generations, 3)
+	assert.Empty(t, backups[0].Generations[2].Files)
+	var out bytes.Buffer
+	require.NoError(t, WriteBackups(&out, backups))
+	assert.Contains(t, out.String(), "PEM "+filepath.Join(dir, "cert.pem")+":\n  generation 1: taken=")
+	assert.Contains(t, out.String(), "generation 2:")
+	assert.Contains(t, out.String(), "generation 3: taken=")
+
+	// an empty generation has nothing to restore
+	err = Restore(task, 3)
+	assert.ErrorIs(t, err, installer.ErrEmptyBackupGeneration)
+	assert.Equal(t, installed[2], readFile(t, filepath.Join(dir, "cert.pem")))
+
+	require.NoError(t, Restore(task, 2))
+	assert.Equal(t, installed[0], readFile(t, filepath.Join(dir, "cert.pem")))
+	assert.Equal(t, "reload\nreload\nreload\nreload\n", readFile(t, filepath.Join(dir, "reloads")))
+
+	// nothing is restored when a generation is missing
+	err = Restore(task, 5)
+	assert.ErrorIs(t, err, installer.ErrNoBackupGeneration)
+	assert.Equal(t, installed[0], readFile(t, filepath.Join(dir, "cert.pem")))
+}
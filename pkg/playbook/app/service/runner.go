@@ -0,0 +1,229 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/metrics"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/installer"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vcertutil"
+	"github.com/Venafi/vcert/v5/pkg/tracing"
+)
+
+// Run executes the certificate tasks of playbook, then its SSH certificate tasks, and returns the result of each one,
+// in the order of the tasks.
+//
+// Up to playbook.Config.Concurrency tasks run at the same time (one at a time if not set). All the tasks share one
+// authenticated connector, and the installations targeting the same location are never run concurrently.
+func Run(playbook domain.Playbook) []TaskResult {
+	tasks := playbook.CertificateTasks
+	sshTasks := playbook.SshCertificateTasks
+	results := make([]TaskResult, len(tasks)+len(sshTasks))
+
+	ctx, span := tracing.Start(context.Background(), "playbook.run", tracing.Int("vcert.tasks", len(results)))
+	defer span.End()
+
+	connectors := vcertutil.NewConnectorCache()
+	locks := &locationLocks{}
+	issued := newIssuanceState(playbook.Location)
+	runConcurrently(playbook.Config.Concurrency, len(results), func(i int) {
+		if i < len(tasks) {
+			results[i] = runTask(ctx, playbook.Config, tasks[i], connectors, locks, issued)
+			return
+		}
+		results[i] = runSshTask(ctx, playbook.Config, sshTasks[i-len(tasks)], connectors, locks)
+	})
+
+	recordRunMetrics(results)
+	return results
+}
+
+// recordRunMetrics records the outcome of results and the expiration of the certificates installed by their tasks
+func recordRunMetrics(results []TaskResult) {
+	failed := false
+	for _, result := range results {
+		metrics.PlaybookTasks.Inc(string(result.Status))
+		failed = failed || result.Status.Failed()
+
+		for _, installation := range result.Installations {
+			cert := installation.Before
+			if installation.Status == InstallationInstalled {
+				cert = result.After
+			}
+			// certificates valid forever, such as SSH ones, have no expiration
+			if cert == nil || cert.NotAfter.IsZero() {
+				continue
+			}
+			notAfter := cert.NotAfter
+			metrics.CertificateExpiry.SetFunc(func() float64 {
+				return time.Until(notAfter).Seconds()
+			}, result.Name, installation.Type, installation.Location)
+		}
+	}
+
+	now := float64(time.Now().Unix())
+	metrics.PlaybookLastRun.Set(now)
+	if !failed {
+		metrics.PlaybookLastSuccess.Set(now)
+	}
+}
+
+// runConcurrently calls fn for every index from 0 to n-1, from up to concurrency goroutines at the same time
+func runConcurrently(concurrency int, n int, fn func(i int)) {
+	workers := concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	zap.L().Debug("running playbook tasks", zap.Int("tasks", n), zap.Int("concurrency", workers))
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func runTask(ctx context.Context, config domain.Config, task domain.CertificateTask, connectors *vcertutil.ConnectorCache, locks *locationLocks, issued *issuanceState) TaskResult {
+	zap.L().Info("running playbook task", zap.String("task", task.Name))
+	ctx, span := tracing.Start(ctx, "playbook.task", tracing.String(tracing.AttrTask, task.Name),
+		tracing.String(tracing.AttrZone, task.Request.Zone))
+	start := time.Now()
+	result := execute(ctx, config, task, connectors, locks, issued)
+	result.Duration = time.Since(start)
+	span.SetAttributes(tracing.String("vcert.task.status", string(result.Status)))
+	if result.Status.Failed() {
+		span.RecordError(errors.Join(result.Errors...))
+	}
+	span.End()
+
+	for _, err := range result.Errors {
+		zap.L().Error("error running task", zap.String("task", task.Name), zap.Error(err))
+	}
+	return result
+}
+
+// locationLocks serializes the access to the locations (files, keystores, certificate stores) installations write to.
+// A nil *locationLocks doesn't lock anything.
+type locationLocks struct {
+	m sync.Map // location -> *sync.Mutex
+}
+
+// lock locks all the locations of installations and returns the function unlocking them
+func (l *locationLocks) lock(installations ...domain.Installation) func() {
+	if l == nil {
+		return func() {}
+	}
+
+	keys := make([]string, 0, len(installations))
+	for _, installation := range installations {
+		keys = append(keys, installationLocations(installation)...)
+	}
+	return l.lockKeys(keys)
+}
+
+// lockFiles locks files and returns the function unlocking them
+func (l *locationLocks) lockFiles(files ...string) func() {
+	if l == nil {
+		return func() {}
+	}
+	return l.lockKeys(fileLocations(files))
+}
+
+// lockKeys locks the locations of keys and returns the function unlocking them
+func (l *locationLocks) lockKeys(keys []string) func() {
+	// always lock in the same order, so two installations sharing several locations can't deadlock
+	sort.Strings(keys)
+	keys = slices.Compact(keys)
+	mutexes := make([]*sync.Mutex, 0, len(keys))
+	for _, key := range keys {
+		m, _ := l.m.LoadOrStore(key, &sync.Mutex{})
+		mutex := m.(*sync.Mutex)
+		mutex.Lock()
+		mutexes = append(mutexes, mutex)
+	}
+	return func() {
+		for i := len(mutexes) - 1; i >= 0; i-- {
+			mutexes[i].Unlock()
+		}
+	}
+}
+
+// installationLocations returns a unique key for every location installation writes to
+func installationLocations(installation domain.Installation) []string {
+	if installation.Type == domain.FormatCAPI {
+		return []string{"capi:" + strings.ToLower(getInstallationLocationString(installation))}
+	}
+	if installation.Type == domain.FormatKubernetes && installation.Kubernetes != nil {
+		return []string{"kubernetes:" + installer.KubernetesLocation(*installation.Kubernetes)}
+	}
+	if installation.Type == domain.FormatVault {
+		return []string{"vault:" + getInstallationLocationString(installation)}
+	}
+
+	files := []string{installation.File, installation.KeyFile, installation.ChainFile}
+	for _, bundle := range installation.Bundles {
+		files = append(files, bundle.File)
+	}
+	// the manifest of the backup directory is shared by the installations with the same backupPolicy.dir
+	files = append(files, installation.BackupDir())
+	return fileLocations(files)
+}
+
+// fileLocations returns a unique key for every file of files
+func fileLocations(files []string) []string {
+	keys := make([]string, 0, len(files))
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		key, err := filepath.Abs(file)
+		if err != nil {
+			key = filepath.Clean(file)
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
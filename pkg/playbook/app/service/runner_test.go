@@ -0,0 +1,445 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/metrics"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/hooks"
+	"github.com/Venafi/vcert/v5/pkg/tracing"
+)
+
+func pemTask(name string, dir string) domain.CertificateTask {
+	return domain.CertificateTask{
+		Name: name,
+		Request: domain.PlaybookRequest{
+			CsrOrigin: certificate.StrLocalGeneratedCSR,
+			KeyType:   certificate.KeyTypeRSA,
+			KeyLength: 2048,
+			Subject:   domain.Subject{CommonName: name + ".vcert.test"},
+		},
+		Installations: domain.Installations{
+			{
+				Type:      domain.FormatPEM,
+				File:      filepath.Join(dir, "cert.pem"),
+				ChainFile: filepath.Join(dir, "chain.pem"),
+				KeyFile:   filepath.Join(dir, "key.pem"),
+			},
+		},
+		RenewBefore: "30d",
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	playbook := domain.Playbook{
+		Config: domain.Config{Concurrency: 4},
+	}
+	for i := 0; i < 8; i++ {
+		playbook.CertificateTasks = append(playbook.CertificateTasks,
+			pemTask(fmt.Sprintf("task%d", i), filepath.Join(dir, fmt.Sprintf("task%d", i))))
+	}
+	// two tasks installing the same certificate in the same location
+	shared := pemTask("task0", filepath.Join(dir, "task0"))
+	shared.Name = "shared"
+	playbook.CertificateTasks = append(playbook.CertificateTasks, shared)
+
+	results := Run(playbook)
+	require.Len(t, results, len(playbook.CertificateTasks))
+	for i, result := range results {
+		assert.Equal(t, playbook.CertificateTasks[i].Name, result.Name)
+		assert.Empty(t, result.Errors, result.Name)
+		assert.Contains(t, []TaskStatus{TaskRenewed, TaskUnchanged}, result.Status, result.Name)
+	}
+
+	// certificates are now installed and valid: nothing to do
+	results = Run(playbook)
+	for _, result := range results {
+		assert.Equal(t, TaskUnchanged, result.Status, result.Name)
+	}
+}
+
+func TestCheckInstallation(t *testing.T) {
+	dir := t.TempDir()
+	task := pemTask("check", dir)
+	installation := task.Installations[0]
+
+	check := checkInstallation(installation, task.RenewBefore, task.Request, false, nil)
+	require.NoError(t, check.err)
+	assert.Nil(t, check.cert)
+	assert.True(t, check.changed)
+
+	results := Run(domain.Playbook{CertificateTasks: domain.CertificateTasks{task}})
+	require.Empty(t, results[0].Errors)
+	check = checkInstallation(installation, task.RenewBefore, task.Request, false, nil)
+	require.NoError(t, check.err)
+	require.NotNil(t, check.cert)
+	assert.Equal(t, results[0].After.Serial, newCertificateInfo(check.cert).Serial)
+	assert.False(t, check.changed)
+
+	// an unreadable certificate fails the check, unless the renewal is forced
+	require.NoError(t, os.WriteFile(installation.File, []byte("not a certificate"), 0600))
+	check = checkInstallation(installation, task.RenewBefore, task.Request, false, nil)
+	assert.Error(t, check.err)
+	check = checkInstallation(installation, task.RenewBefore, task.Request, true, nil)
+	require.NoError(t, check.err)
+	assert.True(t, check.changed)
+}
+
+func TestRun_NoTasks(t *testing.T) {
+	results := Run(domain.Playbook{Config: domain.Config{Concurrency: 4}})
+	assert.Empty(t, results)
+}
+
+func TestRun_FailedTask(t *testing.T) {
+	// the installation directory is a regular file, installing fails
+	dir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(dir, []byte("not a directory"), 0600))
+	task := pemTask("invalid", dir)
+
+	results := Run(domain.Playbook{CertificateTasks: domain.CertificateTasks{task}})
+	require.Len(t, results, 1)
+	assert.Equal(t, TaskFailed, results[0].Status)
+	assert.NotEmpty(t, results[0].Errors)
+}
+
+func TestLocationLocks(t *testing.T) {
+	locks := &locationLocks{}
+	a := domain.Installation{Type: domain.FormatPEM, File: "a.pem", KeyFile: "shared.pem"}
+	b := domain.Installation{Type: domain.FormatPEM, File: "b.pem", ChainFile: "shared.pem"}
+	c := domain.Installation{Type: domain.FormatJKS, File: "c.jks"}
+
+	var running, maxRunning atomic.Int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		installation := a
+		if i%2 == 1 {
+			installation = b
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.lock(installation)
+			defer unlock()
+			n := running.Add(1)
+			if n > maxRunning.Load() {
+				maxRunning.Store(n)
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), maxRunning.Load(), "installations sharing a file must not run concurrently")
+
+	// unrelated installations don't wait for each other
+	unlockA := locks.lock(a)
+	unlockC := locks.lock(c)
+	unlockC()
+	unlockA()
+
+	var nilLocks *locationLocks
+	nilLocks.lock(a)()
+}
+
+func TestInstallationLocations(t *testing.T) {
+	// the file and its backup directory
+	locations := installationLocations(domain.Installation{Type: domain.FormatPEM, File: "cert.pem", KeyFile: "./cert.pem"})
+	assert.Len(t, locations, 2)
+
+	// installations sharing a backup directory lock it
+	backups := &domain.BackupPolicy{Dir: "backups"}
+	dir, err := filepath.Abs("backups")
+	require.NoError(t, err)
+	assert.Contains(t, installationLocations(domain.Installation{Type: domain.FormatPEM, File: "a.pem",
+		BackupPolicy: backups}), dir)
+	assert.Contains(t, installationLocations(domain.Installation{Type: domain.FormatJKS, File: "b.jks",
+		BackupPolicy: backups}), dir)
+
+	locations = installationLocations(domain.Installation{Type: domain.FormatCAPI, CAPILocation: `LocalMachine\My`})
+	assert.Equal(t, []string{`capi:localmachine\my`}, locations)
+
+	// a Secret without namespace is in the default namespace of the cluster
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(`current-context: test
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+users:
+- name: test
+  user:
+    token: test
+`), 0600))
+	locations = installationLocations(domain.Installation{Type: domain.FormatKubernetes,
+		Kubernetes: &domain.KubernetesSecret{Name: "www", Kubeconfig: kubeconfig}})
+	assert.Equal(t, []string{"kubernetes:default/www"}, locations)
+	assert.Equal(t, locations, installationLocations(domain.Installation{Type: domain.FormatKubernetes,
+		Kubernetes: &domain.KubernetesSecret{Namespace: "default", Name: "www", Kubeconfig: kubeconfig}}))
+}
+
+func TestRun_Metrics(t *testing.T) {
+	task := pemTask("metrics", t.TempDir())
+	renewed := metrics.PlaybookTasks.Value(string(TaskRenewed))
+
+	results := Run(domain.Playbook{CertificateTasks: domain.CertificateTasks{task}})
+	require.Len(t, results, 1)
+	require.NotNil(t, results[0].After)
+	assert.Equal(t, renewed+1, metrics.PlaybookTasks.Value(string(TaskRenewed)))
+
+	expiry := metrics.CertificateExpiry.Value("metrics", "PEM", task.Installations[0].File)
+	assert.InDelta(t, time.Until(results[0].After.NotAfter).Seconds(), expiry, 5)
+	assert.InDelta(t, float64(time.Now().Unix()), metrics.PlaybookLastSuccess.Value(), 5)
+}
+
+func TestRun_Tracing(t *testing.T) {
+	recorder := &tracing.Recorder{}
+	tracing.SetExporter(recorder)
+	defer tracing.SetExporter(nil)
+
+	task := pemTask("tracing", t.TempDir())
+	results := Run(domain.Playbook{CertificateTasks: domain.CertificateTasks{task}})
+	require.Len(t, results, 1)
+	require.Equal(t, TaskRenewed, results[0].Status)
+
+	run, ok := recorder.Find("playbook.run")
+	require.True(t, ok)
+	taskSpan, ok := recorder.Find("playbook.task")
+	require.True(t, ok)
+	assert.Equal(t, run.SpanID, taskSpan.ParentSpanID)
+	assert.Equal(t, "tracing", taskSpan.Attribute(tracing.AttrTask))
+	assert.Equal(t, string(TaskRenewed), taskSpan.Attribute("vcert.task.status"))
+
+	for _, phase := range []string{"playbook.check", "playbook.enroll", "playbook.install"} {
+		span, ok := recorder.Find(phase)
+		require.True(t, ok, phase)
+		assert.Equal(t, taskSpan.SpanID, span.ParentSpanID, phase)
+		assert.Equal(t, run.TraceID, span.TraceID, phase)
+		assert.False(t, span.Error, phase)
+	}
+
+	// the connector operations are children of the enrollment
+	enroll, _ := recorder.Find("playbook.enroll")
+	request, ok := recorder.Find("fake.RequestCertificate")
+	require.True(t, ok)
+	assert.Equal(t, enroll.SpanID, request.ParentSpanID)
+	assert.Equal(t, "fake", request.Attribute(tracing.AttrPlatform))
+	assert.NotEmpty(t, request.Attribute(tracing.AttrRequestID))
+}
+
+func TestRun_Drift(t *testing.T) {
+	task := pemTask("drift", t.TempDir())
+	playbook := domain.Playbook{CertificateTasks: domain.CertificateTasks{task}}
+	results := Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status)
+	assert.Equal(t, "no certificate installed", results[0].Reason)
+
+	results = Run(playbook)
+	require.Equal(t, TaskUnchanged, results[0].Status)
+	assert.Empty(t, results[0].Reason)
+
+	// the certificate is far from its renew window, but the request changed
+	task.Request.DNSNames = []string{"drift.vcert.test", "www.drift.vcert.test"}
+	task.Request.KeyLength = 3072
+	playbook.CertificateTasks = domain.CertificateTasks{task}
+	results = Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status)
+	assert.Contains(t, results[0].Reason, "doesn't match the request")
+	assert.Contains(t, results[0].Reason, "missing DNS SANs: drift.vcert.test, www.drift.vcert.test")
+	assert.Contains(t, results[0].Reason, "key size 2048 doesn't match 3072")
+	assert.Equal(t, results[0].Reason, results[0].Installations[0].Reason)
+
+	results = Run(playbook)
+	assert.Equal(t, TaskUnchanged, results[0].Status)
+}
+
+func TestRun_ZoneChanged(t *testing.T) {
+	dir := t.TempDir()
+	task := pemTask("zone", dir)
+	task.Request.Zone = `Certificates\Web`
+	playbook := domain.Playbook{
+		CertificateTasks: domain.CertificateTasks{task},
+		Location:         filepath.Join(dir, "playbook.yaml"),
+	}
+	results := Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status)
+	assert.FileExists(t, playbook.Location+issuanceStateSuffix)
+
+	// the certificate matches the request, but it was issued from the previous zone of the task
+	task.Request.Zone = `Certificates\Api`
+	playbook.CertificateTasks = domain.CertificateTasks{task}
+	plans := Plan(playbook)
+	assert.Equal(t, PlanRenew, plans[0].Action)
+	assert.Equal(t, `zone changed from "Certificates\\Web" to "Certificates\\Api"`, plans[0].Reason)
+	results = Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status)
+	assert.Equal(t, `zone changed from "Certificates\\Web" to "Certificates\\Api"`, results[0].Reason)
+
+	results = Run(playbook)
+	assert.Equal(t, TaskUnchanged, results[0].Status)
+}
+
+func TestRun_Transactional(t *testing.T) {
+	dir := t.TempDir()
+	task := pemTask("transaction", filepath.Join(dir, "a"))
+	second := pemTask("transaction", filepath.Join(dir, "b")).Installations[0]
+	second.BackupFiles = true
+	task.Installations = append(task.Installations, second)
+	task.Installations[0].AfterAction = "echo reload >> " + filepath.Join(dir, "reloads")
+	task.Transactional = true
+	playbook := domain.Playbook{CertificateTasks: domain.CertificateTasks{task}}
+
+	results := Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+	installed := readFile(t, filepath.Join(dir, "a", "cert.pem"))
+	// the backups taken for the transaction are only kept with backupFiles
+	assert.NoDirExists(t, filepath.Join(dir, "a", "cert.pem"+domain.BackupDirSuffix))
+	assert.DirExists(t, filepath.Join(dir, "b", "cert.pem"+domain.BackupDirSuffix))
+
+	// the validation of the second installation fails: both locations keep the previous certificate
+	task.Request.KeyLength = 3072
+	task.Installations[1].AfterAction = "echo 0"
+	task.Installations[1].InstallValidation = "echo 1"
+	playbook.CertificateTasks = domain.CertificateTasks{task}
+	results = Run(playbook)
+	require.Equal(t, TaskRolledBack, results[0].Status)
+	assert.Equal(t, InstallationRolledBack, results[0].Installations[0].Status)
+	assert.Equal(t, InstallationFailed, results[0].Installations[1].Status)
+	assert.Contains(t, results[0].Installations[1].Error, "installation validation actions failed")
+	assert.Equal(t, installed, readFile(t, filepath.Join(dir, "a", "cert.pem")))
+	assert.Equal(t, installed, readFile(t, filepath.Join(dir, "b", "cert.pem")))
+	// the after-install action ran on install, on the renewal and after the rollback
+	assert.Equal(t, "reload\nreload\nreload\n", readFile(t, filepath.Join(dir, "reloads")))
+	assert.NoDirExists(t, filepath.Join(dir, "a", "cert.pem"+domain.BackupDirSuffix))
+}
+
+func TestRun_Hooks(t *testing.T) {
+	var events []hooks.Event
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/validate" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var event hooks.Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events = append(events, event)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	task := pemTask("hooks", dir)
+	task.Installations[0].Hooks = &domain.Hooks{
+		AfterInstall: []domain.Hook{{Type: domain.HookWebhook, URL: server.URL + "/reload"}},
+	}
+	playbook := domain.Playbook{CertificateTasks: domain.CertificateTasks{task}}
+
+	results := Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+	require.Len(t, events, 1)
+	assert.Equal(t, "hooks", events[0].Task)
+	assert.Equal(t, results[0].After.Serial, events[0].Serial)
+	assert.Equal(t, results[0].After.Thumbprint, events[0].Thumbprint)
+	assert.Equal(t, filepath.Join(dir, "key.pem"), events[0].KeyFile)
+	require.Len(t, results[0].Installations[0].Hooks, 1)
+	assert.True(t, results[0].Installations[0].Hooks[0].Success)
+
+	// a validation hook failing after its retries fails the installation
+	task.Request.KeyLength = 3072
+	task.Installations[0].Hooks.Validation = []domain.Hook{
+		{Type: domain.HookWebhook, URL: server.URL + "/validate", Retries: 1, RetryDelay: time.Millisecond},
+	}
+	playbook.CertificateTasks = domain.CertificateTasks{task}
+	calls.Store(0)
+	results = Run(playbook)
+	require.Equal(t, TaskInstallFailed, results[0].Status)
+	assert.Equal(t, int32(3), calls.Load(), "the after-install hook once and the validation hook twice")
+	assert.Contains(t, results[0].Installations[0].Error, "error running validation hooks")
+	require.Len(t, results[0].Installations[0].Hooks, 2)
+	assert.False(t, results[0].Installations[0].Hooks[1].Success)
+}
+
+func TestRun_VerifyEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	reloaded := atomic.Bool{}
+	// the server serves the installed certificate once reloaded
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.TLS = &tls.Config{GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if !reloaded.Load() {
+			return &server.TLS.Certificates[0], nil
+		}
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+		return &cert, err
+	}}
+	server.StartTLS()
+	defer server.Close()
+
+	task := pemTask("endpoint", dir)
+	task.Installations[0].VerifyEndpoint = &domain.EndpointVerification{
+		Address: strings.TrimPrefix(server.URL, "https://"),
+		// without SNI, the server would not call GetCertificate
+		ServerName: "endpoint.vcert.test",
+		Period:     500 * time.Millisecond,
+		Interval:   10 * time.Millisecond,
+	}
+	playbook := domain.Playbook{CertificateTasks: domain.CertificateTasks{task}}
+
+	// the server was not reloaded
+	results := Run(playbook)
+	require.Equal(t, TaskInstallFailed, results[0].Status)
+	require.NotNil(t, results[0].Installations[0].Endpoint)
+	assert.False(t, results[0].Installations[0].Endpoint.Success)
+	assert.Contains(t, results[0].Installations[0].Error, "error verifying endpoint")
+
+	reloaded.Store(true)
+	task.Request.KeyLength = 3072
+	playbook.CertificateTasks = domain.CertificateTasks{task}
+	results = Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+	assert.True(t, results[0].Installations[0].Endpoint.Success)
+	assert.Contains(t, results[0].Installations[0].Endpoint.Output, results[0].After.Serial)
+}
+
+func readFile(t *testing.T, file string) string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	return string(data)
+}
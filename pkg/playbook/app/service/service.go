@@ -17,6 +17,9 @@
 package service
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -25,8 +28,10 @@ import (
 
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/hooks"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/installer"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/vcertutil"
+	"github.com/Venafi/vcert/v5/pkg/tracing"
 	"github.com/Venafi/vcert/v5/pkg/venafi"
 )
 
@@ -39,25 +44,68 @@ const (
 	envVarBase64     = "base64"
 )
 
+// errActionFailed is returned by a transactional installation when an after-install action or a validation outputs "1"
+var errActionFailed = errors.New(`action output was "1"`)
+
 // Execute takes the task and requests the certificate specified,
 // then it installs it in the locations defined by the installers.
 //
 // Config is used to make the connection to the Venafi platform for the certificate request.
 func Execute(config domain.Config, task domain.CertificateTask) []error {
+	return execute(context.Background(), config, task, nil, nil, nil).Errors
+}
+
+// execute runs task and returns its result. connectors, locks and issued may be nil when the task runs on its own.
+//
+// Every phase of the task (check, enroll, install, after-action and validation) is traced as a child of the span of
+// ctx.
+func execute(ctx context.Context, config domain.Config, task domain.CertificateTask, connectors *vcertutil.ConnectorCache, locks *locationLocks, issued *issuanceState) TaskResult {
+	result := TaskResult{
+		Name:          task.Name,
+		Status:        TaskUnchanged,
+		Installations: make([]InstallationResult, len(task.Installations)),
+	}
+	renewBefore := DefaultRenew
+	if task.RenewBefore != "" {
+		renewBefore = task.RenewBefore
+	}
+	checks := make([]installationCheck, len(task.Installations))
+	for i, installation := range task.Installations {
+		checks[i] = checkInstallation(installation, renewBefore, task.Request, config.ForceRenew, locks)
+		result.Installations[i] = InstallationResult{
+			Type:     installation.Type.String(),
+			Location: getInstallationLocationString(installation),
+			Status:   InstallationSkipped,
+			Before:   newCertificateInfo(checks[i].cert),
+		}
+		if result.Before == nil {
+			result.Before = result.Installations[i].Before
+		}
+	}
+	fail := func(status TaskStatus, err error) TaskResult {
+		result.Status = status
+		result.Errors = append(result.Errors, err)
+		return result
+	}
+
 	// Check if certificate needs action
-	changed, err := isCertificateChanged(config, task)
+	_, span := tracing.Start(ctx, "playbook.check", tracing.String(tracing.AttrTask, task.Name))
+	changed, err := isCertificateChanged(config, task, renewBefore, checks, issued, &result)
+	span.SetAttributes(tracing.Bool("vcert.changed", changed))
+	span.Finish(err)
 	if err != nil {
 		zap.L().Error("error checking certificate in task", zap.String("task", task.Name), zap.Error(err))
-		return []error{err}
+		return fail(TaskFailed, err)
 	}
 
 	// Config has not changed. Do nothing
 	if !changed {
 		zap.L().Info("certificate in good health. No actions needed",
 			zap.String("certificate", task.Request.Subject.CommonName))
-		return nil
+		return result
 	}
-	zap.L().Info("certificate needs action", zap.String("certificate", task.Request.Subject.CommonName))
+	zap.L().Info("certificate needs action", zap.String("certificate", task.Request.Subject.CommonName),
+		zap.String("reason", result.Reason))
 
 	// Ensure there is a keyPassword in the request when origin is service
 	csrOrigin := certificate.ParseCSROrigin(task.Request.CsrOrigin)
@@ -67,10 +115,14 @@ func Execute(config domain.Config, task domain.CertificateTask) []error {
 	}
 
 	// Config changed or certificate needs renewal. Do request
-	pcc, certRequest, err := vcertutil.EnrollCertificate(config, task.Request)
+	enrollCtx, span := tracing.Start(ctx, "playbook.enroll", tracing.String(tracing.AttrTask, task.Name),
+		tracing.String(tracing.AttrZone, task.Request.Zone))
+	pcc, certRequest, err := vcertutil.EnrollCertificateWithCache(enrollCtx, connectors, config, task.Request)
 	if err != nil {
-		return []error{fmt.Errorf("error requesting certificate %s: %w", task.Name, err)}
+		span.Finish(err)
+		return fail(TaskEnrollFailed, fmt.Errorf("error requesting certificate %s: %w", task.Name, err))
 	}
+	span.SetAttributes(tracing.String(tracing.AttrRequestID, certRequest.PickupID))
 	zap.L().Info("successfully enrolled certificate", zap.String("certificate", task.Request.Subject.CommonName))
 
 	// Private Key should not be decrypted when csrOrigin is service and Platform is Firefly.
@@ -86,9 +138,12 @@ func Execute(config domain.Config, task domain.CertificateTask) []error {
 	if err != nil {
 		e := "error preparing certificate for installation"
 		zap.L().Error(e, zap.Error(err))
-		return []error{fmt.Errorf("%s: %w", e, err)}
+		span.Finish(err)
+		return fail(TaskEnrollFailed, fmt.Errorf("%s: %w", e, err))
 	}
+	span.End()
 	zap.L().Info("successfully prepared certificate for installation")
+	result.After = newCertificateInfo(&x509Certificate.X509cert)
 
 	// Set certificate to environment variables
 	if task.SetEnvVars != nil {
@@ -97,103 +152,405 @@ func Execute(config domain.Config, task domain.CertificateTask) []error {
 	}
 
 	// Install certificate on locations
-	errorList := make([]error, 0)
-	for _, installation := range task.Installations {
-		e := runInstaller(installation, prepedPcc)
+	result.Status = TaskRenewed
+	event := newHookEvent(task.Name, result.After)
+	if task.Transactional {
+		unlock := locks.lock(task.Installations...)
+		installTransaction(ctx, task, prepedPcc, event, &result)
+		unlock()
+		if result.Status == TaskRenewed {
+			issued.record(task, &x509Certificate.X509cert)
+		}
+		return result
+	}
+	for i, installation := range task.Installations {
+		unlock := locks.lock(installation)
+		e := runInstaller(ctx, installation, prepedPcc, event, &result.Installations[i], false)
+		unlock()
 		if e != nil {
-			errorList = append(errorList, e)
+			result.Status = TaskInstallFailed
+			result.Errors = append(result.Errors, e)
 		}
 	}
-	return errorList
+	if result.Status == TaskRenewed {
+		issued.record(task, &x509Certificate.X509cert)
+	}
+	return result
+
+}
+
+// installationCheck is the certificate installed in a location, if it could be read, and whether it needs to be
+// installed again
+type installationCheck struct {
+	cert    *x509.Certificate
+	changed bool
+	err     error
+}
+
+// checkInstallation reads the certificate installed in installation, once, and checks whether it needs to be installed
+// again. With forceRenew, it always does and read errors are ignored. The certificates of installers that can't be
+// read are only checked
+func checkInstallation(installation domain.Installation, renewBefore string, request domain.PlaybookRequest, forceRenew bool, locks *locationLocks) installationCheck {
+	unlock := locks.lock(installation)
+	defer unlock()
+
+	location := getInstallationLocationString(installation)
+	zap.L().Info("checking certificate health", zap.String("format", installation.Type.String()),
+		zap.String("location", location))
+	instlr := installer.GetInstaller(installation)
+	reader, ok := instlr.(installer.CertificateReader)
+	if !ok {
+		if forceRenew {
+			return installationCheck{changed: true}
+		}
+		changed, err := instlr.Check(renewBefore, request)
+		return installationCheck{changed: changed, err: err}
+	}
 
+	cert, err := reader.InstalledCertificate(request)
+	if err != nil {
+		if forceRenew {
+			zap.L().Debug("could not read installed certificate", zap.String("location", location), zap.Error(err))
+			return installationCheck{changed: true}
+		}
+		return installationCheck{err: err}
+	}
+	return installationCheck{
+		cert:    cert,
+		changed: forceRenew || installer.CheckCertificate(cert, renewBefore, request),
+	}
 }
 
-func isCertificateChanged(config domain.Config, task domain.CertificateTask) (bool, error) {
+// isCertificateChanged returns whether any of the installations of task, whose checks are checks, needs the
+// certificate to be installed and records why in result. The certificates issued from another zone than the one of
+// task, according to issued, are installed again
+func isCertificateChanged(config domain.Config, task domain.CertificateTask, renewBefore string, checks []installationCheck, issued *issuanceState, result *TaskResult) (bool, error) {
 	//If forceRenew is set, then no need to check the certificate status
 	if config.ForceRenew {
 		zap.L().Info("Flag [force-renew] is set. All certificates will be requested/renewed regardless of status")
+		result.Reason = reasonForceRenew
 		return true, nil
 	}
-	renewBefore := DefaultRenew
-	if task.RenewBefore != "" {
-		renewBefore = task.RenewBefore
-	}
 
 	changed := false
 	// check if any installs have changed
-	for _, install := range task.Installations {
-		isChanged, err := installer.GetInstaller(install).Check(renewBefore, task.Request)
-		if err != nil {
-			return false, fmt.Errorf("error checking for certificate %s: %w", task.Name, err)
+	for i, check := range checks {
+		if check.err != nil {
+			return false, fmt.Errorf("error checking for certificate %s: %w", task.Name, check.err)
 		}
-		if isChanged {
+		reason := ""
+		if check.changed {
+			_, reason = renewalReason(check.cert, renewBefore, task.Request, true)
+		} else {
+			reason = issued.zoneDrift(task, check.cert)
+		}
+		if reason != "" {
 			changed = true
+			result.Installations[i].Reason = reason
+			if result.Reason == "" {
+				result.Reason = reason
+			}
 		}
 	}
 
 	return changed, nil
 }
 
-func runInstaller(installation domain.Installation, prepedPcc *certificate.PEMCollection) error {
-	location := getInstallationLocationString(installation)
+// installTransaction installs prepedPcc in all the installations of task, or in none of them. Every location is backed
+// up before the first installation. If an installation, an after-install action, a hook or a validation fails, the
+// locations installed so far are restored from their backup and their after-install actions and hooks run again. The
+// backups of the installations without backupFiles are discarded once the transaction is over
+func installTransaction(ctx context.Context, task domain.CertificateTask, prepedPcc *certificate.PEMCollection, event hooks.Event, result *TaskResult) {
+	ctx, span := tracing.Start(ctx, "playbook.transaction", tracing.String(tracing.AttrTask, task.Name))
+	var err error
+	defer func() { span.Finish(err) }()
+
+	backedUp := 0
+	defer func() { discardBackups(task.Installations[:backedUp], result.Installations) }()
+	for i, installation := range task.Installations {
+		location := result.Installations[i].Location
+		zap.L().Info("backing up certificate for Installer", zap.String("installer", installation.Type.String()),
+			zap.String("location", location))
+		err = installer.GetInstaller(installation).Backup()
+		if err != nil {
+			zap.L().Error("error backing up certificate", zap.String("location", location), zap.Error(err))
+			err = fmt.Errorf("error backing up certificate at location %s: %w", location, err)
+			result.Installations[i].Status = InstallationFailed
+			result.Installations[i].Error = err.Error()
+			result.Status = TaskInstallFailed
+			result.Errors = append(result.Errors, err)
+			return
+		}
+		backedUp++
+	}
+
+	attempted := 0
+	for i, installation := range task.Installations {
+		attempted++
+		err = runInstaller(ctx, installation, prepedPcc, event, &result.Installations[i], true)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		return
+	}
+
+	zap.L().Info("rolling back transactional task", zap.String("task", task.Name))
+	result.Status = TaskRolledBack
+	result.Errors = append(result.Errors, err)
+	for i := 0; i < attempted; i++ {
+		e := rollbackInstaller(ctx, task.Name, task.Installations[i], prepedPcc, &result.Installations[i])
+		if e != nil {
+			result.Errors = append(result.Errors, e)
+		}
+	}
+}
+
+// discardBackups removes the backups taken by a transaction of the installations without backupFiles. Failing to remove
+// one doesn't fail the transaction
+func discardBackups(installations []domain.Installation, results []InstallationResult) {
+	for i, installation := range installations {
+		if installation.BackupFiles {
+			continue
+		}
+		discarder, ok := installer.GetInstaller(installation).(installer.BackupDiscarder)
+		if !ok {
+			continue
+		}
+		err := discarder.DiscardBackup()
+		if err != nil {
+			zap.L().Warn("failed to remove the backup of the transaction", zap.String("location", results[i].Location),
+				zap.Error(err))
+		}
+	}
+}
+
+// rollbackInstaller restores the location of installation from its backup and runs its after-install actions and
+// hooks again
+func rollbackInstaller(ctx context.Context, task string, installation domain.Installation, prepedPcc *certificate.PEMCollection, result *InstallationResult) (err error) {
+	location := result.Location
+	_, span := tracing.Start(ctx, "playbook.rollback", tracing.String("vcert.installation.type",
+		installation.Type.String()), tracing.String("vcert.installation.location", location))
+	defer func() { span.Finish(err) }()
+
+	instlr := installer.GetInstaller(installation)
+	err = instlr.Rollback(*prepedPcc)
+	if err != nil {
+		zap.L().Error("error rolling back certificate", zap.String("location", location), zap.Error(err))
+		err = fmt.Errorf("error rolling back certificate at location %s: %w", location, err)
+		result.Status = InstallationFailed
+		result.Error = err.Error()
+		return err
+	}
+	zap.L().Info("successfully rolled back certificate", zap.String("location", location))
+	// the installation that failed keeps its status and error
+	if result.Status != InstallationFailed {
+		result.Status = InstallationRolledBack
+	}
+
+	if installation.AfterAction != "" {
+		output, err := instlr.AfterInstallActions()
+		if err != nil {
+			zap.L().Error("error running after-install actions after rollback", zap.String("location", location),
+				zap.Error(err))
+			return fmt.Errorf("error running after-install actions after rollback at location %s: %w", location, err)
+		}
+		zap.L().Info("successfully executed after-install actions after rollback", zap.String("location", location),
+			zap.String("output", strings.TrimSpace(output)))
+	}
+
+	if installation.Hooks == nil || len(installation.Hooks.AfterInstall) == 0 {
+		return nil
+	}
+	event := installedHookEvent(task, installation, instlr, location)
+	err = runHooks(ctx, installation.Hooks.AfterInstall, event, nil)
+	if err != nil {
+		zap.L().Error("error running after-install hooks after rollback", zap.String("location", location),
+			zap.Error(err))
+		return fmt.Errorf("error running after-install hooks after rollback at location %s: %w", location, err)
+	}
+	zap.L().Info("successfully executed after-install hooks after rollback", zap.String("location", location))
+	return nil
+}
+
+// runInstaller installs prepedPcc in the location of installation, runs its actions and hooks for event and checks its
+// endpoint serves the certificate of event. A transactional installation is backed up beforehand by
+// installTransaction, and fails when an action outputs "1"
+func runInstaller(ctx context.Context, installation domain.Installation, prepedPcc *certificate.PEMCollection, event hooks.Event, result *InstallationResult, transactional bool) (err error) {
+	location := result.Location
+	ctx, span := tracing.Start(ctx, "playbook.install", tracing.String("vcert.installation.type",
+		installation.Type.String()), tracing.String("vcert.installation.location", location))
+	defer func() { span.Finish(err) }()
 
 	instlr := installer.GetInstaller(installation)
 	zap.L().Info("running Installer", zap.String("installer", installation.Type.String()),
 		zap.String("location", location))
 
-	var err error
+	fail := func(e string, err error) error {
+		zap.L().Error(e, zap.String("location", location), zap.Error(err))
+		err = fmt.Errorf("%s at location %s: %w", e, location, err)
+		result.Status = InstallationFailed
+		result.Error = err.Error()
+		return err
+	}
 
-	if installation.BackupFiles {
+	if installation.BackupFiles && !transactional {
 		zap.L().Info("backing up certificate for Installer", zap.String("installer", installation.Type.String()),
 			zap.String("location", location))
 		err = instlr.Backup()
 		if err != nil {
-			e := "error backing up certificate"
-			zap.L().Error(e, zap.String("location", location), zap.Error(err))
-			return fmt.Errorf("%s at location %s: %w", e, location, err)
+			return fail("error backing up certificate", err)
 		}
 	}
 
 	err = instlr.Install(*prepedPcc)
 	if err != nil {
-		e := "error installing certificate"
-		zap.L().Error(e, zap.String("location", location), zap.Error(err))
-		return fmt.Errorf("%s at location %s: %w", e, location, err)
+		return fail("error installing certificate", err)
 	}
 	zap.L().Info("successfully installed certificate", zap.String("location", location))
+	result.Status = InstallationInstalled
 
-	if installation.AfterAction == "" {
-		return nil
+	var installHooks, validationHooks []domain.Hook
+	if installation.Hooks != nil {
+		installHooks = installation.Hooks.AfterInstall
+		validationHooks = installation.Hooks.Validation
 	}
+	event = installationHookEvent(event, installation, location)
 
-	result, err := instlr.AfterInstallActions()
-	if err != nil {
-		e := "error running after-install actions"
-		zap.L().Error(e, zap.String("location", location), zap.Error(err))
-		return fmt.Errorf("%s at location %s: %w", e, location, err)
-	} else if strings.TrimSpace(result) == "1" {
-		zap.L().Info("after-install actions failed")
+	if installation.AfterAction != "" {
+		_, actionSpan := tracing.Start(ctx, "playbook.after-action")
+		output, err := instlr.AfterInstallActions()
+		actionSpan.Finish(err)
+		result.AfterAction = newActionResult(installation.AfterAction, output, err)
+		if err != nil {
+			return fail("error running after-install actions", err)
+		} else if strings.TrimSpace(output) == "1" {
+			zap.L().Info("after-install actions failed")
+			if transactional {
+				return fail("after-install actions failed", errActionFailed)
+			}
+		}
+		zap.L().Info("successfully executed after-install actions")
 	}
-	zap.L().Info("successfully executed after-install actions")
 
-	if installation.InstallValidation == "" {
-		return nil
+	if len(installHooks) > 0 {
+		err = runHooks(ctx, installHooks, event, &result.Hooks)
+		if err != nil {
+			return fail("error running after-install hooks", err)
+		}
+		zap.L().Info("successfully executed after-install hooks")
+	}
+
+	if installation.VerifyEndpoint != nil {
+		endpointCtx, endpointSpan := tracing.Start(ctx, "playbook.verify-endpoint",
+			tracing.String("vcert.endpoint.address", installation.VerifyEndpoint.Address))
+		output, err := hooks.VerifyEndpoint(endpointCtx, *installation.VerifyEndpoint, event)
+		endpointSpan.Finish(err)
+		result.Endpoint = &ActionResult{Command: "verify " + installation.VerifyEndpoint.Address, Output: output,
+			Success: err == nil}
+		if err != nil {
+			result.Endpoint.Error = err.Error()
+			return fail("error verifying endpoint", err)
+		}
+		zap.L().Info("successfully verified endpoint", zap.String("address", installation.VerifyEndpoint.Address))
 	}
 
-	validationResults, err := instlr.InstallValidationActions()
+	if installation.AfterAction != "" && installation.InstallValidation != "" {
+		_, validationSpan := tracing.Start(ctx, "playbook.validation")
+		validationResults, err := instlr.InstallValidationActions()
+		validationSpan.Finish(err)
+		result.Validation = newActionResult(installation.InstallValidation, validationResults, err)
 
-	if err != nil {
-		e := "error running installation validation actions"
-		zap.L().Error(e, zap.String("location", location), zap.Error(err))
-		return fmt.Errorf("%s at location %s: %w", e, location, err)
-	} else if strings.TrimSpace(validationResults) == "1" {
-		zap.L().Info("installation validation actions failed")
+		if err != nil {
+			return fail("error running installation validation actions", err)
+		} else if strings.TrimSpace(validationResults) == "1" {
+			zap.L().Info("installation validation actions failed")
+			if transactional {
+				return fail("installation validation actions failed", errActionFailed)
+			}
+		}
+		zap.L().Info("successfully executed installation validation actions")
+	}
+
+	if len(validationHooks) > 0 {
+		err = runHooks(ctx, validationHooks, event, &result.Hooks)
+		if err != nil {
+			return fail("error running validation hooks", err)
+		}
+		zap.L().Info("successfully executed validation hooks")
 	}
-	zap.L().Info("successfully executed installation validation actions")
 
 	return nil
 }
 
+// runHooks runs hookList in order for event, stopping at the first one failing. The result of each hook run is
+// appended to results, if not nil
+func runHooks(ctx context.Context, hookList []domain.Hook, event hooks.Event, results *[]*ActionResult) error {
+	for _, hook := range hookList {
+		hookCtx, span := tracing.Start(ctx, "playbook.hook", tracing.String("vcert.hook.type", hook.Type))
+		output, err := hooks.Run(hookCtx, hook, event)
+		span.Finish(err)
+		if results != nil {
+			*results = append(*results, newHookResult(hook, output, err))
+		}
+		if err != nil {
+			return fmt.Errorf("hook %q: %w", hook.String(), err)
+		}
+		zap.L().Info("successfully executed hook", zap.String("hook", hook.String()))
+	}
+	return nil
+}
+
+// newHookResult builds the result of a hook. Hooks report a failure with an error only
+func newHookResult(hook domain.Hook, output string, err error) *ActionResult {
+	r := &ActionResult{
+		Command: hook.String(),
+		Output:  output,
+		Success: err == nil,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// newHookEvent returns the event of the hooks of task, for the certificate cert
+func newHookEvent(task string, cert *CertificateInfo) hooks.Event {
+	event := hooks.Event{Task: task}
+	if cert != nil {
+		event.CommonName = cert.CommonName
+		event.Serial = cert.Serial
+		event.Thumbprint = cert.Thumbprint
+		event.NotAfter = cert.NotAfter
+	}
+	return event
+}
+
+// installationHookEvent returns event with the location of installation
+func installationHookEvent(event hooks.Event, installation domain.Installation, location string) hooks.Event {
+	event.Type = installation.Type.String()
+	event.Location = location
+	event.File = installation.File
+	event.KeyFile = installation.KeyFile
+	event.ChainFile = installation.ChainFile
+	return event
+}
+
+// installedHookEvent returns the event of the hooks of installation, for the certificate currently installed in its
+// location
+func installedHookEvent(task string, installation domain.Installation, instlr installer.Installer, location string) hooks.Event {
+	var cert *x509.Certificate
+	if reader, ok := instlr.(installer.CertificateReader); ok {
+		var err error
+		cert, err = reader.InstalledCertificate(domain.PlaybookRequest{})
+		if err != nil {
+			zap.L().Debug("could not read installed certificate", zap.String("location", location), zap.Error(err))
+		}
+	}
+	return installationHookEvent(newHookEvent(task, newCertificateInfo(cert)), installation, location)
+}
+
 func setEnvVars(task domain.CertificateTask, cert *installer.Certificate, prepedPcc *certificate.PEMCollection) {
 	//todo case sensitivity. upper the name
 	for _, envVar := range task.SetEnvVars {
@@ -227,6 +584,12 @@ func setEnvVars(task domain.CertificateTask, cert *installer.Certificate, preped
 }
 
 func getInstallationLocationString(installation domain.Installation) string {
+	if installation.Type == domain.FormatKubernetes && installation.Kubernetes != nil {
+		return installation.Kubernetes.String()
+	}
+	if installation.Type == domain.FormatVault && installation.Vault != nil {
+		return installation.Vault.String()
+	}
 	if installation.Type != domain.FormatCAPI {
 		return installation.File
 	}
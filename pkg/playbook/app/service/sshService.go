@@ -0,0 +1,384 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vcertutil"
+	playbookutil "github.com/Venafi/vcert/v5/pkg/playbook/util"
+	"github.com/Venafi/vcert/v5/pkg/tracing"
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+const (
+	// sshInstallationType is the type of the installation of an SSH certificate task in its result
+	sshInstallationType = "SSH"
+
+	sshPrivateKeyMode = 0600
+	sshPublicFileMode = 0644
+)
+
+func runSshTask(ctx context.Context, config domain.Config, task domain.SshCertificateTask, connectors *vcertutil.ConnectorCache, locks *locationLocks) TaskResult {
+	zap.L().Info("running playbook SSH task", zap.String("task", task.Name))
+	ctx, span := tracing.Start(ctx, "playbook.task", tracing.String(tracing.AttrTask, task.Name),
+		tracing.String("vcert.ssh.template", task.Request.Template))
+	start := time.Now()
+	result := executeSsh(ctx, config, task, connectors, locks)
+	result.Duration = time.Since(start)
+	span.SetAttributes(tracing.String("vcert.task.status", string(result.Status)))
+	if result.Status.Failed() {
+		span.RecordError(errors.Join(result.Errors...))
+	}
+	span.End()
+
+	for _, err := range result.Errors {
+		zap.L().Error("error running task", zap.String("task", task.Name), zap.Error(err))
+	}
+	return result
+}
+
+// executeSsh runs the SSH certificate task and returns its result. connectors and locks may be nil when the task runs
+// on its own.
+//
+// The certificate is requested when there is none for the key of the task, when it doesn't match the key or the
+// request, or when it is in its renew window. The key pair is generated first when task.GenerateKey is set and there
+// is none. Then the certificate is written next to the key, and the after-install action and hooks of the task run.
+func executeSsh(ctx context.Context, config domain.Config, task domain.SshCertificateTask, connectors *vcertutil.ConnectorCache, locks *locationLocks) TaskResult {
+	certFile := task.CertificateFile()
+	result := TaskResult{
+		Name:   task.Name,
+		Status: TaskUnchanged,
+		Installations: []InstallationResult{{
+			Type:     sshInstallationType,
+			Location: certFile,
+			Status:   InstallationSkipped,
+		}},
+	}
+	installation := &result.Installations[0]
+	fail := func(status TaskStatus, err error) TaskResult {
+		result.Status = status
+		result.Errors = append(result.Errors, err)
+		if status == TaskInstallFailed {
+			installation.Status = InstallationFailed
+			installation.Error = err.Error()
+		}
+		return result
+	}
+
+	// the key, its public key and its certificate are read and written together
+	unlock := locks.lockFiles(task.KeyFile, task.PublicKeyFile(), certFile)
+	defer unlock()
+
+	// Check if certificate needs action
+	_, span := tracing.Start(ctx, "playbook.check", tracing.String(tracing.AttrTask, task.Name))
+	publicKeyData, publicKey, err := readSshPublicKey(task)
+	span.Finish(err)
+	if err != nil {
+		return fail(TaskFailed, fmt.Errorf("error checking SSH certificate %s: %w", task.Name, err))
+	}
+	installed := installedSshCertificate(certFile)
+	result.Before = newSshCertificateInfo(installed)
+	installation.Before = result.Before
+
+	if config.ForceRenew {
+		zap.L().Info("Flag [force-renew] is set. All certificates will be requested/renewed regardless of status")
+	}
+	_, reason := sshRenewalReason(config, task, installed, publicKey)
+	if reason == "" {
+		zap.L().Info("SSH certificate in good health. No actions needed", zap.String("certificate", certFile))
+		return result
+	}
+	result.Reason = reason
+	installation.Reason = reason
+	zap.L().Info("SSH certificate needs action", zap.String("certificate", certFile), zap.String("reason", reason))
+
+	var privateKey []byte
+	if publicKey == nil {
+		zap.L().Info("generating SSH key pair", zap.String("keyFile", task.KeyFile))
+		privateKey, publicKeyData, publicKey, err = generateSshKeyPair(task.Request)
+		if err != nil {
+			return fail(TaskEnrollFailed, fmt.Errorf("error generating SSH key pair for %s: %w", task.Name, err))
+		}
+	}
+
+	// Key changed or certificate needs renewal. Do request
+	enrollCtx, span := tracing.Start(ctx, "playbook.enroll", tracing.String(tracing.AttrTask, task.Name))
+	data, err := vcertutil.RequestSshCertificate(enrollCtx, connectors, config, task.Request, publicKeyData)
+	var cert *ssh.Certificate
+	if err == nil {
+		cert, err = certificate.ParseSshCertificate(data.CertificateData)
+	}
+	if err == nil && !bytes.Equal(cert.Key.Marshal(), publicKey.Marshal()) {
+		err = fmt.Errorf("certificate was issued for another key")
+	}
+	span.Finish(err)
+	if err != nil {
+		return fail(TaskEnrollFailed, fmt.Errorf("error requesting SSH certificate %s: %w", task.Name, err))
+	}
+	zap.L().Info("successfully requested SSH certificate", zap.String("keyId", cert.KeyId))
+	result.After = newSshCertificateInfo(cert)
+
+	// Install the key pair, if generated, and the certificate next to the key
+	result.Status = TaskRenewed
+	_, span = tracing.Start(ctx, "playbook.install", tracing.String("vcert.installation.type", sshInstallationType),
+		tracing.String("vcert.installation.location", certFile))
+	err = installSshCertificate(task, privateKey, publicKeyData, data.CertificateData)
+	span.Finish(err)
+	if err != nil {
+		zap.L().Error("error installing SSH certificate", zap.String("location", certFile), zap.Error(err))
+		return fail(TaskInstallFailed, fmt.Errorf("error installing SSH certificate at location %s: %w", certFile, err))
+	}
+	zap.L().Info("successfully installed SSH certificate", zap.String("location", certFile))
+	installation.Status = InstallationInstalled
+
+	if task.AfterAction != "" {
+		_, actionSpan := tracing.Start(ctx, "playbook.after-action")
+		output, err := playbookutil.ExecuteScript(task.AfterAction)
+		actionSpan.Finish(err)
+		installation.AfterAction = newActionResult(task.AfterAction, output, err)
+		if err != nil {
+			return fail(TaskInstallFailed, fmt.Errorf("error running after-install actions at location %s: %w", certFile, err))
+		} else if strings.TrimSpace(output) == "1" {
+			zap.L().Info("after-install actions failed")
+		}
+		zap.L().Info("successfully executed after-install actions")
+	}
+
+	if task.Hooks == nil {
+		return result
+	}
+	event := newHookEvent(task.Name, result.After)
+	event.Type = sshInstallationType
+	event.Location = certFile
+	event.File = certFile
+	event.KeyFile = task.KeyFile
+	if len(task.Hooks.AfterInstall) > 0 {
+		err = runHooks(ctx, task.Hooks.AfterInstall, event, &installation.Hooks)
+		if err != nil {
+			return fail(TaskInstallFailed, fmt.Errorf("error running after-install hooks at location %s: %w", certFile, err))
+		}
+		zap.L().Info("successfully executed after-install hooks")
+	}
+	if len(task.Hooks.Validation) > 0 {
+		err = runHooks(ctx, task.Hooks.Validation, event, &installation.Hooks)
+		if err != nil {
+			return fail(TaskInstallFailed, fmt.Errorf("error running validation hooks at location %s: %w", certFile, err))
+		}
+		zap.L().Info("successfully executed validation hooks")
+	}
+	return result
+}
+
+// readSshPublicKey returns the content of the public key file of task and its key. Without the public key file, they
+// are derived from the private key. Both are empty when the private key doesn't exist either and task.GenerateKey is
+// set: an existing private key is never replaced by a generated one
+func readSshPublicKey(task domain.SshCertificateTask) (string, ssh.PublicKey, error) {
+	data, err := os.ReadFile(task.PublicKeyFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return deriveSshPublicKey(task)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse public key %s: %w", task.PublicKeyFile(), err)
+	}
+	return string(data), publicKey, nil
+}
+
+// deriveSshPublicKey returns the public key of the private key of task in the authorized_keys format, and its key.
+// Both are empty when the private key doesn't exist and task.GenerateKey is set
+func deriveSshPublicKey(task domain.SshCertificateTask) (string, ssh.PublicKey, error) {
+	data, err := os.ReadFile(task.KeyFile)
+	if errors.Is(err, os.ErrNotExist) && task.GenerateKey {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read public key %s or private key: %w", task.PublicKeyFile(), err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("public key %s is missing and it can't be derived from private key %s: %w",
+			task.PublicKeyFile(), task.KeyFile, err)
+	}
+	zap.L().Info("public key file is missing, using the public key of the private key",
+		zap.String("keyFile", task.KeyFile))
+	publicKey := signer.PublicKey()
+	return string(ssh.MarshalAuthorizedKey(publicKey)), publicKey, nil
+}
+
+// installedSshCertificate returns the certificate in certFile, or nil if there is none or it can't be read
+func installedSshCertificate(certFile string) *ssh.Certificate {
+	data, err := os.ReadFile(certFile)
+	if err == nil {
+		var cert *ssh.Certificate
+		cert, err = certificate.ParseSshCertificate(string(data))
+		if err == nil {
+			return cert
+		}
+	}
+	zap.L().Debug("could not read installed SSH certificate", zap.String("location", certFile), zap.Error(err))
+	return nil
+}
+
+// sshRenewalReason returns when the installed certificate cert enters its renew window and, if the SSH certificate of
+// task needs action, why. publicKey is the key of the task, nil when it is missing like cert. The renewal time is zero
+// when there is no certificate, it is valid forever or automatic renewal is disabled
+func sshRenewalReason(config domain.Config, task domain.SshCertificateTask, cert *ssh.Certificate, publicKey ssh.PublicKey) (time.Time, string) {
+	renewAt := time.Time{}
+	switch {
+	case publicKey == nil:
+		return renewAt, "no key pair installed"
+	case cert == nil:
+		return renewAt, "no certificate installed"
+	}
+
+	renewBefore := DefaultRenew
+	if task.RenewBefore != "" {
+		renewBefore = task.RenewBefore
+	}
+	notBefore, notAfter := sshTime(cert.ValidAfter), sshTime(cert.ValidBefore)
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		var err error
+		renewAt, err = util.RenewalTime(notBefore, notAfter, renewBefore)
+		if errors.Is(err, util.ErrRenewalDisabled) {
+			zap.L().Warn("automatic renewal of SSH certificate disabled", zap.String("task", task.Name),
+				zap.String("expirationDate", notAfter.String()))
+			renewAt = time.Time{}
+		} else if err != nil {
+			zap.L().Error("could not parse renewBefore value. Using default value [10%] instead",
+				zap.String("renewBefore", renewBefore), zap.Error(err))
+			renewAt, _ = util.RenewalTime(notBefore, notAfter, DefaultRenew)
+		}
+	}
+
+	now := time.Now()
+	switch {
+	case config.ForceRenew:
+		return renewAt, reasonForceRenew
+	case !renewAt.IsZero() && notAfter.Before(now):
+		return renewAt, fmt.Sprintf("certificate expired on %s", notAfter.UTC().Format(time.RFC3339))
+	case !renewAt.IsZero() && now.After(renewAt):
+		return renewAt, fmt.Sprintf("certificate in renew window since %s (renewBefore: %s)",
+			renewAt.UTC().Format(time.RFC3339), renewBefore)
+	case !bytes.Equal(cert.Key.Marshal(), publicKey.Marshal()):
+		return renewAt, "installed certificate doesn't match the key"
+	}
+
+	var drift []string
+	if task.Request.KeyID != "" && cert.KeyId != task.Request.KeyID {
+		drift = append(drift, fmt.Sprintf("key ID %q, requested %q", cert.KeyId, task.Request.KeyID))
+	}
+	if len(task.Request.Principals) > 0 && !samePrincipals(cert.ValidPrincipals, task.Request.Principals) {
+		drift = append(drift, fmt.Sprintf("principals %s, requested %s", strings.Join(cert.ValidPrincipals, ","),
+			strings.Join(task.Request.Principals, ",")))
+	}
+	if len(drift) > 0 {
+		return renewAt, "installed certificate doesn't match the request: " + strings.Join(drift, "; ")
+	}
+	return renewAt, ""
+}
+
+// samePrincipals returns true if a and b hold the same principals, in any order
+func samePrincipals(a []string, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// generateSshKeyPair generates a key pair of the key type and size of request, and returns its unencrypted private
+// key in the OpenSSH format, as sshd expects a host key, its public key in the authorized_keys format and its key
+func generateSshKeyPair(request domain.SshPlaybookRequest) ([]byte, string, ssh.PublicKey, error) {
+	keyType, keySize, err := util.ParseSshKeyType(request.KeyType)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if request.KeySize > 0 {
+		keySize = request.KeySize
+	}
+	privateKey, publicKeyData, err := util.GenerateSshKeyPairWithType(keyType, keySize, "", request.KeyID, util.OpenSshFormat)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKeyData)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return privateKey, string(publicKeyData), publicKey, nil
+}
+
+// installSshCertificate writes the certificate of task next to its key. The key pair is written first when it was
+// generated, privateKey being empty otherwise
+func installSshCertificate(task domain.SshCertificateTask, privateKey []byte, publicKeyData string, certificateData string) error {
+	if len(privateKey) > 0 {
+		err := playbookutil.WriteFileWithOptions(task.KeyFile, privateKey,
+			playbookutil.FileOptions{Mode: sshPrivateKeyMode})
+		if err != nil {
+			return err
+		}
+		err = playbookutil.WriteFileWithOptions(task.PublicKeyFile(), []byte(publicKeyData),
+			playbookutil.FileOptions{Mode: sshPublicFileMode})
+		if err != nil {
+			return err
+		}
+	}
+	return playbookutil.WriteFileWithOptions(task.CertificateFile(), []byte(certificateData),
+		playbookutil.FileOptions{Mode: sshPublicFileMode})
+}
+
+// newSshCertificateInfo identifies an SSH certificate in a report: its key ID as common name and its SHA256
+// fingerprint as thumbprint. The NotAfter of a certificate valid forever is zero
+func newSshCertificateInfo(cert *ssh.Certificate) *CertificateInfo {
+	if cert == nil {
+		return nil
+	}
+	details := certificate.NewSshCertificateDetails(cert)
+	info := &CertificateInfo{
+		CommonName: details.KeyID,
+		Serial:     details.SerialNumber,
+		Thumbprint: details.CertificateFingerprintSHA256,
+		NotBefore:  sshTime(cert.ValidAfter),
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		info.NotAfter = sshTime(cert.ValidBefore)
+	}
+	return info
+}
+
+// sshTime returns the time of an SSH certificate timestamp
+func sshTime(timestamp uint64) time.Time {
+	if timestamp > math.MaxInt64 {
+		timestamp = math.MaxInt64
+	}
+	return time.Unix(int64(timestamp), 0)
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+func sshTask(name string, dir string) domain.SshCertificateTask {
+	return domain.SshCertificateTask{
+		Name: name,
+		Request: domain.SshPlaybookRequest{
+			Template:       "host-template",
+			KeyID:          name,
+			Principals:     []string{name + ".vcert.test"},
+			ValidityPeriod: "30d",
+			KeyType:        "ed25519",
+		},
+		KeyFile:     filepath.Join(dir, "ssh_host_ed25519_key"),
+		GenerateKey: true,
+		RenewBefore: "7d",
+		AfterAction: "echo reload >> " + filepath.Join(dir, "reloads"),
+	}
+}
+
+func readSshCertificate(t *testing.T, file string) *ssh.Certificate {
+	t.Helper()
+	cert, err := certificate.ParseSshCertificate(readFile(t, file))
+	require.NoError(t, err)
+	return cert
+}
+
+func TestRun_SshCertificateTask(t *testing.T) {
+	dir := t.TempDir()
+	task := sshTask("web01", dir)
+	playbook := domain.Playbook{SshCertificateTasks: domain.SshCertificateTasks{task}}
+
+	results := Run(playbook)
+	require.Len(t, results, 1)
+	require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+	assert.Equal(t, "no key pair installed", results[0].Reason)
+	assert.Equal(t, InstallationInstalled, results[0].Installations[0].Status)
+	assert.Equal(t, task.CertificateFile(), results[0].Installations[0].Location)
+	assert.True(t, results[0].Installations[0].AfterAction.Success)
+
+	cert := readSshCertificate(t, filepath.Join(dir, "ssh_host_ed25519_key-cert.pub"))
+	assert.Equal(t, uint32(ssh.HostCert), cert.CertType)
+	assert.Equal(t, []string{"web01.vcert.test"}, cert.ValidPrincipals)
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(readFile(t, task.PublicKeyFile())))
+	require.NoError(t, err)
+	assert.Equal(t, publicKey.Marshal(), cert.Key.Marshal())
+	_, err = ssh.ParseRawPrivateKey([]byte(readFile(t, task.KeyFile)))
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(task.KeyFile)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// the certificate is valid: nothing to do
+	issued := results[0].After
+	results = Run(playbook)
+	require.Equal(t, TaskUnchanged, results[0].Status, results[0].Errors)
+	assert.Equal(t, issued.Serial, results[0].Before.Serial)
+
+	// the principals changed: the certificate is renewed for the same key
+	privateKey := readFile(t, task.KeyFile)
+	task.Request.Principals = append(task.Request.Principals, "www.vcert.test")
+	playbook.SshCertificateTasks = domain.SshCertificateTasks{task}
+	results = Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+	assert.Contains(t, results[0].Reason, "principals")
+	assert.Equal(t, privateKey, readFile(t, task.KeyFile))
+
+	// the certificate enters its renew window
+	task.RenewBefore = "31d"
+	playbook.SshCertificateTasks = domain.SshCertificateTasks{task}
+	results = Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+	assert.Contains(t, results[0].Reason, "renew window")
+	assert.Equal(t, "reload\nreload\nreload\n", readFile(t, filepath.Join(dir, "reloads")))
+}
+
+func TestRun_SshCertificateTaskMissingPublicKey(t *testing.T) {
+	dir := t.TempDir()
+	task := sshTask("web03", dir)
+	task.AfterAction = ""
+	privateKey, publicKey, err := util.GenerateSshKeyPairWithType(util.SshKeyTypeEd25519, 0, "", "web03",
+		util.OpenSshFormat)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(task.KeyFile, privateKey, 0600))
+
+	// the existing private key is kept, and the certificate issued for its public key
+	playbook := domain.Playbook{SshCertificateTasks: domain.SshCertificateTasks{task}}
+	results := Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+	assert.Equal(t, string(privateKey), readFile(t, task.KeyFile))
+	key, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	require.NoError(t, err)
+	cert := readSshCertificate(t, task.CertificateFile())
+	assert.Equal(t, key.Marshal(), cert.Key.Marshal())
+
+	// a private key the public key can't be derived from fails the task, and is kept too
+	encrypted, _, err := util.GenerateSshKeyPairWithType(util.SshKeyTypeEd25519, 0, "secret", "web03",
+		util.OpenSshFormat)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(task.KeyFile, encrypted, 0600))
+	require.NoError(t, os.Remove(task.CertificateFile()))
+	results = Run(playbook)
+	require.Equal(t, TaskFailed, results[0].Status)
+	assert.Equal(t, string(encrypted), readFile(t, task.KeyFile))
+	assert.NoFileExists(t, task.CertificateFile())
+}
+
+func TestRun_SshCertificateTaskExistingKey(t *testing.T) {
+	dir := t.TempDir()
+	task := sshTask("web02", dir)
+	task.GenerateKey = false
+	task.AfterAction = ""
+
+	playbook := domain.Playbook{SshCertificateTasks: domain.SshCertificateTasks{task}}
+	results := Run(playbook)
+	require.Equal(t, TaskFailed, results[0].Status)
+	assert.NoFileExists(t, task.CertificateFile())
+
+	_, publicKey, err := util.GenerateSshKeyPairWithType(util.SshKeyTypeRSA, 2048, "", "web02")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(task.PublicKeyFile(), publicKey, 0644))
+
+	results = Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+	assert.Equal(t, "no certificate installed", results[0].Reason)
+	assert.Equal(t, string(publicKey), readFile(t, task.PublicKeyFile()))
+	assert.NoFileExists(t, task.KeyFile)
+	cert := readSshCertificate(t, task.CertificateFile())
+	assert.Equal(t, "web02", cert.KeyId)
+
+	// the key was replaced: the certificate doesn't match it anymore
+	_, publicKey, err = util.GenerateSshKeyPairWithType(util.SshKeyTypeEd25519, 0, "", "web02")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(task.PublicKeyFile(), publicKey, 0644))
+	plans := Plan(playbook)
+	require.Len(t, plans, 1)
+	assert.Equal(t, PlanRenew, plans[0].Action)
+	assert.Equal(t, "installed certificate doesn't match the key", plans[0].Reason)
+
+	results = Run(playbook)
+	require.Equal(t, TaskRenewed, results[0].Status, results[0].Errors)
+	plans = Plan(playbook)
+	assert.Equal(t, PlanSkip, plans[0].Action)
+	assert.False(t, plans[0].Installations[0].RenewAt.IsZero())
+}
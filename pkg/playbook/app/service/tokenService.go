@@ -23,14 +23,70 @@ import (
 
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/parser"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vault"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/vcertutil"
 )
 
+// ReadVaultCredentials sets the credentials of playbook from the Vault secret of config.connection.credentials.vault,
+// if any.
+//
+// The keys of the secret are the ones of the credentials block: accessToken, apiKey, clientId, clientSecret,
+// externalJWT and refreshToken. The refreshed tokens are written to the secret, so its accessToken and refreshToken win
+// over the ones of the playbook file, which would be stale. The other credentials are only read from the secret when
+// the playbook file doesn't set them
+func ReadVaultCredentials(playbook *domain.Playbook) error {
+	credentials := &playbook.Config.Connection.Credentials
+	if credentials.Vault == nil {
+		return nil
+	}
+
+	client, err := vault.NewClient(credentials.Vault.Vault)
+	if err != nil {
+		return err
+	}
+	data, err := client.ReadSecret(*credentials.Vault)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials from vault: %w", err)
+	}
+
+	refreshed := map[string]*string{
+		"accessToken":  &credentials.AccessToken,
+		"refreshToken": &credentials.RefreshToken,
+	}
+	for key, field := range refreshed {
+		value, ok := data[key].(string)
+		if !ok || value == "" {
+			continue
+		}
+		if *field != "" && *field != value {
+			zap.L().Warn("credential of the playbook file ignored, the one of vault is used", zap.String("key", key),
+				zap.String("path", credentials.Vault.String()))
+		}
+		*field = value
+	}
+
+	fields := map[string]*string{
+		"apiKey":       &credentials.APIKey,
+		"clientId":     &credentials.ClientId,
+		"clientSecret": &credentials.ClientSecret,
+		"externalJWT":  &credentials.ExternalJWT,
+	}
+	for key, field := range fields {
+		value, ok := data[key].(string)
+		if ok && *field == "" {
+			*field = value
+		}
+	}
+	zap.L().Info("credentials read from vault", zap.String("path", credentials.Vault.String()))
+	return nil
+}
+
 // ValidateTPPCredentials checks that the TPP credentials are not expired.
 //
 // If expired, it will try to get a new token pair using the refreshToken.
 //
-// If the refreshing is successful it will save the new token pair in the playbook file.
+// If the refreshing is successful it will save the new token pair in the playbook file, or in the Vault secret of the
+// credentials when there is one.
 func ValidateTPPCredentials(playbook *domain.Playbook) error {
 	//Validate TPP tokens
 	if playbook.Config.Connection.Credentials.AccessToken != "" {
@@ -51,6 +107,10 @@ func ValidateTPPCredentials(playbook *domain.Playbook) error {
 
 	zap.L().Info("using refresh token")
 
+	if playbook.Config.Connection.Credentials.Vault != nil {
+		return refreshTokensInVault(playbook)
+	}
+
 	// Read the playbook first, to make sure we can, before refreshing the tokens
 	// and blowing things up!
 	pbData, err := parser.ReadPlaybookRaw(playbook.Location)
@@ -83,6 +143,35 @@ func ValidateTPPCredentials(playbook *domain.Playbook) error {
 	return nil
 }
 
+// refreshTokensInVault refreshes the TPP tokens of playbook and writes them to the Vault secret of its credentials
+func refreshTokensInVault(playbook *domain.Playbook) error {
+	credentials := &playbook.Config.Connection.Credentials
+	client, err := vault.NewClient(credentials.Vault.Vault)
+	if err != nil {
+		return err
+	}
+
+	accessToken, refreshToken, err := vcertutil.RefreshTPPTokens(playbook.Config)
+	if err != nil {
+		zap.L().Error("failed to refresh TPP Tokens", zap.Error(err))
+		return err
+	}
+	zap.L().Info("successfully retrieved new refresh token")
+
+	credentials.AccessToken = accessToken
+	credentials.RefreshToken = refreshToken
+
+	err = client.UpdateSecret(*credentials.Vault, map[string]interface{}{
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
+	})
+	if err != nil {
+		zap.L().Error("failed to write new tokens to vault", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
 func replaceTokensInFile(playbook map[string]interface{}, accessToken string, refreshToken string) error {
 
 	if playbook == nil {
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vault"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vault/vaulttest"
+)
+
+func TestReadVaultCredentials(t *testing.T) {
+	server := vaulttest.NewServer()
+	defer server.Close()
+	server.Put(vaulttest.MountV2+"/vcert/tpp", map[string]interface{}{
+		"accessToken":  "vault-access-token",
+		"refreshToken": "vault-refresh-token",
+		"clientId":     "vault-client-id",
+	})
+
+	playbook := domain.NewPlaybook()
+	playbook.Config.Connection.Credentials = domain.Authentication{
+		Authentication: endpoint.Authentication{ClientId: "vcert-sdk", RefreshToken: "stale-refresh-token"},
+		Vault: &domain.VaultSecret{
+			Vault: domain.Vault{
+				Address: server.URL,
+				Auth:    domain.VaultAuth{RoleID: vaulttest.RoleID, SecretID: vaulttest.SecretID},
+			},
+			Path: vaulttest.MountV2 + "/vcert/tpp",
+		},
+	}
+	require.NoError(t, ReadVaultCredentials(&playbook))
+
+	// The tokens of the secret, where they are refreshed, win over the ones of the playbook. The other credentials set
+	// in the playbook win over the ones of the secret
+	credentials := playbook.Config.Connection.Credentials
+	assert.Equal(t, "vault-access-token", credentials.AccessToken)
+	assert.Equal(t, "vault-refresh-token", credentials.RefreshToken)
+	assert.Equal(t, "vcert-sdk", credentials.ClientId)
+	assert.Empty(t, credentials.APIKey)
+
+	playbook.Config.Connection.Credentials.Vault.Path = vaulttest.MountV2 + "/vcert/missing"
+	err := ReadVaultCredentials(&playbook)
+	assert.ErrorIs(t, err, vault.ErrNotFound)
+
+	// Nothing to do without a vault block
+	playbook = domain.NewPlaybook()
+	assert.NoError(t, ReadVaultCredentials(&playbook))
+}
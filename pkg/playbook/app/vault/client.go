@@ -0,0 +1,249 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package vault reads and writes the secrets of the KV secrets engine of a HashiCorp Vault server
+package vault
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+const (
+	// serviceAccountToken is the token of the service account of a pod, used by the kubernetes auth method
+	serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	envAddress    = "VAULT_ADDR"
+	envCACert     = "VAULT_CACERT"
+	envK8sRole    = "VAULT_K8S_ROLE"
+	envNamespace  = "VAULT_NAMESPACE"
+	envRoleID     = "VAULT_ROLE_ID"
+	envSecretID   = "VAULT_SECRET_ID"
+	envSkipVerify = "VAULT_SKIP_VERIFY"
+	envToken      = "VAULT_TOKEN"
+)
+
+var (
+	// ErrNotFound is returned when the secret doesn't exist
+	ErrNotFound = errors.New("vault secret not found")
+	// ErrNoAddress is returned when the address of the Vault server isn't set
+	ErrNoAddress = fmt.Errorf("no vault address defined. Set vault.address or %s", envAddress)
+	// ErrNoAuth is returned when no auth method can be guessed
+	ErrNoAuth = fmt.Errorf("no vault credentials defined. Set vault.auth or one of %s, %s or %s", envToken, envRoleID,
+		envK8sRole)
+)
+
+// Client is logged in to a Vault server
+type Client struct {
+	address   string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+// NewClient logs in to the Vault server of config
+func NewClient(config domain.Vault) (*Client, error) {
+	config = withEnv(config)
+	if config.Address == "" {
+		return nil, ErrNoAddress
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// #nosec G402 -- set explicitly in the playbook or with VAULT_SKIP_VERIFY
+		InsecureSkipVerify: config.Insecure,
+	}
+	if config.CACert != "" {
+		ca, err := os.ReadFile(config.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to parse vault CA certificate %s", config.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	c := &Client{
+		address:   strings.TrimSuffix(config.Address, "/"),
+		namespace: config.Namespace,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+	err := c.login(config.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// withEnv returns config with the empty values set from the environment
+func withEnv(config domain.Vault) domain.Vault {
+	setFromEnv := func(value *string, env string) {
+		if *value == "" {
+			*value = os.Getenv(env)
+		}
+	}
+	setFromEnv(&config.Address, envAddress)
+	setFromEnv(&config.CACert, envCACert)
+	setFromEnv(&config.Namespace, envNamespace)
+	if !config.Insecure {
+		config.Insecure, _ = strconv.ParseBool(os.Getenv(envSkipVerify))
+	}
+
+	auth := &config.Auth
+	if auth.Method == "" {
+		switch {
+		case auth.Token != "":
+			auth.Method = domain.VaultAuthToken
+		case auth.RoleID != "":
+			auth.Method = domain.VaultAuthAppRole
+		case auth.Role != "":
+			auth.Method = domain.VaultAuthKubernetes
+		case os.Getenv(envToken) != "":
+			auth.Method = domain.VaultAuthToken
+		case os.Getenv(envRoleID) != "":
+			auth.Method = domain.VaultAuthAppRole
+		case os.Getenv(envK8sRole) != "":
+			auth.Method = domain.VaultAuthKubernetes
+		}
+	}
+	switch auth.Method {
+	case domain.VaultAuthToken:
+		setFromEnv(&auth.Token, envToken)
+	case domain.VaultAuthAppRole:
+		setFromEnv(&auth.RoleID, envRoleID)
+		setFromEnv(&auth.SecretID, envSecretID)
+	case domain.VaultAuthKubernetes:
+		setFromEnv(&auth.Role, envK8sRole)
+		if auth.JWTFile == "" {
+			auth.JWTFile = serviceAccountToken
+		}
+	}
+	if auth.Mount == "" {
+		auth.Mount = auth.Method
+	}
+	return config
+}
+
+func (c *Client) login(auth domain.VaultAuth) error {
+	var body map[string]string
+	switch auth.Method {
+	case domain.VaultAuthToken:
+		if auth.Token == "" {
+			return ErrNoAuth
+		}
+		c.token = auth.Token
+		return nil
+	case domain.VaultAuthAppRole:
+		body = map[string]string{"role_id": auth.RoleID, "secret_id": auth.SecretID}
+	case domain.VaultAuthKubernetes:
+		jwt, err := os.ReadFile(auth.JWTFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the service account token for vault: %w", err)
+		}
+		body = map[string]string{"role": auth.Role, "jwt": strings.TrimSpace(string(jwt))}
+	case "":
+		return ErrNoAuth
+	default:
+		return domain.ErrInvalidVaultAuthMethod
+	}
+
+	var res struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	err := c.do(http.MethodPost, "auth/"+strings.Trim(auth.Mount, "/")+"/login", body, &res)
+	if err != nil {
+		return fmt.Errorf("failed to log in to vault with %s: %w", auth.Method, err)
+	}
+	if res.Auth.ClientToken == "" {
+		return fmt.Errorf("failed to log in to vault with %s: no token returned", auth.Method)
+	}
+	c.token = res.Auth.ClientToken
+	return nil
+}
+
+// do sends a request to the path of the Vault API and decodes the data of the response in out
+func (c *Client) do(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.address+"/v1/"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-Vault-Token", c.token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return ErrNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		if json.Unmarshal(data, &vaultErr) != nil || len(vaultErr.Errors) == 0 {
+			vaultErr.Errors = []string{strings.TrimSpace(string(data))}
+		}
+		return fmt.Errorf("vault answered %s to %s %s: %s", res.Status, method, req.URL.Path,
+			strings.Join(vaultErr.Errors, "; "))
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
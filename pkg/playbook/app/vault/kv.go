@@ -0,0 +1,157 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+// Resolve returns secret with its Mount and KVVersion set, and its Path relative to the mount. The ones not set in
+// the playbook are detected from the server, the same way the Vault CLI does
+func (c *Client) Resolve(secret domain.VaultSecret) (domain.VaultSecret, error) {
+	secret.Path = strings.Trim(secret.Path, "/")
+	if secret.Mount != "" && secret.KVVersion != 0 {
+		secret.Mount = strings.Trim(secret.Mount, "/")
+		return secret, nil
+	}
+
+	var res struct {
+		Data struct {
+			Path    string `json:"path"`
+			Options struct {
+				Version string `json:"version"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+	err := c.do(http.MethodGet, "sys/internal/ui/mounts/"+secret.String(), nil, &res)
+	if err != nil {
+		return secret, fmt.Errorf("failed to detect the KV mount of %s, set vault.mount and vault.kvVersion: %w",
+			secret.String(), err)
+	}
+
+	mount := strings.Trim(res.Data.Path, "/")
+	if secret.Mount == "" {
+		if secret.Path != mount && !strings.HasPrefix(secret.Path, mount+"/") {
+			return secret, fmt.Errorf("vault secret %s is not in mount %s", secret.Path, mount)
+		}
+		secret.Path = strings.TrimPrefix(strings.TrimPrefix(secret.Path, mount), "/")
+		secret.Mount = mount
+	}
+	if secret.KVVersion == 0 {
+		secret.KVVersion = 1
+		if res.Data.Options.Version == "2" {
+			secret.KVVersion = 2
+		}
+	}
+	return secret, nil
+}
+
+// ReadSecret returns the data of the latest version of secret, or ErrNotFound
+func (c *Client) ReadSecret(secret domain.VaultSecret) (map[string]interface{}, error) {
+	secret, err := c.Resolve(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = c.do(http.MethodGet, dataPath(secret), nil, &res)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, secret.String())
+		}
+		return nil, err
+	}
+	if secret.KVVersion == 1 {
+		return res.Data, nil
+	}
+
+	// KV v2 returns the data and the metadata of the version. Deleted versions have no data
+	data, _ := res.Data["data"].(map[string]interface{})
+	if data == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, secret.String())
+	}
+	return data, nil
+}
+
+// ReadString returns the value of key in secret
+func (c *Client) ReadString(secret domain.VaultSecret, key string) (string, error) {
+	data, err := c.ReadSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	value, found := data[key]
+	if !found {
+		return "", fmt.Errorf("key %s not found in vault secret %s", key, secret.String())
+	}
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Sprint(value), nil
+	}
+	return s, nil
+}
+
+// UpdateSecret sets the values of data in secret, keeping its other values. The secret is created if it doesn't
+// exist. With KV v2, this writes a new version of the secret
+func (c *Client) UpdateSecret(secret domain.VaultSecret, data map[string]interface{}) error {
+	secret, err := c.Resolve(secret)
+	if err != nil {
+		return err
+	}
+
+	current, err := c.ReadSecret(secret)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	merged := make(map[string]interface{}, len(current)+len(data))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range data {
+		merged[k] = v
+	}
+
+	var body interface{} = merged
+	if secret.KVVersion == 2 {
+		body = map[string]interface{}{"data": merged}
+	}
+	return c.do(http.MethodPost, dataPath(secret), body, nil)
+}
+
+// dataPath returns the API path of the data of a resolved secret
+// DeleteSecret deletes secret. With KV v2, this deletes its latest version, the previous ones are kept. A secret that
+// doesn't exist is not an error
+func (c *Client) DeleteSecret(secret domain.VaultSecret) error {
+	secret, err := c.Resolve(secret)
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodDelete, dataPath(secret), nil, nil)
+}
+
+func dataPath(secret domain.VaultSecret) string {
+	if secret.KVVersion == 2 {
+		return secret.Mount + "/data/" + secret.Path
+	}
+	return secret.Mount + "/" + secret.Path
+}
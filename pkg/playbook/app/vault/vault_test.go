@@ -0,0 +1,141 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/vault/vaulttest"
+)
+
+func TestNewClient_Auth(t *testing.T) {
+	server := vaulttest.NewServer()
+	defer server.Close()
+	for _, env := range []string{envAddress, envToken, envRoleID, envSecretID, envK8sRole} {
+		t.Setenv(env, "")
+	}
+
+	jwtFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(jwtFile, []byte(vaulttest.K8sJWT+"\n"), 0600))
+
+	tests := []struct {
+		name  string
+		auth  domain.VaultAuth
+		env   map[string]string
+		token string
+		err   string
+	}{
+		{name: "Token", auth: domain.VaultAuth{Token: vaulttest.Token}, token: vaulttest.Token},
+		{name: "TokenFromEnv", env: map[string]string{envToken: vaulttest.Token}, token: vaulttest.Token},
+		{
+			name:  "AppRole",
+			auth:  domain.VaultAuth{RoleID: vaulttest.RoleID, SecretID: vaulttest.SecretID},
+			token: "token-approle/login",
+		},
+		{
+			name:  "AppRoleFromEnv",
+			env:   map[string]string{envRoleID: vaulttest.RoleID, envSecretID: vaulttest.SecretID},
+			token: "token-approle/login",
+		},
+		{
+			name:  "Kubernetes",
+			auth:  domain.VaultAuth{Method: domain.VaultAuthKubernetes, Role: vaulttest.K8sRole, JWTFile: jwtFile},
+			token: "token-kubernetes/login",
+		},
+		{
+			name: "BadSecretID",
+			auth: domain.VaultAuth{RoleID: vaulttest.RoleID, SecretID: "wrong"},
+			err:  "failed to log in to vault with approle",
+		},
+		{name: "NoAuth", err: ErrNoAuth.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			c, err := NewClient(domain.Vault{Address: server.URL, Auth: tt.auth})
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.token, c.token)
+		})
+	}
+
+	_, err := NewClient(domain.Vault{Auth: domain.VaultAuth{Token: vaulttest.Token}})
+	assert.ErrorIs(t, err, ErrNoAddress)
+}
+
+func TestClient_KV(t *testing.T) {
+	server := vaulttest.NewServer()
+	defer server.Close()
+	c, err := NewClient(domain.Vault{Address: server.URL, Auth: domain.VaultAuth{Token: vaulttest.Token}})
+	require.NoError(t, err)
+
+	for _, mount := range []string{vaulttest.MountV1, vaulttest.MountV2} {
+		t.Run(mount, func(t *testing.T) {
+			secret := domain.VaultSecret{Path: mount + "/vcert/tpp"}
+
+			resolved, err := c.Resolve(secret)
+			require.NoError(t, err)
+			assert.Equal(t, mount, resolved.Mount)
+			assert.Equal(t, "vcert/tpp", resolved.Path)
+
+			_, err = c.ReadSecret(secret)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			server.Put(mount+"/vcert/tpp", map[string]interface{}{"refreshToken": "abc", "port": 443})
+			value, err := c.ReadString(secret, "refreshToken")
+			require.NoError(t, err)
+			assert.Equal(t, "abc", value)
+			value, err = c.ReadString(secret, "port")
+			require.NoError(t, err)
+			assert.Equal(t, "443", value)
+			_, err = c.ReadString(secret, "missing")
+			assert.Error(t, err)
+
+			// Other values of the secret are kept
+			err = c.UpdateSecret(secret, map[string]interface{}{"refreshToken": "def", "accessToken": "ghi"})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"refreshToken": "def", "accessToken": "ghi", "port": float64(443)},
+				server.Get(mount+"/vcert/tpp"))
+
+			// An explicit mount makes the path relative to it
+			value, err = c.ReadString(domain.VaultSecret{Mount: mount, Path: "vcert/tpp"}, "accessToken")
+			require.NoError(t, err)
+			assert.Equal(t, "ghi", value)
+
+			// Deleting a secret twice is not an error
+			require.NoError(t, c.DeleteSecret(secret))
+			_, err = c.ReadSecret(secret)
+			assert.ErrorIs(t, err, ErrNotFound)
+			require.NoError(t, c.DeleteSecret(secret))
+		})
+	}
+
+	_, err = c.Resolve(domain.VaultSecret{Path: "unknown/vcert"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package vaulttest provides an in-memory HashiCorp Vault server for tests
+package vaulttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const (
+	// Token is the root token of the server
+	Token = "root-token"
+	// RoleID and SecretID log in with the approle auth method
+	RoleID   = "test-role-id"
+	SecretID = "test-secret-id"
+	// K8sRole and K8sJWT log in with the kubernetes auth method
+	K8sRole = "vcert"
+	K8sJWT  = "test-service-account-token"
+
+	// MountV1 and MountV2 are the paths of a KV v1 and a KV v2 secrets engine
+	MountV1 = "kv"
+	MountV2 = "secret"
+)
+
+// Server is an in-memory Vault server with a KV v1 engine at MountV1, a KV v2 engine at MountV2, and the approle and
+// kubernetes auth methods
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	secrets  map[string][]map[string]interface{}
+	tokens   map[string]bool
+	Requests []string
+}
+
+// NewServer starts a Server. Close it when done
+func NewServer() *Server {
+	s := &Server{
+		secrets: map[string][]map[string]interface{}{},
+		tokens:  map[string]bool{Token: true},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Put sets the data of the secret at path, which starts with the mount
+func (s *Server) Put(path string, data map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[path] = append(s.secrets[path], data)
+}
+
+// Get returns the latest data of the secret at path, which starts with the mount
+func (s *Server) Get(path string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := s.secrets[path]
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions[len(versions)-1]
+}
+
+// Versions returns the number of versions of the secret at path
+func (s *Server) Versions(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.secrets[path])
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	s.Requests = append(s.Requests, r.Method+" "+path)
+
+	if strings.HasPrefix(path, "auth/") {
+		s.login(w, r, path)
+		return
+	}
+	if !s.tokens[r.Header.Get("X-Vault-Token")] {
+		writeError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "sys/internal/ui/mounts/"):
+		path = strings.TrimPrefix(path, "sys/internal/ui/mounts/")
+		mount, version := "", ""
+		switch {
+		case path == MountV1 || strings.HasPrefix(path, MountV1+"/"):
+			mount, version = MountV1, "1"
+		case path == MountV2 || strings.HasPrefix(path, MountV2+"/"):
+			mount, version = MountV2, "2"
+		default:
+			writeError(w, http.StatusBadRequest, "no handler for route")
+			return
+		}
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+			"path": mount + "/", "type": "kv", "options": map[string]string{"version": version},
+		}})
+	case strings.HasPrefix(path, MountV1+"/"):
+		s.kv(w, r, path, false)
+	case strings.HasPrefix(path, MountV2+"/data/"):
+		s.kv(w, r, MountV2+"/"+strings.TrimPrefix(path, MountV2+"/data/"), true)
+	default:
+		writeError(w, http.StatusNotFound, "no handler for route")
+	}
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request, path string) {
+	var body map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	ok := false
+	switch path {
+	case "auth/approle/login":
+		ok = body["role_id"] == RoleID && body["secret_id"] == SecretID
+	case "auth/kubernetes/login":
+		ok = body["role"] == K8sRole && body["jwt"] == K8sJWT
+	}
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid credentials")
+		return
+	}
+	token := "token-" + strings.TrimPrefix(path, "auth/")
+	s.tokens[token] = true
+	writeJSON(w, map[string]interface{}{"auth": map[string]string{"client_token": token}})
+}
+
+func (s *Server) kv(w http.ResponseWriter, r *http.Request, path string, v2 bool) {
+	switch r.Method {
+	case http.MethodGet:
+		versions := s.secrets[path]
+		if len(versions) == 0 {
+			writeError(w, http.StatusNotFound, "")
+			return
+		}
+		data := versions[len(versions)-1]
+		if v2 {
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+				"data": data, "metadata": map[string]int{"version": len(versions)},
+			}})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"data": data})
+	case http.MethodPost, http.MethodPut:
+		var body map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if v2 {
+			data, ok := body["data"].(map[string]interface{})
+			if !ok {
+				writeError(w, http.StatusBadRequest, "no data provided")
+				return
+			}
+			body = data
+		}
+		s.secrets[path] = append(s.secrets[path], body)
+		if v2 {
+			writeJSON(w, map[string]interface{}{"data": map[string]int{"version": len(s.secrets[path])}})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		// KV v2 deletes the latest version only
+		versions := s.secrets[path]
+		if v2 && len(versions) > 0 {
+			versions[len(versions)-1] = nil
+		} else {
+			delete(s.secrets, path)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	errs := []string{}
+	if message != "" {
+		errs = append(errs, message)
+	}
+	_ = json.NewEncoder(w).Encode(map[string][]string{"errors": errs})
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcertutil
+
+import (
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
+)
+
+// zoneConnector is implemented by the connectors that can be copied to work on another zone without authenticating
+// again
+type zoneConnector interface {
+	WithZone(zone string) endpoint.Connector
+}
+
+// ConnectorCache shares one authenticated connector per connection among the certificate tasks of a playbook run,
+// so the platform is authenticated against once instead of once per task.
+//
+// It is safe for concurrent use. A nil *ConnectorCache doesn't cache anything: every call builds and authenticates a
+// new connector.
+type ConnectorCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedConnector
+}
+
+type cachedConnector struct {
+	mu        sync.Mutex
+	connector endpoint.Connector
+}
+
+// NewConnectorCache returns an empty ConnectorCache
+func NewConnectorCache() *ConnectorCache {
+	return &ConnectorCache{entries: make(map[string]*cachedConnector)}
+}
+
+// Get returns a connector to the platform defined by config, working on zone. Only the first call for a connection
+// authenticates, the following ones get a copy of that connector set to their zone.
+func (c *ConnectorCache) Get(config domain.Config, zone string, timeout int) (endpoint.Connector, error) {
+	if c == nil {
+		return buildClient(config, zone, timeout)
+	}
+
+	// the timeout is part of the HTTP client of the connector, so connectors with different timeouts can't be shared
+	key := fmt.Sprintf("%s|%s|%d", config.Connection.Platform, config.Connection.URL, timeout)
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cachedConnector{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	// tasks of the same connection wait here while the first one authenticates
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.connector != nil {
+		return entry.connector.(zoneConnector).WithZone(zone), nil
+	}
+
+	client, err := buildClient(config, zone, timeout)
+	if err != nil {
+		// failures are not cached, the next task tries to authenticate again
+		return nil, err
+	}
+	if _, ok = client.(zoneConnector); !ok {
+		return client, nil
+	}
+	zap.L().Debug("sharing authenticated connector", zap.String("platform", config.Connection.Platform.String()))
+	entry.connector = client
+	return client.(zoneConnector).WithZone(zone), nil
+}
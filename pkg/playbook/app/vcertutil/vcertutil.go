@@ -17,6 +17,7 @@
 package vcertutil
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
@@ -26,6 +27,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -33,6 +35,7 @@ import (
 	"github.com/Venafi/vcert/v5"
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 	"github.com/Venafi/vcert/v5/pkg/playbook/app/domain"
 	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/Venafi/vcert/v5/pkg/venafi/tpp"
@@ -43,20 +46,27 @@ import (
 //
 // Then it retrieves the certificate and returns it along with the certificate chain and the private key used.
 func EnrollCertificate(config domain.Config, request domain.PlaybookRequest) (*certificate.PEMCollection, *certificate.Request, error) {
-	client, err := buildClient(config, request.Zone, request.Timeout)
+	return EnrollCertificateWithCache(context.Background(), nil, config, request)
+}
+
+// EnrollCertificateWithCache is like EnrollCertificate but gets the connector from connectors, so the authentication
+// to the Venafi platform is shared with the other tasks of the playbook. ctx is passed to the connector operations, so
+// they are traced as children of its span.
+func EnrollCertificateWithCache(ctx context.Context, connectors *ConnectorCache, config domain.Config, request domain.PlaybookRequest) (*certificate.PEMCollection, *certificate.Request, error) {
+	client, err := getContextClient(connectors, config, request.Zone, request.Timeout)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	vRequest := buildRequest(request)
 
-	zoneCfg, err := client.ReadZoneConfiguration()
+	zoneCfg, err := client.ReadZoneConfigurationContext(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
 	zap.L().Debug("successfully read zone config", zap.String("zone", request.Zone))
 
-	err = client.GenerateRequest(zoneCfg, &vRequest)
+	err = client.GenerateRequestContext(ctx, zoneCfg, &vRequest)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -65,9 +75,9 @@ func EnrollCertificate(config domain.Config, request domain.PlaybookRequest) (*c
 	var pcc *certificate.PEMCollection
 
 	if client.SupportSynchronousRequestCertificate() {
-		pcc, err = client.SynchronousRequestCertificate(&vRequest)
+		pcc, err = client.SynchronousRequestCertificateContext(ctx, &vRequest)
 	} else {
-		reqID, reqErr := client.RequestCertificate(&vRequest)
+		reqID, reqErr := client.RequestCertificateContext(ctx, &vRequest)
 		if reqErr != nil {
 			return nil, nil, reqErr
 		}
@@ -75,7 +85,7 @@ func EnrollCertificate(config domain.Config, request domain.PlaybookRequest) (*c
 
 		vRequest.PickupID = reqID
 
-		pcc, err = client.RetrieveCertificate(&vRequest)
+		pcc, err = client.RetrieveCertificateContext(ctx, &vRequest)
 	}
 
 	if err != nil {
@@ -86,6 +96,128 @@ func EnrollCertificate(config domain.Config, request domain.PlaybookRequest) (*c
 	return pcc, &vRequest, nil
 }
 
+// ValidateRequest checks request against the policy of its zone without requesting a certificate. It authenticates
+// to the Venafi platform defined by config, reads the zone configuration and validates the request with it.
+//
+// Requests not allowed by the policy return an error wrapping verror.PolicyValidationError.
+func ValidateRequest(ctx context.Context, connectors *ConnectorCache, config domain.Config, request domain.PlaybookRequest) error {
+	client, err := getContextClient(connectors, config, request.Zone, request.Timeout)
+	if err != nil {
+		return err
+	}
+
+	zoneCfg, err := client.ReadZoneConfigurationContext(ctx)
+	if err != nil {
+		return err
+	}
+	zap.L().Debug("successfully read zone config", zap.String("zone", request.Zone))
+
+	vRequest := buildRequest(request)
+	// subject values not set in the playbook are empty strings, which would be validated against the policy
+	vRequest.Subject.Country = removeEmpty(vRequest.Subject.Country)
+	vRequest.Subject.Organization = removeEmpty(vRequest.Subject.Organization)
+	vRequest.Subject.OrganizationalUnit = removeEmpty(vRequest.Subject.OrganizationalUnit)
+	vRequest.Subject.Locality = removeEmpty(vRequest.Subject.Locality)
+	vRequest.Subject.Province = removeEmpty(vRequest.Subject.Province)
+
+	zoneCfg.UpdateCertificateRequest(&vRequest)
+	err = zoneCfg.ValidateCertificateRequest(&vRequest)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.PolicyValidationError, err)
+	}
+	return nil
+}
+
+// RequestSshCertificate requests the SSH certificate of request for publicKeyData, in the authorized_keys format, to
+// the Venafi platform defined by config, and retrieves it when it is not issued right away. The connector is taken
+// from connectors, like EnrollCertificateWithCache does.
+func RequestSshCertificate(ctx context.Context, connectors *ConnectorCache, config domain.Config, request domain.SshPlaybookRequest, publicKeyData string) (*certificate.SshCertificateObject, error) {
+	client, err := getContextClient(connectors, config, "", request.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := DefaultTimeout
+	if request.Timeout > 0 {
+		timeout = request.Timeout
+	}
+	vRequest := certificate.SshCertRequest{
+		Template:                  request.Template,
+		PolicyDN:                  request.PolicyDN,
+		ObjectName:                request.ObjectName,
+		DestinationAddresses:      request.DestinationAddresses,
+		KeyId:                     request.KeyID,
+		Principals:                request.Principals,
+		ValidityPeriod:            request.ValidityPeriod,
+		PublicKeyData:             publicKeyData,
+		Extensions:                request.Extensions,
+		ForceCommand:              request.ForceCommand,
+		SourceAddresses:           request.SourceAddresses,
+		IncludeCertificateDetails: true,
+		Timeout:                   time.Duration(timeout) * time.Second,
+	}
+
+	data, err := client.RequestSSHCertificateContext(ctx, &vRequest)
+	if err != nil {
+		return nil, err
+	}
+	if data.CertificateData != "" {
+		return data, nil
+	}
+	zap.L().Debug("successfully requested SSH certificate", zap.String("requestID", data.DN))
+
+	// the certificate is pending, or issued without its data: it is retrieved with the ID of the request
+	vRequest.PickupID = data.DN
+	vRequest.Guid = data.Guid
+	return client.RetrieveSSHCertificateContext(ctx, &vRequest)
+}
+
+// getContextClient returns the connector of zone from connectors. All the connectors of vcert implement
+// endpoint.ConnectorContext
+func getContextClient(connectors *ConnectorCache, config domain.Config, zone string, timeout int) (endpoint.ConnectorContext, error) {
+	client, err := connectors.Get(config, zone, timeout)
+	if err != nil {
+		return nil, err
+	}
+	cc, ok := client.(endpoint.ConnectorContext)
+	if !ok {
+		return nil, fmt.Errorf("%w: connector %s doesn't support contexts", verror.VcertError, client.GetType())
+	}
+	return cc, nil
+}
+
+func removeEmpty(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// rateLimiters holds a RateLimiter per platform, so every client of a playbook run shares the same limit
+var rateLimiters = struct {
+	sync.Mutex
+	m map[string]*httputils.RateLimiter
+}{m: make(map[string]*httputils.RateLimiter)}
+
+func getRateLimiter(c domain.Connection) *httputils.RateLimiter {
+	if c.RateLimit == nil || c.RateLimit.RequestsPerSecond <= 0 {
+		return nil
+	}
+	key := fmt.Sprintf("%s|%s|%v|%d", c.Platform, c.URL, c.RateLimit.RequestsPerSecond, c.RateLimit.Burst)
+
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+	limiter, ok := rateLimiters.m[key]
+	if !ok {
+		limiter = httputils.NewRateLimiter(c.RateLimit.RequestsPerSecond, c.RateLimit.Burst)
+		rateLimiters.m[key] = limiter
+	}
+	return limiter
+}
+
 func buildClient(config domain.Config, zone string, timeout int) (endpoint.Connector, error) {
 	var netTransport = &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
@@ -105,6 +237,8 @@ func buildClient(config domain.Config, zone string, timeout int) (endpoint.Conne
 		Zone:            zone,
 		ConnectionTrust: loadTrustBundle(config.Connection.TrustBundlePath),
 		LogVerbose:      false,
+		RetryPolicy:     config.Connection.Retry,
+		RateLimiter:     getRateLimiter(config.Connection),
 	}
 
 	vcertConfig.Client = &http.Client{
@@ -25,4 +25,5 @@ type InstallationConfig struct {
 	Password        string
 	StoreLocation   string
 	StoreName       string
+	Thumbprint      string
 }
@@ -0,0 +1,36 @@
+<##################
+.DESCRIPTION
+    remove-cert removes an end-entity certificate from the Personal CAPI store. Its chain certificates are kept
+.PARAMETER thumbprint
+    The SHA-1 thumbprint of the certificate to remove
+.PARAMETER storeName
+    The name of the CAPI store
+.PARAMETER storeLocation
+    The location of the CAPI store
+##################>
+function remove-cert {
+    [CmdletBinding()]
+    param (
+        [Parameter(Mandatory)]
+        [string] $thumbprint,
+
+        [Parameter(Mandatory)]
+        [string] $storeName,
+
+        [Parameter(Mandatory)]
+        [System.Security.Cryptography.X509Certificates.storeLocation] $storeLocation
+    )
+
+    $path = "Cert:\$($storeLocation)\$($storeName)\$($thumbprint)"
+    if (!(Test-Path $path))
+    {
+        return  # not in the CAPI store
+    }
+
+    Remove-Item -Path $path -DeleteKey
+
+    if (Test-Path $path)
+    {
+        throw "Could not remove certificate from target system"
+    }
+}
@@ -36,6 +36,8 @@ var (
 	installCertScript string
 	//go:embed embedded/retrieve-cert.ps1
 	retrieveCertScript string
+	//go:embed embedded/remove-cert.ps1
+	removeCertScript string
 )
 
 // PowerShell represents the powershell program in Windows. It is used to execute any script on it
@@ -133,6 +135,35 @@ func (ps PowerShell) RetrieveCertificateFromCAPI(config InstallationConfig) (str
 	return stdout, nil
 }
 
+// RemoveCertificateFromCAPI removes the certificate with config.Thumbprint, and its private key, from the CAPI store
+// config.StoreName. It does nothing if the certificate is not in the store
+func (ps PowerShell) RemoveCertificateFromCAPI(config InstallationConfig) error {
+	zap.L().Info("removing certificate from CAPI Store", zap.String("thumbprint", config.Thumbprint))
+
+	// verify thumbprint doesn't have command injection
+	err := containsInjectableData(config.Thumbprint)
+	if err != nil {
+		m := "failed to remove certificate because of invalid characters in thumbprint"
+		zap.L().Error(m)
+		return errors.WithMessagef(err, m)
+	}
+
+	params := map[string]string{
+		"thumbprint":    config.Thumbprint,
+		"storeName":     config.StoreName,
+		"storeLocation": config.StoreLocation,
+	}
+
+	stdout, err := ps.executeScript(removeCertScript, "remove-cert", params)
+	if err != nil {
+		m := "failed to remove certificate from CAPI"
+		zap.L().Error(m, zap.String("stdout", stdout), zap.Error(err))
+		return errors.WithMessagef(err, "%s, stdout: '%s'", m, stdout)
+	}
+
+	return nil
+}
+
 // ExecuteScript runs the specified powershell script function found within the script.
 // String parameters can be specified as named arguments to the function.
 // Parameters have a limited size, large parameters should be first read from disk to avoid command size limits.
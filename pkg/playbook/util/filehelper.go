@@ -24,6 +24,8 @@ import (
 	"path/filepath"
 
 	"go.uber.org/zap"
+
+	pkgutil "github.com/Venafi/vcert/v5/pkg/util"
 )
 
 // FileExists returns true if  a file exists and is accessible on the given certPath
@@ -40,8 +42,21 @@ func FileExists(certPath string) (bool, error) {
 	return true, nil
 }
 
-// WriteFile saves the content in the given location. Creates any folders necessary for this action
+// FileOptions are the permissions and ownership of a file written by WriteFileWithOptions
+type FileOptions = pkgutil.FileOptions
+
+// WriteFile saves the content in the given location. Creates any folders necessary for this action. An existing file
+// keeps its permissions and ownership, a new one is only readable by its owner
 func WriteFile(location string, content []byte) error {
+	return WriteFileWithOptions(location, content, FileOptions{KeepExisting: true})
+}
+
+// WriteFileWithOptions saves the content in the given location, with the permissions and ownership of options.
+// Creates any folders necessary for this action.
+//
+// The content is written to a temporary file in the same folder, which is then renamed to location: a reader never
+// gets a partially written file
+func WriteFileWithOptions(location string, content []byte, options FileOptions) error {
 	dirPath := filepath.Dir(location)
 	err := os.MkdirAll(dirPath, 0750)
 	if err != nil {
@@ -50,7 +65,7 @@ func WriteFile(location string, content []byte) error {
 		return err
 	}
 
-	err = os.WriteFile(location, content, 0600)
+	err = pkgutil.WriteFileAtomically(location, content, options)
 	if err != nil {
 		zap.L().Error("could not write certificate to file", zap.String("file", location), zap.Error(err))
 		return err
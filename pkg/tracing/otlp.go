@@ -0,0 +1,312 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultServiceName is the service.name resource attribute of the exported spans
+	DefaultServiceName = "vcert"
+
+	otlpTracesPath   = "/v1/traces"
+	otlpBatchSize    = 512
+	otlpMaxQueueSize = 8192
+	otlpExportPeriod = 5 * time.Second
+)
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector with the OTLP/HTTP protocol, JSON encoded.
+type OTLPExporter struct {
+	url         string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+
+	mu      sync.Mutex
+	queue   []SpanData
+	dropped int
+
+	flush    chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewOTLPExporter returns an exporter sending spans to the collector at endpoint, like http://localhost:4318. The
+// spans are posted to endpoint/v1/traces, unless endpoint already ends with that path. headers are added to every
+// request, for the authentication to the collector.
+func NewOTLPExporter(endpoint string, headers map[string]string, serviceName string) *OTLPExporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, otlpTracesPath) {
+		url += otlpTracesPath
+	}
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	e := &OTLPExporter{
+		url:         url,
+		headers:     headers,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		flush:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// ParseHeaders parses headers in the format of the OTEL_EXPORTER_OTLP_HEADERS environment variable:
+// comma-separated key=value pairs
+func ParseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", pair)
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers, nil
+}
+
+// Export queues span. Spans are dropped when the collector can't keep up
+func (e *OTLPExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= otlpMaxQueueSize {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, span)
+	if len(e.queue) >= otlpBatchSize {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown sends the queued spans and stops the exporter
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return e.send(ctx)
+}
+
+func (e *OTLPExporter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(otlpExportPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		case <-e.flush:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), e.client.Timeout)
+		err := e.send(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("failed to export traces: %s", err)
+		}
+	}
+}
+
+// send posts all the queued spans, in batches
+func (e *OTLPExporter) send(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		n := min(len(e.queue), otlpBatchSize)
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+
+		if dropped > 0 {
+			log.Printf("dropped %d spans: the trace collector is not keeping up", dropped)
+		}
+		if n == 0 {
+			return nil
+		}
+		err := e.post(ctx, batch)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *OTLPExporter) post(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("trace collector answered %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// The types below are the JSON encoding of the OTLP ExportTraceServiceRequest message
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// otlpStatusError is the code of failed spans. The status of the other ones is left unset
+const otlpStatusError = 2
+
+func (e *OTLPExporter) request(spans []SpanData) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.SpanID[:]),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+		}
+		if s.ParentSpanID != ([8]byte{}) {
+			span.ParentSpanID = hex.EncodeToString(s.ParentSpanID[:])
+		}
+		if s.Error {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.StatusMessage}
+		}
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otlpAttributes([]Attribute{String("service.name", e.serviceName)})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/Venafi/vcert/v5"},
+			Spans: out,
+		}},
+	}}}
+}
+
+func otlpAttributes(attrs []Attribute) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attrs))
+	for _, a := range attrs {
+		v := otlpAnyValue{}
+		switch value := a.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case bool:
+			v.BoolValue = &value
+		case int64:
+			i := strconv.FormatInt(value, 10)
+			v.IntValue = &i
+		case float64:
+			v.DoubleValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		out = append(out, otlpAttribute{Key: a.Key, Value: v})
+	}
+	return out
+}
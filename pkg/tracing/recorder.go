@@ -0,0 +1,67 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+// Recorder is an Exporter keeping the ended spans in memory, for tests
+type Recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// Export records span
+func (r *Recorder) Export(span SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+// Shutdown does nothing, the spans are kept
+func (r *Recorder) Shutdown(_ context.Context) error {
+	return nil
+}
+
+// Spans returns the spans recorded so far, in the order they ended
+func (r *Recorder) Spans() []SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SpanData(nil), r.spans...)
+}
+
+// Find returns the first recorded span named name
+func (r *Recorder) Find(name string) (SpanData, bool) {
+	for _, span := range r.Spans() {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return SpanData{}, false
+}
+
+// Attribute returns the value of the attribute key of the span, or nil if it has none
+func (s SpanData) Attribute(key string) interface{} {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tracing records spans around the operations of vcert (connector operations, HTTP requests to the Venafi
+// platforms and playbook task phases) and exports them with OpenTelemetry's OTLP protocol.
+//
+// Tracing is disabled until an Exporter is set with SetExporter: Start then returns a nil *Span, whose methods do
+// nothing, so instrumented code costs next to nothing.
+//
+// Attributes must never hold secrets: credentials, private keys, passwords or full URLs with query strings.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Attribute keys shared by the instrumented packages
+const (
+	AttrPlatform  = "vcert.platform"
+	AttrZone      = "vcert.zone"
+	AttrRequestID = "vcert.request_id"
+	AttrTask      = "vcert.task"
+)
+
+// SpanKind is the OTLP kind of a span
+type SpanKind int
+
+const (
+	// SpanKindInternal is an operation inside vcert
+	SpanKindInternal SpanKind = 1
+	// SpanKindClient is a request sent to a remote server
+	SpanKindClient SpanKind = 3
+)
+
+// Attribute is a key and a value describing a span. The value is a string, a bool, an int64 or a float64
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Exporter sends the ended spans to a tracing backend
+type Exporter interface {
+	// Export is called with every ended span. It must not block
+	Export(span SpanData)
+	// Shutdown sends the pending spans and stops the exporter
+	Shutdown(ctx context.Context) error
+}
+
+var global = struct {
+	sync.RWMutex
+	exporter Exporter
+}{}
+
+// SetExporter enables tracing, sending the spans to exporter. A nil exporter disables tracing
+func SetExporter(exporter Exporter) {
+	global.Lock()
+	defer global.Unlock()
+	global.exporter = exporter
+}
+
+// Shutdown sends the pending spans, stops the exporter and disables tracing
+func Shutdown(ctx context.Context) error {
+	global.Lock()
+	exporter := global.exporter
+	global.exporter = nil
+	global.Unlock()
+	if exporter == nil {
+		return nil
+	}
+	return exporter.Shutdown(ctx)
+}
+
+func getExporter() Exporter {
+	global.RLock()
+	defer global.RUnlock()
+	return global.exporter
+}
+
+// SpanData is the content of an ended span
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	TraceID       [16]byte
+	SpanID        [8]byte
+	ParentSpanID  [8]byte
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Error         bool
+	StatusMessage string
+}
+
+// Span is an operation being traced. A nil *Span is valid and does nothing
+type Span struct {
+	mu       sync.Mutex
+	data     SpanData
+	ended    bool
+	exporter Exporter
+}
+
+type spanContextKey struct{}
+
+// spanContext identifies the current span of a context
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+}
+
+// Start starts an internal span named name, child of the span of ctx if any, and returns a context holding it.
+// The span must be ended with End or Finish.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return StartKind(ctx, SpanKindInternal, name, attrs...)
+}
+
+// StartKind is like Start for a span of the given kind
+func StartKind(ctx context.Context, kind SpanKind, name string, attrs ...Attribute) (context.Context, *Span) {
+	exporter := getExporter()
+	if exporter == nil {
+		return ctx, nil
+	}
+
+	s := &Span{
+		data: SpanData{
+			Name:       name,
+			Kind:       kind,
+			Start:      time.Now(),
+			Attributes: append([]Attribute(nil), attrs...),
+		},
+		exporter: exporter,
+	}
+	if parent, ok := ctx.Value(spanContextKey{}).(spanContext); ok {
+		s.data.TraceID = parent.traceID
+		s.data.ParentSpanID = parent.spanID
+	} else {
+		_, _ = rand.Read(s.data.TraceID[:])
+	}
+	_, _ = rand.Read(s.data.SpanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, spanContext{traceID: s.data.TraceID, spanID: s.data.SpanID}), s
+}
+
+// SetAttributes adds attrs to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// RecordError marks the span as failed with err. A nil err is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = true
+	s.data.StatusMessage = err.Error()
+}
+
+// End ends the span and exports it. Calls after the first one are ignored
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.exporter.Export(data)
+}
+
+// Finish records err, if any, and ends the span. It is meant to be deferred with the named error result of the
+// traced function
+func (s *Span) Finish(err error) {
+	s.RecordError(err)
+	s.End()
+}
+
+// Inject sets the W3C traceparent header of header to the span of ctx, so the server can join the trace
+func Inject(ctx context.Context, header http.Header) {
+	sc, ok := ctx.Value(spanContextKey{}).(spanContext)
+	if !ok {
+		return
+	}
+	header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(sc.traceID[:]),
+		hex.EncodeToString(sc.spanID[:])))
+}
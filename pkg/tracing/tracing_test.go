@@ -0,0 +1,162 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStart_Disabled(t *testing.T) {
+	ctx := context.Background()
+	spanCtx, span := Start(ctx, "disabled")
+	assert.Nil(t, span)
+	assert.Equal(t, ctx, spanCtx)
+
+	// a nil span does nothing
+	span.SetAttributes(String("key", "value"))
+	span.Finish(errors.New("failed"))
+
+	header := http.Header{}
+	Inject(spanCtx, header)
+	assert.Empty(t, header.Get("traceparent"))
+}
+
+func TestStart(t *testing.T) {
+	recorder := &Recorder{}
+	SetExporter(recorder)
+	defer SetExporter(nil)
+
+	ctx, parent := Start(context.Background(), "parent", String(AttrZone, "zone"))
+	childCtx, child := StartKind(ctx, SpanKindClient, "child")
+	header := http.Header{}
+	Inject(childCtx, header)
+	child.Finish(errors.New("failed"))
+	child.Finish(nil)
+	parent.SetAttributes(Int("count", 2), Bool("ok", true))
+	parent.End()
+
+	spans := recorder.Spans()
+	require.Len(t, spans, 2)
+	c, p := spans[0], spans[1]
+	assert.Equal(t, "child", c.Name)
+	assert.Equal(t, SpanKindClient, c.Kind)
+	assert.Equal(t, p.TraceID, c.TraceID)
+	assert.Equal(t, p.SpanID, c.ParentSpanID)
+	assert.True(t, c.Error)
+	assert.Equal(t, "failed", c.StatusMessage)
+
+	assert.Equal(t, SpanKindInternal, p.Kind)
+	assert.Equal(t, [8]byte{}, p.ParentSpanID)
+	assert.False(t, p.Error)
+	assert.Equal(t, "zone", p.Attribute(AttrZone))
+	assert.Equal(t, int64(2), p.Attribute("count"))
+	assert.Equal(t, true, p.Attribute("ok"))
+	assert.False(t, p.End.Before(p.Start))
+
+	assert.Equal(t, "00-"+hex.EncodeToString(c.TraceID[:])+"-"+hex.EncodeToString(c.SpanID[:])+"-01",
+		header.Get("traceparent"))
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		var req otlpRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		received <- req
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(server.URL+"/", map[string]string{"Authorization": "secret"}, "")
+	SetExporter(exporter)
+	ctx, parent := Start(context.Background(), "parent", String(AttrTask, "task"), Int("count", 3))
+	_, child := Start(ctx, "child")
+	child.Finish(errors.New("failed"))
+	parent.End()
+	require.NoError(t, Shutdown(context.Background()))
+
+	var req otlpRequest
+	select {
+	case req = <-received:
+	default:
+		t.Fatal("no spans were sent")
+	}
+	require.Len(t, req.ResourceSpans, 1)
+	resource := req.ResourceSpans[0]
+	require.Len(t, resource.Resource.Attributes, 1)
+	assert.Equal(t, "service.name", resource.Resource.Attributes[0].Key)
+	assert.Equal(t, DefaultServiceName, *resource.Resource.Attributes[0].Value.StringValue)
+
+	require.Len(t, resource.ScopeSpans, 1)
+	spans := resource.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	c, p := spans[0], spans[1]
+	assert.Equal(t, "child", c.Name)
+	assert.Len(t, c.TraceID, 32)
+	assert.Equal(t, p.TraceID, c.TraceID)
+	assert.Equal(t, p.SpanID, c.ParentSpanID)
+	assert.Equal(t, otlpStatusError, c.Status.Code)
+	assert.Equal(t, "failed", c.Status.Message)
+
+	assert.Empty(t, p.ParentSpanID)
+	assert.Equal(t, 0, p.Status.Code)
+	require.Len(t, p.Attributes, 2)
+	assert.Equal(t, "task", *p.Attributes[0].Value.StringValue)
+	assert.Equal(t, "3", *p.Attributes[1].Value.IntValue)
+
+	// tracing is disabled after the shutdown
+	_, span := Start(context.Background(), "disabled")
+	assert.Nil(t, span)
+	assert.NoError(t, exporter.Shutdown(context.Background()))
+}
+
+func TestOTLPExporter_CollectorError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(server.URL+"/v1/traces", nil, "test")
+	exporter.Export(SpanData{Name: "span"})
+	err := exporter.Shutdown(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "quota exceeded")
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders("api-key=secret, x-tenant = venafi=1,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"api-key": "secret", "x-tenant": "venafi=1"}, headers)
+
+	headers, err = ParseHeaders("")
+	require.NoError(t, err)
+	assert.Empty(t, headers)
+
+	_, err = ParseHeaders("api-key")
+	assert.Error(t, err)
+}
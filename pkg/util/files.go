@@ -0,0 +1,133 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// FileOptions are the permissions and ownership of a file written by WriteFileAtomically
+type FileOptions struct {
+	// Mode is the permissions of the file. Defaults to 0600
+	Mode os.FileMode
+	// Owner is the user owning the file, by name or ID. Empty keeps the user running vcert
+	Owner string
+	// Group is the group owning the file, by name or ID. Empty keeps the group of the user running vcert
+	Group string
+	// KeepExisting keeps the permissions and ownership of the file replaced, if any, instead of Mode, Owner and Group
+	KeepExisting bool
+}
+
+// WriteFileAtomically saves the content in the given location, with the permissions and ownership of options. The
+// folder of location must exist.
+//
+// The content is written to a temporary file in the same folder, which is then renamed to location: a reader, like
+// sshd, never gets a partially written file. When location is a symbolic link, the file it points to is written
+// instead, so the link is kept
+func WriteFileAtomically(location string, content []byte, options FileOptions) error {
+	target, err := filepath.EvalSymlinks(location)
+	switch {
+	case err == nil:
+		location = target
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	uid, gid, err := lookupOwner(options.Owner, options.Group)
+	if err != nil {
+		return fmt.Errorf("could not find owner of %s: %w", location, err)
+	}
+	mode := options.Mode
+	if mode == 0 {
+		mode = 0600
+	}
+	if options.KeepExisting {
+		info, err := os.Stat(location)
+		switch {
+		case err == nil:
+			mode = info.Mode().Perm()
+			uid, gid = fileOwner(info)
+		case !errors.Is(err, fs.ErrNotExist):
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(location), "."+filepath.Base(location)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	err = writeTemp(tmp, content, mode, uid, gid)
+	if err == nil {
+		err = os.Rename(tmpName, location)
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// writeTemp writes content to tmp and sets its permissions and ownership. tmp is closed
+func writeTemp(tmp *os.File, content []byte, mode os.FileMode, uid int, gid int) error {
+	_, err := tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return err
+	}
+	if uid != -1 || gid != -1 {
+		return os.Chown(tmp.Name(), uid, gid)
+	}
+	return nil
+}
+
+// lookupOwner returns the IDs of owner and group, or -1 when they are empty
+func lookupOwner(owner string, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner != "" {
+		id := owner
+		if _, err := strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return 0, 0, err
+			}
+			id = u.Uid
+		}
+		var err error
+		uid, err = strconv.Atoi(id)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid user ID %s of %s: %w", id, owner, err)
+		}
+	}
+	if group != "" {
+		id := group
+		if _, err := strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return 0, 0, err
+			}
+			id = g.Gid
+		}
+		var err error
+		gid, err = strconv.Atoi(id)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid group ID %s of %s: %w", id, group, err)
+		}
+	}
+	return uid, gid, nil
+}
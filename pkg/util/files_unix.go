@@ -0,0 +1,26 @@
+//go:build !windows
+
+package util
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the IDs of the user and group owning the file of info, or -1 for the ones of the process, which
+// don't need to be set
+func fileOwner(info fs.FileInfo) (int, int) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1
+	}
+	uid, gid := int(stat.Uid), int(stat.Gid)
+	if uid == os.Geteuid() {
+		uid = -1
+	}
+	if gid == os.Getegid() {
+		gid = -1
+	}
+	return uid, gid
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFileAtomically_KeepExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sshd_config")
+	options := FileOptions{Mode: 0644, KeepExisting: true}
+
+	// a new file gets the mode of options
+	err := WriteFileAtomically(path, []byte("v1\n"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Fatalf("expected mode 0644, got %v", info.Mode())
+	}
+
+	// a replaced file keeps its mode and, when running as root, its owner
+	err = os.Chmod(path, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := os.Geteuid() == 0
+	if root {
+		err = os.Chown(path, 4242, 4343)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = WriteFileAtomically(path, []byte("v2\n"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("expected the mode of the file to be kept, got %v", info.Mode())
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	if root && (stat.Uid != 4242 || stat.Gid != 4343) {
+		t.Fatalf("expected the owner of the file to be kept, got %d:%d", stat.Uid, stat.Gid)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "v2\n" {
+		t.Fatalf("unexpected content %q", content)
+	}
+}
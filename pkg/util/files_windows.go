@@ -0,0 +1,12 @@
+//go:build windows
+
+package util
+
+import (
+	"io/fs"
+)
+
+// fileOwner returns -1 for the user and group owning the file of info: the ownership of a file is not set on Windows
+func fileOwner(_ fs.FileInfo) (int, int) {
+	return -1, -1
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dayDuration = 24 * time.Hour
+
+// ErrRenewalDisabled is returned by RenewalTime when the renew window turns automatic renewal off
+var ErrRenewalDisabled = errors.New("automatic renewal is disabled")
+
+// renewWindow is a parsed renewBefore: either a duration before expiration or a percentage of the certificate
+// validity. The zero value turns renewal off
+type renewWindow struct {
+	duration time.Duration
+	percent  int64
+}
+
+// parseRenewWindow parses renewBefore in the playbook format
+func parseRenewWindow(renewBefore string) (renewWindow, error) {
+	if renewBefore == "0" || strings.ToLower(renewBefore) == "disabled" {
+		return renewWindow{}, nil
+	}
+	if len(renewBefore) < 2 {
+		return renewWindow{}, fmt.Errorf("invalid renew window %q", renewBefore)
+	}
+
+	timePostfix := renewBefore[len(renewBefore)-1:]
+	renewValue, err := strconv.ParseInt(renewBefore[:len(renewBefore)-1], 10, 32)
+	if err != nil {
+		return renewWindow{}, fmt.Errorf("invalid renew window %q: %w", renewBefore, err)
+	}
+
+	switch timePostfix {
+	case "d":
+		// operation happens in integers to avoid issues with linter and time.Duration struct
+		return renewWindow{duration: time.Duration(dayDuration.Nanoseconds() * renewValue)}, nil
+	case "h":
+		return renewWindow{duration: time.Duration(time.Hour.Nanoseconds() * renewValue)}, nil
+	case "%":
+		return renewWindow{percent: renewValue}, nil
+	default:
+		return renewWindow{}, fmt.Errorf("invalid renew window %q: valid postfixes are d (days), h (hours) and %% (percentage)", renewBefore)
+	}
+}
+
+// RenewalTime returns the moment a certificate valid between notBefore and notAfter enters its renew window.
+//
+// renewBefore uses the playbook format: a number followed by "d" (days before expiration), "h" (hours before
+// expiration) or "%" (percentage of the certificate validity left). "0" or "disabled" turn renewal off, in which case
+// ErrRenewalDisabled is returned.
+func RenewalTime(notBefore, notAfter time.Time, renewBefore string) (time.Time, error) {
+	window, err := parseRenewWindow(renewBefore)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if window == (renewWindow{}) {
+		return time.Time{}, ErrRenewalDisabled
+	}
+
+	renewDuration := window.duration
+	if window.percent != 0 {
+		// if 10%, then renew when 90% of the validity time has elapsed
+		nsCertValidity := notAfter.Sub(notBefore).Nanoseconds()
+		renewDuration = time.Duration(float64(nsCertValidity) * float64(window.percent) / 100)
+	}
+
+	return notAfter.Add(-renewDuration), nil
+}
+
+// ParseDuration parses a duration in the format of renewBefore, such as "90d" or "12h". "0" or "disabled" return 0.
+// Percentages are rejected, as they are only meaningful relative to the validity of a certificate
+func ParseDuration(value string) (time.Duration, error) {
+	window, err := parseRenewWindow(value)
+	if err != nil {
+		return 0, err
+	}
+	if window.percent != 0 {
+		return 0, fmt.Errorf("invalid duration %q: a percentage needs the validity of a certificate", value)
+	}
+	return window.duration, nil
+}
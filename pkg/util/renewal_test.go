@@ -0,0 +1,72 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRenewalTime(t *testing.T) {
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(100 * dayDuration)
+
+	cases := []struct {
+		renewBefore string
+		expected    time.Time
+	}{
+		{"30d", notAfter.Add(-30 * dayDuration)},
+		{"12h", notAfter.Add(-12 * time.Hour)},
+		{"10%", notAfter.Add(-10 * dayDuration)},
+	}
+	for _, c := range cases {
+		renewAt, err := RenewalTime(notBefore, notAfter, c.renewBefore)
+		if err != nil {
+			t.Fatalf("%s: %s", c.renewBefore, err)
+		}
+		if !renewAt.Equal(c.expected) {
+			t.Fatalf("%s: expected %s, got %s", c.renewBefore, c.expected, renewAt)
+		}
+	}
+
+	for _, disabled := range []string{"0", "disabled", "0d", "0%"} {
+		_, err := RenewalTime(notBefore, notAfter, disabled)
+		if !errors.Is(err, ErrRenewalDisabled) {
+			t.Fatalf("%s: expected renewal to be disabled, got %v", disabled, err)
+		}
+	}
+
+	for _, invalid := range []string{"", "d", "10x", "abc%"} {
+		_, err := RenewalTime(notBefore, notAfter, invalid)
+		if err == nil || errors.Is(err, ErrRenewalDisabled) {
+			t.Fatalf("%s: expected parsing error, got %v", invalid, err)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"90d", 90 * dayDuration},
+		{"12h", 12 * time.Hour},
+		{"0", 0},
+		{"Disabled", 0},
+	}
+	for _, c := range cases {
+		duration, err := ParseDuration(c.value)
+		if err != nil {
+			t.Fatalf("%s: %s", c.value, err)
+		}
+		if duration != c.expected {
+			t.Fatalf("%s: expected %s, got %s", c.value, c.expected, duration)
+		}
+	}
+
+	for _, invalid := range []string{"", "d", "3w", "10%"} {
+		_, err := ParseDuration(invalid)
+		if err == nil {
+			t.Fatalf("%s: expected parsing error", invalid)
+		}
+	}
+}
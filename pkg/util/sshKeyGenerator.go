@@ -1,6 +1,10 @@
 package util
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -15,8 +19,44 @@ import (
 
 const (
 	RsaPrivKeyType = "RSA PRIVATE KEY"
+	// OpenSshFormat encodes SSH private keys in the OpenSSH format, as ssh-keygen does
+	OpenSshFormat = "openssh"
+
+	// DefaultSshRsaKeySize is the size of the RSA SSH keys generated when no size is given
+	DefaultSshRsaKeySize = 3072
+	// DefaultSshEcdsaKeySize is the curve size of the ECDSA SSH keys generated when no size is given
+	DefaultSshEcdsaKeySize = 256
+)
+
+// SshKeyType is the algorithm of a locally generated SSH key pair
+type SshKeyType string
+
+const (
+	SshKeyTypeRSA     SshKeyType = "rsa"
+	SshKeyTypeEd25519 SshKeyType = "ed25519"
+	SshKeyTypeECDSA   SshKeyType = "ecdsa"
 )
 
+// ParseSshKeyType returns the SshKeyType named s, as given to ssh-keygen -t. An empty s is RSA. The OpenSSH names of
+// the ECDSA algorithms, such as ecdsa-sha2-nistp384, are accepted with the size of their curve
+func ParseSshKeyType(s string) (SshKeyType, int, error) {
+	switch strings.ToLower(s) {
+	case "", "rsa", "ssh-rsa":
+		return SshKeyTypeRSA, 0, nil
+	case "ed25519", "ssh-ed25519":
+		return SshKeyTypeEd25519, 0, nil
+	case "ecdsa":
+		return SshKeyTypeECDSA, 0, nil
+	case "ecdsa-sha2-nistp256":
+		return SshKeyTypeECDSA, 256, nil
+	case "ecdsa-sha2-nistp384":
+		return SshKeyTypeECDSA, 384, nil
+	case "ecdsa-sha2-nistp521":
+		return SshKeyTypeECDSA, 521, nil
+	}
+	return "", 0, fmt.Errorf("unsupported SSH key type %q, expected rsa, ed25519 or ecdsa", s)
+}
+
 func generatePrivKey(bitSize int) (*rsa.PrivateKey, error) {
 
 	privKey, err := rsa.GenerateKey(rand.Reader, bitSize)
@@ -82,49 +122,104 @@ func encodePrivKeyToPEM(privateKey *rsa.PrivateKey, keyPassword string, format .
 	return privatePEM, nil
 }
 
-func generatePublicKey(key *rsa.PublicKey) ([]byte, error) {
+// generateSshPrivKey generates a private key of keyType. bitSize is the size of an RSA key or the curve of an ECDSA
+// key, 0 meaning the default one
+func generateSshPrivKey(keyType SshKeyType, bitSize int) (crypto.Signer, error) {
+	switch keyType {
+	case SshKeyTypeRSA:
+		if bitSize <= 0 {
+			bitSize = DefaultSshRsaKeySize
+		}
+		return generatePrivKey(bitSize)
+	case SshKeyTypeEd25519:
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Private Key was generated")
+		return privKey, nil
+	case SshKeyTypeECDSA:
+		var curve elliptic.Curve
+		switch bitSize {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported ECDSA key size %d, expected 256, 384 or 521", bitSize)
+		}
+		privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Private Key was generated")
+		return privKey, nil
+	}
+	return nil, fmt.Errorf("unsupported SSH key type %q", keyType)
+}
 
-	publicRsaKey, err := ssh.NewPublicKey(key)
+// encodePrivKeyToOpenSsh encodes privateKey in the OpenSSH format, encrypted with keyPassword if not empty
+func encodePrivKeyToOpenSsh(privateKey crypto.Signer, keyPassword, comment string) ([]byte, error) {
+	var privBlock *pem.Block
+	var err error
+	if keyPassword != "" {
+		privBlock, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, comment, []byte(keyPassword))
+	} else {
+		privBlock, err = ssh.MarshalPrivateKey(privateKey, comment)
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	pubKeyBytes := ssh.MarshalAuthorizedKey(publicRsaKey)
-
-	log.Println("Public key was generated")
-	return pubKeyBytes, nil
-
+	return pem.EncodeToMemory(privBlock), nil
 }
 
+// GenerateSshKeyPair generates an RSA key pair of bitSize bits and returns the private key, in the PKCS#8, legacy PEM
+// or OpenSSH format, and the public key in the authorized_keys format with certId as comment
 func GenerateSshKeyPair(bitSize int, keyPassword, certId string, format ...string) ([]byte, []byte, error) {
+	return GenerateSshKeyPairWithType(SshKeyTypeRSA, bitSize, keyPassword, certId, format...)
+}
 
+// GenerateSshKeyPairWithType generates a key pair of keyType and returns the private key and the public key in the
+// authorized_keys format with certId as comment. bitSize is the size of an RSA key or the curve of an ECDSA key (256,
+// 384 or 521), 0 meaning the default one. ed25519 and ECDSA private keys are encoded in the OpenSSH format, RSA ones
+// in the format given, as GenerateSshKeyPair does. The private key is encrypted with keyPassword if not empty
+func GenerateSshKeyPairWithType(keyType SshKeyType, bitSize int, keyPassword, certId string, format ...string) ([]byte, []byte, error) {
 	currentFormat := ""
 	if len(format) > 0 && format[0] != "" {
 		currentFormat = format[0]
 	}
+	if keyType == "" {
+		keyType = SshKeyTypeRSA
+	}
+	if keyType != SshKeyTypeRSA && currentFormat == LegacyPem {
+		return nil, nil, fmt.Errorf("%s format is only supported for RSA SSH keys", LegacyPem)
+	}
 
-	privateKey, err := generatePrivKey(bitSize)
-
+	privateKey, err := generateSshPrivKey(keyType, bitSize)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	publicKeyBytes, err := generatePublicKey(&privateKey.PublicKey)
-
+	sshPublicKey, err := ssh.NewPublicKey(privateKey.Public())
 	if err != nil {
 		return nil, nil, err
 	}
+	log.Println("Public key was generated")
 
-	privateKeyBytes, err := encodePrivKeyToPEM(privateKey, keyPassword, currentFormat)
-
+	var privateKeyBytes []byte
+	if rsaKey, ok := privateKey.(*rsa.PrivateKey); ok && currentFormat != OpenSshFormat {
+		privateKeyBytes, err = encodePrivKeyToPEM(rsaKey, keyPassword, currentFormat)
+	} else {
+		privateKeyBytes, err = encodePrivKeyToOpenSsh(privateKey, keyPassword, certId)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
 
-	sPubKey := string(publicKeyBytes)
-	sPubKey = strings.TrimRight(sPubKey, "\r\n")
+	sPubKey := strings.TrimRight(string(ssh.MarshalAuthorizedKey(sshPublicKey)), "\r\n")
 	sPubKey = fmt.Sprint(sPubKey, " ", certId)
 
 	return privateKeyBytes, []byte(sPubKey), nil
-
 }
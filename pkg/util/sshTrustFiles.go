@@ -0,0 +1,151 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// SshBackupSuffix is appended to the name of a file updated by UpdateSshManagedBlock to back it up
+	SshBackupSuffix = ".bak"
+
+	sshManagedBlockBegin = "# BEGIN VCERT MANAGED BLOCK %s"
+	sshManagedBlockEnd   = "# END VCERT MANAGED BLOCK %s"
+	sshCertAuthority     = "@cert-authority"
+	defaultSshTrustPerm  = 0644
+)
+
+// SshCaKeyLines returns the keys of caPublicKey, in the authorized_keys format, one per line as expected in an sshd
+// TrustedUserCAKeys file. It fails when caPublicKey holds no key or something else than keys
+func SshCaKeyLines(caPublicKey string) ([]string, error) {
+	var lines []string
+	for _, line := range strings.Split(caPublicKey, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CA public key: %w", err)
+		}
+		line = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+		if comment != "" {
+			line += " " + comment
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("failed to parse CA public key: no key found")
+	}
+	return lines, nil
+}
+
+// SshKnownHostsLines returns the @cert-authority lines of a known_hosts file trusting the keys of caPublicKey to sign
+// the certificates of the hosts matching hostPatterns, "*" matching all hosts
+func SshKnownHostsLines(caPublicKey string, hostPatterns []string) ([]string, error) {
+	if len(hostPatterns) == 0 {
+		return nil, fmt.Errorf("at least one host pattern is required for a @cert-authority line")
+	}
+	for _, pattern := range hostPatterns {
+		if pattern == "" || strings.ContainsAny(pattern, " \t,") {
+			return nil, fmt.Errorf("invalid host pattern %q", pattern)
+		}
+	}
+
+	keys, err := SshCaKeyLines(caPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s %s %s", sshCertAuthority, strings.Join(hostPatterns, ","), key))
+	}
+	return lines, nil
+}
+
+// UpdateSshManagedBlock makes lines the content of the block named name in the file at path, between "# BEGIN VCERT
+// MANAGED BLOCK <name>" and "# END VCERT MANAGED BLOCK <name>" lines, leaving the rest of the file as is. The block is
+// appended to the file when missing, and the file created if needed. Nothing is written and false is returned when
+// the file is up to date, otherwise the previous version of the file, if any, is copied to path + SshBackupSuffix
+// before it is updated. The file keeps its mode and owner
+func UpdateSshManagedBlock(path string, name string, lines []string) (bool, error) {
+	for _, line := range append([]string{name}, lines...) {
+		if strings.ContainsAny(line, "\r\n") {
+			return false, fmt.Errorf("invalid line %q for %s", line, path)
+		}
+	}
+	begin := fmt.Sprintf(sshManagedBlockBegin, name)
+	end := fmt.Sprintf(sshManagedBlockEnd, name)
+
+	perm := fs.FileMode(defaultSshTrustPerm)
+	previous, err := os.ReadFile(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if exists {
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+	}
+
+	block := append(append([]string{begin}, lines...), end)
+	content, err := replaceSshManagedBlock(string(previous), begin, end, block)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if exists && bytes.Equal(previous, []byte(content)) {
+		return false, nil
+	}
+
+	if exists {
+		err = os.WriteFile(path+SshBackupSuffix, previous, perm)
+		if err != nil {
+			return false, fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+	err = WriteFileAtomically(path, []byte(content), FileOptions{Mode: perm, KeepExisting: true})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func replaceSshManagedBlock(content string, begin string, end string, block []string) (string, error) {
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	first, last := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case begin:
+			if first != -1 {
+				return "", fmt.Errorf("duplicate line %q", begin)
+			}
+			first = i
+		case end:
+			if first == -1 || last != -1 {
+				return "", fmt.Errorf("unexpected line %q", end)
+			}
+			last = i
+		}
+	}
+
+	switch {
+	case first == -1:
+		lines = append(lines, block...)
+	case last == -1:
+		return "", fmt.Errorf("line %q is missing", end)
+	default:
+		lines = append(lines[:first], append(block, lines[last+1:]...)...)
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
@@ -0,0 +1,129 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func testSshCaPublicKey(t *testing.T) string {
+	_, publicKey, err := GenerateSshKeyPairWithType(SshKeyTypeEd25519, 0, "", "ssh-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(publicKey)
+}
+
+func TestSshCaKeyLines(t *testing.T) {
+	caPublicKey := testSshCaPublicKey(t)
+
+	lines, err := SshCaKeyLines("\n" + caPublicKey + "\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0] != strings.TrimSpace(caPublicKey) {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+
+	_, err = SshCaKeyLines("not a key")
+	if err == nil {
+		t.Fatal("expected an invalid key to fail")
+	}
+	_, err = SshCaKeyLines("\n")
+	if err == nil {
+		t.Fatal("expected an empty CA public key to fail")
+	}
+}
+
+func TestSshKnownHostsLines(t *testing.T) {
+	caPublicKey := testSshCaPublicKey(t)
+
+	lines, err := SshKnownHostsLines(caPublicKey, []string{"*.example.com", "10.0.0.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "@cert-authority *.example.com,10.0.0.* " + strings.TrimSpace(caPublicKey)
+	if len(lines) != 1 || lines[0] != expected {
+		t.Fatalf("unexpected lines %q, expected %q", lines, expected)
+	}
+
+	for _, patterns := range [][]string{nil, {""}, {"a.example.com b.example.com"}} {
+		_, err = SshKnownHostsLines(caPublicKey, patterns)
+		if err == nil {
+			t.Fatalf("expected host patterns %q to fail", patterns)
+		}
+	}
+}
+
+func TestUpdateSshManagedBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_principals")
+
+	changed, err := UpdateSshManagedBlock(path, "ssh-users", []string{"ops", "deploy"})
+	if err != nil || !changed {
+		t.Fatalf("expected the file to be created, got %t, %v", changed, err)
+	}
+	if _, err = os.Stat(path + SshBackupSuffix); !os.IsNotExist(err) {
+		t.Fatalf("expected no backup of a new file, got %v", err)
+	}
+
+	// lines of the administrators are kept, as the blocks of other templates
+	content, _ := os.ReadFile(path)
+	err = os.WriteFile(path, append([]byte("root\n"), content...), 0600)
+	if err == nil {
+		err = os.Chmod(path, 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = UpdateSshManagedBlock(path, "ssh-admins", []string{"admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err = UpdateSshManagedBlock(path, "ssh-users", []string{"ops", "deploy"})
+	if err != nil || changed {
+		t.Fatalf("expected the file to be up to date, got %t, %v", changed, err)
+	}
+
+	previous, _ := os.ReadFile(path)
+	changed, err = UpdateSshManagedBlock(path, "ssh-users", []string{"ops"})
+	if err != nil || !changed {
+		t.Fatalf("expected the file to be updated, got %t, %v", changed, err)
+	}
+
+	expected := `root
+# BEGIN VCERT MANAGED BLOCK ssh-users
+ops
+# END VCERT MANAGED BLOCK ssh-users
+# BEGIN VCERT MANAGED BLOCK ssh-admins
+admin
+# END VCERT MANAGED BLOCK ssh-admins
+`
+	content, _ = os.ReadFile(path)
+	if string(content) != expected {
+		t.Fatalf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+	backup, _ := os.ReadFile(path + SshBackupSuffix)
+	if string(backup) != string(previous) {
+		t.Fatalf("unexpected backup:\n%s\nexpected:\n%s", backup, previous)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the mode of the file to be kept, got %v", info.Mode())
+	}
+
+	err = os.WriteFile(path, []byte("# BEGIN VCERT MANAGED BLOCK ssh-users\nops\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = UpdateSshManagedBlock(path, "ssh-users", []string{"ops"})
+	if err == nil {
+		t.Fatal("expected a block without end to fail")
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rand"
@@ -162,3 +163,45 @@ func GetKeystoreOptionsString(cloudProviderID *string, cloudKeystoreID *string,
 
 	return msg
 }
+
+// SleepContext pauses the current goroutine for the duration d or until ctx is done, whichever happens first.
+// It returns ctx.Err() if ctx is done before d elapses.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RequestContext is the context of the requests made by a connector. The *Context methods of the connectors set it on
+// a shallow copy of the connector, so that operations running at the same time on a shared connector never see each
+// other's context.
+//
+// The zero value is the context of a connector no operation was started on: its methods start one by calling their
+// *Context version, with context.Background(), so every operation is traced the same way.
+type RequestContext struct {
+	ctx     context.Context
+	started bool
+}
+
+// NewRequestContext returns the RequestContext of an operation started with ctx
+func NewRequestContext(ctx context.Context) RequestContext {
+	return RequestContext{ctx: ctx, started: true}
+}
+
+// Context returns the context of the requests
+func (r RequestContext) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// Started returns true if r is the context of an operation started by a *Context method
+func (r RequestContext) Started() bool {
+	return r.started
+}
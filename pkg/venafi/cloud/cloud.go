@@ -38,6 +38,7 @@ import (
 
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 	"github.com/Venafi/vcert/v5/pkg/policy"
 	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/Venafi/vcert/v5/pkg/verror"
@@ -243,6 +244,9 @@ type ApplicationDetails struct {
 
 // GenerateRequest generates a CertificateRequest based on the zone configuration, and returns the request along with the private key.
 func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *certificate.Request) (err error) {
+	if !c.ctx.Started() {
+		return c.GenerateRequestContext(c.ctx.Context(), config, req)
+	}
 	switch req.CsrOrigin {
 	case certificate.LocalGeneratedCSR:
 		if config == nil {
@@ -329,7 +333,7 @@ func (c *Connector) request(method string, url string, data interface{}, authNot
 		payload = bytes.NewReader(b)
 	}
 
-	r, err := http.NewRequest(method, url, payload)
+	r, err := http.NewRequestWithContext(c.ctx.Context(), method, url, payload)
 	if err != nil {
 		err = fmt.Errorf("%w: %v", verror.VcertError, err)
 		return
@@ -352,9 +356,10 @@ func (c *Connector) request(method string, url string, data interface{}, authNot
 
 	var httpClient = c.getHTTPClient()
 
-	res, err := httpClient.Do(r)
+	idempotent := method != http.MethodPost && method != http.MethodPatch
+	res, err := httputils.Do(httpClient, r, idempotent, c.retryPolicy, c.rateLimiter)
 	if err != nil {
-		err = fmt.Errorf("%w: %v", verror.ServerUnavailableError, err)
+		err = fmt.Errorf("%w: %w", verror.ServerUnavailableError, err)
 		return
 	}
 	statusCode = res.StatusCode
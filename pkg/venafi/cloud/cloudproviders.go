@@ -1,7 +1,6 @@
 package cloud
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -40,6 +39,9 @@ const (
 )
 
 func (c *Connector) ProvisionCertificate(req *domain.ProvisioningRequest, options *domain.ProvisioningOptions) (*domain.ProvisioningMetadata, error) {
+	if !c.ctx.Started() {
+		return c.ProvisionCertificateContext(c.ctx.Context(), req, options)
+	}
 	log.Printf("Starting Provisioning Flow")
 
 	if req == nil {
@@ -120,7 +122,7 @@ func (c *Connector) ProvisionCertificate(req *domain.ProvisioningRequest, option
 	}
 
 	log.Printf("Provisioning Certificate ID %s for Keystore %s", certificateIDString, cloudKeystore.ID)
-	_, err = c.cloudProvidersClient.ProvisionCertificate(context.Background(), certificateIDString, cloudKeystore.ID, wsClientID, provisioningOptions)
+	_, err = c.cloudProvidersClient.ProvisionCertificate(c.ctx.Context(), certificateIDString, cloudKeystore.ID, wsClientID, provisioningOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -181,7 +183,7 @@ func (c *Connector) ProvisionCertificateToMachineIdentity(req domain.Provisionin
 	}
 	log.Println("Certificate is VCP generated")
 
-	ctx := context.Background()
+	ctx := c.ctx.Context()
 	wsClientID := uuid.New().String()
 
 	wsConn, err := c.notificationSvcClient.Subscribe(wsClientID)
@@ -228,7 +230,7 @@ func (c *Connector) ProvisionCertificateToMachineIdentity(req domain.Provisionin
 }
 
 func (c *Connector) GetCloudProvider(request domain.GetCloudProviderRequest) (*domain.CloudProvider, error) {
-	cloudProvider, err := c.cloudProvidersClient.GetCloudProvider(context.Background(), request)
+	cloudProvider, err := c.cloudProvidersClient.GetCloudProvider(c.ctx.Context(), request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve Cloud Provider with name %s: %w", request.Name, err)
 	}
@@ -239,7 +241,7 @@ func (c *Connector) GetCloudProvider(request domain.GetCloudProviderRequest) (*d
 }
 
 func (c *Connector) GetCloudKeystore(request domain.GetCloudKeystoreRequest) (*domain.CloudKeystore, error) {
-	cloudKeystore, err := c.cloudProvidersClient.GetCloudKeystore(context.Background(), request)
+	cloudKeystore, err := c.cloudProvidersClient.GetCloudKeystore(c.ctx.Context(), request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve Cloud Keystore: %w", err)
 	}
@@ -255,7 +257,7 @@ func (c *Connector) GetMachineIdentity(request domain.GetCloudMachineIdentityReq
 		return nil, fmt.Errorf("machine identity ID cannot be empty")
 	}
 
-	machineIdentity, err := c.cloudProvidersClient.GetMachineIdentity(context.Background(), request)
+	machineIdentity, err := c.cloudProvidersClient.GetMachineIdentity(c.ctx.Context(), request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve Cloud Machine Identity with ID %s: %w", *request.MachineIdentityID, err)
 	}
@@ -269,7 +271,7 @@ func (c *Connector) DeleteMachineIdentity(machineIdentityID string) (bool, error
 	if machineIdentityID == "" {
 		return false, fmt.Errorf("machine identity ID cannot be nil")
 	}
-	deleted, err := c.cloudProvidersClient.DeleteMachineIdentity(context.Background(), machineIdentityID)
+	deleted, err := c.cloudProvidersClient.DeleteMachineIdentity(c.ctx.Context(), machineIdentityID)
 	if err != nil {
 		return false, fmt.Errorf("failed to delete machine identity with ID %s: %w", machineIdentityID, err)
 	}
@@ -38,6 +38,7 @@ import (
 
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 	"github.com/Venafi/vcert/v5/pkg/policy"
 	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/Venafi/vcert/v5/pkg/verror"
@@ -73,6 +74,10 @@ const (
 	urlTeams                          urlResource = apiVersion + "teams"
 	urlCertificateDetails                         = basePath + "certificates/%s"
 	urlGraphql                                    = "graphql"
+	urlSshIssuingTemplates            urlResource = apiVersion + "sshcertificateissuingtemplates"
+	urlSshIssuingTemplateByID                     = urlSshIssuingTemplates + "/%s"
+	urlSshCertificateRequests         urlResource = apiVersion + "sshcertificaterequests"
+	urlSshCertificateRequestByID                  = urlSshCertificateRequests + "/%s"
 
 	defaultAppName = "Default"
 	oauthTokenType = "Bearer"
@@ -98,6 +103,9 @@ type Connector struct {
 	userAgent             string
 	cloudProvidersClient  *cloudproviders.CloudProvidersClient
 	notificationSvcClient *notificationservice.NotificationServiceClient
+	ctx                   util.RequestContext
+	retryPolicy           *httputils.RetryPolicy
+	rateLimiter           *httputils.RateLimiter
 }
 
 // NewConnector creates a new Venafi Cloud Connector object used to communicate with Venafi Cloud
@@ -122,6 +130,17 @@ func (c *Connector) SetZone(z string) {
 	c.zone = cZone
 }
 
+// WithZone returns a copy of c working on zone, an application and an issuing template alias separated by a
+// backslash. The application and template of c, resolved from its zone, are not carried over. The copy keeps the
+// API key or access token of c, so it doesn't need to authenticate again, and shares its HTTP client and its cloud
+// providers and notification clients. It can be used concurrently with c.
+func (c *Connector) WithZone(zone string) endpoint.Connector {
+	c.getHTTPClient()
+	cc := *c
+	cc.SetZone(zone)
+	return &cc
+}
+
 func (c *Connector) SetUserAgent(userAgent string) {
 	c.userAgent = userAgent
 }
@@ -130,13 +149,29 @@ func (c *Connector) SetHTTPClient(client *http.Client) {
 	c.client = client
 }
 
+// SetRetryPolicy sets how the requests failing with a transient error are retried. A nil policy disables retries
+func (c *Connector) SetRetryPolicy(policy *httputils.RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// SetRateLimiter sets the limiter every request waits on before being sent. A nil limiter disables rate limiting
+func (c *Connector) SetRateLimiter(limiter *httputils.RateLimiter) {
+	c.rateLimiter = limiter
+}
+
 // Ping attempts to connect to the Venafi Cloud API and returns an error if it cannot
 func (c *Connector) Ping() (err error) {
+	if !c.ctx.Started() {
+		return c.PingContext(c.ctx.Context())
+	}
 	return nil
 }
 
 // Authenticate authenticates the user with Venafi Cloud using the provided API Key
 func (c *Connector) Authenticate(auth *endpoint.Authentication) error {
+	if !c.ctx.Started() {
+		return c.AuthenticateContext(c.ctx.Context(), auth)
+	}
 	if auth == nil {
 		return fmt.Errorf("failed to authenticate: missing credentials")
 	}
@@ -174,6 +209,9 @@ func (c *Connector) Authenticate(auth *endpoint.Authentication) error {
 }
 
 func (c *Connector) ReadPolicyConfiguration() (policy *endpoint.Policy, err error) {
+	if !c.ctx.Started() {
+		return c.ReadPolicyConfigurationContext(c.ctx.Context())
+	}
 	if !c.isAuthenticated() {
 		return nil, fmt.Errorf("must be autheticated to request a certificate")
 
@@ -188,6 +226,9 @@ func (c *Connector) ReadPolicyConfiguration() (policy *endpoint.Policy, err erro
 
 // ReadZoneConfiguration reads the Zone information needed for generating and requesting a certificate from Venafi Cloud
 func (c *Connector) ReadZoneConfiguration() (config *endpoint.ZoneConfiguration, err error) {
+	if !c.ctx.Started() {
+		return c.ReadZoneConfigurationContext(c.ctx.Context())
+	}
 	if !c.isAuthenticated() {
 		return nil, fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -227,6 +268,9 @@ func (c *Connector) ReadZoneConfiguration() (config *endpoint.ZoneConfiguration,
 
 // GetZonesByParent returns a list of valid zones for a VaaS application specified by parent
 func (c *Connector) GetZonesByParent(parent string) ([]string, error) {
+	if !c.ctx.Started() {
+		return c.GetZonesByParentContext(c.ctx.Context(), parent)
+	}
 	if !c.isAuthenticated() {
 		return nil, fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -251,6 +295,9 @@ func (c *Connector) ResetCertificate(_ *certificate.Request, _ bool) (err error)
 
 // RequestCertificate submits the CSR to the Venafi Cloud API for processing
 func (c *Connector) RequestCertificate(req *certificate.Request) (requestID string, err error) {
+	if !c.ctx.Started() {
+		return c.RequestCertificateContext(c.ctx.Context(), req)
+	}
 	if !c.isAuthenticated() {
 		return "", fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -277,6 +324,9 @@ func (c *Connector) RequestCertificate(req *certificate.Request) (requestID stri
 
 // RetrieveCertificate retrieves the certificate for the specified ID
 func (c *Connector) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	if !c.ctx.Started() {
+		return c.RetrieveCertificateContext(c.ctx.Context(), req)
+	}
 	if !c.isAuthenticated() {
 		return nil, fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -387,6 +437,9 @@ func (c *Connector) RetrieveCertificate(req *certificate.Request) (*certificate.
 
 // RenewCertificate attempts to renew the certificate
 func (c *Connector) RenewCertificate(renewReq *certificate.RenewalRequest) (requestID string, err error) {
+	if !c.ctx.Started() {
+		return c.RenewCertificateContext(c.ctx.Context(), renewReq)
+	}
 	if !c.isAuthenticated() {
 		return "", fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -507,6 +560,9 @@ func (c *Connector) RenewCertificate(renewReq *certificate.RenewalRequest) (requ
 
 // RetireCertificate attempts to retire the certificate
 func (c *Connector) RetireCertificate(retireReq *certificate.RetireRequest) error {
+	if !c.ctx.Started() {
+		return c.RetireCertificateContext(c.ctx.Context(), retireReq)
+	}
 	if !c.isAuthenticated() {
 		return fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -577,6 +633,9 @@ func (c *Connector) RevokeCertificate(_ *certificate.RevocationRequest) (err err
 }
 
 func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (*certificate.ImportResponse, error) {
+	if !c.ctx.Started() {
+		return c.ImportCertificateContext(c.ctx.Context(), req)
+	}
 	if !c.isAuthenticated() {
 		return nil, fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -636,7 +695,10 @@ func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (*certific
 	} else if !(len(r.CertificateInformations) == 1) {
 		return nil, fmt.Errorf("%w: certificate was not imported on unknown reason", verror.ServerBadDataResponce)
 	}
-	time.Sleep(time.Second)
+	err = util.SleepContext(c.ctx.Context(), time.Second)
+	if err != nil {
+		return nil, err
+	}
 	foundCert, err := c.searchCertificatesByFingerprint(fingerprint)
 	if err != nil {
 		return nil, err
@@ -650,6 +712,9 @@ func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (*certific
 }
 
 func (c *Connector) ListCertificates(filter endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	if !c.ctx.Started() {
+		return c.ListCertificatesContext(c.ctx.Context(), filter)
+	}
 	if !c.isAuthenticated() {
 		return nil, fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -696,6 +761,9 @@ func (c *Connector) SearchCertificates(_ *certificate.SearchRequest) (*certifica
 }
 
 func (c *Connector) SearchCertificate(zone string, cn string, sans *certificate.Sans, certMinTimeLeft time.Duration) (certificateInfo *certificate.CertificateInfo, err error) {
+	if !c.ctx.Started() {
+		return c.SearchCertificateContext(c.ctx.Context(), zone, cn, sans, certMinTimeLeft)
+	}
 	if !c.isAuthenticated() {
 		return nil, fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -771,7 +839,9 @@ func (c *Connector) getCertIDFromPickupID(pickupId string, timeout time.Duration
 		if time.Now().After(startTime.Add(timeout)) {
 			return nil, endpoint.ErrRetrieveCertificateTimeout{CertificateID: pickupId}
 		}
-		time.Sleep(2 * time.Second)
+		if err := util.SleepContext(c.ctx.Context(), 2*time.Second); err != nil {
+			return nil, err
+		}
 	}
 	if certificateId == "" {
 		return nil, fmt.Errorf("something went wrong during polling cert status and we still got and empty CertificateID at the end")
@@ -781,6 +851,9 @@ func (c *Connector) getCertIDFromPickupID(pickupId string, timeout time.Duration
 }
 
 func (c *Connector) IsCSRServiceGenerated(req *certificate.Request) (bool, error) {
+	if !c.ctx.Started() {
+		return c.IsCSRServiceGeneratedContext(c.ctx.Context(), req)
+	}
 	if !c.isAuthenticated() {
 		return false, fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -875,7 +948,9 @@ func getCertificateId(c *Connector, req *certificate.Request) (string, error) {
 		if time.Now().After(startTime.Add(req.Timeout)) {
 			return "", endpoint.ErrRetrieveCertificateTimeout{CertificateID: req.PickupID}
 		}
-		time.Sleep(2 * time.Second)
+		if err := util.SleepContext(c.ctx.Context(), 2*time.Second); err != nil {
+			return "", err
+		}
 	}
 
 	return "", endpoint.ErrRetrieveCertificateTimeout{CertificateID: req.PickupID}
@@ -905,7 +980,7 @@ func (c *Connector) GetAccessToken(auth *endpoint.Authentication) (*TLSPCAccessT
 	body.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
 	body.Set("client_assertion", auth.ExternalJWT)
 
-	r, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body.Encode()))
+	r, err := http.NewRequestWithContext(c.ctx.Context(), http.MethodPost, url, strings.NewReader(body.Encode()))
 	if err != nil {
 		err = fmt.Errorf("%w: %v", verror.VcertError, err)
 		return nil, err
@@ -914,9 +989,10 @@ func (c *Connector) GetAccessToken(auth *endpoint.Authentication) (*TLSPCAccessT
 	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
 	httpClient := c.getHTTPClient()
-	resp, err := httpClient.Do(r)
+	// exchanging the JWT for an access token has no side effect, so it can always be retried
+	resp, err := httputils.Do(httpClient, r, true, c.retryPolicy, c.rateLimiter)
 	if err != nil {
-		err = fmt.Errorf("%w: %v", verror.ServerUnavailableError, err)
+		err = fmt.Errorf("%w: %w", verror.ServerUnavailableError, err)
 		return nil, err
 	}
 
@@ -1216,7 +1292,10 @@ func (c *Connector) waitForCertificate(url string, request *certificate.Request)
 			err = endpoint.ErrRetrieveCertificateTimeout{CertificateID: request.PickupID}
 			return
 		}
-		time.Sleep(2 * time.Second)
+		err = util.SleepContext(c.ctx.Context(), 2*time.Second)
+		if err != nil {
+			return
+		}
 	}
 }
 
@@ -1306,7 +1385,9 @@ func (c *Connector) getCertificate(certificateId string) (*managedCertificate, e
 				return nil, err
 			}
 		}
-		time.Sleep(2 * time.Second)
+		if err := util.SleepContext(c.ctx.Context(), 2*time.Second); err != nil {
+			return nil, err
+		}
 	}
 }
 
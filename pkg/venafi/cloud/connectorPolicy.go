@@ -9,6 +9,9 @@ import (
 )
 
 func (c *Connector) GetPolicy(name string) (*policy.PolicySpecification, error) {
+	if !c.ctx.Started() {
+		return c.GetPolicyContext(c.ctx.Context(), name)
+	}
 	if !c.isAuthenticated() {
 		return nil, fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -38,6 +41,9 @@ func (c *Connector) GetPolicy(name string) (*policy.PolicySpecification, error)
 }
 
 func (c *Connector) SetPolicy(name string, ps *policy.PolicySpecification) (string, error) {
+	if !c.ctx.Started() {
+		return c.SetPolicyContext(c.ctx.Context(), name, ps)
+	}
 	if !c.isAuthenticated() {
 		return "", fmt.Errorf("must be autheticated to request a certificate")
 	}
@@ -1,19 +1,311 @@
 package cloud
 
-import "github.com/Venafi/vcert/v5/pkg/certificate"
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
 
-func (c *Connector) RetrieveSshConfig(_ *certificate.SshCaTemplateRequest) (*certificate.SshConfig, error) {
-	panic("operation is not supported yet")
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/util"
+	"github.com/Venafi/vcert/v5/pkg/verror"
+)
+
+// Final statuses of an SSH certificate request, any other one meaning it is pending, and the statuses of
+// certificate.ProcessingDetails they map to, which are the ones returned by TPP
+const (
+	sshRequestStatusIssued   = "ISSUED"
+	sshRequestStatusRejected = "REJECTED"
+	sshRequestStatusFailed   = "FAILED"
+
+	sshProcessingStatusPending = "Pending Issue"
+	sshProcessingStatusIssued  = "Issued"
+)
+
+// The types below are the bodies of the sshcertificateissuingtemplates and sshcertificaterequests resources of the
+// TLSPC API. The tests use a stand-in built on them, and TestSSHTenant checks them against a tenant when
+// CLOUD_SSH_TEMPLATE is set
+type sshIssuingTemplate struct {
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	CaPublicKey       string   `json:"caPublicKey"`
+	DefaultPrincipals []string `json:"defaultPrincipals,omitempty"`
+}
+
+type sshIssuingTemplates struct {
+	SshIssuingTemplates []sshIssuingTemplate `json:"sshCertificateIssuingTemplates"`
 }
 
-func (c *Connector) RetrieveSSHCertificate(_ *certificate.SshCertRequest) (response *certificate.SshCertificateObject, err error) {
-	panic("operation is not supported yet")
+type sshCertificateRequest struct {
+	IssuingTemplateID    string            `json:"certificateIssuingTemplateId"`
+	KeyID                string            `json:"keyId,omitempty"`
+	Principals           []string          `json:"principals,omitempty"`
+	ValidityPeriod       string            `json:"validityPeriod,omitempty"`
+	PublicKey            string            `json:"publicKey,omitempty"`
+	PrivateKeyPassphrase string            `json:"privateKeyPassphrase,omitempty"`
+	Extensions           map[string]string `json:"extensions,omitempty"`
+	ForceCommand         string            `json:"forceCommand,omitempty"`
+	SourceAddresses      []string          `json:"sourceAddresses,omitempty"`
+	DestinationAddresses []string          `json:"destinationAddresses,omitempty"`
 }
 
-func (c *Connector) RequestSSHCertificate(_ *certificate.SshCertRequest) (response *certificate.SshCertificateObject, err error) {
-	panic("operation is not supported yet")
+type sshCertificateRequestResponse struct {
+	ID                string `json:"id"`
+	IssuingTemplateID string `json:"certificateIssuingTemplateId"`
+	Status            string `json:"status"`
+	StatusDescription string `json:"statusDescription,omitempty"`
+	// Certificate is the issued certificate in the authorized_keys format of the -cert.pub files. PrivateKey and
+	// PublicKey are only set when the key pair was generated by the service, the private key being encrypted with
+	// the passphrase of the request
+	Certificate string `json:"certificate,omitempty"`
+	PrivateKey  string `json:"privateKey,omitempty"`
+	PublicKey   string `json:"publicKey,omitempty"`
+}
+
+// RetrieveSshConfig retrieves the public key of the CA of an SSH certificate issuing template, found by name or by
+// ID, and its default principals
+func (c *Connector) RetrieveSshConfig(ca *certificate.SshCaTemplateRequest) (*certificate.SshConfig, error) {
+	if !c.ctx.Started() {
+		return c.RetrieveSshConfigContext(c.ctx.Context(), ca)
+	}
+	var template *sshIssuingTemplate
+	var err error
+	if ca.Template != "" {
+		log.Println("Retrieving the configured CA public key for template:", ca.Template)
+		template, err = c.getSshIssuingTemplateByName(ca.Template)
+	} else if ca.Guid != "" {
+		log.Println("Retrieving the configured CA public key for template with ID:", ca.Guid)
+		template, err = c.getSshIssuingTemplate(ca.Guid)
+	} else {
+		return nil, fmt.Errorf("%w: CA template or ID are not specified", verror.UserDataError)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificate.SshConfig{
+		CaPublicKey: template.CaPublicKey,
+		Principals:  template.DefaultPrincipals,
+	}, nil
+}
+
+// RetrieveSSHCertificate retrieves the SSH certificate requested with PickupID, or Guid, which are the ID of the
+// request. It waits up to req.Timeout for the certificate to be issued
+func (c *Connector) RetrieveSSHCertificate(req *certificate.SshCertRequest) (response *certificate.SshCertificateObject, err error) {
+	if !c.ctx.Started() {
+		return c.RetrieveSSHCertificateContext(c.ctx.Context(), req)
+	}
+	requestID := req.PickupID
+	if requestID == "" {
+		requestID = req.Guid
+	}
+	if requestID == "" {
+		return nil, fmt.Errorf("%w: pickup ID of the SSH certificate request is not specified", verror.UserDataError)
+	}
+
+	startTime := time.Now()
+	for {
+		details, err := c.getSshCertificateRequest(requestID)
+		if err != nil {
+			return nil, err
+		}
+		switch details.Status {
+		case sshRequestStatusIssued:
+			return newSshCertificateObject(details)
+		case sshRequestStatusRejected, sshRequestStatusFailed:
+			return nil, endpoint.ErrCertificateRejected{CertificateID: requestID, Status: details.StatusDescription}
+		}
+
+		if req.Timeout == 0 {
+			return nil, endpoint.ErrCertificatePending{CertificateID: requestID, Status: details.Status}
+		}
+		if time.Now().After(startTime.Add(req.Timeout)) {
+			return nil, endpoint.ErrRetrieveCertificateTimeout{CertificateID: requestID}
+		}
+		if err := util.SleepContext(c.ctx.Context(), 2*time.Second); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// RequestSSHCertificate requests an SSH certificate from the issuing template named req.Template. The key pair is
+// generated by the service when req.PublicKeyData is empty. The returned object holds the certificate when it is
+// issued right away, otherwise its processing status is "Pending Issue" and its DN is the pickup ID of the request
+func (c *Connector) RequestSSHCertificate(req *certificate.SshCertRequest) (response *certificate.SshCertificateObject, err error) {
+	if !c.ctx.Started() {
+		return c.RequestSSHCertificateContext(c.ctx.Context(), req)
+	}
+	if req.Template == "" {
+		return nil, fmt.Errorf("%w: SSH certificate issuing template is not specified", verror.UserDataError)
+	}
+	template, err := c.getSshIssuingTemplateByName(req.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	sshReq := newSshCertificateRequest(template.ID, req)
+	if sshReq.KeyID == "" {
+		log.Println("Requesting SSH certificate from", template.Name)
+	} else {
+		log.Println("Requesting SSH certificate with certificate identifier:", sshReq.KeyID)
+	}
+
+	statusCode, status, body, err := c.request("POST", c.getURL(urlSshCertificateRequests), sshReq)
+	if err != nil {
+		return nil, err
+	}
+	details, err := parseSshResult[sshCertificateRequestResponse](http.StatusCreated, statusCode, status, body, "SSH certificate request")
+	if err != nil {
+		return nil, err
+	}
+	log.Println("SSH certificate request ID:", details.ID)
+
+	switch details.Status {
+	case sshRequestStatusIssued:
+		return newSshCertificateObject(details)
+	case sshRequestStatusRejected, sshRequestStatusFailed:
+		return nil, endpoint.ErrCertificateRejected{CertificateID: details.ID, Status: details.StatusDescription}
+	}
+	return &certificate.SshCertificateObject{
+		Guid:   details.ID,
+		DN:     details.ID,
+		CAGuid: details.IssuingTemplateID,
+		CADN:   template.Name,
+		ProcessingDetails: certificate.ProcessingDetails{
+			Status:            sshProcessingStatusPending,
+			StatusDescription: details.StatusDescription,
+		},
+	}, nil
 }
 
+// RetrieveAvailableSSHTemplates returns the SSH certificate issuing templates, their name as DN and their ID as Guid
 func (c *Connector) RetrieveAvailableSSHTemplates() (response []certificate.SshAvaliableTemplate, err error) {
-	panic("operation is not supported yet")
+	if !c.ctx.Started() {
+		return c.RetrieveAvailableSSHTemplatesContext(c.ctx.Context())
+	}
+	templates, err := c.getSshIssuingTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	response = make([]certificate.SshAvaliableTemplate, 0, len(templates))
+	for _, t := range templates {
+		response = append(response, certificate.SshAvaliableTemplate{DN: t.Name, Guid: t.ID})
+	}
+	return response, nil
+}
+
+func (c *Connector) getSshIssuingTemplates() ([]sshIssuingTemplate, error) {
+	statusCode, status, body, err := c.request("GET", c.getURL(urlSshIssuingTemplates), nil)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := parseSshResult[sshIssuingTemplates](http.StatusOK, statusCode, status, body, "SSH certificate issuing templates read")
+	if err != nil {
+		return nil, err
+	}
+	return templates.SshIssuingTemplates, nil
+}
+
+func (c *Connector) getSshIssuingTemplate(id string) (*sshIssuingTemplate, error) {
+	url := fmt.Sprintf(c.getURL(urlSshIssuingTemplateByID), id)
+	statusCode, status, body, err := c.request("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: SSH certificate issuing template with ID %s", verror.ZoneNotFoundError, id)
+	}
+	return parseSshResult[sshIssuingTemplate](http.StatusOK, statusCode, status, body, "SSH certificate issuing template read")
+}
+
+func (c *Connector) getSshIssuingTemplateByName(name string) (*sshIssuingTemplate, error) {
+	templates, err := c.getSshIssuingTemplates()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range templates {
+		if t.Name == name {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: SSH certificate issuing template %s", verror.ZoneNotFoundError, name)
+}
+
+func (c *Connector) getSshCertificateRequest(id string) (*sshCertificateRequestResponse, error) {
+	url := fmt.Sprintf(c.getURL(urlSshCertificateRequestByID), id)
+	statusCode, status, body, err := c.request("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseSshResult[sshCertificateRequestResponse](http.StatusOK, statusCode, status, body, "SSH certificate request read")
+}
+
+func newSshCertificateRequest(templateID string, req *certificate.SshCertRequest) sshCertificateRequest {
+	sshReq := sshCertificateRequest{
+		IssuingTemplateID:    templateID,
+		KeyID:                req.KeyId,
+		Principals:           req.Principals,
+		ValidityPeriod:       req.ValidityPeriod,
+		PublicKey:            req.PublicKeyData,
+		ForceCommand:         req.ForceCommand,
+		SourceAddresses:      req.SourceAddresses,
+		DestinationAddresses: req.DestinationAddresses,
+	}
+	if req.PublicKeyData == "" {
+		sshReq.PrivateKeyPassphrase = req.PrivateKeyPassphrase
+	}
+
+	// extensions are given as name or name:value, as for TPP
+	if len(req.Extensions) > 0 {
+		sshReq.Extensions = make(map[string]string, len(req.Extensions))
+		for _, extension := range req.Extensions {
+			name, value, _ := strings.Cut(extension, ":")
+			sshReq.Extensions[name] = value
+		}
+	}
+	return sshReq
+}
+
+// newSshCertificateObject converts an issued request, its details being read from the certificate itself
+func newSshCertificateObject(details *sshCertificateRequestResponse) (*certificate.SshCertificateObject, error) {
+	certDetails, err := certificate.ParseSshCertificateDetails(details.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", verror.ServerError, err)
+	}
+	return &certificate.SshCertificateObject{
+		Guid:               details.ID,
+		DN:                 details.ID,
+		CAGuid:             details.IssuingTemplateID,
+		CertificateData:    details.Certificate,
+		PrivateKeyData:     details.PrivateKey,
+		PublicKeyData:      details.PublicKey,
+		CertificateDetails: *certDetails,
+		ProcessingDetails: certificate.ProcessingDetails{
+			Status:            sshProcessingStatusIssued,
+			StatusDescription: details.StatusDescription,
+		},
+	}, nil
+}
+
+func parseSshResult[T any](expectedStatusCode int, httpStatusCode int, httpStatus string, body []byte, operation string) (*T, error) {
+	switch httpStatusCode {
+	case expectedStatusCode:
+		return parseJSON[T](body, verror.ServerError)
+	case http.StatusUnauthorized:
+		return nil, verror.UnauthorizedError
+	default:
+		respErrors, err := parseResponseErrors(body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unexpected status code on Venafi Cloud %s. Status: %s", verror.ServerError, operation, httpStatus)
+		}
+
+		respError := fmt.Sprintf("unexpected status code on Venafi Cloud %s. Status: %s\n", operation, httpStatus)
+		for _, e := range respErrors {
+			respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+	}
 }
@@ -0,0 +1,87 @@
+//go:build !standin
+
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cloud
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+// TestSSHTenant runs the SSH certificate lifecycle against the TLSPC tenant of CLOUD_APIKEY, with the issuing template
+// named CLOUD_SSH_TEMPLATE, to validate the requests and responses the stand-in above is built on
+func TestSSHTenant(t *testing.T) {
+	if ctx.CloudSshTemplate == "" {
+		t.Skip("SSH certificate issuing template is empty. See Makefile")
+	}
+	c := getTestConnector("")
+	err := c.Authenticate(&endpoint.Authentication{APIKey: ctx.CloudAPIkey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := c.RetrieveSshConfig(&certificate.SshCaTemplateRequest{Template: ctx.CloudSshTemplate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(conf.CaPublicKey))
+	if err != nil {
+		t.Fatalf("invalid CA public key %q: %s", conf.CaPublicKey, err)
+	}
+
+	req := &certificate.SshCertRequest{
+		Template:   ctx.CloudSshTemplate,
+		KeyId:      "vcert-test-" + strings.ReplaceAll(time.Now().Format(time.RFC3339), ":", ""),
+		Principals: []string{"vcert"},
+		KeyType:    util.SshKeyTypeEd25519,
+		Timeout:    time.Minute,
+	}
+	if _, err := req.GenerateKeyPair("", ""); err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.RequestSSHCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.CertificateData == "" {
+		data, err = c.RetrieveSSHCertificate(&certificate.SshCertRequest{PickupID: data.DN, Timeout: time.Minute})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(data.CertificateData))
+	if err != nil {
+		t.Fatalf("invalid certificate %q: %s", data.CertificateData, err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		t.Fatalf("not a certificate: %q", data.CertificateData)
+	}
+	if cert.KeyId != req.KeyId || !bytes.Equal(cert.SignatureKey.Marshal(), caKey.Marshal()) {
+		t.Fatalf("unexpected certificate %+v", cert)
+	}
+}
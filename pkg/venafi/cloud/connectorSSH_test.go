@@ -0,0 +1,357 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cloud
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/util"
+	"github.com/Venafi/vcert/v5/pkg/verror"
+)
+
+const (
+	sshTestingAccessToken  = "ssh-access-token"
+	sshTestingTemplateID   = "7f6a5a30-4d3a-11ee-9b4c-3f8b4bbf6b21"
+	sshTestingTemplateName = "ssh-users"
+)
+
+// sshMockServer is a stand-in for the SSH certificate API of TLSPC, signing the requested certificates with an
+// ed25519 CA. Requests are issued on their first read when pending is set, otherwise right away
+type sshMockServer struct {
+	server  *httptest.Server
+	ca      ssh.Signer
+	pending bool
+
+	mu       sync.Mutex
+	requests map[string]*sshCertificateRequestResponse
+	received []sshCertificateRequest
+}
+
+func newSshMockServer(t *testing.T) *sshMockServer {
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &sshMockServer{ca: ca, requests: map[string]*sshCertificateRequestResponse{}}
+	s.server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *sshMockServer) connector(t *testing.T) *Connector {
+	trust := x509.NewCertPool()
+	trust.AddCert(s.server.Certificate())
+	c, err := NewConnector(s.server.URL, "", false, trust)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Authenticate(&endpoint.Authentication{AccessToken: sshTestingAccessToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (s *sshMockServer) caPublicKey() string {
+	return string(ssh.MarshalAuthorizedKey(s.ca.PublicKey()))
+}
+
+func (s *sshMockServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+sshTestingAccessToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	templates := "/" + string(urlSshIssuingTemplates)
+	requests := "/" + string(urlSshCertificateRequests)
+	template := sshIssuingTemplate{
+		ID:                sshTestingTemplateID,
+		Name:              sshTestingTemplateName,
+		CaPublicKey:       s.caPublicKey(),
+		DefaultPrincipals: []string{"ops", "deploy"},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == templates:
+		writeJSON(w, http.StatusOK, sshIssuingTemplates{SshIssuingTemplates: []sshIssuingTemplate{template}})
+	case r.Method == http.MethodGet && r.URL.Path == templates+"/"+sshTestingTemplateID:
+		writeJSON(w, http.StatusOK, template)
+	case r.Method == http.MethodPost && r.URL.Path == requests:
+		var req sshCertificateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.received = append(s.received, req)
+		if req.IssuingTemplateID != sshTestingTemplateID {
+			writeErrors(w, http.StatusBadRequest, "unknown SSH certificate issuing template")
+			return
+		}
+		resp := &sshCertificateRequestResponse{
+			ID:                fmt.Sprintf("ssh-request-%d", len(s.received)),
+			IssuingTemplateID: req.IssuingTemplateID,
+			Status:            "PENDING",
+		}
+		if req.KeyID == "rejected" {
+			resp.Status, resp.StatusDescription = "REJECTED", "key ID is not allowed"
+		} else if !s.pending {
+			if err := s.issue(resp, req); err != nil {
+				writeErrors(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		s.requests[resp.ID] = resp
+		writeJSON(w, http.StatusCreated, resp)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, requests+"/"):
+		resp, ok := s.requests[strings.TrimPrefix(r.URL.Path, requests+"/")]
+		if !ok {
+			writeErrors(w, http.StatusNotFound, "SSH certificate request not found")
+			return
+		}
+		if resp.Status == "PENDING" {
+			if err := s.issue(resp, s.received[len(s.received)-1]); err != nil {
+				writeErrors(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, resp)
+	default:
+		writeErrors(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *sshMockServer) issue(resp *sshCertificateRequestResponse, req sshCertificateRequest) error {
+	publicKeyData := req.PublicKey
+	if publicKeyData == "" {
+		privateKey, publicKey, err := util.GenerateSshKeyPairWithType(util.SshKeyTypeEd25519, 0, req.PrivateKeyPassphrase, req.KeyID)
+		if err != nil {
+			return err
+		}
+		resp.PrivateKey, resp.PublicKey = string(privateKey), string(publicKey)
+		publicKeyData = resp.PublicKey
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKeyData))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	cert := &ssh.Certificate{
+		Key:             publicKey,
+		Serial:          42,
+		CertType:        ssh.UserCert,
+		KeyId:           req.KeyID,
+		ValidPrincipals: req.Principals,
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: map[string]string{},
+			Extensions:      req.Extensions,
+		},
+	}
+	if req.ForceCommand != "" {
+		cert.CriticalOptions["force-command"] = req.ForceCommand
+	}
+	if len(req.SourceAddresses) > 0 {
+		cert.CriticalOptions["source-address"] = strings.Join(req.SourceAddresses, ",")
+	}
+	if err := cert.SignCert(rand.Reader, s.ca); err != nil {
+		return err
+	}
+	resp.Status = "ISSUED"
+	resp.Certificate = string(ssh.MarshalAuthorizedKey(cert))
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeErrors(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, jsonData{Errors: []responseError{{Code: statusCode, Message: message}}})
+}
+
+func TestSSHRetrieveSshConfig(t *testing.T) {
+	s := newSshMockServer(t)
+	c := s.connector(t)
+
+	for _, req := range []certificate.SshCaTemplateRequest{{Template: sshTestingTemplateName}, {Guid: sshTestingTemplateID}} {
+		conf, err := c.RetrieveSshConfig(&req)
+		if err != nil {
+			t.Fatalf("%+v: %s", req, err)
+		}
+		if conf.CaPublicKey != s.caPublicKey() {
+			t.Fatalf("%+v: unexpected CA public key %q", req, conf.CaPublicKey)
+		}
+		if strings.Join(conf.Principals, ",") != "ops,deploy" {
+			t.Fatalf("%+v: unexpected default principals %v", req, conf.Principals)
+		}
+	}
+
+	_, err := c.RetrieveSshConfig(&certificate.SshCaTemplateRequest{Template: "unknown"})
+	if !errors.Is(err, verror.ZoneNotFoundError) {
+		t.Fatalf("expected a template not found error, got %v", err)
+	}
+	_, err = c.RetrieveSshConfig(&certificate.SshCaTemplateRequest{})
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a user data error, got %v", err)
+	}
+}
+
+func TestSSHRetrieveAvailableSSHTemplates(t *testing.T) {
+	s := newSshMockServer(t)
+
+	templates, err := s.connector(t).RetrieveAvailableSSHTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || templates[0].DN != sshTestingTemplateName || templates[0].Guid != sshTestingTemplateID {
+		t.Fatalf("unexpected templates %+v", templates)
+	}
+}
+
+func TestSSHRequestSSHCertificate(t *testing.T) {
+	s := newSshMockServer(t)
+	c := s.connector(t)
+
+	req := &certificate.SshCertRequest{
+		Template:        sshTestingTemplateName,
+		KeyId:           "alice",
+		Principals:      []string{"alice", "ops"},
+		Extensions:      []string{"permit-pty", "login@example.com:alice"},
+		ForceCommand:    "/usr/bin/uptime",
+		SourceAddresses: []string{"10.0.0.0/8", "192.168.1.1"},
+		KeyType:         util.SshKeyTypeEd25519,
+	}
+	if _, err := req.GenerateKeyPair("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.RequestSSHCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.ProcessingDetails.Status != "Issued" || data.DN != "ssh-request-1" || data.PrivateKeyData != "" {
+		t.Fatalf("unexpected response %+v", data)
+	}
+
+	received := s.received[0]
+	if received.PublicKey != req.PublicKeyData || received.Extensions["login@example.com"] != "alice" {
+		t.Fatalf("unexpected request %+v", received)
+	}
+
+	details := data.CertificateDetails
+	if details.KeyID != "alice" || details.CertificateType != certificate.SshCertificateTypeUser || details.SerialNumber != "42" {
+		t.Fatalf("unexpected certificate details %+v", details)
+	}
+	if strings.Join(details.Principals, ",") != "alice,ops" {
+		t.Fatalf("unexpected principals %v", details.Principals)
+	}
+	if details.ForceCommand != "/usr/bin/uptime" || strings.Join(details.SourceAddresses, ",") != "10.0.0.0/8,192.168.1.1" {
+		t.Fatalf("unexpected critical options %+v", details)
+	}
+	if _, ok := details.Extensions["permit-pty"]; !ok {
+		t.Fatalf("unexpected extensions %v", details.Extensions)
+	}
+	if details.CAFingerprintSHA256 != strings.TrimPrefix(ssh.FingerprintSHA256(s.ca.PublicKey()), "SHA256:") {
+		t.Fatalf("unexpected CA fingerprint %s", details.CAFingerprintSHA256)
+	}
+	if details.ValidTo-details.ValidFrom != int64(time.Hour/time.Second) {
+		t.Fatalf("unexpected validity %d - %d", details.ValidFrom, details.ValidTo)
+	}
+}
+
+func TestSSHRequestSSHCertificateServiceGenerated(t *testing.T) {
+	s := newSshMockServer(t)
+
+	data, err := s.connector(t).RequestSSHCertificate(&certificate.SshCertRequest{
+		Template:             sshTestingTemplateName,
+		KeyId:                "service",
+		PrivateKeyPassphrase: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.received[0].PrivateKeyPassphrase != "secret" {
+		t.Fatalf("passphrase was not sent, request %+v", s.received[0])
+	}
+	if data.PrivateKeyData == "" || data.PublicKeyData == "" || data.CertificateDetails.KeyType != ssh.KeyAlgoED25519 {
+		t.Fatalf("unexpected response %+v", data)
+	}
+}
+
+func TestSSHRequestSSHCertificatePending(t *testing.T) {
+	s := newSshMockServer(t)
+	s.pending = true
+	c := s.connector(t)
+
+	data, err := c.RequestSSHCertificate(&certificate.SshCertRequest{Template: sshTestingTemplateName, KeyId: "pending"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.ProcessingDetails.Status != "Pending Issue" || data.CertificateData != "" {
+		t.Fatalf("unexpected response %+v", data)
+	}
+
+	retrieved, err := c.RetrieveSSHCertificate(&certificate.SshCertRequest{PickupID: data.DN, Timeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retrieved.CertificateData == "" || retrieved.CertificateDetails.KeyID != "pending" {
+		t.Fatalf("unexpected retrieved certificate %+v", retrieved)
+	}
+
+	_, err = c.RetrieveSSHCertificate(&certificate.SshCertRequest{PickupID: "unknown"})
+	if !errors.Is(err, verror.ServerError) {
+		t.Fatalf("expected a server error, got %v", err)
+	}
+}
+
+func TestSSHRequestSSHCertificateRejected(t *testing.T) {
+	s := newSshMockServer(t)
+
+	_, err := s.connector(t).RequestSSHCertificate(&certificate.SshCertRequest{Template: sshTestingTemplateName, KeyId: "rejected"})
+	var rejected endpoint.ErrCertificateRejected
+	if !errors.As(err, &rejected) || rejected.Status != "key ID is not allowed" {
+		t.Fatalf("expected the request to be rejected, got %v", err)
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !standin
+
 /*
  * Copyright 2018 Venafi, Inc.
  *
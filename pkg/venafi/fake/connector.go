@@ -33,10 +33,12 @@ import (
 	"github.com/Venafi/vcert/v5/pkg/domain"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
 	"github.com/Venafi/vcert/v5/pkg/policy"
+	"github.com/Venafi/vcert/v5/pkg/util"
 )
 
 type Connector struct {
 	verbose bool
+	ctx     util.RequestContext
 }
 
 func (c *Connector) ProvisionCertificate(_ *domain.ProvisioningRequest, _ *domain.ProvisioningOptions) (*domain.ProvisioningMetadata, error) {
@@ -67,10 +69,6 @@ func (c *Connector) RetrieveSSHCertificate(req *certificate.SshCertRequest) (res
 	panic("operation is not supported yet")
 }
 
-func (c *Connector) RequestSSHCertificate(req *certificate.SshCertRequest) (response *certificate.SshCertificateObject, err error) {
-	panic("operation is not supported yet")
-}
-
 func (c *Connector) RetrieveAvailableSSHTemplates() (response []certificate.SshAvaliableTemplate, err error) {
 	panic("operation is not supported yet")
 }
@@ -84,6 +82,9 @@ func (c *Connector) ResetCertificate(req *certificate.Request, restart bool) (er
 }
 
 func (c *Connector) GetPolicy(name string) (*policy.PolicySpecification, error) {
+	if !c.ctx.Started() {
+		return c.GetPolicyContext(c.ctx.Context(), name)
+	}
 
 	caName := "\\VED\\Policy\\Certificate Authorities\\TEST CA\\QA Test CA - Server 90 Days"
 	validityHours := 120
@@ -150,6 +151,9 @@ func (c *Connector) GetPolicy(name string) (*policy.PolicySpecification, error)
 }
 
 func (c *Connector) SetPolicy(name string, ps *policy.PolicySpecification) (string, error) {
+	if !c.ctx.Started() {
+		return c.SetPolicyContext(c.ctx.Context(), name, ps)
+	}
 	return "OK", nil
 }
 
@@ -165,14 +169,28 @@ func (c *Connector) GetType() endpoint.ConnectorType {
 func (c *Connector) SetZone(z string) {
 }
 
+// WithZone returns a copy of c. The fake connector issues every certificate with the same CA and policy, so the
+// zone is ignored.
+func (c *Connector) WithZone(zone string) endpoint.Connector {
+	cc := *c
+	cc.SetZone(zone)
+	return &cc
+}
+
 func (c *Connector) SetUserAgent(_ string) {
 }
 
 func (c *Connector) Ping() (err error) {
+	if !c.ctx.Started() {
+		return c.PingContext(c.ctx.Context())
+	}
 	return
 }
 
 func (c *Connector) Authenticate(auth *endpoint.Authentication) (err error) {
+	if !c.ctx.Started() {
+		return c.AuthenticateContext(c.ctx.Context(), auth)
+	}
 	return
 }
 
@@ -189,6 +207,9 @@ func validateRequest(req *certificate.Request) error {
 }
 
 func (c *Connector) RequestCertificate(req *certificate.Request) (requestID string, err error) {
+	if !c.ctx.Started() {
+		return c.RequestCertificateContext(c.ctx.Context(), req)
+	}
 	err = validateRequest(req)
 	if err != nil {
 		return "", fmt.Errorf("certificate request validation fail: %s", err)
@@ -270,6 +291,9 @@ func issueCertificate(csr *x509.CertificateRequest) ([]byte, error) {
 }
 
 func (c *Connector) RetrieveCertificate(req *certificate.Request) (pcc *certificate.PEMCollection, err error) {
+	if !c.ctx.Started() {
+		return c.RetrieveCertificateContext(c.ctx.Context(), req)
+	}
 
 	bytes, err := base64.StdEncoding.DecodeString(req.PickupID)
 	if err != nil {
@@ -361,6 +385,9 @@ func (c *Connector) RetireCertificate(revReq *certificate.RetireRequest) (err er
 }
 
 func (c *Connector) ReadZoneConfiguration() (config *endpoint.ZoneConfiguration, err error) {
+	if !c.ctx.Started() {
+		return c.ReadZoneConfigurationContext(c.ctx.Context())
+	}
 	config = endpoint.NewZoneConfiguration()
 	policy, err := c.ReadPolicyConfiguration()
 	config.Policy = *policy
@@ -377,6 +404,9 @@ func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (*certific
 }
 
 func (c *Connector) ReadPolicyConfiguration() (policy *endpoint.Policy, err error) {
+	if !c.ctx.Started() {
+		return c.ReadPolicyConfigurationContext(c.ctx.Context())
+	}
 	policy = &endpoint.Policy{
 		SubjectCNRegexes: []string{".*"},
 		SubjectORegexes:  []string{".*"},
@@ -400,6 +430,9 @@ func (c *Connector) ReadPolicyConfiguration() (policy *endpoint.Policy, err erro
 }
 
 func (c *Connector) GetZonesByParent(parent string) ([]string, error) {
+	if !c.ctx.Started() {
+		return c.GetZonesByParentContext(c.ctx.Context(), parent)
+	}
 	zones := make([]string, 0)
 
 	children := []string{"Alpha", "Epsilon", "Eta", "Iota", "Omicron", "Upsilon", "Omega"}
@@ -414,6 +447,9 @@ func (c *Connector) SetHTTPClient(client *http.Client) {
 }
 
 func (c *Connector) ListCertificates(filter endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	if !c.ctx.Started() {
+		return c.ListCertificatesContext(c.ctx.Context(), filter)
+	}
 	return nil, nil
 }
 
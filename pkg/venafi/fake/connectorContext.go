@@ -0,0 +1,329 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fake
+
+import (
+	"context"
+	"time"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/domain"
+	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/policy"
+	"github.com/Venafi/vcert/v5/pkg/tracing"
+	"github.com/Venafi/vcert/v5/pkg/util"
+)
+
+// withContext returns a copy of c running an operation with ctx. The fake connector sends no request, ctx is only
+// checked before each operation
+func (c *Connector) withContext(ctx context.Context) *Connector {
+	cc := *c
+	cc.ctx = util.NewRequestContext(ctx)
+	return &cc
+}
+
+// startSpan starts the span of the operation op of the connector, when tracing is enabled
+func (c *Connector) startSpan(ctx context.Context, op string, attrs ...tracing.Attribute) (context.Context, *tracing.Span) {
+	attrs = append(attrs, tracing.String(tracing.AttrPlatform, "fake"))
+	return tracing.Start(ctx, "fake."+op, attrs...)
+}
+
+// AuthenticateContext is like Authenticate but fails if ctx is already done
+func (c *Connector) AuthenticateContext(ctx context.Context, auth *endpoint.Authentication) (err error) {
+	ctx, span := c.startSpan(ctx, "Authenticate")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.withContext(ctx).Authenticate(auth)
+}
+
+// PingContext is like Ping but fails if ctx is already done
+func (c *Connector) PingContext(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "Ping")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.withContext(ctx).Ping()
+}
+
+// ReadPolicyConfigurationContext is like ReadPolicyConfiguration but fails if ctx is already done
+func (c *Connector) ReadPolicyConfigurationContext(ctx context.Context) (_ *endpoint.Policy, err error) {
+	ctx, span := c.startSpan(ctx, "ReadPolicyConfiguration")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).ReadPolicyConfiguration()
+}
+
+// ReadZoneConfigurationContext is like ReadZoneConfiguration but fails if ctx is already done
+func (c *Connector) ReadZoneConfigurationContext(ctx context.Context) (_ *endpoint.ZoneConfiguration, err error) {
+	ctx, span := c.startSpan(ctx, "ReadZoneConfiguration")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).ReadZoneConfiguration()
+}
+
+// GetZonesByParentContext is like GetZonesByParent but fails if ctx is already done
+func (c *Connector) GetZonesByParentContext(ctx context.Context, parent string) (_ []string, err error) {
+	ctx, span := c.startSpan(ctx, "GetZonesByParent")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).GetZonesByParent(parent)
+}
+
+// GenerateRequestContext is like GenerateRequest but fails if ctx is already done
+func (c *Connector) GenerateRequestContext(ctx context.Context, config *endpoint.ZoneConfiguration, req *certificate.Request) (err error) {
+	ctx, span := c.startSpan(ctx, "GenerateRequest")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.withContext(ctx).GenerateRequest(config, req)
+}
+
+// ResetCertificateContext is like ResetCertificate but fails if ctx is already done
+func (c *Connector) ResetCertificateContext(ctx context.Context, req *certificate.Request, restart bool) (err error) {
+	ctx, span := c.startSpan(ctx, "ResetCertificate", tracing.String(tracing.AttrRequestID, req.PickupID))
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.withContext(ctx).ResetCertificate(req, restart)
+}
+
+// RequestCertificateContext is like RequestCertificate but fails if ctx is already done
+func (c *Connector) RequestCertificateContext(ctx context.Context, req *certificate.Request) (requestID string, err error) {
+	ctx, span := c.startSpan(ctx, "RequestCertificate")
+	defer func() {
+		span.SetAttributes(tracing.String(tracing.AttrRequestID, requestID))
+		span.Finish(err)
+	}()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.withContext(ctx).RequestCertificate(req)
+}
+
+// RetrieveCertificateContext is like RetrieveCertificate but fails if ctx is already done
+func (c *Connector) RetrieveCertificateContext(ctx context.Context, req *certificate.Request) (_ *certificate.PEMCollection, err error) {
+	ctx, span := c.startSpan(ctx, "RetrieveCertificate", tracing.String(tracing.AttrRequestID, req.PickupID))
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).RetrieveCertificate(req)
+}
+
+// SynchronousRequestCertificateContext is like SynchronousRequestCertificate but fails if ctx is already done
+func (c *Connector) SynchronousRequestCertificateContext(ctx context.Context, req *certificate.Request) (_ *certificate.PEMCollection, err error) {
+	ctx, span := c.startSpan(ctx, "SynchronousRequestCertificate")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).SynchronousRequestCertificate(req)
+}
+
+// ProvisionCertificateContext is like ProvisionCertificate but fails if ctx is already done
+func (c *Connector) ProvisionCertificateContext(ctx context.Context, req *domain.ProvisioningRequest, options *domain.ProvisioningOptions) (_ *domain.ProvisioningMetadata, err error) {
+	ctx, span := c.startSpan(ctx, "ProvisionCertificate")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).ProvisionCertificate(req, options)
+}
+
+// IsCSRServiceGeneratedContext is like IsCSRServiceGenerated but fails if ctx is already done
+func (c *Connector) IsCSRServiceGeneratedContext(ctx context.Context, req *certificate.Request) (_ bool, err error) {
+	ctx, span := c.startSpan(ctx, "IsCSRServiceGenerated")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return c.withContext(ctx).IsCSRServiceGenerated(req)
+}
+
+// RevokeCertificateContext is like RevokeCertificate but fails if ctx is already done
+func (c *Connector) RevokeCertificateContext(ctx context.Context, req *certificate.RevocationRequest) (err error) {
+	ctx, span := c.startSpan(ctx, "RevokeCertificate")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.withContext(ctx).RevokeCertificate(req)
+}
+
+// RenewCertificateContext is like RenewCertificate but fails if ctx is already done
+func (c *Connector) RenewCertificateContext(ctx context.Context, req *certificate.RenewalRequest) (requestID string, err error) {
+	ctx, span := c.startSpan(ctx, "RenewCertificate")
+	defer func() {
+		span.SetAttributes(tracing.String(tracing.AttrRequestID, requestID))
+		span.Finish(err)
+	}()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.withContext(ctx).RenewCertificate(req)
+}
+
+// RetireCertificateContext is like RetireCertificate but fails if ctx is already done
+func (c *Connector) RetireCertificateContext(ctx context.Context, req *certificate.RetireRequest) (err error) {
+	ctx, span := c.startSpan(ctx, "RetireCertificate")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.withContext(ctx).RetireCertificate(req)
+}
+
+// ImportCertificateContext is like ImportCertificate but fails if ctx is already done
+func (c *Connector) ImportCertificateContext(ctx context.Context, req *certificate.ImportRequest) (_ *certificate.ImportResponse, err error) {
+	ctx, span := c.startSpan(ctx, "ImportCertificate")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).ImportCertificate(req)
+}
+
+// ListCertificatesContext is like ListCertificates but fails if ctx is already done
+func (c *Connector) ListCertificatesContext(ctx context.Context, filter endpoint.Filter) (_ []certificate.CertificateInfo, err error) {
+	ctx, span := c.startSpan(ctx, "ListCertificates")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).ListCertificates(filter)
+}
+
+// SearchCertificatesContext is like SearchCertificates but fails if ctx is already done
+func (c *Connector) SearchCertificatesContext(ctx context.Context, req *certificate.SearchRequest) (_ *certificate.CertSearchResponse, err error) {
+	ctx, span := c.startSpan(ctx, "SearchCertificates")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).SearchCertificates(req)
+}
+
+// SearchCertificateContext is like SearchCertificate but fails if ctx is already done
+func (c *Connector) SearchCertificateContext(ctx context.Context, zone string, cn string, sans *certificate.Sans, certMinTimeLeft time.Duration) (_ *certificate.CertificateInfo, err error) {
+	ctx, span := c.startSpan(ctx, "SearchCertificate")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).SearchCertificate(zone, cn, sans, certMinTimeLeft)
+}
+
+// RetrieveCertificateMetaDataContext is like RetrieveCertificateMetaData but fails if ctx is already done
+func (c *Connector) RetrieveCertificateMetaDataContext(ctx context.Context, dn string) (_ *certificate.CertificateMetaData, err error) {
+	ctx, span := c.startSpan(ctx, "RetrieveCertificateMetaData")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).RetrieveCertificateMetaData(dn)
+}
+
+// SetPolicyContext is like SetPolicy but fails if ctx is already done
+func (c *Connector) SetPolicyContext(ctx context.Context, name string, ps *policy.PolicySpecification) (_ string, err error) {
+	ctx, span := c.startSpan(ctx, "SetPolicy")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.withContext(ctx).SetPolicy(name, ps)
+}
+
+// GetPolicyContext is like GetPolicy but fails if ctx is already done
+func (c *Connector) GetPolicyContext(ctx context.Context, name string) (_ *policy.PolicySpecification, err error) {
+	ctx, span := c.startSpan(ctx, "GetPolicy")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).GetPolicy(name)
+}
+
+// RequestSSHCertificateContext is like RequestSSHCertificate but fails if ctx is already done
+func (c *Connector) RequestSSHCertificateContext(ctx context.Context, req *certificate.SshCertRequest) (_ *certificate.SshCertificateObject, err error) {
+	ctx, span := c.startSpan(ctx, "RequestSSHCertificate")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).RequestSSHCertificate(req)
+}
+
+// RetrieveSSHCertificateContext is like RetrieveSSHCertificate but fails if ctx is already done
+func (c *Connector) RetrieveSSHCertificateContext(ctx context.Context, req *certificate.SshCertRequest) (_ *certificate.SshCertificateObject, err error) {
+	ctx, span := c.startSpan(ctx, "RetrieveSSHCertificate", tracing.String(tracing.AttrRequestID, req.PickupID))
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).RetrieveSSHCertificate(req)
+}
+
+// RetrieveSshConfigContext is like RetrieveSshConfig but fails if ctx is already done
+func (c *Connector) RetrieveSshConfigContext(ctx context.Context, ca *certificate.SshCaTemplateRequest) (_ *certificate.SshConfig, err error) {
+	ctx, span := c.startSpan(ctx, "RetrieveSshConfig")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).RetrieveSshConfig(ca)
+}
+
+// RetrieveAvailableSSHTemplatesContext is like RetrieveAvailableSSHTemplates but fails if ctx is already done
+func (c *Connector) RetrieveAvailableSSHTemplatesContext(ctx context.Context) (_ []certificate.SshAvaliableTemplate, err error) {
+	ctx, span := c.startSpan(ctx, "RetrieveAvailableSSHTemplates")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.withContext(ctx).RetrieveAvailableSSHTemplates()
+}
+
+// RetrieveSystemVersionContext is like RetrieveSystemVersion but fails if ctx is already done
+func (c *Connector) RetrieveSystemVersionContext(ctx context.Context) (_ string, err error) {
+	ctx, span := c.startSpan(ctx, "RetrieveSystemVersion")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.withContext(ctx).RetrieveSystemVersion()
+}
+
+// WriteLogContext is like WriteLog but fails if ctx is already done
+func (c *Connector) WriteLogContext(ctx context.Context, req *endpoint.LogRequest) (err error) {
+	ctx, span := c.startSpan(ctx, "WriteLog")
+	defer func() { span.Finish(err) }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.withContext(ctx).WriteLog(req)
+}
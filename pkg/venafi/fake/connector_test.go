@@ -22,6 +22,8 @@ import (
 	"time"
 
 	"github.com/Venafi/vcert/v5/pkg/certificate"
+	"github.com/Venafi/vcert/v5/pkg/tracing"
+	"github.com/Venafi/vcert/v5/pkg/util"
 )
 
 func TestRetrieveCertificate(t *testing.T) {
@@ -93,3 +95,69 @@ func TestRequestCertificate(t *testing.T) {
 		t.Fatalf("should return non-empty pickupId")
 	}
 }
+
+func TestRequestSSHCertificate(t *testing.T) {
+	connector := getTestConnector()
+	_, publicKey, err := util.GenerateSshKeyPairWithType(util.SshKeyTypeEd25519, 0, "", "web01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &certificate.SshCertRequest{
+		Template:       "host-template",
+		KeyId:          "web01",
+		Principals:     []string{"web01.example.com"},
+		ValidityPeriod: "2d",
+		PublicKeyData:  string(publicKey),
+	}
+	data, err := connector.RequestSSHCertificate(req)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	details, err := certificate.ParseSshCertificateDetails(data.CertificateData)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if details.CertificateType != certificate.SshCertificateTypeHost || details.KeyID != "web01" {
+		t.Fatalf("unexpected certificate %+v", details)
+	}
+	if details.ValidTo-details.ValidFrom != int64(48*time.Hour/time.Second) {
+		t.Fatalf("unexpected validity %d - %d", details.ValidFrom, details.ValidTo)
+	}
+
+	req.PublicKeyData = ""
+	_, err = connector.RequestSSHCertificate(req)
+	if err == nil {
+		t.Fatal("should fail without a public key")
+	}
+}
+
+func TestRequestCertificate_Span(t *testing.T) {
+	recorder := &tracing.Recorder{}
+	tracing.SetExporter(recorder)
+	defer tracing.SetExporter(nil)
+
+	connector := getTestConnector()
+	req := &certificate.Request{}
+	req.Subject.CommonName = "test-mode"
+	req.KeyType = certificate.KeyTypeECDSA
+	err := connector.GenerateRequest(nil, req)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	requestID, err := connector.RequestCertificate(req)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	span, ok := recorder.Find("fake.RequestCertificate")
+	if !ok {
+		t.Fatalf("RequestCertificate should be traced like RequestCertificateContext, got spans %v", recorder.Spans())
+	}
+	if span.Attribute(tracing.AttrRequestID) != requestID {
+		t.Fatalf("expected request ID %q, got %v", requestID, span.Attribute(tracing.AttrRequestID))
+	}
+	if len(recorder.Spans()) != 2 {
+		t.Fatalf("expected the spans of GenerateRequest and RequestCertificate only, got %v", recorder.Spans())
+	}
+}
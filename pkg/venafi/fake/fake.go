@@ -24,6 +24,9 @@ import (
 
 // GenerateRequest creates a new certificate request, based on the zone/policy configuration and the user data
 func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *certificate.Request) (err error) {
+	if !c.ctx.Started() {
+		return c.GenerateRequestContext(c.ctx.Context(), config, req)
+	}
 
 	switch req.CsrOrigin {
 	case certificate.LocalGeneratedCSR:
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2024 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fake
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v5/pkg/certificate"
+)
+
+// defaultSshValidity is the validity of the SSH certificates issued in test mode when the request doesn't set one
+const defaultSshValidity = 24 * time.Hour
+
+// RequestSSHCertificate issues an SSH certificate for req.PublicKeyData, signed with the key of the test mode CA. It
+// is a host certificate when the name of the template contains "host", otherwise a user one. The certificate is
+// issued right away, so it never has to be retrieved
+func (c *Connector) RequestSSHCertificate(req *certificate.SshCertRequest) (response *certificate.SshCertificateObject, err error) {
+	if !c.ctx.Started() {
+		return c.RequestSSHCertificateContext(c.ctx.Context(), req)
+	}
+	if req.PublicKeyData == "" {
+		return nil, fmt.Errorf("Test-mode: the public key of the SSH certificate is required")
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKeyData))
+	if err != nil {
+		return nil, fmt.Errorf("Test-mode: failed to parse the public key of the SSH certificate: %w", err)
+	}
+	validity, err := sshValidity(req.ValidityPeriod)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).SetUint64(math.MaxUint64))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             pubKey,
+		Serial:          serial.Uint64(),
+		CertType:        ssh.UserCert,
+		KeyId:           req.KeyId,
+		ValidPrincipals: req.Principals,
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.Add(validity).Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: map[string]string{},
+			Extensions:      map[string]string{},
+		},
+	}
+	if strings.Contains(strings.ToLower(req.Template), "host") {
+		cert.CertType = ssh.HostCert
+	}
+	if req.ForceCommand != "" {
+		cert.CriticalOptions["force-command"] = req.ForceCommand
+	}
+	if len(req.SourceAddresses) > 0 {
+		cert.CriticalOptions["source-address"] = strings.Join(req.SourceAddresses, ",")
+	}
+	for _, extension := range req.Extensions {
+		cert.Extensions[extension] = ""
+	}
+	err = cert.SignCert(rand.Reader, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificate.SshCertificateObject{
+		Guid:               strconv.FormatUint(cert.Serial, 10),
+		CADN:               req.Template,
+		CertificateData:    string(ssh.MarshalAuthorizedKey(cert)),
+		PublicKeyData:      req.PublicKeyData,
+		CertificateDetails: certificate.NewSshCertificateDetails(cert),
+		ProcessingDetails:  certificate.ProcessingDetails{Status: "Issued"},
+	}, nil
+}
+
+// sshValidity returns the validity of an SSH certificate requested for period: a number of days such as "30d", or a
+// duration such as "12h"
+func sshValidity(period string) (time.Duration, error) {
+	if period == "" {
+		return defaultSshValidity, nil
+	}
+	if days, ok := strings.CutSuffix(period, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("Test-mode: invalid SSH certificate validity period %q", period)
+	}
+	return d, nil
+}
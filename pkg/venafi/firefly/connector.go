@@ -17,7 +17,6 @@
 package firefly
 
 import (
-	"context"
 	"crypto/x509"
 	"errors"
 	"fmt"
@@ -34,6 +33,7 @@ import (
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/domain"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 	"github.com/Venafi/vcert/v5/pkg/policy"
 	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/Venafi/vcert/v5/pkg/venafi"
@@ -53,6 +53,9 @@ type Connector struct {
 	client      *http.Client
 	zone        string // holds the policyName
 	userAgent   string
+	ctx         util.RequestContext
+	retryPolicy *httputils.RetryPolicy
+	rateLimiter *httputils.RateLimiter
 }
 
 // NewConnector creates a new Firefly Connector object used to communicate with Firefly
@@ -78,6 +81,16 @@ func (c *Connector) SetZone(zone string) {
 	c.zone = zone
 }
 
+// WithZone returns a copy of c requesting certificates with the policy named zone. The copy keeps the access
+// token of c, so it doesn't need to authenticate again, and shares its HTTP client. It can be used concurrently
+// with c.
+func (c *Connector) WithZone(zone string) endpoint.Connector {
+	c.getHTTPClient()
+	cc := *c
+	cc.SetZone(zone)
+	return &cc
+}
+
 func (c *Connector) SetUserAgent(userAgent string) {
 	c.userAgent = userAgent
 }
@@ -87,6 +100,9 @@ func (c *Connector) GetType() endpoint.ConnectorType {
 }
 
 func (c *Connector) Authenticate(auth *endpoint.Authentication) error {
+	if !c.ctx.Started() {
+		return c.AuthenticateContext(c.ctx.Context(), auth)
+	}
 	if auth == nil {
 		msg := "failed to authenticate: no credentials provided"
 		zap.L().Error(msg, fieldPlatform)
@@ -113,7 +129,7 @@ func (c *Connector) Authenticate(auth *endpoint.Authentication) error {
 func (c *Connector) Authorize(auth *endpoint.Authentication) (token *oauth2.Token, err error) {
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("%w: %s", verror.AuthError, err)
+			err = fmt.Errorf("%w: %w", verror.AuthError, err)
 		}
 	}()
 
@@ -145,7 +161,7 @@ func (c *Connector) Authorize(auth *endpoint.Authentication) (token *oauth2.Toke
 			}
 		}
 
-		token, err = config.Token(context.Background())
+		token, err = config.Token(c.ctx.Context())
 		if err != nil {
 			zap.L().Error(failureMsg, fieldPlatform, zap.Error(err))
 			return token, err
@@ -173,7 +189,7 @@ func (c *Connector) Authorize(auth *endpoint.Authentication) (token *oauth2.Toke
 			},
 		}
 
-		token, err = config.PasswordCredentialsToken(context.Background(), auth.User, auth.Password)
+		token, err = config.PasswordCredentialsToken(c.ctx.Context(), auth.User, auth.Password)
 		if err != nil {
 			zap.L().Error(failureMsg, fieldPlatform, zap.Error(err))
 			return token, err
@@ -204,6 +220,9 @@ func (c *Connector) Authorize(auth *endpoint.Authentication) (token *oauth2.Toke
 
 // SynchronousRequestCertificate It's not supported yet in VaaS
 func (c *Connector) SynchronousRequestCertificate(req *certificate.Request) (certificates *certificate.PEMCollection, err error) {
+	if !c.ctx.Started() {
+		return c.SynchronousRequestCertificateContext(c.ctx.Context(), req)
+	}
 
 	zap.L().Info("requesting certificate", zap.String("cn", req.Subject.CommonName), fieldPlatform)
 	//creating the request object
@@ -417,6 +436,9 @@ func (c *Connector) ReadPolicyConfiguration() (policy *endpoint.Policy, err erro
 }
 
 func (c *Connector) ReadZoneConfiguration() (config *endpoint.ZoneConfiguration, err error) {
+	if !c.ctx.Started() {
+		return c.ReadZoneConfigurationContext(c.ctx.Context())
+	}
 	return nil, nil
 }
 
@@ -436,6 +458,16 @@ func (c *Connector) SetHTTPClient(client *http.Client) {
 	c.client = client
 }
 
+// SetRetryPolicy sets how the requests failing with a transient error are retried. A nil policy disables retries
+func (c *Connector) SetRetryPolicy(policy *httputils.RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// SetRateLimiter sets the limiter every request waits on before being sent. A nil limiter disables rate limiting
+func (c *Connector) SetRateLimiter(limiter *httputils.RateLimiter) {
+	c.rateLimiter = limiter
+}
+
 func (c *Connector) WriteLog(_ *endpoint.LogRequest) error {
 	panic("operation is not supported yet")
 }
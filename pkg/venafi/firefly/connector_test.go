@@ -17,6 +17,7 @@
 package firefly
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509/pkix"
 	"fmt"
@@ -28,6 +29,7 @@ import (
 
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
@@ -138,6 +140,33 @@ func (s *ConnectorSuite) TestAuthenticate() {
 	})
 }
 
+func (s *ConnectorSuite) TestAuthenticateContext() {
+	s.Run("Success", func() {
+		fireflyConnector, err := NewConnector(s.fireflyServer.serverURL, "", false, nil)
+		assert.Nil(s.T(), err, fmt.Errorf("error creating firefly connector: %w", err).Error())
+
+		fireflyConnector.SetZone("policy")
+		err = fireflyConnector.AuthenticateContext(context.Background(), s.createCredFlowAuth())
+
+		assert.Nil(s.T(), err, fmt.Errorf("error getting acccess token: %w", err).Error())
+		assert.NotEmpty(s.T(), fireflyConnector.accessToken)
+		assert.Equal(s.T(), util.RequestContext{}, fireflyConnector.ctx)
+		assert.Equal(s.T(), "policy", fireflyConnector.zone)
+	})
+
+	s.Run("Canceled", func() {
+		fireflyConnector, err := NewConnector(s.fireflyServer.serverURL, "", false, nil)
+		assert.Nil(s.T(), err, fmt.Errorf("error creating firefly connector: %w", err).Error())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = fireflyConnector.AuthenticateContext(ctx, s.createCredFlowAuth())
+
+		assert.ErrorIs(s.T(), err, context.Canceled)
+		assert.Equal(s.T(), "", fireflyConnector.accessToken)
+	})
+}
+
 func (s *ConnectorSuite) TestClientCredentialFlow() {
 	fireflyConnector, err := NewConnector(s.fireflyServer.serverURL, "", false, nil)
 	assert.Nil(s.T(), err, fmt.Errorf("error creating firefly connector: %w", err).Error())
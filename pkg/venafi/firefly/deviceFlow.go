@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/Venafi/vcert/v5/pkg/verror"
 	"golang.org/x/oauth2"
 )
@@ -147,10 +148,16 @@ func (c *Connector) waitForDeviceAuthorization(devCred *DeviceCred, auth *endpoi
 		//verifying the error gotten
 		switch GetDevAuthStatusFromError(err) {
 		case AuthorizationPending:
-			time.Sleep(time.Duration(devCred.Interval) * time.Second)
+			err = util.SleepContext(c.ctx.Context(), time.Duration(devCred.Interval)*time.Second)
+			if err != nil {
+				return nil, err
+			}
 		case SlowDown:
 			devCred.Interval += 5
-			time.Sleep(time.Duration(devCred.Interval) * time.Second)
+			err = util.SleepContext(c.ctx.Context(), time.Duration(devCred.Interval)*time.Second)
+			if err != nil {
+				return nil, err
+			}
 		case AccessDenied:
 			return nil, fmt.Errorf("the access from device was denied by the user")
 		case ExpiredToken:
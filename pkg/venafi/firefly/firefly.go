@@ -34,6 +34,7 @@ import (
 
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 	"github.com/Venafi/vcert/v5/pkg/verror"
 )
 
@@ -83,7 +84,10 @@ type certificateRequestResponse struct {
 // GenerateRequest should generate a CertificateRequest based on the zone configuration when the csrOrigin was
 // set to LocalGeneratedCSR but given that is not supported by Firefly yet, then it's only validating if the CSR
 // was provided when the csrOrigin was set to UserProvidedCSR
-func (c *Connector) GenerateRequest(_ *endpoint.ZoneConfiguration, req *certificate.Request) (err error) {
+func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *certificate.Request) (err error) {
+	if !c.ctx.Started() {
+		return c.GenerateRequestContext(c.ctx.Context(), config, req)
+	}
 	switch req.CsrOrigin {
 	case certificate.LocalGeneratedCSR:
 		return fmt.Errorf("local generated CSR it's not supported by Firefly yet")
@@ -131,7 +135,7 @@ func (c *Connector) request(method string, resource urlResource, data interface{
 		}
 	}
 
-	r, _ := http.NewRequest(method, resourceUrl, payload)
+	r, _ := http.NewRequestWithContext(c.ctx.Context(), method, resourceUrl, payload)
 	r.Close = true
 	r.Header.Set(headers.UserAgent, c.userAgent)
 	if c.accessToken != "" {
@@ -140,7 +144,8 @@ func (c *Connector) request(method string, resource urlResource, data interface{
 	r.Header.Add("content-type", contentType)
 	r.Header.Add("cache-control", "no-cache")
 
-	res, err := c.getHTTPClient().Do(r)
+	idempotent := method != http.MethodPost && method != http.MethodPatch
+	res, err := httputils.Do(c.getHTTPClient(), r, idempotent, c.retryPolicy, c.rateLimiter)
 	if err != nil {
 		return
 	}
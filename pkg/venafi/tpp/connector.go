@@ -34,6 +34,7 @@ import (
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/domain"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 	"github.com/Venafi/vcert/v5/pkg/policy"
 	"github.com/Venafi/vcert/v5/pkg/util"
 	"github.com/Venafi/vcert/v5/pkg/verror"
@@ -50,6 +51,9 @@ type Connector struct {
 	zone        string
 	client      *http.Client
 	userAgent   string
+	ctx         util.RequestContext
+	retryPolicy *httputils.RetryPolicy
+	rateLimiter *httputils.RateLimiter
 }
 
 func (c *Connector) IsCSRServiceGenerated(req *certificate.Request) (bool, error) {
@@ -57,10 +61,16 @@ func (c *Connector) IsCSRServiceGenerated(req *certificate.Request) (bool, error
 }
 
 func (c *Connector) RetrieveSshConfig(ca *certificate.SshCaTemplateRequest) (*certificate.SshConfig, error) {
+	if !c.ctx.Started() {
+		return c.RetrieveSshConfigContext(c.ctx.Context(), ca)
+	}
 	return RetrieveSshConfig(c, ca)
 }
 
 func (c *Connector) RetrieveAvailableSSHTemplates() (response []certificate.SshAvaliableTemplate, err error) {
+	if !c.ctx.Started() {
+		return c.RetrieveAvailableSSHTemplatesContext(c.ctx.Context())
+	}
 	return GetAvailableSshTemplates(c)
 }
 
@@ -95,6 +105,16 @@ func (c *Connector) SetZone(z string) {
 	c.zone = z
 }
 
+// WithZone returns a copy of c requesting certificates in the policy folder zone, relative to \VED\Policy. The copy
+// keeps the API key or access token and the identity of c, so it doesn't need to authenticate again, and shares
+// its HTTP client. It can be used concurrently with c.
+func (c *Connector) WithZone(zone string) endpoint.Connector {
+	c.getHTTPClient()
+	cc := *c
+	cc.SetZone(zone)
+	return &cc
+}
+
 func (c *Connector) SetUserAgent(userAgent string) {
 	c.userAgent = userAgent
 }
@@ -105,6 +125,9 @@ func (c *Connector) GetType() endpoint.ConnectorType {
 
 // Ping attempts to connect to the TPP Server WebSDK API and returns an error if it cannot
 func (c *Connector) Ping() (err error) {
+	if !c.ctx.Started() {
+		return c.PingContext(c.ctx.Context())
+	}
 
 	//Extended timeout to allow the server to wake up
 	c.getHTTPClient().Timeout = time.Second * 90
@@ -120,9 +143,12 @@ func (c *Connector) Ping() (err error) {
 
 // Authenticate authenticates the user to the TPP
 func (c *Connector) Authenticate(auth *endpoint.Authentication) (err error) {
+	if !c.ctx.Started() {
+		return c.AuthenticateContext(c.ctx.Context(), auth)
+	}
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("%w: %s", verror.AuthError, err)
+			err = fmt.Errorf("%w: %w", verror.AuthError, err)
 		}
 	}()
 
@@ -455,6 +481,9 @@ func (c *Connector) retrieveSelfIdentity() (response identity, err error) {
 
 // RetrieveSystemVersion returns the TPP system version of the connector context
 func (c *Connector) RetrieveSystemVersion() (string, error) {
+	if !c.ctx.Started() {
+		return c.RetrieveSystemVersionContext(c.ctx.Context())
+	}
 	statusCode, status, body, err := c.request("GET", urlResourceSystemStatusVersion, "")
 	if err != nil {
 		return "", err
@@ -711,6 +740,9 @@ func (c *Connector) proccessLocation(req *certificate.Request) error {
 // RequestCertificate submits the CSR to TPP returning the DN of the requested
 // Certificate.
 func (c *Connector) RequestCertificate(req *certificate.Request) (requestID string, err error) {
+	if !c.ctx.Started() {
+		return c.RequestCertificateContext(c.ctx.Context(), req)
+	}
 	if req.Location != nil {
 		err = c.proccessLocation(req)
 		if err != nil {
@@ -822,6 +854,9 @@ func IsCertNotFound(err error) bool {
 // reset. It returns an error of type *ErrCertNotFound if the certificate is not
 // found.
 func (c *Connector) ResetCertificate(req *certificate.Request, restart bool) (err error) {
+	if !c.ctx.Started() {
+		return c.ResetCertificateContext(c.ctx.Context(), req, restart)
+	}
 	certificateDN := getCertificateDN(c.zone, req.FriendlyName, req.Subject.CommonName)
 
 	statusCode, status, body, err := c.request("POST", urlResourceCertificateReset, certificateResetRequest{
@@ -857,6 +892,9 @@ func (c *Connector) ResetCertificate(req *certificate.Request, restart bool) (er
 }
 
 func (c *Connector) GetPolicy(name string) (*policy.PolicySpecification, error) {
+	if !c.ctx.Started() {
+		return c.GetPolicyContext(c.ctx.Context(), name)
+	}
 	var ps *policy.PolicySpecification
 	var tp policy.TppPolicy
 
@@ -978,6 +1016,9 @@ func PolicyExist(policyName string, c *Connector) (bool, error) {
 }
 
 func (c *Connector) SetPolicy(name string, ps *policy.PolicySpecification) (string, error) {
+	if !c.ctx.Started() {
+		return c.SetPolicyContext(c.ctx.Context(), name, ps)
+	}
 
 	//validate policy specification and policy
 	err := policy.ValidateTppPolicySpecification(ps)
@@ -1386,6 +1427,9 @@ func (c *Connector) browseIdentities(browseReq BrowseIdentitiesRequest) (*Browse
 
 // RetrieveCertificate attempts to retrieve the requested certificate
 func (c *Connector) RetrieveCertificate(req *certificate.Request) (certificates *certificate.PEMCollection, err error) {
+	if !c.ctx.Started() {
+		return c.RetrieveCertificateContext(c.ctx.Context(), req)
+	}
 
 	includeChain := req.ChainOption != certificate.ChainOptionIgnore
 	rootFirstOrder := includeChain && req.ChainOption == certificate.ChainOptionRootFirst
@@ -1440,7 +1484,10 @@ func (c *Connector) RetrieveCertificate(req *certificate.Request) (certificates
 		if time.Now().After(startTime.Add(req.Timeout)) {
 			return nil, endpoint.ErrRetrieveCertificateTimeout{CertificateID: req.PickupID}
 		}
-		time.Sleep(2 * time.Second)
+		err = util.SleepContext(c.ctx.Context(), 2*time.Second)
+		if err != nil {
+			return nil, err
+		}
 	}
 }
 
@@ -1502,6 +1549,9 @@ func (c *Connector) prepareRenewalRequest(renewReq *certificate.RenewalRequest)
 
 // RenewCertificate attempts to renew the certificate
 func (c *Connector) RenewCertificate(renewReq *certificate.RenewalRequest) (requestID string, err error) {
+	if !c.ctx.Started() {
+		return c.RenewCertificateContext(c.ctx.Context(), renewReq)
+	}
 	if renewReq.Thumbprint != "" && renewReq.CertificateDN == "" {
 		// search by Thumbprint and fill *renewReq.CertificateDN
 		searchResult, err := c.searchCertificatesByFingerprint(renewReq.Thumbprint)
@@ -1560,6 +1610,9 @@ func (c *Connector) RenewCertificate(renewReq *certificate.RenewalRequest) (requ
 
 // RevokeCertificate attempts to revoke the certificate
 func (c *Connector) RevokeCertificate(revReq *certificate.RevocationRequest) (err error) {
+	if !c.ctx.Started() {
+		return c.RevokeCertificateContext(c.ctx.Context(), revReq)
+	}
 	reason, ok := RevocationReasonsMap[revReq.Reason]
 	if !ok {
 		return fmt.Errorf("could not parse revocation reason `%s`", revReq.Reason)
@@ -1587,6 +1640,9 @@ func (c *Connector) RevokeCertificate(revReq *certificate.RevocationRequest) (er
 }
 
 func (c *Connector) RetireCertificate(req *certificate.RetireRequest) (err error) {
+	if !c.ctx.Started() {
+		return c.RetireCertificateContext(c.ctx.Context(), req)
+	}
 
 	if req.CertificateDN == "" && req.Thumbprint != "" {
 		// search cert by Thumbprint and fill pickupID
@@ -1614,6 +1670,9 @@ func (c *Connector) RetireCertificate(req *certificate.RetireRequest) (err error
 var zoneNonFoundregexp = regexp.MustCompile("PolicyDN: .+ does not exist")
 
 func (c *Connector) ReadPolicyConfiguration() (policy *endpoint.Policy, err error) {
+	if !c.ctx.Started() {
+		return c.ReadPolicyConfigurationContext(c.ctx.Context())
+	}
 	if c.zone == "" {
 		return nil, fmt.Errorf("empty zone")
 	}
@@ -1649,6 +1708,9 @@ func (c *Connector) ReadPolicyConfiguration() (policy *endpoint.Policy, err erro
 
 // ReadZoneConfiguration reads the policy data from TPP to get locked and pre-configured values for certificate requests
 func (c *Connector) ReadZoneConfiguration() (config *endpoint.ZoneConfiguration, err error) {
+	if !c.ctx.Started() {
+		return c.ReadZoneConfigurationContext(c.ctx.Context())
+	}
 	if c.zone == "" {
 		return nil, fmt.Errorf("empty zone")
 	}
@@ -1686,6 +1748,9 @@ func (c *Connector) ReadZoneConfiguration() (config *endpoint.ZoneConfiguration,
 }
 
 func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (*certificate.ImportResponse, error) {
+	if !c.ctx.Started() {
+		return c.ImportCertificateContext(c.ctx.Context(), req)
+	}
 	r := importRequest{
 		PolicyDN:        req.PolicyDN,
 		ObjectName:      req.ObjectName,
@@ -1734,6 +1799,9 @@ func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (*certific
 }
 
 func (c *Connector) SearchCertificates(req *certificate.SearchRequest) (*certificate.CertSearchResponse, error) {
+	if !c.ctx.Started() {
+		return c.SearchCertificatesContext(c.ctx.Context(), req)
+	}
 
 	var err error
 
@@ -1750,6 +1818,9 @@ func (c *Connector) SearchCertificates(req *certificate.SearchRequest) (*certifi
 }
 
 func (c *Connector) SearchCertificate(zone string, cn string, sans *certificate.Sans, certMinTimeLeft time.Duration) (certificateInfo *certificate.CertificateInfo, err error) {
+	if !c.ctx.Started() {
+		return c.SearchCertificateContext(c.ctx.Context(), zone, cn, sans, certMinTimeLeft)
+	}
 	// format arguments for request
 	req := formatSearchCertificateArguments(cn, sans, certMinTimeLeft)
 
@@ -1797,7 +1868,20 @@ func (c *Connector) SetHTTPClient(client *http.Client) {
 	c.client = client
 }
 
+// SetRetryPolicy sets how the requests failing with a transient error are retried. A nil policy disables retries
+func (c *Connector) SetRetryPolicy(policy *httputils.RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// SetRateLimiter sets the limiter every request waits on before being sent. A nil limiter disables rate limiting
+func (c *Connector) SetRateLimiter(limiter *httputils.RateLimiter) {
+	c.rateLimiter = limiter
+}
+
 func (c *Connector) WriteLog(logReq *endpoint.LogRequest) error {
+	if !c.ctx.Started() {
+		return c.WriteLogContext(c.ctx.Context(), logReq)
+	}
 	statusCode, httpStatus, body, err := c.request("POST", urlResourceLog, logReq)
 	if err != nil {
 		return err
@@ -1811,6 +1895,9 @@ func (c *Connector) WriteLog(logReq *endpoint.LogRequest) error {
 }
 
 func (c *Connector) ListCertificates(filter endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	if !c.ctx.Started() {
+		return c.ListCertificatesContext(c.ctx.Context(), filter)
+	}
 	if c.zone == "" {
 		return nil, fmt.Errorf("empty zone")
 	}
@@ -2000,6 +2087,9 @@ func (c *Connector) findObjectsOfClass(req *findObjectsOfClassRequest) (*findObj
 
 // GetZonesByParent returns a list of valid zones for a TPP parent folder specified by parent
 func (c *Connector) GetZonesByParent(parent string) ([]string, error) {
+	if !c.ctx.Started() {
+		return c.GetZonesByParentContext(c.ctx.Context(), parent)
+	}
 	zones := make([]string, 0)
 
 	parentFolderDn := parent
@@ -2231,12 +2321,18 @@ func resetTPPAttribute(c *Connector, at, zone string) error {
 }
 
 func (c *Connector) RequestSSHCertificate(req *certificate.SshCertRequest) (response *certificate.SshCertificateObject, err error) {
+	if !c.ctx.Started() {
+		return c.RequestSSHCertificateContext(c.ctx.Context(), req)
+	}
 
 	return RequestSshCertificate(c, req)
 
 }
 
 func (c *Connector) RetrieveSSHCertificate(req *certificate.SshCertRequest) (response *certificate.SshCertificateObject, err error) {
+	if !c.ctx.Started() {
+		return c.RetrieveSSHCertificateContext(c.ctx.Context(), req)
+	}
 	return RetrieveSshCertificate(c, req)
 }
 
@@ -2245,6 +2341,9 @@ func (c *Connector) ProvisionCertificate(_ *domain.ProvisioningRequest, _ *domai
 }
 
 func (c *Connector) RetrieveCertificateMetaData(dn string) (*certificate.CertificateMetaData, error) {
+	if !c.ctx.Started() {
+		return c.RetrieveCertificateMetaDataContext(c.ctx.Context(), dn)
+	}
 
 	//first step convert dn to guid
 	request := DNToGUIDRequest{ObjectDN: dn}
@@ -184,7 +184,9 @@ func RetrieveSshCertificate(c *Connector, req *certificate.SshCertRequest) (*cer
 		if time.Now().After(startTime.Add(req.Timeout)) {
 			return nil, endpoint.ErrRetrieveCertificateTimeout{CertificateID: req.PickupID}
 		}
-		time.Sleep(2 * time.Second)
+		if err := util.SleepContext(c.ctx.Context(), 2*time.Second); err != nil {
+			return nil, err
+		}
 	}
 }
 
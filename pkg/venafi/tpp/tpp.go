@@ -35,6 +35,7 @@ import (
 
 	"github.com/Venafi/vcert/v5/pkg/certificate"
 	"github.com/Venafi/vcert/v5/pkg/endpoint"
+	"github.com/Venafi/vcert/v5/pkg/httputils"
 )
 
 const defaultKeySize = 2048
@@ -490,7 +491,7 @@ func (c *Connector) request(method string, resource urlResource, data interface{
 		payload = bytes.NewReader(b)
 	}
 
-	r, _ := http.NewRequest(method, url, payload)
+	r, _ := http.NewRequestWithContext(c.ctx.Context(), method, url, payload)
 	r.Close = true
 	r.Header.Set(headers.UserAgent, c.userAgent)
 	if c.accessToken != "" {
@@ -501,7 +502,7 @@ func (c *Connector) request(method string, resource urlResource, data interface{
 	r.Header.Add("content-type", "application/json")
 	r.Header.Add("cache-control", "no-cache")
 
-	res, err := c.getHTTPClient().Do(r)
+	res, err := httputils.Do(c.getHTTPClient(), r, isIdempotent(method, resource), c.retryPolicy, c.rateLimiter)
 	if res != nil {
 		statusCode = res.StatusCode
 		statusText = res.Status
@@ -530,6 +531,35 @@ func (c *Connector) request(method string, resource urlResource, data interface{
 	return
 }
 
+// readOnlyResources are the resources TPP exposes through POST that don't change anything and can be retried
+var readOnlyResources = map[urlResource]bool{
+	urlResourceCertificateRetrieve:  true,
+	urlResourceCertificatePolicy:    true,
+	urlResourceConfigDnToGuid:       true,
+	urlResourceConfigReadDn:         true,
+	urlResourceFindPolicy:           true,
+	urlResourceAllMetadataGet:       true,
+	urlResourceMetadataGet:          true,
+	urlResourceReadPolicy:           true,
+	urlResourceIsValidPolicy:        true,
+	urlResourceBrowseIdentities:     true,
+	urlResourceValidateIdentity:     true,
+	urlResourceSshCertRet:           true,
+	urlResourceSshCADetails:         true,
+	urlResourceSshTemplateAvaliable: true,
+	urlResourceDNToGUID:             true,
+	urlResourceFindObjectsOfClass:   true,
+}
+
+// isIdempotent tells whether a request can be sent again without side effects, like enrolling a certificate twice
+func isIdempotent(method string, resource urlResource) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return readOnlyResources[resource]
+}
+
 func (c *Connector) getHTTPClient() *http.Client {
 	if c.client != nil {
 		return c.client
@@ -568,6 +598,9 @@ func (c *Connector) getHTTPClient() *http.Client {
 
 // GenerateRequest creates a new certificate request, based on the zone/policy configuration and the user data
 func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *certificate.Request) (err error) {
+	if !c.ctx.Started() {
+		return c.GenerateRequestContext(c.ctx.Context(), config, req)
+	}
 	if req.KeyType == certificate.KeyTypeED25519 {
 		return fmt.Errorf("Unable to request certificate from TPP, ed25519 key type is not for TPP")
 	}
@@ -35,6 +35,7 @@ type Context struct {
 	CloudZone           string
 	VAASzoneEC          string
 	CloudZoneRestricted string
+	CloudSshTemplate    string
 }
 
 func GetEnvContext() *Context {
@@ -54,6 +55,7 @@ func GetEnvContext() *Context {
 	c.CloudZone = os.Getenv("CLOUD_ZONE")
 	c.VAASzoneEC = os.Getenv("VAAS_ZONE_EC")
 	c.CloudZoneRestricted = os.Getenv("CLOUD_ZONE_RESTRICTED")
+	c.CloudSshTemplate = os.Getenv("CLOUD_SSH_TEMPLATE")
 
 	return c
 }